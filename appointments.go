@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	// Schedules name IANA timezones, which containers often lack.
+	_ "time/tzdata"
+
+	"medically-core/scheduling"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxSlotRange bounds the period a slot listing may cover.
+const maxSlotRange = 31 * 24 * time.Hour
+
+// bookingError refuses a booking for a reason the client can act on,
+// answered with status.
+type bookingError struct {
+	status int
+	msg    string
+}
+
+func (e *bookingError) Error() string { return e.msg }
+
+// ----------------------------  Clinician Server Methods ---------------------------------//
+
+func (s *Server) getClinicians(c *gin.Context) {
+	var clinicians []Clinician
+	if err := s.dbFor(c).Order("id").Find(&clinicians).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clinicians)
+}
+
+func (s *Server) createClinician(c *gin.Context) {
+	var clinician Clinician
+	if err := BindJSON(c, &clinician); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if clinician.Name == "" {
+		c.String(http.StatusBadRequest, "error: name is required")
+		return
+	}
+
+	if err := s.dbFor(c).Create(&clinician).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clinician)
+}
+
+func (s *Server) getSchedules(c *gin.Context) {
+	var schedules []Schedule
+	err := s.dbFor(c).Where("clinician_id = ?", c.Param("clinicianID")).Order("weekday, start_time").Find(&schedules).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// createSchedule adds a weekly period of availability to a clinician. It
+// must not overlap the clinician's other periods on that day.
+func (s *Server) createSchedule(c *gin.Context) {
+	var schedule Schedule
+	if err := BindJSON(c, &schedule); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	window, err := scheduleWindow(schedule)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+
+	db := s.dbFor(c)
+	var clinician Clinician
+	err = db.Take(&clinician, "id = ?", c.Param("clinicianID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	schedule.ClinicianID = clinician.ID
+
+	var sameDay []Schedule
+	if err := db.Where("clinician_id = ? AND weekday = ?", clinician.ID, schedule.Weekday).Find(&sameDay).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	for _, other := range sameDay {
+		w, err := scheduleWindow(other)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if window.Start.Before(w.End) && w.Start.Before(window.End) {
+			c.String(http.StatusConflict, fmt.Sprintf("error: schedule overlaps schedule %d", other.ID))
+			return
+		}
+	}
+
+	if err := db.Create(&schedule).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// deleteSchedule removes a period of availability. Appointments booked in
+// it are kept.
+func (s *Server) deleteSchedule(c *gin.Context) {
+	scheduleID := c.Param("scheduleID")
+	req := s.dbFor(c).Delete(Schedule{}, "id = ? AND clinician_id = ?", scheduleID, c.Param("clinicianID"))
+	if err := req.Error; err != nil {
+		internalError(c, err)
+	} else if req.RowsAffected == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else {
+		c.JSON(http.StatusOK, scheduleID)
+	}
+}
+
+// scheduleWindow validates a schedule and returns its period.
+func scheduleWindow(schedule Schedule) (scheduling.Window, error) {
+	w := scheduling.Window{
+		ID:      schedule.ID,
+		Weekday: time.Weekday(schedule.Weekday),
+		Slot:    time.Duration(schedule.SlotMinutes) * time.Minute,
+	}
+	if schedule.Weekday < 0 || schedule.Weekday > 6 {
+		return w, errors.New("weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	var err error
+	if w.Start, err = scheduling.ParseClock(schedule.StartTime); err != nil {
+		return w, fmt.Errorf("start: %w", err)
+	}
+	if w.End, err = scheduling.ParseClock(schedule.EndTime); err != nil {
+		return w, fmt.Errorf("end: %w", err)
+	}
+	if !w.Start.Before(w.End) {
+		return w, errors.New("start must be before end")
+	}
+	if schedule.SlotMinutes <= 0 {
+		return w, errors.New("slotMinutes must be positive")
+	}
+	if w.Location, err = time.LoadLocation(schedule.Timezone); err != nil {
+		return w, fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+	return w, nil
+}
+
+// windows returns the periods of the schedules of the clinicians by
+// clinician, or of every clinician of the clinic when there are none.
+func windows(db *gorm.DB, clinicianIDs ...int) (map[int][]scheduling.Window, error) {
+	if len(clinicianIDs) > 0 {
+		db = db.Where("clinician_id IN ?", clinicianIDs)
+	}
+	var schedules []Schedule
+	if err := db.Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	byClinician := make(map[int][]scheduling.Window)
+	for _, schedule := range schedules {
+		w, err := scheduleWindow(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %d: %w", schedule.ID, err)
+		}
+		byClinician[schedule.ClinicianID] = append(byClinician[schedule.ClinicianID], w)
+	}
+	return byClinician, nil
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Appointment Server Methods ---------------------------------//
+
+// slot is a free slot of a clinician.
+type slot struct {
+	ClinicianID int       `json:"clinicianId"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+// getSlots lists the free slots of the clinic's clinicians, or of the one
+// in ?clinicianId, between ?from and ?to (by default the next week).
+func (s *Server) getSlots(c *gin.Context) {
+	now := time.Now()
+	from, err := timeQuery(c, "from", now)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	to, err := timeQuery(c, "to", from.Add(7*24*time.Hour))
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if !from.Before(to) || to.Sub(from) > maxSlotRange {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: to must be after from, by at most %s", maxSlotRange))
+		return
+	}
+	// Only slots that can still be booked are listed.
+	if from.Before(now) {
+		from = now
+	}
+	if horizon := now.Add(s.scheduling.Horizon); to.After(horizon) {
+		to = horizon
+	}
+
+	db := s.dbFor(c)
+	var clinicianIDs []int
+	if v, ok := c.GetQuery("clinicianId"); ok {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.String(http.StatusBadRequest, "error: invalid clinicianId")
+			return
+		}
+		clinicianIDs = append(clinicianIDs, id)
+	}
+	byClinician, err := windows(db, clinicianIDs...)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	var booked []Appointment
+	err = db.Select("clinician_id, start_at, end_at").
+		Where("status = ? AND start_at < ? AND end_at > ?", AppointmentBooked, to, from).
+		Find(&booked).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	busy := make(map[int][]scheduling.Interval)
+	for _, a := range booked {
+		busy[a.ClinicianID] = append(busy[a.ClinicianID], scheduling.Interval{Start: a.StartAt, End: a.EndAt})
+	}
+
+	slots := []slot{}
+	for clinicianID, ws := range byClinician {
+		for _, free := range scheduling.Slots(ws, from, to, busy[clinicianID]) {
+			slots = append(slots, slot{ClinicianID: clinicianID, Start: free.Start, End: free.End})
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		if !slots[i].Start.Equal(slots[j].Start) {
+			return slots[i].Start.Before(slots[j].Start)
+		}
+		return slots[i].ClinicianID < slots[j].ClinicianID
+	})
+	c.JSON(http.StatusOK, slots)
+}
+
+// getAppointments lists the clinic's appointments, filtered by ?from, ?to,
+// ?clinicianId, ?userId and ?status.
+func (s *Server) getAppointments(c *gin.Context) {
+	db := s.dbFor(c).Order("start_at, id")
+	for param, column := range map[string]string{"clinicianId": "clinician_id", "userId": "user_id", "status": "status"} {
+		if v, ok := c.GetQuery(param); ok {
+			db = db.Where(column+" = ?", v)
+		}
+	}
+	for param, cond := range map[string]string{"from": "start_at >= ?", "to": "start_at < ?"} {
+		if _, ok := c.GetQuery(param); ok {
+			t, err := timeQuery(c, param, time.Time{})
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+				return
+			}
+			db = db.Where(cond, t)
+		}
+	}
+
+	var appointments []Appointment
+	if err := db.Find(&appointments).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointments)
+}
+
+func (s *Server) getAppointment(c *gin.Context) {
+	var appointment Appointment
+	err := s.dbFor(c).Take(&appointment, "id = ?", c.Param("appointmentID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointment)
+}
+
+// appointmentRequest books or moves an appointment. StartAt must be the
+// start of a free slot of the clinician.
+type appointmentRequest struct {
+	UserID      int       `json:"userId"`
+	ClinicianID int       `json:"clinicianId"`
+	StartAt     time.Time `json:"startAt"`
+	Reason      string    `json:"reason"`
+}
+
+// createAppointment books a slot for a user. The booking runs in a
+// serializable transaction, so concurrent bookings of a slot cannot both
+// succeed.
+func (s *Server) createAppointment(c *gin.Context) {
+	var req appointmentRequest
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if req.UserID == 0 || req.ClinicianID == 0 || req.StartAt.IsZero() {
+		c.String(http.StatusBadRequest, "error: userId, clinicianId and startAt are required")
+		return
+	}
+
+	var appointment Appointment
+	err := serializable(s.dbFor(c), func(tx *gorm.DB) error {
+		if err := mustExist(tx, &User{}, req.UserID, "unknown user"); err != nil {
+			return err
+		}
+		free, err := s.freeSlot(tx, req.ClinicianID, req.UserID, req.StartAt, 0)
+		if err != nil {
+			return err
+		}
+		appointment = Appointment{
+			UserID:      req.UserID,
+			ClinicianID: req.ClinicianID,
+			StartAt:     free.Start,
+			EndAt:       free.End,
+			Status:      AppointmentBooked,
+			Reason:      req.Reason,
+		}
+		if err := tx.Create(&appointment).Error; err != nil {
+			return err
+		}
+		return s.notifyAppointment(tx, &appointment, "appointment_booked")
+	})
+	if err != nil {
+		bookingFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointment)
+}
+
+// cancelAppointment cancels an appointment, at the latest
+// scheduling.cancel_window before it starts.
+func (s *Server) cancelAppointment(c *gin.Context) {
+	var appointment Appointment
+	err := serializable(s.dbFor(c), func(tx *gorm.DB) error {
+		if err := takeBooked(tx, c.Param("appointmentID"), &appointment); err != nil {
+			return err
+		}
+		if time.Until(appointment.StartAt) < s.scheduling.CancelWindow {
+			return &bookingError{http.StatusConflict, fmt.Sprintf("appointments can only be cancelled up to %s before they start", s.scheduling.CancelWindow)}
+		}
+		now := time.Now()
+		appointment.Status = AppointmentCancelled
+		appointment.CancelledAt = &now
+		appointment.Sequence++
+		if err := tx.Model(&appointment).Select("status", "cancelled_at", "sequence").Updates(&appointment).Error; err != nil {
+			return err
+		}
+		return s.notifyAppointment(tx, &appointment, "appointment_cancelled")
+	})
+	if err != nil {
+		bookingFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointment)
+}
+
+// rescheduleAppointment moves an appointment to another free slot, of the
+// same clinician unless the request names another, at the latest
+// scheduling.reschedule_window before it starts.
+func (s *Server) rescheduleAppointment(c *gin.Context) {
+	var req appointmentRequest
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if req.StartAt.IsZero() {
+		c.String(http.StatusBadRequest, "error: startAt is required")
+		return
+	}
+
+	var appointment Appointment
+	err := serializable(s.dbFor(c), func(tx *gorm.DB) error {
+		if err := takeBooked(tx, c.Param("appointmentID"), &appointment); err != nil {
+			return err
+		}
+		if time.Until(appointment.StartAt) < s.scheduling.RescheduleWindow {
+			return &bookingError{http.StatusConflict, fmt.Sprintf("appointments can only be rescheduled up to %s before they start", s.scheduling.RescheduleWindow)}
+		}
+		if req.ClinicianID != 0 {
+			appointment.ClinicianID = req.ClinicianID
+		}
+		free, err := s.freeSlot(tx, appointment.ClinicianID, appointment.UserID, req.StartAt, appointment.ID)
+		if err != nil {
+			return err
+		}
+		appointment.StartAt = free.Start
+		appointment.EndAt = free.End
+		appointment.Sequence++
+		if err := tx.Model(&appointment).Select("clinician_id", "start_at", "end_at", "sequence").Updates(&appointment).Error; err != nil {
+			return err
+		}
+		return s.notifyAppointment(tx, &appointment, "appointment_rescheduled")
+	})
+	if err != nil {
+		bookingFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointment)
+}
+
+// freeSlot returns the slot of the clinician starting at start, unless it
+// overlaps a booked appointment of the clinician or the user other than
+// the one with ID exclude.
+func (s *Server) freeSlot(tx *gorm.DB, clinicianID, userID int, start time.Time, exclude int) (scheduling.Slot, error) {
+	now := time.Now()
+	if !start.After(now) {
+		return scheduling.Slot{}, &bookingError{http.StatusUnprocessableEntity, "startAt must be in the future"}
+	}
+	if start.After(now.Add(s.scheduling.Horizon)) {
+		return scheduling.Slot{}, &bookingError{http.StatusUnprocessableEntity, fmt.Sprintf("appointments can be booked at most %s ahead", s.scheduling.Horizon)}
+	}
+	if err := mustExist(tx, &Clinician{}, clinicianID, "unknown clinician"); err != nil {
+		return scheduling.Slot{}, err
+	}
+	byClinician, err := windows(tx, clinicianID)
+	if err != nil {
+		return scheduling.Slot{}, err
+	}
+	free, ok := scheduling.Match(byClinician[clinicianID], start)
+	if !ok {
+		return scheduling.Slot{}, &bookingError{http.StatusUnprocessableEntity, "startAt is not the start of a slot of the clinician"}
+	}
+
+	var conflicts []Appointment
+	err = tx.Select("clinician_id").
+		Where("status = ? AND start_at < ? AND end_at > ? AND (clinician_id = ? OR user_id = ?) AND id <> ?",
+			AppointmentBooked, free.End, free.Start, clinicianID, userID, exclude).
+		Find(&conflicts).Error
+	if err != nil {
+		return scheduling.Slot{}, err
+	}
+	for _, a := range conflicts {
+		if a.ClinicianID == clinicianID {
+			return scheduling.Slot{}, &bookingError{http.StatusConflict, "the slot is already booked"}
+		}
+	}
+	if len(conflicts) > 0 {
+		return scheduling.Slot{}, &bookingError{http.StatusConflict, "the user has another appointment at that time"}
+	}
+	return free, nil
+}
+
+// notifyAppointment queues the notification of a change to an
+// appointment for its user, once per change.
+func (s *Server) notifyAppointment(tx *gorm.DB, a *Appointment, template string) error {
+	var user User
+	if err := tx.Take(&user, "id = ?", a.UserID).Error; err != nil {
+		return err
+	}
+	var clinician Clinician
+	if err := tx.Take(&clinician, "id = ?", a.ClinicianID).Error; err != nil {
+		return err
+	}
+	var clinic Clinic
+	if err := tx.Find(&clinic, a.TenantID).Error; err != nil {
+		return err
+	}
+	data := map[string]interface{}{"Clinic": "", "Clinician": clinician.Name, "StartAt": a.StartAt}
+	if clinic.Name != nil {
+		data["Clinic"] = *clinic.Name
+	}
+	return notifyUser(s.notifier, tx, &user, template, fmt.Sprintf("appointment:%d:%d", a.ID, a.Sequence), data)
+}
+
+// mustExist refuses the booking with msg unless the clinic has the record
+// of model with ID id.
+func mustExist(tx *gorm.DB, model interface{}, id int, msg string) error {
+	var n int64
+	if err := tx.Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return &bookingError{http.StatusUnprocessableEntity, msg}
+	}
+	return nil
+}
+
+// takeBooked loads a booked appointment to change.
+func takeBooked(tx *gorm.DB, id string, appointment *Appointment) error {
+	err := tx.Take(appointment, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &bookingError{http.StatusNotFound, "record not found"}
+	}
+	if err != nil {
+		return err
+	}
+	if appointment.Status != AppointmentBooked {
+		return &bookingError{http.StatusConflict, "appointment is " + appointment.Status}
+	}
+	return nil
+}
+
+// bookingFailed answers a failed booking change.
+func bookingFailed(c *gin.Context, err error) {
+	var refused *bookingError
+	if errors.As(err, &refused) {
+		c.String(refused.status, "error: "+refused.msg)
+		return
+	}
+	internalError(c, err)
+}
+
+// timeQuery parses the RFC 3339 query parameter name, returning def when
+// it is absent.
+func timeQuery(c *gin.Context, name string, def time.Time) (time.Time, error) {
+	v, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return t, nil
+}
+
+// getUserAppointments lists the appointments of a user.
+func (s *Server) getUserAppointments(c *gin.Context) {
+	var appointments []Appointment
+	err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("start_at, id").Find(&appointments).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, appointments)
+}
+
+// getUserCalendar exports the appointments of a user as an iCalendar
+// file, which calendar applications can subscribe to. Cancelled
+// appointments stay in it so subscribers remove them. Reasons are left
+// out, as calendars are often synced to third parties.
+func (s *Server) getUserCalendar(c *gin.Context) {
+	db := s.dbFor(c)
+	var appointments []Appointment
+	err := db.Preload("Clinician").Where("user_id = ?", c.Param("userID")).Order("start_at, id").Find(&appointments).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	id, _ := tenant.FromContext(c.Request.Context())
+	var clinic Clinic
+	if err := db.Find(&clinic, id).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	clinicName := ""
+	if clinic.Name != nil {
+		clinicName = *clinic.Name
+	}
+
+	events := make([]scheduling.Event, 0, len(appointments))
+	for _, a := range appointments {
+		e := scheduling.Event{
+			UID:       fmt.Sprintf("appointment-%d@medically", a.ID),
+			Start:     a.StartAt,
+			End:       a.EndAt,
+			Stamp:     a.CreatedAt,
+			Summary:   "Appointment",
+			Location:  clinicName,
+			Cancelled: a.Status == AppointmentCancelled,
+			Sequence:  a.Sequence,
+		}
+		if a.UpdatedAt != nil {
+			e.Stamp = *a.UpdatedAt
+		}
+		if a.Clinician != nil {
+			e.Summary = "Appointment with " + a.Clinician.Name
+		}
+		events = append(events, e)
+	}
+
+	var buf bytes.Buffer
+	if err := scheduling.WriteICS(&buf, "Appointments at "+clinicName, events); err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="appointments.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// ------------------------------- ------------------- ------------------------------------//
@@ -0,0 +1,361 @@
+// Package bulkexport implements the asynchronous $export operation of the
+// FHIR Bulk Data Access specification.
+//
+// A kick-off request records a job in the "export_jobs" table and returns
+// the URL of its status. Every replica runs a worker that claims pending
+// jobs, writes one NDJSON file per resource type to a storage.Store and
+// records the files in the job, so that any replica can report the status
+// and serve the downloads. Workers keep a heartbeat on their job, and a
+// job whose worker stopped beating is claimed again.
+package bulkexport
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"medically-core/config"
+	"medically-core/storage"
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+)
+
+// NDJSONType is the media type of the exported files.
+const NDJSONType = "application/fhir+ndjson"
+
+// Job statuses.
+const (
+	statusAccepted   = "accepted"
+	statusInProgress = "in-progress"
+	statusCompleted  = "completed"
+	statusFailed     = "failed"
+)
+
+const (
+	// pollInterval is how often workers look for pending jobs.
+	pollInterval = 5 * time.Second
+	// heartbeatInterval is how often a worker records that it is still
+	// running a job, and staleAfter how long after the last heartbeat
+	// another worker may take the job over.
+	heartbeatInterval = 30 * time.Second
+	staleAfter        = 2 * time.Minute
+)
+
+// errLost is returned when a worker finds that its job was cancelled or
+// taken over.
+var errLost = errors.New("export job cancelled or taken over")
+
+// Source exports the resources of one type.
+type Source struct {
+	// Type is the FHIR resource type.
+	Type string
+	// Export calls fn with every resource updated after since, or every
+	// resource if since is nil, reading them through db.
+	Export func(db *gorm.DB, since *time.Time, fn func(resource interface{}) error) error
+}
+
+// File is an exported file of a job.
+type File struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// job is an export in the "export_jobs" table. It belongs to the clinic
+// that asked for it.
+type job struct {
+	ID       string `gorm:"primaryKey"`
+	TenantID int    `gorm:"index"`
+	// Types are the comma-separated resource types to export.
+	Types   string `gorm:"not null"`
+	Since   *time.Time
+	Request string `gorm:"not null"`
+	Status  string `gorm:"not null;index"`
+	// Progress is reported in the X-Progress header while the job runs.
+	Progress string
+	Output   []File `gorm:"serializer:json"`
+	Error    string
+	// Claim identifies the worker running the job.
+	Claim       string
+	HeartbeatAt time.Time
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+func (job) TableName() string {
+	return "export_jobs"
+}
+
+func (j *job) types() []string {
+	return strings.Split(j.Types, ",")
+}
+
+func (j *job) dir() string {
+	return "exports/" + j.ID
+}
+
+// Exporter runs exports and serves the $export endpoints.
+type Exporter struct {
+	db        *gorm.DB
+	store     storage.Store
+	tenancy   *tenant.Resolver
+	retention time.Duration
+	sources   map[string]Source
+	types     []string
+	wake      chan struct{}
+}
+
+// NewExporter creates an Exporter of sources, creating the jobs table if
+// needed. The tenancy resolver scopes each job to its clinic.
+func NewExporter(db *gorm.DB, store storage.Store, tenancy *tenant.Resolver, cfg config.BulkExportConfig, sources ...Source) (*Exporter, error) {
+	if err := db.AutoMigrate(&job{}); err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		db:        db,
+		store:     store,
+		tenancy:   tenancy,
+		retention: cfg.Retention,
+		sources:   make(map[string]Source, len(sources)),
+		wake:      make(chan struct{}, 1),
+	}
+	for _, s := range sources {
+		e.sources[s.Type] = s
+		e.types = append(e.types, s.Type)
+	}
+	return e, nil
+}
+
+// Run runs pending jobs and deletes expired ones until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	ctx = tenant.System(ctx)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastSweep := time.Time{}
+	for {
+		for {
+			j, err := e.claim(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.Printf("bulkexport: claiming a job: %v", err)
+				}
+				break
+			}
+			if j == nil {
+				break
+			}
+			e.run(ctx, j)
+		}
+		if time.Since(lastSweep) > time.Hour {
+			if err := e.sweep(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("bulkexport: deleting expired jobs: %v", err)
+			}
+			lastSweep = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+// claim takes a pending job, or one whose worker stopped, for this
+// worker. It returns nil when there is none.
+func (e *Exporter) claim(ctx context.Context) (*job, error) {
+	db := e.db.WithContext(ctx)
+	stale := time.Now().Add(-staleAfter)
+	var candidates []job
+	err := db.Where("status = ? OR (status = ? AND heartbeat_at < ?)", statusAccepted, statusInProgress, stale).
+		Order("created_at").Limit(10).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range candidates {
+		claim := randomID()
+		now := time.Now()
+		// Only one worker can move the job from the state it was read in.
+		res := db.Model(&job{}).
+			Where("id = ? AND status = ? AND heartbeat_at = ?", j.ID, j.Status, j.HeartbeatAt).
+			Updates(map[string]interface{}{"status": statusInProgress, "claim": claim, "heartbeat_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			j.Status, j.Claim, j.HeartbeatAt = statusInProgress, claim, now
+			return &j, nil
+		}
+	}
+	return nil, nil
+}
+
+// run exports every type of j and records the outcome.
+func (e *Exporter) run(ctx context.Context, j *job) {
+	// Files of an earlier, interrupted attempt are overwritten.
+	output, err := e.export(ctx, j)
+	updates := map[string]interface{}{"completed_at": time.Now(), "progress": ""}
+	switch {
+	case errors.Is(err, errLost):
+		e.dropCancelled(ctx, j)
+		return
+	case errors.Is(err, context.Canceled):
+		return
+	case err != nil:
+		log.Printf("bulkexport: job %s failed: %v", j.ID, err)
+		updates["status"] = statusFailed
+		updates["error"] = "export failed"
+	default:
+		// Updates with a map bypass the json serializer of Output.
+		data, err := json.Marshal(output)
+		if err != nil {
+			log.Printf("bulkexport: encoding output of job %s: %v", j.ID, err)
+			return
+		}
+		updates["status"] = statusCompleted
+		updates["output"] = string(data)
+	}
+	res := e.db.WithContext(ctx).Model(&job{}).Where("id = ? AND claim = ?", j.ID, j.Claim).Updates(updates)
+	if res.Error != nil {
+		log.Printf("bulkexport: recording job %s: %v", j.ID, res.Error)
+	}
+}
+
+// dropCancelled deletes the files j wrote after it was cancelled. Files
+// of a job taken over by another worker are left to it.
+func (e *Exporter) dropCancelled(ctx context.Context, j *job) {
+	err := e.db.WithContext(ctx).Take(&job{}, "id = ?", j.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = e.store.DeleteDir(ctx, j.dir())
+	}
+	if err != nil {
+		log.Printf("bulkexport: cleaning up job %s: %v", j.ID, err)
+	}
+}
+
+func (e *Exporter) export(ctx context.Context, j *job) ([]File, error) {
+	var files []File
+	types := j.types()
+	for i, typ := range types {
+		if err := e.heartbeat(ctx, j, fmt.Sprintf("exporting %s (%d of %d types)", typ, i+1, len(types))); err != nil {
+			return nil, err
+		}
+		f, err := e.exportType(ctx, j, typ)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", typ, err)
+		}
+		// Types without resources have no file.
+		if f.Count > 0 {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (e *Exporter) exportType(ctx context.Context, j *job, typ string) (File, error) {
+	f := File{Type: typ, Name: typ + ".ndjson"}
+	source, ok := e.sources[typ]
+	if !ok {
+		return f, fmt.Errorf("unknown resource type %s", typ)
+	}
+
+	tmp, err := ioutil.TempFile("", "export-*.ndjson")
+	if err != nil {
+		return f, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	lastBeat := time.Now()
+	err = e.tenancy.Run(ctx, j.TenantID, func(db *gorm.DB) error {
+		return source.Export(db, j.Since, func(resource interface{}) error {
+			if time.Since(lastBeat) > heartbeatInterval {
+				if err := e.heartbeat(ctx, j, fmt.Sprintf("exporting %s (%d resources)", typ, f.Count)); err != nil {
+					return err
+				}
+				lastBeat = time.Now()
+			}
+			f.Count++
+			// Encode writes one line per resource, as NDJSON requires.
+			return enc.Encode(resource)
+		})
+	})
+	if err != nil {
+		return f, err
+	}
+	if f.Count == 0 {
+		return f, nil
+	}
+	if err := w.Flush(); err != nil {
+		return f, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return f, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return f, err
+	}
+	return f, e.store.Put(ctx, j.dir()+"/"+f.Name, tmp, size, NDJSONType)
+}
+
+// heartbeat records that j is still running, returning errLost if it was
+// cancelled or taken over by another worker.
+func (e *Exporter) heartbeat(ctx context.Context, j *job, progress string) error {
+	res := e.db.WithContext(ctx).Model(&job{}).Where("id = ? AND claim = ?", j.ID, j.Claim).
+		Updates(map[string]interface{}{"heartbeat_at": time.Now(), "progress": progress})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errLost
+	}
+	return nil
+}
+
+// sweep deletes the jobs that finished more than the retention ago, with
+// their files.
+func (e *Exporter) sweep(ctx context.Context) error {
+	db := e.db.WithContext(ctx)
+	var expired []job
+	if err := db.Where("completed_at < ?", time.Now().Add(-e.retention)).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, j := range expired {
+		if err := e.delete(ctx, &j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete deletes j and its files. A worker running it stops at its next
+// heartbeat.
+func (e *Exporter) delete(ctx context.Context, j *job) error {
+	if err := e.db.WithContext(ctx).Delete(j).Error; err != nil {
+		return err
+	}
+	return e.store.DeleteDir(ctx, j.dir())
+}
+
+func randomID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,202 @@
+package bulkexport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"medically-core/fhir"
+	"medically-core/storage"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// outputFormats are the accepted values of _outputFormat, all meaning
+// NDJSON.
+var outputFormats = map[string]bool{
+	NDJSONType:           true,
+	"application/ndjson": true,
+	"ndjson":             true,
+}
+
+// manifest is the body of the status of a completed export.
+type manifest struct {
+	TransactionTime     string         `json:"transactionTime"`
+	Request             string         `json:"request"`
+	RequiresAccessToken bool           `json:"requiresAccessToken"`
+	Output              []manifestFile `json:"output"`
+	Error               []manifestFile `json:"error"`
+}
+
+type manifestFile struct {
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Count int    `json:"count,omitempty"`
+}
+
+// KickOff starts a system-level export of the resources of the clinic of
+// the request. It takes the _type, _since and _outputFormat parameters
+// and answers 202 with the status URL in Content-Location.
+func (e *Exporter) KickOff(c *gin.Context) {
+	if !strings.Contains(c.GetHeader("Prefer"), "respond-async") {
+		fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, "the Prefer: respond-async header is required")
+		return
+	}
+	j := job{ID: randomID(), Status: statusAccepted, Request: fhir.BaseURL(c) + strings.TrimPrefix(c.Request.URL.RequestURI(), "/fhir")}
+	types := e.types
+	for name, values := range c.Request.URL.Query() {
+		v := values[len(values)-1]
+		switch name {
+		case "_outputFormat":
+			if !outputFormats[v] {
+				fhir.Error(c, http.StatusBadRequest, fhir.IssueNotSupported, fmt.Sprintf("_outputFormat %q is not supported", v))
+				return
+			}
+		case "_type":
+			types = nil
+			for _, t := range strings.Split(v, ",") {
+				if _, ok := e.sources[t]; !ok {
+					fhir.Error(c, http.StatusBadRequest, fhir.IssueNotSupported, fmt.Sprintf("_type %q cannot be exported", t))
+					return
+				}
+				types = append(types, t)
+			}
+		case "_since":
+			since, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, "_since must be a FHIR instant")
+				return
+			}
+			j.Since = &since
+		default:
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueNotSupported, fmt.Sprintf("parameter %q is not supported", name))
+			return
+		}
+	}
+	j.Types = strings.Join(types, ",")
+
+	db := tenant.DB(c, e.db)
+	var running int64
+	err := db.Model(&job{}).Where("status IN ?", []string{statusAccepted, statusInProgress}).Count(&running).Error
+	if err != nil {
+		fhir.InternalError(c, err)
+		return
+	}
+	if running > 0 {
+		c.Header("Retry-After", "60")
+		fhir.Error(c, http.StatusTooManyRequests, fhir.IssueThrottled, "an export is already running")
+		return
+	}
+	if err := db.Create(&j).Error; err != nil {
+		fhir.InternalError(c, err)
+		return
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	c.Header("Content-Location", fhir.BaseURL(c)+"/$export-status/"+j.ID)
+	c.Status(http.StatusAccepted)
+}
+
+// Status reports the progress of an export, or its manifest once it is
+// complete.
+func (e *Exporter) Status(c *gin.Context) {
+	j, ok := e.find(c)
+	if !ok {
+		return
+	}
+	switch j.Status {
+	case statusAccepted, statusInProgress:
+		progress := j.Progress
+		if progress == "" {
+			progress = j.Status
+		}
+		c.Header("X-Progress", progress)
+		c.Header("Retry-After", "5")
+		c.Status(http.StatusAccepted)
+	case statusFailed:
+		fhir.Error(c, http.StatusInternalServerError, fhir.IssueException, j.Error)
+	default:
+		base := fhir.BaseURL(c)
+		m := manifest{
+			TransactionTime:     j.CreatedAt.UTC().Format(time.RFC3339Nano),
+			Request:             j.Request,
+			RequiresAccessToken: true,
+			Output:              []manifestFile{},
+			Error:               []manifestFile{},
+		}
+		for _, f := range j.Output {
+			m.Output = append(m.Output, manifestFile{Type: f.Type, URL: base + "/$export-file/" + j.ID + "/" + f.Name, Count: f.Count})
+		}
+		if j.CompletedAt != nil {
+			c.Header("Expires", j.CompletedAt.Add(e.retention).UTC().Format(http.TimeFormat))
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// Cancel cancels an export, or deletes a finished one, with its files.
+func (e *Exporter) Cancel(c *gin.Context) {
+	j, ok := e.find(c)
+	if !ok {
+		return
+	}
+	if err := e.delete(c.Request.Context(), j); err != nil {
+		fhir.InternalError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Download serves a file of a completed export. It supports range
+// requests, so interrupted downloads can be resumed.
+func (e *Exporter) Download(c *gin.Context) {
+	j, ok := e.find(c)
+	if !ok {
+		return
+	}
+	name := c.Param("file")
+	found := false
+	for _, f := range j.Output {
+		found = found || f.Name == name
+	}
+	if j.Status != statusCompleted || !found {
+		fhir.Error(c, http.StatusNotFound, fhir.IssueNotFound, "export file not found")
+		return
+	}
+
+	obj, info, err := e.store.Open(c.Request.Context(), j.dir()+"/"+name)
+	if errors.Is(err, storage.ErrNotFound) {
+		fhir.Error(c, http.StatusNotFound, fhir.IssueNotFound, "export file not found")
+		return
+	}
+	if err != nil {
+		fhir.InternalError(c, err)
+		return
+	}
+	defer obj.Close()
+	c.Header("Content-Type", NDJSONType)
+	c.Header("ETag", fmt.Sprintf(`"%s-%s"`, j.ID, name))
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime, obj)
+}
+
+// find loads the job named by the jobID parameter, answering 404 if the
+// clinic of the request has none.
+func (e *Exporter) find(c *gin.Context) (*job, bool) {
+	var j job
+	err := tenant.DB(c, e.db).Take(&j, "id = ?", c.Param("jobID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fhir.Error(c, http.StatusNotFound, fhir.IssueNotFound, "export not found")
+		return nil, false
+	}
+	if err != nil {
+		fhir.InternalError(c, err)
+		return nil, false
+	}
+	return &j, true
+}
@@ -0,0 +1,138 @@
+// Package catalog finds near-duplicate entries of the shared medication
+// and disease catalogs, such as "Paracetamol", "paracetamol 500mg" and
+// "Acetaminophen". Names are compared once normalized, with synonyms
+// replaced by their preferred name, by the similarity of their trigrams.
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Entry is an entry of a catalog.
+type Entry struct {
+	ID   int
+	Name string
+}
+
+// Match is a pair of entries that are likely the same.
+type Match struct {
+	ID      int
+	OtherID int
+	// Score is the similarity of their names, from 0 to 1.
+	Score   float64
+	Reasons []string
+}
+
+// synonymScore is the score of names that only match through synonyms,
+// a little below that of names that match as they are.
+const synonymScore = 0.95
+
+// differentNumbers scales the score of names that are alike but for
+// their numbers.
+const differentNumbers = 0.5
+
+// Catalog is how the names of a catalog are compared.
+type Catalog struct {
+	// Synonyms are groups of names of the same thing. The first name of
+	// a group is the preferred one.
+	Synonyms [][]string
+	// Strengths drops strengths and dose forms from names, so that
+	// "Paracetamol 500 mg tablets" is paracetamol.
+	Strengths bool
+}
+
+// Meds compares medications, by their active ingredient.
+var Meds = Catalog{Synonyms: medSynonyms, Strengths: true}
+
+// Diseases compares diseases. Numbers are kept, as in "type 2 diabetes".
+var Diseases = Catalog{Synonyms: diseaseSynonyms}
+
+// WithSynonyms returns a copy of c with more synonyms, such as the names
+// of entries merged into others.
+func (c Catalog) WithSynonyms(groups ...[]string) Catalog {
+	c.Synonyms = append(append([][]string(nil), c.Synonyms...), groups...)
+	return c
+}
+
+// Find returns the pairs of entries whose names score at least min, best
+// first. Only pairs that share a trigram are compared.
+func (c Catalog) Find(entries []Entry, min float64) []Match {
+	syn := newSynonyms(c)
+	type name struct {
+		plain, canonical string
+		grams            map[string]bool
+	}
+	names := make([]name, len(entries))
+	postings := map[string][]int{}
+	for i, e := range entries {
+		plain := normalize(e.Name, c.Strengths)
+		canonical := syn.replace(plain)
+		names[i] = name{plain, canonical, trigrams(canonical)}
+		for g := range names[i].grams {
+			postings[g] = append(postings[g], i)
+		}
+	}
+
+	var matches []Match
+	for i := range entries {
+		shared := map[int]int{}
+		for g := range names[i].grams {
+			for _, j := range postings[g] {
+				if j > i {
+					shared[j]++
+				}
+			}
+		}
+		for j, n := range shared {
+			a, b := names[i], names[j]
+			var score float64
+			var reason string
+			switch {
+			case a.plain == b.plain:
+				score, reason = 1, "names match once normalized"
+			case a.canonical == b.canonical:
+				score, reason = synonymScore, fmt.Sprintf("%q and %q are synonyms", a.plain, b.plain)
+			default:
+				score = float64(n) / float64(len(a.grams)+len(b.grams)-n)
+				reason = fmt.Sprintf("names are %.0f%% similar", score*100)
+				if numbers(a.canonical) != numbers(b.canonical) {
+					// "Type 1 diabetes" is not "type 2 diabetes".
+					score *= differentNumbers
+					reason += ", but their numbers differ"
+				}
+			}
+			if score < min || entries[i].ID == entries[j].ID {
+				continue
+			}
+			m := Match{ID: entries[i].ID, OtherID: entries[j].ID, Score: score, Reasons: []string{reason}}
+			if m.ID > m.OtherID {
+				m.ID, m.OtherID = m.OtherID, m.ID
+			}
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].ID != matches[j].ID {
+			return matches[i].ID < matches[j].ID
+		}
+		return matches[i].OtherID < matches[j].OtherID
+	})
+	return matches
+}
+
+// numbers returns the words of normalized name that are numbers.
+func numbers(name string) string {
+	var nums []string
+	for _, w := range strings.Fields(name) {
+		if strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			nums = append(nums, w)
+		}
+	}
+	return strings.Join(nums, " ")
+}
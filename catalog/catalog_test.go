@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		strengths bool
+		want      string
+	}{
+		{"Paracetamol", true, "paracetamol"},
+		{"Paracetamol 500mg tablets", true, "paracetamol"},
+		{"PARACETAMOL 500 MG Film-Coated Tablets", true, "paracetamol"},
+		{"Salbutamol 2.5mg/2.5ml nebuliser", true, "salbutamol nebuliser"},
+		{"Insulin glargine 100 units/ml injection", true, "insulin glargine"},
+		{"Vitamin D3 1000 IU", true, "vitamin d3"},
+		{"L-Thyroxine", true, "l thyroxine"},
+		{"Ménière's disease", false, "meniere s disease"},
+		{"Type 2 Diabetes", false, "type 2 diabetes"},
+		{"  Gastro-oesophageal   reflux ", false, "gastro oesophageal reflux"},
+		{"500 mg", true, ""},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.name, tt.strengths); got != tt.want {
+			t.Errorf("normalize(%q, %v) = %q, want %q", tt.name, tt.strengths, got, tt.want)
+		}
+	}
+}
+
+func TestTrigrams(t *testing.T) {
+	var got []string
+	for g := range trigrams("ab cd") {
+		got = append(got, g)
+	}
+	sort.Strings(got)
+	want := []string{"  a", "  c", " ab", " cd", "ab ", "cd "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trigrams = %q, want %q", got, want)
+	}
+}
+
+func TestSynonyms(t *testing.T) {
+	syn := newSynonyms(Meds)
+	tests := []struct {
+		name, want string
+	}{
+		{"acetaminophen", "paracetamol"},
+		{"aspirin", "acetylsalicylic acid"},
+		// The longest synonym wins, so the acid is not replaced on its own.
+		{"acetylsalicylic acid", "acetylsalicylic acid"},
+		{"l thyroxine", "levothyroxine"},
+		{"codeine apap", "codeine paracetamol"},
+		{"unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := syn.replace(tt.name); got != tt.want {
+			t.Errorf("replace(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	merged := newSynonyms(Meds.WithSynonyms([]string{"paracetamol", "Pamol"}))
+	if got := merged.replace("pamol"); got != "paracetamol" {
+		t.Errorf("replace(pamol) with an added synonym = %q, want paracetamol", got)
+	}
+	if len(Meds.Synonyms) != len(medSynonyms) {
+		t.Error("WithSynonyms changed the catalog it was called on")
+	}
+}
+
+// pairs returns the ID pairs of matches, in order.
+func pairs(matches []Match) [][2]int {
+	var got [][2]int
+	for _, m := range matches {
+		got = append(got, [2]int{m.ID, m.OtherID})
+	}
+	return got
+}
+
+func TestFindMeds(t *testing.T) {
+	entries := []Entry{
+		{ID: 1, Name: "Paracetamol"},
+		{ID: 2, Name: "paracetamol 500mg tablets"},
+		{ID: 3, Name: "Acetaminophen"},
+		{ID: 4, Name: "Ibuprofen"},
+		{ID: 5, Name: "Ibuprofen 400 mg"},
+		{ID: 6, Name: "Amoxicilin"},
+		{ID: 7, Name: "Amoxicillin"},
+		{ID: 8, Name: "Metformin"},
+	}
+	matches := Meds.Find(entries, 0.6)
+	want := [][2]int{{1, 2}, {4, 5}, {1, 3}, {2, 3}, {6, 7}}
+	if got := pairs(matches); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Find = %v, want %v", got, want)
+	}
+	if m := matches[0]; m.Score != 1 || m.Reasons[0] != "names match once normalized" {
+		t.Errorf("first match = %+v", m)
+	}
+	if m := matches[2]; m.Score != synonymScore {
+		t.Errorf("synonym match scores %v, want %v", m.Score, synonymScore)
+	}
+	if m := matches[4]; m.Score >= synonymScore || m.Score < 0.6 {
+		t.Errorf("misspelling scores %v", m.Score)
+	}
+}
+
+func TestFindDiseases(t *testing.T) {
+	entries := []Entry{
+		{ID: 1, Name: "Type 2 diabetes"},
+		{ID: 2, Name: "Type 1 diabetes"},
+		{ID: 3, Name: "T2DM"},
+		{ID: 4, Name: "High blood pressure"},
+		{ID: 5, Name: "Hypertension"},
+	}
+	matches := Diseases.Find(entries, 0.6)
+	want := [][2]int{{1, 3}, {4, 5}}
+	if got := pairs(matches); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %v, want %v", got, want)
+	}
+
+	// Type 1 and type 2 are alike but for their number, which halves
+	// their score.
+	all := Diseases.Find(entries[:2], 0)
+	if len(all) != 1 || all[0].Score > 0.5 {
+		t.Errorf("type 1 and type 2 diabetes: %+v, want one match scoring at most 0.5", all)
+	}
+}
+
+func TestFindSkipsSameID(t *testing.T) {
+	entries := []Entry{{ID: 1, Name: "Paracetamol"}, {ID: 1, Name: "Paracetamol"}}
+	if matches := Meds.Find(entries, 0); len(matches) != 0 {
+		t.Errorf("Find = %+v, want none", matches)
+	}
+}
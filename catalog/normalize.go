@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// strength matches a strength or an amount, such as 500, 500mg or 10ml.
+// Decimal points split words, so 2.5mg is 2 and 5mg.
+var strength = regexp.MustCompile(`^\d+(mg|g|mcg|ug|ml|l|iu|mmol|units?)?$`)
+
+// forms are the words of strengths and dose forms, which say how much of
+// a medication there is and how it is taken rather than what it is.
+var forms = map[string]bool{
+	"mg": true, "g": true, "mcg": true, "ug": true, "ml": true, "iu": true, "mmol": true, "unit": true, "units": true,
+	"tablet": true, "tablets": true, "tab": true, "tabs": true, "capsule": true, "capsules": true, "cap": true, "caps": true,
+	"oral": true, "solution": true, "suspension": true, "syrup": true, "injection": true, "infusion": true,
+	"cream": true, "ointment": true, "gel": true, "drops": true, "spray": true, "inhaler": true, "patch": true,
+	"film": true, "coated": true, "chewable": true, "effervescent": true, "mr": true, "sr": true, "xr": true, "er": true,
+}
+
+// normalize returns name in lower case, without accents and punctuation,
+// and, if strengths is set, without strengths and dose forms.
+func normalize(name string, strengths bool) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// The accents split off the letters they were on.
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	if strengths {
+		kept := words[:0]
+		for _, w := range words {
+			if !forms[w] && !strength.MatchString(w) {
+				kept = append(kept, w)
+			}
+		}
+		words = kept
+	}
+	return strings.Join(words, " ")
+}
+
+// trigrams returns the trigrams of the words of s, each padded with two
+// spaces in front and one behind, as PostgreSQL's pg_trgm does.
+func trigrams(s string) map[string]bool {
+	grams := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			grams[string(r[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+// synonyms replaces the names of a catalog with their preferred names.
+type synonyms struct {
+	preferred map[string]string
+	// longest is the number of words of the longest synonym.
+	longest int
+}
+
+func newSynonyms(c Catalog) synonyms {
+	s := synonyms{preferred: map[string]string{}}
+	for _, group := range c.Synonyms {
+		if len(group) == 0 {
+			continue
+		}
+		first := normalize(group[0], c.Strengths)
+		for _, name := range group {
+			n := normalize(name, c.Strengths)
+			if n == "" {
+				continue
+			}
+			if _, ok := s.preferred[n]; !ok {
+				s.preferred[n] = first
+			}
+			if words := len(strings.Fields(n)); words > s.longest {
+				s.longest = words
+			}
+		}
+	}
+	return s
+}
+
+// replace replaces the synonyms in normalized name with their preferred
+// names, longest first, so "acetylsalicylic acid" is aspirin rather
+// than acid.
+func (s synonyms) replace(name string) string {
+	words := strings.Fields(name)
+	var out []string
+	for i := 0; i < len(words); {
+		n := s.longest
+		if n > len(words)-i {
+			n = len(words) - i
+		}
+		for ; n > 0; n-- {
+			if p, ok := s.preferred[strings.Join(words[i:i+n], " ")]; ok {
+				out = append(out, p)
+				break
+			}
+		}
+		if n == 0 {
+			out = append(out, words[i])
+			n = 1
+		}
+		i += n
+	}
+	return strings.Join(out, " ")
+}
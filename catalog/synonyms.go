@@ -0,0 +1,45 @@
+package catalog
+
+// medSynonyms are common names of medications that differ between
+// countries or between generic and brand use, the international
+// nonproprietary name first.
+var medSynonyms = [][]string{
+	{"paracetamol", "acetaminophen", "apap", "tylenol", "panadol"},
+	{"salbutamol", "albuterol", "ventolin"},
+	{"adrenaline", "epinephrine"},
+	{"noradrenaline", "norepinephrine"},
+	{"furosemide", "frusemide", "lasix"},
+	{"lidocaine", "lignocaine"},
+	{"acetylsalicylic acid", "aspirin", "asa"},
+	{"ibuprofen", "advil", "nurofen", "motrin"},
+	{"amoxicillin", "amoxycillin"},
+	{"glyceryl trinitrate", "nitroglycerin", "gtn"},
+	{"levothyroxine", "thyroxine", "l thyroxine"},
+	{"ciclosporin", "cyclosporine"},
+	{"metamizole", "dipyrone"},
+	{"pethidine", "meperidine"},
+	{"colecalciferol", "cholecalciferol", "vitamin d3"},
+	{"atorvastatin", "lipitor"},
+	{"omeprazole", "losec", "prilosec"},
+	{"metformin", "glucophage"},
+}
+
+// diseaseSynonyms are lay and clinical names of diseases, the clinical
+// name first.
+var diseaseSynonyms = [][]string{
+	{"hypertension", "high blood pressure"},
+	{"myocardial infarction", "heart attack"},
+	{"cerebrovascular accident", "stroke"},
+	{"influenza", "flu"},
+	{"type 2 diabetes mellitus", "type 2 diabetes", "diabetes mellitus type 2", "t2dm"},
+	{"type 1 diabetes mellitus", "type 1 diabetes", "diabetes mellitus type 1", "t1dm"},
+	{"chronic obstructive pulmonary disease", "copd"},
+	{"gastroesophageal reflux disease", "gastro oesophageal reflux disease", "gerd", "gord", "acid reflux"},
+	{"varicella", "chickenpox"},
+	{"pertussis", "whooping cough"},
+	{"rubella", "german measles"},
+	{"otitis media", "middle ear infection"},
+	{"urinary tract infection", "uti"},
+	{"hyperlipidaemia", "hyperlipidemia", "high cholesterol"},
+	{"anaemia", "anemia"},
+}
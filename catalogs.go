@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"medically-core/catalog"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// catalogDuplicateScore is the least score of the pairs in the review
+// queue of a catalog, unless the minScore query parameter says otherwise.
+const catalogDuplicateScore = 0.6
+
+// catalogKind is a shared catalog whose duplicate entries can be merged.
+type catalogKind struct {
+	// name names the catalog in routes and events, as "med".
+	name string
+	// param is the route parameter of the ID of an entry.
+	param string
+	// newEntry returns a new *Med or *Disease.
+	newEntry func() interface{}
+	compare  catalog.Catalog
+	// refs are the models that refer to entries, which a merge moves to
+	// the surviving entry.
+	refs []catalogRef
+}
+
+// catalogRef is a model that refers to the entries of a catalog in
+// column.
+type catalogRef struct {
+	typ    string
+	model  interface{}
+	column string
+}
+
+var (
+	medCatalog = catalogKind{
+		name:     "med",
+		param:    "medID",
+		newEntry: func() interface{} { return &Med{} },
+		compare:  catalog.Meds,
+		refs:     []catalogRef{{"prescriptions", &Prescription{}, "med_id"}},
+	}
+	diseaseCatalog = catalogKind{
+		name:     "disease",
+		param:    "diseaseID",
+		newEntry: func() interface{} { return &Disease{} },
+		compare:  catalog.Diseases,
+		refs:     []catalogRef{{"diagnoses", &Diagnosis{}, "disease_id"}},
+	}
+)
+
+// catalogEntry is an entry of a catalog as the review queue shows it.
+type catalogEntry struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Desc string `json:"desc"`
+}
+
+// catalogCandidate is a pair of entries in the review queue of a catalog.
+// Entry is the older one, which a merge of the pair would keep.
+type catalogCandidate struct {
+	Score     float64       `json:"score"`
+	Reasons   []string      `json:"reasons"`
+	Entry     *catalogEntry `json:"entry"`
+	Duplicate *catalogEntry `json:"duplicate"`
+}
+
+// findCatalogDuplicates returns the pairs of entries of kind that score
+// at least min, best first, except dismissed pairs. The names of merged
+// entries are synonyms of the entries they were merged into.
+func findCatalogDuplicates(db *gorm.DB, kind catalogKind, min float64) ([]catalogCandidate, error) {
+	var entries []catalogEntry
+	if err := db.Model(kind.newEntry()).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	byID := map[int]*catalogEntry{}
+	list := make([]catalog.Entry, len(entries))
+	for i := range entries {
+		byID[entries[i].ID] = &entries[i]
+		list[i] = catalog.Entry{ID: entries[i].ID, Name: entries[i].Name}
+	}
+
+	var merges []CatalogMerge
+	if err := db.Where("catalog = ?", kind.name).Find(&merges).Error; err != nil {
+		return nil, err
+	}
+	var synonyms [][]string
+	for _, m := range merges {
+		if survivor, ok := byID[m.SurvivorID]; ok {
+			synonyms = append(synonyms, []string{survivor.Name, m.RetiredName})
+		}
+	}
+
+	var dismissals []CatalogDismissal
+	if err := db.Where("catalog = ?", kind.name).Find(&dismissals).Error; err != nil {
+		return nil, err
+	}
+	dismissed := map[[2]int]bool{}
+	for _, d := range dismissals {
+		dismissed[[2]int{d.EntryID, d.OtherID}] = true
+	}
+
+	candidates := []catalogCandidate{}
+	for _, m := range kind.compare.WithSynonyms(synonyms...).Find(list, min) {
+		if dismissed[[2]int{m.ID, m.OtherID}] {
+			continue
+		}
+		candidates = append(candidates, catalogCandidate{Score: m.Score, Reasons: m.Reasons, Entry: byID[m.ID], Duplicate: byID[m.OtherID]})
+	}
+	return candidates, nil
+}
+
+// resolveCatalogID returns the ID of the entry of kind that entry id was
+// merged into, or id if it was not.
+func resolveCatalogID(db *gorm.DB, kind catalogKind, id int) (int, error) {
+	var merge CatalogMerge
+	if err := db.Where("catalog = ? AND retired_id = ?", kind.name, id).Limit(1).Find(&merge).Error; err != nil {
+		return 0, err
+	}
+	if merge.ID != 0 {
+		return merge.SurvivorID, nil
+	}
+	return id, nil
+}
+
+// mergeCatalogEntries merges entry retiredID of kind into entry
+// survivorID on tx, which must reach every clinic: the records of every
+// clinic that refer to the retired entry move to the survivor, which
+// takes its description if it has none, and the retired entry is
+// deleted, leaving a redirect to the survivor.
+func (s *Server) mergeCatalogEntries(tx *gorm.DB, kind catalogKind, survivorID, retiredID int, mergedBy string) (*CatalogMerge, error) {
+	var entries []catalogEntry
+	err := tx.Model(kind.newEntry()).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", []int{survivorID, retiredID}).Order("id").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 2 {
+		var earlier CatalogMerge
+		if err := tx.Where("catalog = ? AND retired_id = ?", kind.name, retiredID).Limit(1).Find(&earlier).Error; err != nil {
+			return nil, err
+		}
+		if earlier.ID != 0 {
+			return nil, &mergeError{http.StatusConflict, fmt.Sprintf("%s %d was already merged into %s %d", kind.name, retiredID, kind.name, earlier.SurvivorID)}
+		}
+		return nil, &mergeError{http.StatusNotFound, "record not found"}
+	}
+	survivor, retired := entries[0], entries[1]
+	if survivor.ID != survivorID {
+		survivor, retired = retired, survivor
+	}
+
+	merge := CatalogMerge{Catalog: kind.name, RetiredID: retiredID, RetiredName: retired.Name, SurvivorID: survivorID, MergedBy: mergedBy, Moved: map[string]int64{}}
+	pair := []catalog.Entry{{ID: survivor.ID, Name: survivor.Name}, {ID: retired.ID, Name: retired.Name}}
+	if matches := kind.compare.Find(pair, 0); len(matches) > 0 {
+		merge.Score = &matches[0].Score
+	}
+
+	for _, ref := range kind.refs {
+		res := tx.Model(ref.model).Where(ref.column+" = ?", retiredID).Update(ref.column, survivorID)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		merge.Moved[ref.typ] = res.RowsAffected
+	}
+
+	// Entries merged into the retired entry before now redirect to the
+	// survivor, and pairs with the retired entry leave the review queue.
+	err = tx.Model(&CatalogMerge{}).Where("catalog = ? AND survivor_id = ?", kind.name, retiredID).Update("survivor_id", survivorID).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Where("catalog = ? AND (entry_id = ? OR other_id = ?)", kind.name, retiredID, retiredID).Delete(&CatalogDismissal{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if survivor.Desc == "" && retired.Desc != "" {
+		updated := kind.newEntry()
+		if err := tx.Model(updated).Where("id = ?", survivorID).Update("desc", retired.Desc).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Take(updated, "id = ?", survivorID).Error; err != nil {
+			return nil, err
+		}
+		if err := s.changes.publish(tx, kind.name+".updated", updated); err != nil {
+			return nil, err
+		}
+	}
+	deleted := kind.newEntry()
+	if err := tx.Clauses(clause.Returning{}).Delete(deleted, "id = ?", retiredID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&merge).Error; err != nil {
+		return nil, err
+	}
+	if err := s.changes.publish(tx, kind.name+".deleted", deleted); err != nil {
+		return nil, err
+	}
+	return &merge, nil
+}
+
+// ----------------------------  Catalog Duplicate Server Methods ---------------------------------//
+
+// redirectMergedEntry redirects requests for an entry of kind that was
+// merged into another to the same route of the surviving entry.
+func (s *Server) redirectMergedEntry(kind catalogKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		param := c.Param(kind.param)
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			return
+		}
+		survivorID, err := resolveCatalogID(s.dbFor(c), kind, id)
+		if err != nil {
+			internalError(c, err)
+			c.Abort()
+			return
+		}
+		if survivorID != id {
+			redirectID(c, "/"+kind.name+"/", param, survivorID)
+		}
+	}
+}
+
+// getCatalogDuplicates is the review queue of entries of kind that are
+// likely the same.
+func (s *Server) getCatalogDuplicates(kind catalogKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		min, ok := minScore(c, catalogDuplicateScore)
+		if !ok {
+			return
+		}
+		candidates, err := findCatalogDuplicates(s.dbFor(c), kind, min)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, candidates)
+	}
+}
+
+// catalogDismissal takes a pair of entries out of the review queue.
+type catalogDismissal struct {
+	EntryID     int    `json:"entryId"`
+	DuplicateID int    `json:"duplicateId"`
+	DismissedBy string `json:"dismissedBy"`
+}
+
+// dismissCatalogDuplicate records that a pair of entries of kind are
+// different. Dismissing a pair again changes nothing.
+func (s *Server) dismissCatalogDuplicate(kind catalogKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req catalogDismissal
+		if err := BindJSON(c, &req); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return
+		}
+		switch {
+		case req.EntryID == 0 || req.DuplicateID == 0:
+			c.String(http.StatusBadRequest, "error: entryId and duplicateId are required")
+			return
+		case req.EntryID == req.DuplicateID:
+			c.String(http.StatusBadRequest, "error: entryId and duplicateId must differ")
+			return
+		case req.DismissedBy == "":
+			c.String(http.StatusBadRequest, "error: dismissedBy is required")
+			return
+		}
+		d := CatalogDismissal{Catalog: kind.name, EntryID: req.EntryID, OtherID: req.DuplicateID, DismissedBy: req.DismissedBy}
+		if d.EntryID > d.OtherID {
+			d.EntryID, d.OtherID = d.OtherID, d.EntryID
+		}
+
+		db := s.dbFor(c)
+		var n int64
+		if err := db.Model(kind.newEntry()).Where("id IN ?", []int{d.EntryID, d.OtherID}).Count(&n).Error; err != nil {
+			internalError(c, err)
+			return
+		}
+		if n != 2 {
+			c.String(http.StatusNotFound, "error: record not found")
+			return
+		}
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&d).Error
+		if err == nil {
+			err = db.Take(&d, "catalog = ? AND entry_id = ? AND other_id = ?", d.Catalog, d.EntryID, d.OtherID).Error
+		}
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// mergeCatalogEntry merges a duplicate into the entry of kind of the
+// route, for every clinic in one transaction, and answers the merge.
+func (s *Server) mergeCatalogEntry(kind catalogKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mergeRequest
+		if err := BindJSON(c, &req); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return
+		}
+		survivorID, err := strconv.Atoi(c.Param(kind.param))
+		switch {
+		case err != nil:
+			c.String(http.StatusNotFound, "error: record not found")
+			return
+		case req.DuplicateID == 0:
+			c.String(http.StatusBadRequest, "error: duplicateId is required")
+			return
+		case req.MergedBy == "":
+			c.String(http.StatusBadRequest, "error: mergedBy is required")
+			return
+		case req.DuplicateID == survivorID:
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: a %s cannot be merged into itself", kind.name))
+			return
+		}
+
+		// Prescriptions and diagnoses belong to clinics, and the merge
+		// moves those of every clinic. It runs on a context of its own,
+		// so that a client that disconnects cannot cut it short.
+		var merge *CatalogMerge
+		err = tenant.AsSystem(context.Background(), s.db, func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				merge, err = s.mergeCatalogEntries(tx, kind, survivorID, req.DuplicateID, req.MergedBy)
+				return err
+			})
+		})
+		if err != nil {
+			mergeFailed(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, merge)
+	}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
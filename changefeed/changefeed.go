@@ -0,0 +1,202 @@
+// Package changefeed records every change to an entity in the "changes"
+// table, in the transaction of the change, and serves them in order from
+// a cursor.
+//
+// Transactions commit in any order, so changes are only numbered once
+// they are committed: a relay gives the changes without a position the
+// next positions, one relay at a time across replicas. A reader that has
+// seen position n has therefore seen every change before it.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"medically-core/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	relayInterval = time.Second
+	relayBatch    = 1000
+	sweepInterval = time.Hour
+	// relayLock is the advisory lock key that serializes relays.
+	relayLock = 0x6368616e676573
+)
+
+// ErrExpired is returned for cursors whose following changes were already
+// removed.
+var ErrExpired = errors.New("cursor expired")
+
+// Change is a created, updated or deleted entity. Type is the event type,
+// such as "user.updated", and Data the entity after the change, or
+// before a deletion. Changes of entities owned by a clinic have its
+// ClinicID; those of shared entities have none.
+type Change struct {
+	ID        int64           `json:"-"`
+	Position  *int64          `json:"position" gorm:"uniqueIndex"`
+	ClinicID  int             `json:"clinicId,omitempty" gorm:"index"`
+	Type      string          `json:"type" gorm:"not null"`
+	EntityID  int             `json:"entityId"`
+	Payload   string          `json:"-" gorm:"not null;serializer:encrypted" phi:"true"`
+	Data      json.RawMessage `json:"data" gorm:"-"`
+	CreatedAt time.Time       `json:"createdAt" gorm:"index"`
+}
+
+// AfterFind sets Data from the stored payload.
+func (c *Change) AfterFind(*gorm.DB) error {
+	c.Data = json.RawMessage(c.Payload)
+	return nil
+}
+
+// Feed records changes and numbers them.
+type Feed struct {
+	db        *gorm.DB
+	retention time.Duration
+	wake      chan struct{}
+
+	mu       sync.Mutex
+	relayed  chan struct{}
+	closing  chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a Feed, creating its table if needed.
+func New(db *gorm.DB, cfg config.ChangesConfig) (*Feed, error) {
+	if err := db.AutoMigrate(&Change{}); err != nil {
+		return nil, err
+	}
+	if err := db.Exec("CREATE SEQUENCE IF NOT EXISTS changes_position_seq").Error; err != nil {
+		return nil, err
+	}
+	return &Feed{
+		db:        db,
+		retention: cfg.Retention,
+		wake:      make(chan struct{}, 1),
+		relayed:   make(chan struct{}),
+		closing:   make(chan struct{}),
+	}, nil
+}
+
+// Append records a change on db. Appended in a transaction, it is only
+// served if the transaction commits.
+func (f *Feed) Append(db *gorm.DB, typ string, clinicID, entityID int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c := Change{ClinicID: clinicID, Type: typ, EntityID: entityID, Payload: string(payload)}
+	if err := db.Create(&c).Error; err != nil {
+		return err
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Since returns up to limit changes after position since, in order, of
+// the shared entities and those of clinicID. It returns ErrExpired if
+// changes after since were already removed.
+func (f *Feed) Since(db *gorm.DB, clinicID int, since int64, limit int) ([]Change, error) {
+	if since > 0 {
+		var oldest *int64
+		if err := db.Model(&Change{}).Select("MIN(position)").Scan(&oldest).Error; err != nil {
+			return nil, err
+		}
+		if oldest != nil && *oldest > since+1 {
+			return nil, ErrExpired
+		}
+	}
+	var changes []Change
+	err := db.Where("position > ? AND clinic_id IN ?", since, []int{0, clinicID}).
+		Order("position").Limit(limit).Find(&changes).Error
+	return changes, err
+}
+
+// Relayed returns a channel that is closed once this replica numbers
+// more changes. Changes numbered by other replicas are not signalled, so
+// readers poll as well.
+func (f *Feed) Relayed() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.relayed
+}
+
+// Closing returns a channel that is closed when the server shuts down, so
+// that streams end.
+func (f *Feed) Closing() <-chan struct{} {
+	return f.closing
+}
+
+// Close ends the streams reading from the feed.
+func (f *Feed) Close() {
+	f.stopOnce.Do(func() { close(f.closing) })
+}
+
+// Run numbers committed changes and removes those older than the
+// retention until ctx is done.
+func (f *Feed) Run(ctx context.Context) {
+	relay := time.NewTicker(relayInterval)
+	defer relay.Stop()
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	for {
+		for {
+			n, err := f.relay(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("changefeed: numbering changes: %v", err)
+			}
+			if n > 0 {
+				f.mu.Lock()
+				close(f.relayed)
+				f.relayed = make(chan struct{})
+				f.mu.Unlock()
+			}
+			if err != nil || n < relayBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-relay.C:
+		case <-f.wake:
+		case <-sweep.C:
+			err := f.db.WithContext(ctx).
+				Where("position IS NOT NULL AND created_at < ?", time.Now().Add(-f.retention)).
+				Delete(&Change{}).Error
+			if err != nil {
+				log.Printf("changefeed: removing old changes: %v", err)
+			}
+		}
+	}
+}
+
+// relay numbers a batch of committed changes in the order they were
+// recorded and returns how many.
+func (f *Feed) relay(ctx context.Context) (int64, error) {
+	var n int64
+	err := f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", relayLock).Error; err != nil {
+			return err
+		}
+		// Since PostgreSQL 9.6 nextval in the select list is evaluated
+		// after ORDER BY.
+		res := tx.Exec(`WITH numbered AS (
+	SELECT id, nextval('changes_position_seq') AS position
+	FROM (SELECT id FROM changes WHERE position IS NULL ORDER BY id LIMIT ?) pending
+	ORDER BY id
+)
+UPDATE changes SET position = numbered.position FROM numbered WHERE changes.id = numbered.id`, relayBatch)
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/changefeed"
+	"medically-core/logging"
+	"medically-core/tenant"
+	"medically-core/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// changeBatch is the default and maxChanges the largest number of
+	// changes read at a time.
+	changeBatch = 100
+	maxChanges  = 1000
+	// Streams look for changes numbered by other replicas every
+	// changePoll, and send a comment every changeKeepalive so proxies
+	// keep idle streams open.
+	changePoll      = 2 * time.Second
+	changeKeepalive = 15 * time.Second
+)
+
+// changePublisher announces changes to entities, in the transaction that
+// makes them, on the change feed and to webhook subscriptions.
+type changePublisher struct {
+	feed  *changefeed.Feed
+	hooks *webhooks.Dispatcher
+}
+
+// publish records event, such as "user.updated", for entity on tx. Users
+// are only announced to their clinic; meds, diseases and clinics are
+// shared by every clinic.
+func (p *changePublisher) publish(tx *gorm.DB, event string, entity interface{}) error {
+	var clinicID, id int
+	switch e := entity.(type) {
+	case *User:
+		tenantID, ok := tenant.FromContext(tx.Statement.Context)
+		if !ok {
+			return tenant.ErrMissing
+		}
+		clinicID, id = tenantID, e.ID
+	case *Med:
+		id = e.ID
+	case *Disease:
+		id = e.ID
+	case *Clinic:
+		id = e.ID
+	}
+	if err := p.feed.Append(tx, event, clinicID, id, entity); err != nil {
+		return err
+	}
+	e := webhooks.Event{Type: event, TenantID: clinicID, Data: entity}
+	if _, ok := entity.(*User); ok {
+		e.UserID = id
+	}
+	return p.hooks.Publish(tx, e)
+}
+
+// ----------------------------  Change Server Methods ---------------------------------//
+
+// getChanges lists the changes after the since cursor, with the cursor to
+// read the next ones from.
+func (s *Server) getChanges(c *gin.Context) {
+	since, ok := changeCursor(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(changeBatch)))
+	if err != nil || limit < 1 || limit > maxChanges {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: limit must be between 1 and %d", maxChanges))
+		return
+	}
+	clinicID, _ := tenant.FromContext(c.Request.Context())
+	changes, err := s.changes.feed.Since(s.dbFor(c), clinicID, since, limit)
+	if errors.Is(err, changefeed.ErrExpired) {
+		c.String(http.StatusGone, "error: cursor expired, read the entities again")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if len(changes) > 0 {
+		since = *changes[len(changes)-1].Position
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes, "next": since})
+}
+
+// streamChanges streams the changes after the cursor as Server-Sent
+// Events with their position as ID, so a client that reconnects with
+// Last-Event-ID resumes where it stopped.
+func (s *Server) streamChanges(c *gin.Context) {
+	since, ok := changeCursor(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	clinicID, _ := tenant.FromContext(ctx)
+	// Streams last long, so they do not hold a tenant connection; the
+	// changes table is filtered by clinic instead.
+	db := s.db.WithContext(ctx)
+	feed := s.changes.feed
+
+	relayed := feed.Relayed()
+	changes, err := feed.Since(db, clinicID, since, changeBatch)
+	if errors.Is(err, changefeed.ErrExpired) {
+		c.String(http.StatusGone, "error: cursor expired, read the entities again")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	poll := time.NewTicker(changePoll)
+	defer poll.Stop()
+	keepalive := time.NewTicker(changeKeepalive)
+	defer keepalive.Stop()
+	for {
+		for _, change := range changes {
+			data, err := json.Marshal(change)
+			if err != nil {
+				logging.FromContext(ctx).Error("streaming changes failed", logging.Err(err))
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", *change.Position, change.Type, data)
+			since = *change.Position
+		}
+		w.Flush()
+
+		if len(changes) < changeBatch {
+			select {
+			case <-ctx.Done():
+				return
+			case <-feed.Closing():
+				return
+			case <-relayed:
+			case <-poll.C:
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+		}
+		relayed = feed.Relayed()
+		if changes, err = feed.Since(db, clinicID, since, changeBatch); err != nil {
+			logging.FromContext(ctx).Error("streaming changes failed", logging.Err(err))
+			return
+		}
+	}
+}
+
+// changeCursor returns the position to read changes after: the
+// Last-Event-ID of a resumed stream, or the since parameter.
+func changeCursor(c *gin.Context) (int64, bool) {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.DefaultQuery("since", "0")
+	}
+	since, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || since < 0 {
+		c.String(http.StatusBadRequest, "error: invalid cursor")
+		return 0, false
+	}
+	return since, true
+}
+
+// ------------------------------- ------------------- ------------------------------------//
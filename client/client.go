@@ -0,0 +1,20 @@
+// Package client identifies the client that sent a request, for features
+// that keep per-client state such as rate limits and idempotency keys.
+package client
+
+import "github.com/gin-gonic/gin"
+
+// PrincipalKey is the gin context key under which authentication
+// middleware stores the ID of the authenticated user.
+const PrincipalKey = "principal"
+
+// Key identifies the client of a request by authenticated user, or else
+// by IP address. Headers the client chooses, such as an API key nothing
+// checked, are not used: a client could send a new one with every
+// request and never share its state.
+func Key(c *gin.Context) string {
+	if principal := c.GetString(PrincipalKey); principal != "" {
+		return "user:" + principal
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+// CallKey identifies the client of a gRPC call by IP address, as Key does
+// for requests without an authenticated user.
+func CallKey(ctx context.Context) string {
+	return "ip:" + CallIP(ctx)
+}
+
+// CallIP returns the IP address of the client of a gRPC call, or "" if it
+// is not known.
+func CallIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"medically-core/scheduling"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Nearby searches default to and are bounded by these radii, in km, and
+// return at most maxNearbyResults clinics.
+const (
+	defaultNearbyRadius = 10
+	maxNearbyRadius     = 200
+	maxNearbyResults    = 100
+)
+
+// earthRadius is the mean radius of the earth in km.
+const earthRadius = 6371.0
+
+// validateClinic checks the location and timezone of a clinic.
+func validateClinic(cl *Clinic) error {
+	if (cl.Latitude == nil) != (cl.Longitude == nil) {
+		return errors.New("latitude and longitude must be set together")
+	}
+	if cl.Latitude != nil && (*cl.Latitude < -90 || *cl.Latitude > 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if cl.Longitude != nil && (*cl.Longitude < -180 || *cl.Longitude > 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	if _, err := time.LoadLocation(cl.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", cl.Timezone)
+	}
+	return nil
+}
+
+// location returns the timezone of the clinic's opening hours.
+func (cl *Clinic) location() *time.Location {
+	loc, err := time.LoadLocation(cl.Timezone)
+	if err != nil {
+		// Timezones are validated when clinics are written.
+		return time.UTC
+	}
+	return loc
+}
+
+// period parses the times of day a period opens and closes.
+func period(opens, closes string) (scheduling.Clock, scheduling.Clock, error) {
+	o, err := scheduling.ParseClock(opens)
+	if err != nil {
+		return o, o, fmt.Errorf("opens: %w", err)
+	}
+	c, err := scheduling.ParseClock(closes)
+	if err != nil {
+		return o, c, fmt.Errorf("closes: %w", err)
+	}
+	if !o.Before(c) {
+		return o, c, errors.New("opens must be before closes")
+	}
+	return o, c, nil
+}
+
+// openAt reports whether a clinic with the hours and holidays is open at
+// t in loc. A holiday on the date of t replaces the hours of that day.
+func openAt(loc *time.Location, hours []OpeningHours, holidays []Holiday, t time.Time) bool {
+	t = t.In(loc)
+	now := scheduling.Clock{Hour: t.Hour(), Minute: t.Minute()}
+	within := func(opens, closes string) bool {
+		o, c, err := period(opens, closes)
+		// Periods are validated when they are written.
+		return err == nil && !now.Before(o) && now.Before(c)
+	}
+
+	date := t.Format("2006-01-02")
+	for _, h := range holidays {
+		if h.Date == date {
+			return h.Opens != "" && within(h.Opens, h.Closes)
+		}
+	}
+	for _, h := range hours {
+		if time.Weekday(h.Weekday) == t.Weekday() && within(h.Opens, h.Closes) {
+			return true
+		}
+	}
+	return false
+}
+
+// distance returns the great-circle distance between two points in km.
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLng := rad(lat2-lat1), rad(lng2-lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// nearbyClinic is a clinic found by a nearby search.
+type nearbyClinic struct {
+	Clinic
+	DistanceKm float64  `json:"distanceKm"`
+	OpenNow    bool     `json:"openNow"`
+	Services   []string `json:"services"`
+}
+
+// getNearbyClinics lists the clinics within ?radius km (10 by default) of
+// ?lat and ?lng, nearest first. ?open_now=true only lists clinics that
+// are open, and ?service those offering a service.
+func (s *Server) getNearbyClinics(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.String(http.StatusBadRequest, "error: lat and lng must be a valid position")
+		return
+	}
+	radius := float64(defaultNearbyRadius)
+	if v, ok := c.GetQuery("radius"); ok {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r > maxNearbyRadius {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: radius must be a distance in km of at most %d", maxNearbyRadius))
+			return
+		}
+		radius = r
+	}
+	openNow := false
+	if v, ok := c.GetQuery("open_now"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.String(http.StatusBadRequest, "error: open_now must be true or false")
+			return
+		}
+		openNow = b
+	}
+
+	// A bounding box around the radius narrows down the clinics whose
+	// distance is computed. Longitudes are only bounded if the box does
+	// not span a pole or the antimeridian.
+	db := s.dbFor(c)
+	dLat := radius / earthRadius * 180 / math.Pi
+	q := db.Where("latitude BETWEEN ? AND ? AND longitude IS NOT NULL", lat-dLat, lat+dLat)
+	if cos := math.Cos(lat * math.Pi / 180); lat+dLat < 90 && lat-dLat > -90 {
+		if dLng := dLat / cos; lng-dLng > -180 && lng+dLng < 180 {
+			q = q.Where("longitude BETWEEN ? AND ?", lng-dLng, lng+dLng)
+		}
+	}
+	if service := c.Query("service"); service != "" {
+		q = q.Where("id IN (?)", db.Model(&ClinicService{}).Select("clinic_id").Where("LOWER(name) = LOWER(?)", service))
+	}
+	var candidates []Clinic
+	if err := q.Find(&candidates).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+
+	var found []nearbyClinic
+	for _, cl := range candidates {
+		if d := distance(lat, lng, *cl.Latitude, *cl.Longitude); d <= radius {
+			found = append(found, nearbyClinic{Clinic: cl, DistanceKm: math.Round(d*100) / 100, Services: []string{}})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].DistanceKm < found[j].DistanceKm })
+	ids := make([]int, len(found))
+	for i, f := range found {
+		ids[i] = f.ID
+	}
+
+	// Holidays are loaded around today, as it is another date in some
+	// clinics' timezones.
+	now := time.Now()
+	var (
+		hours    []OpeningHours
+		holidays []Holiday
+		services []ClinicService
+	)
+	err := db.Where("clinic_id IN ?", ids).Find(&hours).Error
+	if err == nil {
+		err = db.Where("clinic_id IN ? AND date BETWEEN ? AND ?", ids,
+			now.AddDate(0, 0, -1).Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")).Find(&holidays).Error
+	}
+	if err == nil {
+		err = db.Where("clinic_id IN ?", ids).Order("name").Find(&services).Error
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	hoursOf := make(map[int][]OpeningHours)
+	for _, h := range hours {
+		hoursOf[h.ClinicID] = append(hoursOf[h.ClinicID], h)
+	}
+	holidaysOf := make(map[int][]Holiday)
+	for _, h := range holidays {
+		holidaysOf[h.ClinicID] = append(holidaysOf[h.ClinicID], h)
+	}
+	servicesOf := make(map[int][]string)
+	for _, sv := range services {
+		servicesOf[sv.ClinicID] = append(servicesOf[sv.ClinicID], sv.Name)
+	}
+
+	result := []nearbyClinic{}
+	for _, f := range found {
+		f.OpenNow = openAt(f.location(), hoursOf[f.ID], holidaysOf[f.ID], now)
+		if openNow && !f.OpenNow {
+			continue
+		}
+		if names, ok := servicesOf[f.ID]; ok {
+			f.Services = names
+		}
+		result = append(result, f)
+		if len(result) == maxNearbyResults {
+			break
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// findClinic loads the clinic of the clinicID parameter, answering 404 if
+// there is none.
+func (s *Server) findClinic(c *gin.Context) (*Clinic, bool) {
+	var clinic Clinic
+	err := s.dbFor(c).Take(&clinic, "id = ?", c.Param("clinicID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	return &clinic, true
+}
+
+// ----------------------------  Opening Hours Server Methods ---------------------------------//
+
+func (s *Server) getOpeningHours(c *gin.Context) {
+	var hours []OpeningHours
+	err := s.dbFor(c).Where("clinic_id = ?", c.Param("clinicID")).Order("weekday, opens").Find(&hours).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hours)
+}
+
+// putOpeningHours replaces the weekly opening hours of a clinic.
+func (s *Server) putOpeningHours(c *gin.Context) {
+	var hours []OpeningHours
+	if err := BindJSON(c, &hours); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	clinic, ok := s.findClinic(c)
+	if !ok {
+		return
+	}
+
+	type span struct{ opens, closes scheduling.Clock }
+	days := make(map[int][]span)
+	for i := range hours {
+		h := &hours[i]
+		if h.Weekday < 0 || h.Weekday > 6 {
+			c.String(http.StatusBadRequest, "error: weekday must be between 0 (Sunday) and 6 (Saturday)")
+			return
+		}
+		opens, closes, err := period(h.Opens, h.Closes)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return
+		}
+		for _, other := range days[h.Weekday] {
+			if opens.Before(other.closes) && other.opens.Before(closes) {
+				c.String(http.StatusBadRequest, fmt.Sprintf("error: opening hours overlap on weekday %d", h.Weekday))
+				return
+			}
+		}
+		days[h.Weekday] = append(days[h.Weekday], span{opens, closes})
+		h.ID, h.ClinicID = 0, clinic.ID
+	}
+
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(OpeningHours{}, "clinic_id = ?", clinic.ID).Error; err != nil {
+			return err
+		}
+		if len(hours) == 0 {
+			return nil
+		}
+		return tx.Create(&hours).Error
+	})
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hours)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Holiday Server Methods ---------------------------------//
+
+// getHolidays lists the holidays of a clinic, by default those from today
+// on; ?from sets another first date.
+func (s *Server) getHolidays(c *gin.Context) {
+	from := c.DefaultQuery("from", time.Now().Format("2006-01-02"))
+	var holidays []Holiday
+	err := s.dbFor(c).Where("clinic_id = ? AND date >= ?", c.Param("clinicID"), from).Order("date").Find(&holidays).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, holidays)
+}
+
+func (s *Server) createHoliday(c *gin.Context) {
+	var holiday Holiday
+	if err := BindJSON(c, &holiday); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+		c.String(http.StatusBadRequest, "error: date must be written as YYYY-MM-DD")
+		return
+	}
+	if holiday.Opens != "" || holiday.Closes != "" {
+		if _, _, err := period(holiday.Opens, holiday.Closes); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return
+		}
+	}
+	clinic, ok := s.findClinic(c)
+	if !ok {
+		return
+	}
+	holiday.ClinicID = clinic.ID
+
+	db := s.dbFor(c)
+	var n int64
+	if err := db.Model(&Holiday{}).Where("clinic_id = ? AND date = ?", clinic.ID, holiday.Date).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n > 0 {
+		c.String(http.StatusConflict, "error: the clinic already has a holiday on that date")
+		return
+	}
+	if err := db.Create(&holiday).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, holiday)
+}
+
+func (s *Server) deleteHoliday(c *gin.Context) {
+	holidayID := c.Param("holidayID")
+	req := s.dbFor(c).Delete(Holiday{}, "id = ? AND clinic_id = ?", holidayID, c.Param("clinicID"))
+	if err := req.Error; err != nil {
+		internalError(c, err)
+	} else if req.RowsAffected == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else {
+		c.JSON(http.StatusOK, holidayID)
+	}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Clinic Service Server Methods ---------------------------------//
+
+func (s *Server) getClinicServices(c *gin.Context) {
+	var services []ClinicService
+	err := s.dbFor(c).Where("clinic_id = ?", c.Param("clinicID")).Order("name").Find(&services).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, services)
+}
+
+func (s *Server) createClinicService(c *gin.Context) {
+	var service ClinicService
+	if err := BindJSON(c, &service); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if service.Name = strings.TrimSpace(service.Name); service.Name == "" {
+		c.String(http.StatusBadRequest, "error: name is required")
+		return
+	}
+	clinic, ok := s.findClinic(c)
+	if !ok {
+		return
+	}
+	service.ClinicID = clinic.ID
+
+	db := s.dbFor(c)
+	var n int64
+	if err := db.Model(&ClinicService{}).Where("clinic_id = ? AND LOWER(name) = LOWER(?)", clinic.ID, service.Name).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n > 0 {
+		c.String(http.StatusConflict, "error: the clinic already offers that service")
+		return
+	}
+	if err := db.Create(&service).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, service)
+}
+
+func (s *Server) deleteClinicService(c *gin.Context) {
+	serviceID := c.Param("serviceID")
+	req := s.dbFor(c).Delete(ClinicService{}, "id = ? AND clinic_id = ?", serviceID, c.Param("clinicID"))
+	if err := req.Error; err != nil {
+		internalError(c, err)
+	} else if req.RowsAffected == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else {
+		c.JSON(http.StatusOK, serviceID)
+	}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
@@ -0,0 +1,1138 @@
+// Package config loads the service configuration from a YAML file,
+// environment variables and command line flags.
+//
+// Sources are applied in increasing order of precedence:
+//
+//	defaults < YAML file < environment variables < flags
+//
+// Secret values may be given inline or, preferably, through a "_file"
+// companion setting that names a file holding the secret (e.g. a Docker
+// or Kubernetes secret mount).
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix is the prefix of every environment variable read by Load.
+const envPrefix = "MEDICALLY_"
+
+// Config is the typed configuration of the service.
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	NLP           NLPConfig           `yaml:"nlp"`
+	Log           LogConfig           `yaml:"log"`
+	Tracing       TracingConfig       `yaml:"tracing"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Idempotency   IdempotencyConfig   `yaml:"idempotency"`
+	Tenancy       TenancyConfig       `yaml:"tenancy"`
+	Encryption    EncryptionConfig    `yaml:"encryption"`
+	Storage       StorageConfig       `yaml:"storage"`
+	BulkExport    BulkExportConfig    `yaml:"bulk_export"`
+	HL7           HL7Config           `yaml:"hl7"`
+	Scheduling    SchedulingConfig    `yaml:"scheduling"`
+	Reminders     RemindersConfig     `yaml:"reminders"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Changes       ChangesConfig       `yaml:"changes"`
+	GraphQL       GraphQLConfig       `yaml:"graphql"`
+	GRPC          GRPCConfig          `yaml:"grpc"`
+	UserExport    UserExportConfig    `yaml:"user_export"`
+	Erasure       ErasureConfig       `yaml:"erasure"`
+}
+
+// ServerConfig configures the HTTP server.
+type ServerConfig struct {
+	Port int    `yaml:"port"`
+	Mode string `yaml:"mode"`
+
+	// ReadHeaderTimeout and ReadTimeout bound how long a client may take
+	// to send the headers and the whole request. There is no write
+	// timeout, as change streams stay open.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+
+	// DrainDelay is how long the server keeps serving after SIGTERM while
+	// reporting not ready, so load balancers stop sending it requests
+	// before it closes its listener.
+	DrainDelay time.Duration `yaml:"drain_delay"`
+
+	// ShutdownTimeout bounds how long in-flight requests may take to
+	// drain after SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// TrustedProxies are the addresses or CIDR ranges of the proxies
+	// whose X-Forwarded-For header gives the client IP. With none, the
+	// client IP is the peer's and the header is ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig configures the Postgres connection.
+type DatabaseConfig struct {
+	URL     Secret `yaml:"url"`
+	URLFile string `yaml:"url_file,omitempty"`
+
+	// ConnectTimeout bounds how long startup keeps retrying the initial
+	// connection before giving up.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// NLPConfig configures the Google Cloud Natural Language client.
+type NLPConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+// LogConfig configures logging. It is reloadable.
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter is one of none, otlp, stdout or file.
+	Exporter    string  `yaml:"exporter"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+
+	// Endpoint is the host:port of the OTLP/HTTP collector. When empty the
+	// OTEL_EXPORTER_OTLP_* environment variables apply.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+
+	// File receives the spans, one JSON document per line, when Exporter
+	// is file.
+	File string `yaml:"file,omitempty"`
+}
+
+// RateLimitConfig configures per client rate limiting. Enabled and Groups
+// are reloadable.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Store is memory for a single instance or postgres to share limits
+	// between replicas.
+	Store string `yaml:"store"`
+	// Groups maps a route group (user, med, disease, clinic) to its limit.
+	// The "default" entry applies to groups without one.
+	Groups map[string]RateLimitRule `yaml:"groups"`
+}
+
+// RateLimitRule is a token bucket refilled at Rate requests per second and
+// allowing bursts of Burst requests.
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// IdempotencyConfig configures Idempotency-Key handling.
+type IdempotencyConfig struct {
+	// Window is how long a key and its stored response are kept.
+	Window time.Duration `yaml:"window"`
+}
+
+// TenancyConfig configures the isolation of clinics from each other.
+type TenancyConfig struct {
+	// TrustHeader accepts the X-Tenant-ID header, and the x-tenant-id gRPC
+	// metadata, from requests without an authenticated principal. It is
+	// for gateway deployments only: enable it behind a gateway that
+	// authenticates clients and sets the header itself, never when
+	// clients reach the server directly.
+	TrustHeader bool `yaml:"trust_header"`
+	// RowLevelSecurity installs Postgres row-level security policies on
+	// tenant-owned tables and runs tenant requests on connections
+	// restricted to their tenant.
+	RowLevelSecurity bool `yaml:"row_level_security"`
+}
+
+// EncryptionConfig configures the encryption of sensitive fields.
+type EncryptionConfig struct {
+	// Provider holds the master keys. Only "local" is supported.
+	Provider string `yaml:"provider"`
+	// KeyFile is the master key file of the local provider.
+	KeyFile string `yaml:"key_file"`
+	// GenerateKeyFile creates KeyFile with fresh keys when it does not
+	// exist. Meant for development: losing the file loses the data.
+	GenerateKeyFile bool `yaml:"generate_key_file"`
+}
+
+// StorageConfig configures where generated files, such as bulk exports,
+// are stored.
+type StorageConfig struct {
+	// Backend is local or s3. Replicas must share the store, so local
+	// only suits a single instance or a shared volume.
+	Backend string   `yaml:"backend"`
+	Dir     string   `yaml:"dir"`
+	S3      S3Config `yaml:"s3"`
+}
+
+// S3Config configures an S3-compatible bucket.
+type S3Config struct {
+	Endpoint            string `yaml:"endpoint"`
+	Region              string `yaml:"region,omitempty"`
+	Bucket              string `yaml:"bucket"`
+	AccessKeyID         string `yaml:"access_key_id"`
+	SecretAccessKey     Secret `yaml:"secret_access_key"`
+	SecretAccessKeyFile string `yaml:"secret_access_key_file,omitempty"`
+	// Insecure talks plain HTTP, e.g. to a local MinIO.
+	Insecure bool `yaml:"insecure,omitempty"`
+}
+
+// BulkExportConfig configures FHIR bulk data exports.
+type BulkExportConfig struct {
+	// Retention is how long finished exports can be downloaded before
+	// their files are deleted.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// GraphQLConfig bounds the queries of the GraphQL endpoint.
+type GraphQLConfig struct {
+	// MaxDepth bounds how deeply fields may be nested.
+	MaxDepth int `yaml:"max_depth"`
+	// MaxComplexity bounds the number of fields a query may resolve,
+	// counting the fields below a list once per expected item.
+	MaxComplexity int `yaml:"max_complexity"`
+}
+
+// GRPCConfig configures the gRPC API.
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	// Reflection lets clients such as grpcurl list the services.
+	Reflection bool `yaml:"reflection"`
+}
+
+// UserExportConfig configures the exports of their data patients ask
+// for.
+type UserExportConfig struct {
+	// Expiry is how long an export can be downloaded, through links that
+	// expire with it, before its archive is deleted.
+	Expiry time.Duration `yaml:"expiry"`
+	// PublicURL is the URL patients reach the service at, which download
+	// links start with. It is configured rather than taken from requests,
+	// whose Host and X-Forwarded-Proto headers the client chooses.
+	PublicURL string `yaml:"public_url"`
+}
+
+// ErasureConfig configures the erasure of the personal data of users.
+type ErasureConfig struct {
+	// RequireApproval holds erasure requests until someone other than
+	// the requester approves them.
+	RequireApproval bool `yaml:"require_approval"`
+	// ClinicalRetention is how long clinical records, such as diagnoses
+	// and prescriptions, are kept after they were made when their user
+	// is erased.
+	ClinicalRetention time.Duration `yaml:"clinical_retention"`
+}
+
+// HL7Config configures the HL7 v2 MLLP listener.
+type HL7Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	// IdleTimeout closes connections that send nothing for that long.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// Facilities maps the sending facility (MSH-4) of each partner to the
+	// clinic its messages belong to. Messages from other facilities are
+	// rejected.
+	Facilities map[string]int `yaml:"facilities"`
+	Mapping    HL7Mapping     `yaml:"mapping"`
+}
+
+// SchedulingConfig configures appointment booking.
+type SchedulingConfig struct {
+	// CancelWindow is how long before its start an appointment can last
+	// be cancelled, and RescheduleWindow how long before it can last be
+	// moved.
+	CancelWindow     time.Duration `yaml:"cancel_window"`
+	RescheduleWindow time.Duration `yaml:"reschedule_window"`
+	// Horizon is how far ahead appointments can be booked.
+	Horizon time.Duration `yaml:"horizon"`
+}
+
+// RemindersConfig configures the medication reminders generated from
+// prescriptions.
+type RemindersConfig struct {
+	// Reminders are generated every Interval for the doses due within
+	// Lookahead.
+	Interval  time.Duration `yaml:"interval"`
+	Lookahead time.Duration `yaml:"lookahead"`
+}
+
+// NotificationsConfig configures how users are notified.
+type NotificationsConfig struct {
+	// DefaultLocale is the language of users who did not choose one.
+	DefaultLocale string `yaml:"default_locale"`
+	// MaxAttempts bounds how often a message is tried before it fails.
+	MaxAttempts int         `yaml:"max_attempts"`
+	Email       EmailConfig `yaml:"email"`
+	SMS         SMSConfig   `yaml:"sms"`
+	// LogFile is where the log provider writes messages, "-" for stdout.
+	LogFile string `yaml:"log_file"`
+}
+
+// EmailConfig configures the email channel.
+type EmailConfig struct {
+	// Provider is smtp, log (write to notifications.log_file) or none.
+	Provider string     `yaml:"provider"`
+	From     string     `yaml:"from"`
+	SMTP     SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig configures an SMTP relay. STARTTLS is used when the server
+// offers it.
+type SMTPConfig struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port"`
+	Username     string `yaml:"username,omitempty"`
+	Password     Secret `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// SMSConfig configures the SMS channel.
+type SMSConfig struct {
+	// Provider is http (a generic SMS gateway), log or none.
+	Provider string           `yaml:"provider"`
+	From     string           `yaml:"from"`
+	HTTP     SMSGatewayConfig `yaml:"http"`
+}
+
+// SMSGatewayConfig configures an HTTP SMS gateway, which is sent a JSON
+// object with from, to and body.
+type SMSGatewayConfig struct {
+	URL       string `yaml:"url"`
+	Token     Secret `yaml:"token,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty"`
+}
+
+// WebhooksConfig configures the delivery of webhook events to partner
+// systems.
+type WebhooksConfig struct {
+	// MaxAttempts bounds how often an event is posted before it fails.
+	MaxAttempts int `yaml:"max_attempts"`
+	// DisableAfter is the number of consecutive failed attempts after
+	// which a subscription is disabled.
+	DisableAfter int `yaml:"disable_after"`
+	// Timeout bounds each attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// AllowHTTP permits plain http endpoints, for development.
+	AllowHTTP bool `yaml:"allow_http"`
+	// AllowPrivate permits endpoints on loopback, private and link-local
+	// addresses, for development. Otherwise they are refused when
+	// connecting, so redirects and DNS answers cannot reach them either.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// ChangesConfig configures the change feed.
+type ChangesConfig struct {
+	// Retention is how long changes are kept; clients that fall further
+	// behind must read the entities again.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// HL7Mapping locates the values read from messages, as paths such as
+// "PID-5.1". Values with several paths join the non-empty values with
+// spaces. Observation paths are read from each OBX segment.
+type HL7Mapping struct {
+	PatientID          string   `yaml:"patient_id"`
+	PatientIDAuthority string   `yaml:"patient_id_authority"`
+	Name               []string `yaml:"name"`
+	Email              string   `yaml:"email"`
+	Contact            string   `yaml:"contact"`
+	ObservationCode    string   `yaml:"observation_code"`
+	ObservationName    string   `yaml:"observation_name"`
+	ObservationSystem  string   `yaml:"observation_system"`
+	ObservationValue   string   `yaml:"observation_value"`
+	ObservationUnit    string   `yaml:"observation_unit"`
+	ObservationRange   string   `yaml:"observation_range"`
+	ObservationFlag    string   `yaml:"observation_flag"`
+	ObservationStatus  string   `yaml:"observation_status"`
+	ObservationTime    string   `yaml:"observation_time"`
+}
+
+// paths returns every path of m by setting name.
+func (m HL7Mapping) paths() map[string][]string {
+	return map[string][]string{
+		"patient_id":           {m.PatientID},
+		"patient_id_authority": {m.PatientIDAuthority},
+		"name":                 m.Name,
+		"email":                {m.Email},
+		"contact":              {m.Contact},
+		"observation_code":     {m.ObservationCode},
+		"observation_name":     {m.ObservationName},
+		"observation_system":   {m.ObservationSystem},
+		"observation_value":    {m.ObservationValue},
+		"observation_unit":     {m.ObservationUnit},
+		"observation_range":    {m.ObservationRange},
+		"observation_flag":     {m.ObservationFlag},
+		"observation_status":   {m.ObservationStatus},
+		"observation_time":     {m.ObservationTime},
+	}
+}
+
+// Default returns the configuration used when no other source sets a value.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: 9000,
+			Mode: "debug",
+
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			DrainDelay:        5 * time.Second,
+			ShutdownTimeout:   15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			ConnectTimeout: time.Minute,
+		},
+		NLP: NLPConfig{
+			CredentialsFile: "credentials.json",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "medically-core",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Groups: map[string]RateLimitRule{
+				"default": {Rate: 20, Burst: 40},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			Window: 24 * time.Hour,
+		},
+		Tenancy: TenancyConfig{
+			TrustHeader:      false,
+			RowLevelSecurity: true,
+		},
+		Encryption: EncryptionConfig{
+			Provider: "local",
+			KeyFile:  "keys.json",
+		},
+		Storage: StorageConfig{
+			Backend: "local",
+			Dir:     "data",
+		},
+		BulkExport: BulkExportConfig{
+			Retention: 24 * time.Hour,
+		},
+		HL7: HL7Config{
+			Listen:      ":2575",
+			IdleTimeout: 5 * time.Minute,
+			Mapping: HL7Mapping{
+				PatientID:          "PID-3.1",
+				PatientIDAuthority: "PID-3.4",
+				Name:               []string{"PID-5.2", "PID-5.1"},
+				Email:              "PID-13.4",
+				Contact:            "PID-13.1",
+				ObservationCode:    "OBX-3.1",
+				ObservationName:    "OBX-3.2",
+				ObservationSystem:  "OBX-3.3",
+				ObservationValue:   "OBX-5",
+				ObservationUnit:    "OBX-6.1",
+				ObservationRange:   "OBX-7",
+				ObservationFlag:    "OBX-8",
+				ObservationStatus:  "OBX-11",
+				ObservationTime:    "OBX-14",
+			},
+		},
+		Scheduling: SchedulingConfig{
+			CancelWindow:     24 * time.Hour,
+			RescheduleWindow: 24 * time.Hour,
+			Horizon:          90 * 24 * time.Hour,
+		},
+		Reminders: RemindersConfig{
+			Interval:  5 * time.Minute,
+			Lookahead: 24 * time.Hour,
+		},
+		Notifications: NotificationsConfig{
+			DefaultLocale: "en",
+			MaxAttempts:   8,
+			Email: EmailConfig{
+				Provider: "log",
+				From:     "medically <no-reply@medically.local>",
+				SMTP:     SMTPConfig{Port: 587},
+			},
+			SMS: SMSConfig{
+				Provider: "log",
+			},
+			LogFile: "-",
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:  10,
+			DisableAfter: 50,
+			Timeout:      10 * time.Second,
+		},
+		Changes: ChangesConfig{
+			Retention: 7 * 24 * time.Hour,
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:      10,
+			MaxComplexity: 5000,
+		},
+		GRPC: GRPCConfig{
+			Listen:     ":9090",
+			Reflection: true,
+		},
+		UserExport: UserExportConfig{
+			Expiry:    72 * time.Hour,
+			PublicURL: "http://localhost:9000",
+		},
+		Erasure: ErasureConfig{
+			RequireApproval:   true,
+			ClinicalRetention: 20 * 365 * 24 * time.Hour,
+		},
+	}
+}
+
+// Options are the command line options that are not configuration values.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+
+	// applyFlags re-applies the flags that were set explicitly, so they
+	// keep their precedence when the configuration is reloaded.
+	applyFlags func(*Config)
+}
+
+// flagValues holds the raw values of the configuration flags.
+type flagValues struct {
+	port            int
+	mode            string
+	databaseURLFile string
+	credentialsFile string
+	logLevel        string
+}
+
+// Load builds a Config from the command line arguments (without the program
+// name), the environment and the YAML file named by --config or
+// MEDICALLY_CONFIG. The returned Config has been validated.
+func Load(args []string) (*Config, Options, error) {
+	var opts Options
+	var fv flagValues
+
+	fs := flag.NewFlagSet("medically-core", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", os.Getenv(envPrefix+"CONFIG"), "path to the YAML configuration file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	fs.IntVar(&fv.port, "port", 0, "HTTP listen port")
+	fs.StringVar(&fv.mode, "mode", "", "gin mode: debug, release or test")
+	fs.StringVar(&fv.databaseURLFile, "database-url-file", "", "file containing the database URL")
+	fs.StringVar(&fv.credentialsFile, "nlp-credentials-file", "", "Google Cloud credentials file for the NLP client")
+	fs.StringVar(&fv.logLevel, "log-level", "", "log level: debug, info, warn or error")
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	opts.applyFlags = func(cfg *Config) {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				cfg.Server.Port = fv.port
+			case "mode":
+				cfg.Server.Mode = fv.mode
+			case "database-url-file":
+				cfg.Database.URLFile = fv.databaseURLFile
+			case "nlp-credentials-file":
+				cfg.NLP.CredentialsFile = fv.credentialsFile
+			case "log-level":
+				cfg.Log.Level = fv.logLevel
+			}
+		})
+	}
+	cfg, err := load(opts.ConfigFile, opts.applyFlags)
+	return cfg, opts, err
+}
+
+// load applies defaults, the file at path, the environment and then
+// applyFlags, resolves secrets and validates the result.
+func load(path string, applyFlags func(*Config)) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if applyFlags != nil {
+		applyFlags(cfg)
+	}
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	// A file listing rate limit groups replaces the default ones, and
+	// strict decoding rejects keys already present in a map.
+	groups := c.RateLimit.Groups
+	c.RateLimit.Groups = nil
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if c.RateLimit.Groups == nil {
+		c.RateLimit.Groups = groups
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	// DATABASE_URL predates the prefixed variables and is still honoured.
+	if v, ok := os.LookupEnv("DATABASE_URL"); ok {
+		c.Database.URL = Secret(v)
+	}
+	if v, ok := lookupEnv("DATABASE_URL"); ok {
+		c.Database.URL = Secret(v)
+	}
+	if v, ok := lookupEnv("DATABASE_URL_FILE"); ok {
+		c.Database.URLFile = v
+	}
+	if v, ok := lookupEnv("PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%sPORT: %w", envPrefix, err)
+		}
+		c.Server.Port = port
+	}
+	if v, ok := lookupEnv("MODE"); ok {
+		c.Server.Mode = v
+	}
+	if v, ok := lookupEnv("READ_HEADER_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sREAD_HEADER_TIMEOUT: %w", envPrefix, err)
+		}
+		c.Server.ReadHeaderTimeout = d
+	}
+	if v, ok := lookupEnv("READ_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sREAD_TIMEOUT: %w", envPrefix, err)
+		}
+		c.Server.ReadTimeout = d
+	}
+	if v, ok := lookupEnv("DRAIN_DELAY"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sDRAIN_DELAY: %w", envPrefix, err)
+		}
+		c.Server.DrainDelay = d
+	}
+	if v, ok := lookupEnv("SHUTDOWN_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sSHUTDOWN_TIMEOUT: %w", envPrefix, err)
+		}
+		c.Server.ShutdownTimeout = d
+	}
+	if v, ok := lookupEnv("TRUSTED_PROXIES"); ok {
+		c.Server.TrustedProxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.Server.TrustedProxies = append(c.Server.TrustedProxies, p)
+			}
+		}
+	}
+	if v, ok := lookupEnv("DATABASE_CONNECT_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sDATABASE_CONNECT_TIMEOUT: %w", envPrefix, err)
+		}
+		c.Database.ConnectTimeout = d
+	}
+	if v, ok := lookupEnv("NLP_ENABLED"); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sNLP_ENABLED: %w", envPrefix, err)
+		}
+		c.NLP.Enabled = enabled
+	}
+	if v, ok := lookupEnv("NLP_CREDENTIALS_FILE"); ok {
+		c.NLP.CredentialsFile = v
+	}
+	if v, ok := lookupEnv("LOG_LEVEL"); ok {
+		c.Log.Level = v
+	}
+	if v, ok := lookupEnv("RATE_LIMIT_ENABLED"); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sRATE_LIMIT_ENABLED: %w", envPrefix, err)
+		}
+		c.RateLimit.Enabled = enabled
+	}
+	if v, ok := lookupEnv("RATE_LIMIT_STORE"); ok {
+		c.RateLimit.Store = v
+	}
+	if v, ok := lookupEnv("IDEMPOTENCY_WINDOW"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sIDEMPOTENCY_WINDOW: %w", envPrefix, err)
+		}
+		c.Idempotency.Window = d
+	}
+	if v, ok := lookupEnv("TENANCY_TRUST_HEADER"); ok {
+		trust, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sTENANCY_TRUST_HEADER: %w", envPrefix, err)
+		}
+		c.Tenancy.TrustHeader = trust
+	}
+	if v, ok := lookupEnv("TENANCY_ROW_LEVEL_SECURITY"); ok {
+		rls, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sTENANCY_ROW_LEVEL_SECURITY: %w", envPrefix, err)
+		}
+		c.Tenancy.RowLevelSecurity = rls
+	}
+	if v, ok := lookupEnv("ENCRYPTION_KEY_FILE"); ok {
+		c.Encryption.KeyFile = v
+	}
+	if v, ok := lookupEnv("ENCRYPTION_GENERATE_KEY_FILE"); ok {
+		generate, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sENCRYPTION_GENERATE_KEY_FILE: %w", envPrefix, err)
+		}
+		c.Encryption.GenerateKeyFile = generate
+	}
+	if v, ok := lookupEnv("STORAGE_BACKEND"); ok {
+		c.Storage.Backend = v
+	}
+	if v, ok := lookupEnv("STORAGE_DIR"); ok {
+		c.Storage.Dir = v
+	}
+	if v, ok := lookupEnv("STORAGE_S3_ENDPOINT"); ok {
+		c.Storage.S3.Endpoint = v
+	}
+	if v, ok := lookupEnv("STORAGE_S3_REGION"); ok {
+		c.Storage.S3.Region = v
+	}
+	if v, ok := lookupEnv("STORAGE_S3_BUCKET"); ok {
+		c.Storage.S3.Bucket = v
+	}
+	if v, ok := lookupEnv("STORAGE_S3_ACCESS_KEY_ID"); ok {
+		c.Storage.S3.AccessKeyID = v
+	}
+	if v, ok := lookupEnv("STORAGE_S3_SECRET_ACCESS_KEY"); ok {
+		c.Storage.S3.SecretAccessKey = Secret(v)
+	}
+	if v, ok := lookupEnv("STORAGE_S3_SECRET_ACCESS_KEY_FILE"); ok {
+		c.Storage.S3.SecretAccessKeyFile = v
+	}
+	if v, ok := lookupEnv("BULK_EXPORT_RETENTION"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sBULK_EXPORT_RETENTION: %w", envPrefix, err)
+		}
+		c.BulkExport.Retention = d
+	}
+	if v, ok := lookupEnv("HL7_ENABLED"); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sHL7_ENABLED: %w", envPrefix, err)
+		}
+		c.HL7.Enabled = enabled
+	}
+	if v, ok := lookupEnv("HL7_LISTEN"); ok {
+		c.HL7.Listen = v
+	}
+	if v, ok := lookupEnv("USER_EXPORT_PUBLIC_URL"); ok {
+		c.UserExport.PublicURL = v
+	}
+	for name, dst := range map[string]*string{
+		"NOTIFICATIONS_DEFAULT_LOCALE":           &c.Notifications.DefaultLocale,
+		"NOTIFICATIONS_LOG_FILE":                 &c.Notifications.LogFile,
+		"NOTIFICATIONS_EMAIL_PROVIDER":           &c.Notifications.Email.Provider,
+		"NOTIFICATIONS_EMAIL_FROM":               &c.Notifications.Email.From,
+		"NOTIFICATIONS_EMAIL_SMTP_HOST":          &c.Notifications.Email.SMTP.Host,
+		"NOTIFICATIONS_EMAIL_SMTP_USERNAME":      &c.Notifications.Email.SMTP.Username,
+		"NOTIFICATIONS_EMAIL_SMTP_PASSWORD":      (*string)(&c.Notifications.Email.SMTP.Password),
+		"NOTIFICATIONS_EMAIL_SMTP_PASSWORD_FILE": &c.Notifications.Email.SMTP.PasswordFile,
+		"NOTIFICATIONS_SMS_PROVIDER":             &c.Notifications.SMS.Provider,
+		"NOTIFICATIONS_SMS_FROM":                 &c.Notifications.SMS.From,
+		"NOTIFICATIONS_SMS_HTTP_URL":             &c.Notifications.SMS.HTTP.URL,
+		"NOTIFICATIONS_SMS_HTTP_TOKEN":           (*string)(&c.Notifications.SMS.HTTP.Token),
+		"NOTIFICATIONS_SMS_HTTP_TOKEN_FILE":      &c.Notifications.SMS.HTTP.TokenFile,
+	} {
+		if v, ok := lookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	if v, ok := lookupEnv("NOTIFICATIONS_EMAIL_SMTP_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%sNOTIFICATIONS_EMAIL_SMTP_PORT: %w", envPrefix, err)
+		}
+		c.Notifications.Email.SMTP.Port = port
+	}
+	for name, dst := range map[string]*int{
+		"WEBHOOKS_MAX_ATTEMPTS":  &c.Webhooks.MaxAttempts,
+		"WEBHOOKS_DISABLE_AFTER": &c.Webhooks.DisableAfter,
+		"GRAPHQL_MAX_DEPTH":      &c.GraphQL.MaxDepth,
+		"GRAPHQL_MAX_COMPLEXITY": &c.GraphQL.MaxComplexity,
+	} {
+		if v, ok := lookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", envPrefix, name, err)
+			}
+			*dst = n
+		}
+	}
+	if v, ok := lookupEnv("WEBHOOKS_ALLOW_HTTP"); ok {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sWEBHOOKS_ALLOW_HTTP: %w", envPrefix, err)
+		}
+		c.Webhooks.AllowHTTP = allow
+	}
+	if v, ok := lookupEnv("WEBHOOKS_ALLOW_PRIVATE"); ok {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sWEBHOOKS_ALLOW_PRIVATE: %w", envPrefix, err)
+		}
+		c.Webhooks.AllowPrivate = allow
+	}
+	for name, dst := range map[string]*bool{
+		"GRPC_ENABLED":             &c.GRPC.Enabled,
+		"GRPC_REFLECTION":          &c.GRPC.Reflection,
+		"ERASURE_REQUIRE_APPROVAL": &c.Erasure.RequireApproval,
+	} {
+		if v, ok := lookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", envPrefix, name, err)
+			}
+			*dst = b
+		}
+	}
+	if v, ok := lookupEnv("GRPC_LISTEN"); ok {
+		c.GRPC.Listen = v
+	}
+	for name, dst := range map[string]*time.Duration{
+		"SCHEDULING_CANCEL_WINDOW":     &c.Scheduling.CancelWindow,
+		"SCHEDULING_RESCHEDULE_WINDOW": &c.Scheduling.RescheduleWindow,
+		"SCHEDULING_HORIZON":           &c.Scheduling.Horizon,
+		"REMINDERS_INTERVAL":           &c.Reminders.Interval,
+		"REMINDERS_LOOKAHEAD":          &c.Reminders.Lookahead,
+		"WEBHOOKS_TIMEOUT":             &c.Webhooks.Timeout,
+		"CHANGES_RETENTION":            &c.Changes.Retention,
+		"USER_EXPORT_EXPIRY":           &c.UserExport.Expiry,
+		"ERASURE_CLINICAL_RETENTION":   &c.Erasure.ClinicalRetention,
+	} {
+		if v, ok := lookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", envPrefix, name, err)
+			}
+			*dst = d
+		}
+	}
+	if v, ok := lookupEnv("TRACING_EXPORTER"); ok {
+		c.Tracing.Exporter = v
+	}
+	if v, ok := lookupEnv("TRACING_ENDPOINT"); ok {
+		c.Tracing.Endpoint = v
+	}
+	if v, ok := lookupEnv("TRACING_FILE"); ok {
+		c.Tracing.File = v
+	}
+	if v, ok := lookupEnv("TRACING_SAMPLE_RATIO"); ok {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%sTRACING_SAMPLE_RATIO: %w", envPrefix, err)
+		}
+		c.Tracing.SampleRatio = ratio
+	}
+	// A secret set inline in the environment outranks a file named in the
+	// config file, which resolveSecrets would otherwise read over it.
+	if _, ok := os.LookupEnv("DATABASE_URL"); ok {
+		dropSecretFile("DATABASE_URL", &c.Database.URLFile)
+	}
+	for name, file := range map[string]*string{
+		"DATABASE_URL":                      &c.Database.URLFile,
+		"STORAGE_S3_SECRET_ACCESS_KEY":      &c.Storage.S3.SecretAccessKeyFile,
+		"NOTIFICATIONS_EMAIL_SMTP_PASSWORD": &c.Notifications.Email.SMTP.PasswordFile,
+		"NOTIFICATIONS_SMS_HTTP_TOKEN":      &c.Notifications.SMS.HTTP.TokenFile,
+	} {
+		if _, ok := lookupEnv(name); ok {
+			dropSecretFile(name, file)
+		}
+	}
+	return nil
+}
+
+// dropSecretFile clears file, the "_file" companion of the secret set by
+// the variable name, unless the environment sets the file too.
+func dropSecretFile(name string, file *string) {
+	if _, ok := lookupEnv(name + "_FILE"); !ok {
+		*file = ""
+	}
+}
+
+func lookupEnv(name string) (string, bool) {
+	return os.LookupEnv(envPrefix + name)
+}
+
+// resolveSecrets replaces secrets with the contents of their "_file"
+// companion when one is set. It runs after the environment, which clears the
+// companions of the secrets it sets inline.
+func (c *Config) resolveSecrets() error {
+	if c.Database.URLFile != "" {
+		s, err := readSecretFile(c.Database.URLFile)
+		if err != nil {
+			return fmt.Errorf("database.url_file: %w", err)
+		}
+		c.Database.URL = s
+	}
+	if c.Notifications.Email.SMTP.PasswordFile != "" {
+		s, err := readSecretFile(c.Notifications.Email.SMTP.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("notifications.email.smtp.password_file: %w", err)
+		}
+		c.Notifications.Email.SMTP.Password = s
+	}
+	if c.Notifications.SMS.HTTP.TokenFile != "" {
+		s, err := readSecretFile(c.Notifications.SMS.HTTP.TokenFile)
+		if err != nil {
+			return fmt.Errorf("notifications.sms.http.token_file: %w", err)
+		}
+		c.Notifications.SMS.HTTP.Token = s
+	}
+	if c.Storage.S3.SecretAccessKeyFile != "" {
+		s, err := readSecretFile(c.Storage.S3.SecretAccessKeyFile)
+		if err != nil {
+			return fmt.Errorf("storage.s3.secret_access_key_file: %w", err)
+		}
+		c.Storage.S3.SecretAccessKey = s
+	}
+	return nil
+}
+
+// Validate reports every invalid setting in c.
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port %d is out of range", c.Server.Port))
+	}
+	switch c.Server.Mode {
+	case "debug", "release", "test":
+	default:
+		problems = append(problems, fmt.Sprintf("server.mode %q must be debug, release or test", c.Server.Mode))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 {
+		problems = append(problems, "server.read_header_timeout must be positive")
+	}
+	if c.Server.ReadTimeout <= 0 {
+		problems = append(problems, "server.read_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		problems = append(problems, "server.drain_delay must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				problems = append(problems, fmt.Sprintf("server.trusted_proxies: %q is not an IP address or CIDR range", p))
+			}
+		}
+	}
+	if c.Database.URL == "" {
+		problems = append(problems, "database.url is required (set DATABASE_URL or database.url_file)")
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		problems = append(problems, "database.connect_timeout must be positive")
+	}
+	if c.NLP.Enabled && c.NLP.CredentialsFile == "" {
+		problems = append(problems, "nlp.credentials_file is required when nlp.enabled is set")
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			problems = append(problems, "tracing.file is required when tracing.exporter is file")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q must be none, otlp, stdout or file", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+	switch c.RateLimit.Store {
+	case "memory", "postgres":
+	default:
+		problems = append(problems, fmt.Sprintf("rate_limit.store %q must be memory or postgres", c.RateLimit.Store))
+	}
+	for name, r := range c.RateLimit.Groups {
+		if r.Rate <= 0 || r.Burst < 1 {
+			problems = append(problems, fmt.Sprintf("rate_limit.groups.%s needs a positive rate and burst", name))
+		}
+	}
+	if c.Idempotency.Window <= 0 {
+		problems = append(problems, "idempotency.window must be positive")
+	}
+	if c.Encryption.Provider != "local" {
+		problems = append(problems, fmt.Sprintf("encryption.provider %q must be local", c.Encryption.Provider))
+	}
+	if c.Encryption.KeyFile == "" {
+		problems = append(problems, "encryption.key_file is required")
+	}
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.Dir == "" {
+			problems = append(problems, "storage.dir is required when storage.backend is local")
+		}
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			problems = append(problems, "storage.s3.endpoint and storage.s3.bucket are required when storage.backend is s3")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend %q must be local or s3", c.Storage.Backend))
+	}
+	if c.BulkExport.Retention <= 0 {
+		problems = append(problems, "bulk_export.retention must be positive")
+	}
+	if c.HL7.Enabled {
+		if c.HL7.Listen == "" {
+			problems = append(problems, "hl7.listen is required when hl7.enabled is set")
+		}
+		if c.HL7.IdleTimeout <= 0 {
+			problems = append(problems, "hl7.idle_timeout must be positive")
+		}
+		for name, id := range c.HL7.Facilities {
+			if id <= 0 {
+				problems = append(problems, fmt.Sprintf("hl7.facilities.%s must be a clinic ID", name))
+			}
+		}
+		for name, paths := range c.HL7.Mapping.paths() {
+			if len(paths) == 0 {
+				problems = append(problems, fmt.Sprintf("hl7.mapping.%s is required", name))
+			}
+			for _, p := range paths {
+				if !hl7Path.MatchString(p) {
+					problems = append(problems, fmt.Sprintf("hl7.mapping.%s: %q is not a path such as PID-5.1", name, p))
+				}
+			}
+		}
+	}
+	if c.Scheduling.CancelWindow < 0 {
+		problems = append(problems, "scheduling.cancel_window must not be negative")
+	}
+	if c.Scheduling.RescheduleWindow < 0 {
+		problems = append(problems, "scheduling.reschedule_window must not be negative")
+	}
+	if c.Scheduling.Horizon <= 0 {
+		problems = append(problems, "scheduling.horizon must be positive")
+	}
+	if c.Reminders.Interval <= 0 {
+		problems = append(problems, "reminders.interval must be positive")
+	}
+	if c.Reminders.Lookahead < c.Reminders.Interval {
+		problems = append(problems, "reminders.lookahead must be at least reminders.interval")
+	}
+	n := c.Notifications
+	if n.DefaultLocale == "" {
+		problems = append(problems, "notifications.default_locale is required")
+	}
+	if n.MaxAttempts < 1 {
+		problems = append(problems, "notifications.max_attempts must be at least 1")
+	}
+	switch n.Email.Provider {
+	case "none", "log":
+	case "smtp":
+		if n.Email.SMTP.Host == "" || n.Email.SMTP.Port <= 0 {
+			problems = append(problems, "notifications.email.smtp.host and port are required when notifications.email.provider is smtp")
+		}
+		if _, err := mail.ParseAddress(n.Email.From); err != nil {
+			problems = append(problems, fmt.Sprintf("notifications.email.from: %v", err))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("notifications.email.provider %q must be smtp, log or none", n.Email.Provider))
+	}
+	switch n.SMS.Provider {
+	case "none", "log":
+	case "http":
+		if u, err := url.Parse(n.SMS.HTTP.URL); err != nil || u.Host == "" {
+			problems = append(problems, "notifications.sms.http.url must be a URL when notifications.sms.provider is http")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("notifications.sms.provider %q must be http, log or none", n.SMS.Provider))
+	}
+	if (n.Email.Provider == "log" || n.SMS.Provider == "log") && n.LogFile == "" {
+		problems = append(problems, "notifications.log_file is required by the log provider")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, "webhooks.max_attempts must be at least 1")
+	}
+	if c.Webhooks.DisableAfter < 1 {
+		problems = append(problems, "webhooks.disable_after must be at least 1")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		problems = append(problems, "webhooks.timeout must be positive")
+	}
+	if c.Changes.Retention <= 0 {
+		problems = append(problems, "changes.retention must be positive")
+	}
+	if c.GraphQL.MaxDepth < 1 {
+		problems = append(problems, "graphql.max_depth must be at least 1")
+	}
+	if c.GraphQL.MaxComplexity < 1 {
+		problems = append(problems, "graphql.max_complexity must be at least 1")
+	}
+	if c.GRPC.Enabled && c.GRPC.Listen == "" {
+		problems = append(problems, "grpc.listen is required when grpc.enabled is set")
+	}
+	if c.UserExport.Expiry <= 0 {
+		problems = append(problems, "user_export.expiry must be positive")
+	}
+	if u, err := url.Parse(c.UserExport.PublicURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		problems = append(problems, "user_export.public_url must be an http or https URL")
+	}
+	if c.Erasure.ClinicalRetention < 0 {
+		problems = append(problems, "erasure.clinical_retention must not be negative")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// hl7Path matches HL7 v2 paths such as "PID-5.1".
+var hl7Path = regexp.MustCompile(`^[A-Z][A-Z0-9]{2}-[1-9][0-9]*(\.[1-9][0-9]*){0,2}$`)
+
+// Redacted returns c as YAML with every secret masked.
+func (c *Config) Redacted() ([]byte, error) {
+	return yaml.Marshal(c)
+}
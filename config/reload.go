@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// Manager holds the current configuration and reloads it on SIGHUP.
+//
+// Only settings that are safe to change on a running process are applied
+// on reload (see copyReloadable); changes to any other setting are logged
+// and take effect at the next restart.
+type Manager struct {
+	opts Options
+
+	mu       sync.RWMutex
+	current  *Config
+	onReload []func(*Config)
+}
+
+// NewManager creates a Manager for cfg, which must have been returned by
+// Load together with opts.
+func NewManager(cfg *Config, opts Options) *Manager {
+	return &Manager{opts: opts, current: cfg}
+}
+
+// Current returns the configuration in effect. Callers must not modify it.
+func (m *Manager) Current() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// OnReload registers fn to be called with the new configuration after every
+// successful reload.
+func (m *Manager) OnReload(fn func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReload = append(m.onReload, fn)
+}
+
+// Reload re-reads every configuration source and applies the reloadable
+// settings. The current configuration is kept if the new one is invalid.
+func (m *Manager) Reload() error {
+	next, err := load(m.opts.ConfigFile, m.opts.applyFlags)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	merged := *m.current
+	copyReloadable(&merged, next)
+
+	probe := *next
+	copyReloadable(&probe, m.current)
+	if !reflect.DeepEqual(probe, *m.current) {
+		log.Printf("config: some changed settings are not reloadable and need a restart")
+	}
+
+	m.current = &merged
+	subscribers := append([]func(*Config){}, m.onReload...)
+	m.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(&merged)
+	}
+	return nil
+}
+
+// WatchSignals reloads the configuration every time the process receives
+// SIGHUP, until ctx is done.
+func (m *Manager) WatchSignals(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				if err := m.Reload(); err != nil {
+					log.Printf("config: reload failed, keeping current configuration: %v", err)
+				} else {
+					log.Printf("config: reloaded")
+				}
+			}
+		}
+	}()
+}
+
+// copyReloadable copies the settings that can change at runtime from src
+// to dst.
+func copyReloadable(dst, src *Config) {
+	dst.Log = src.Log
+	dst.RateLimit.Enabled = src.RateLimit.Enabled
+	dst.RateLimit.Groups = src.RateLimit.Groups
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/nlp_processor"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errNoSharingConsent refuses a clinic the record of a user of another
+// clinic who does not consent to sharing it.
+var errNoSharingConsent = errors.New("no clinic-sharing consent")
+
+// nlpGrantee is the grantee of the consents that allow sending notes to
+// the language API.
+const nlpGrantee = "google-cloud-language"
+
+// consentScopes are the scopes consents can be given for, and whether
+// they need a grantee.
+var consentScopes = map[string]bool{
+	ConsentClinicSharing:   true,
+	ConsentCloudProcessing: true,
+	ConsentResearch:        false,
+}
+
+// validateConsent checks the scope, grantee and period of a consent.
+func validateConsent(c *Consent) error {
+	needsGrantee, ok := consentScopes[c.Scope]
+	if !ok {
+		return fmt.Errorf("unknown scope %q", c.Scope)
+	}
+	if needsGrantee && c.Grantee == "" {
+		return fmt.Errorf("grantee is required for scope %s", c.Scope)
+	}
+	if c.ValidUntil != nil && !c.ValidUntil.After(c.ValidFrom) {
+		return errors.New("validUntil must be after validFrom")
+	}
+	return nil
+}
+
+// consentGiven reports whether user userID consents at time at to scope
+// for grantee, through a consent for grantee or for any grantee.
+func consentGiven(db *gorm.DB, userID int, scope, grantee string, at time.Time) (bool, error) {
+	var n int64
+	err := consenting(db, scope, grantee, at).Where("user_id = ?", userID).Count(&n).Error
+	return n > 0, err
+}
+
+// consenting selects the consents at time at to scope for grantee, of
+// every user of the tenant of db. Selecting user_id, it is a subquery of
+// the users who consent.
+func consenting(db *gorm.DB, scope, grantee string, at time.Time) *gorm.DB {
+	return db.Model(&Consent{}).
+		Where("scope = ? AND (grantee = ? OR grantee = '')", scope, grantee).
+		Where("valid_from <= ? AND (valid_until IS NULL OR valid_until > ?) AND revoked_at IS NULL", at, at)
+}
+
+// requireConsent is an enforcement hook for code that is handed a
+// context rather than a database handle, such as the NLP client: it
+// checks the consent of a user of the tenant of ctx to scope for
+// grantee, returning refused if there is none.
+func requireConsent(tenancy *tenant.Resolver, scope, grantee string, refused error) func(ctx context.Context, userID int) error {
+	return func(ctx context.Context, userID int) error {
+		tenantID, ok := tenant.FromContext(ctx)
+		if !ok {
+			return tenant.ErrMissing
+		}
+		return tenancy.Run(ctx, tenantID, func(db *gorm.DB) error {
+			given, err := consentGiven(db, userID, scope, grantee, time.Now())
+			if err != nil {
+				return err
+			}
+			if !given {
+				return refused
+			}
+			return nil
+		})
+	}
+}
+
+// requireNLPConsent is the consent hook of the NLP client.
+func requireNLPConsent(tenancy *tenant.Resolver) nlp_processor.ConsentFunc {
+	return requireConsent(tenancy, ConsentCloudProcessing, nlpGrantee, nlp_processor.ErrNoConsent)
+}
+
+// ----------------------------  Consent Server Methods ---------------------------------//
+
+// getConsents lists the consents of a user, including expired and
+// revoked ones.
+func (s *Server) getConsents(c *gin.Context) {
+	var consents []Consent
+	if err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("id").Find(&consents).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, consents)
+}
+
+// createConsent records a consent of a user, valid from now unless
+// validFrom says otherwise.
+func (s *Server) createConsent(c *gin.Context) {
+	var consent Consent
+	if err := BindJSON(c, &consent); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if consent.ValidFrom.IsZero() {
+		consent.ValidFrom = time.Now()
+	}
+	if err := validateConsent(&consent); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	consent.ID, consent.UserID, consent.RevokedAt, consent.RevocationReason = 0, userID, nil, ""
+	if err := s.dbFor(c).Create(&consent).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, consent)
+}
+
+// revokeConsent revokes a consent from now on.
+func (s *Server) revokeConsent(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional, and so is the body.
+	if c.Request.ContentLength != 0 {
+		if err := BindJSON(c, &body); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return
+		}
+	}
+
+	var consent Consent
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&consent, "id = ? AND user_id = ?", c.Param("consentID"), c.Param("userID")).Error
+		if err != nil {
+			return err
+		}
+		if consent.RevokedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		consent.RevokedAt, consent.RevocationReason = &now, body.Reason
+		return tx.Model(&consent).Select("revoked_at", "revocation_reason").Updates(&consent).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, consent)
+}
+
+// checkConsent reports whether a user consents now to the scope and
+// grantee of the query, for partner systems that enforce consents
+// themselves.
+func (s *Server) checkConsent(c *gin.Context) {
+	scope, grantee := c.Query("scope"), c.Query("grantee")
+	if _, ok := consentScopes[scope]; !ok {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: unknown scope %q", scope))
+		return
+	}
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	given, err := consentGiven(s.dbFor(c), userID, scope, grantee, time.Now())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"userId": userID, "scope": scope, "grantee": grantee, "granted": given})
+}
+
+// getSharedUser serves the record of a user of another clinic to the
+// clinic of the request, if the user consents to sharing it with that
+// clinic. Without consent the answer is the same whether or not the user
+// exists. The access is logged by the clinic of the user.
+func (s *Server) getSharedUser(c *gin.Context) {
+	ownerID, err := strconv.Atoi(c.Param("clinicID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	clinicID, _ := tenant.FromContext(c.Request.Context())
+
+	var user User
+	err = s.tenancy.Run(c.Request.Context(), ownerID, func(db *gorm.DB) error {
+		given, err := consentGiven(db, userID, ConsentClinicSharing, strconv.Itoa(clinicID), time.Now())
+		if err != nil {
+			return err
+		}
+		if !given && ownerID != clinicID {
+			return errNoSharingConsent
+		}
+		if err := db.Take(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		access := requestAccess(c, c.FullPath())
+		access.Status, access.ClinicID = http.StatusOK, clinicID
+		recordAccess(db, access, user.ID)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errNoSharingConsent):
+		c.String(http.StatusForbidden, "error: the user does not consent to sharing their record with this clinic")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.String(http.StatusNotFound, "error: record not found")
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"medically-core/config"
+	"medically-core/logging"
+	"medically-core/tenant"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// models lists every model managed by AutoMigrate.
+var models = []interface{}{&User{}, &Disease{}, &Med{}, &Clinic{}, &PatientIdentifier{}, &Observation{}, &Clinician{}, &Schedule{}, &Appointment{}, &OpeningHours{}, &Holiday{}, &ClinicService{}, &Prescription{}, &Dose{}, &Reminder{}, &Diagnosis{}, &RecordAccess{}, &ErasureRequest{}, &LegalHold{}, &Consent{}, &UserMerge{}, &DuplicateDismissal{}, &CatalogMerge{}, &CatalogDismissal{}}
+
+// tenantOwned lists the models owned by a clinic.
+var tenantOwned = []interface{}{&User{}, &PatientIdentifier{}, &Observation{}, &Clinician{}, &Schedule{}, &Appointment{}, &Prescription{}, &Dose{}, &Reminder{}, &Diagnosis{}, &RecordAccess{}, &ErasureRequest{}, &LegalHold{}, &Consent{}, &UserMerge{}, &DuplicateDismissal{}}
+
+// connectDB opens the database, retrying with exponential backoff until
+// cfg.ConnectTimeout elapses or ctx is done, so the service survives the
+// database starting after it (as with docker-compose).
+func connectDB(ctx context.Context, cfg config.DatabaseConfig) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		db, err := gorm.Open(postgres.Open(cfg.URL.Value()), &gorm.Config{
+			Logger: logging.NewGormLogger(),
+		})
+		if err == nil {
+			return db, nil
+		}
+		log.Printf("database: connection attempt %d failed, retrying in %s: %v", attempt, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+}
+
+// migrate brings the schema up to date and, if rls is set, installs the
+// row-level security policies of tenant-owned tables.
+func migrate(db *gorm.DB, rls bool) error {
+	if err := db.AutoMigrate(models...); err != nil {
+		return err
+	}
+	if rls {
+		return tenant.InstallRLS(db, tenantOwned...)
+	}
+	return nil
+}
+
+// pingDB is the readiness check of the database connection.
+func pingDB(db *gorm.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// checkMigrations is the readiness check of the schema: every migrated
+// table must exist.
+func checkMigrations(db *gorm.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		migrator := db.WithContext(ctx).Migrator()
+		for _, m := range models {
+			if !migrator.HasTable(m) {
+				return fmt.Errorf("table for %T is missing", m)
+			}
+		}
+		return nil
+	}
+}
+
+// serializationRetries bounds how often serializable runs a transaction
+// that the database aborted.
+const serializationRetries = 5
+
+// serializable runs fn in a serializable transaction. The database aborts
+// one of two concurrent transactions whose reads and writes conflict,
+// such as two bookings of the same slot; the aborted one is run again so
+// it sees the other's writes.
+func serializable(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		var pgErr *pgconn.PgError
+		if attempt < serializationRetries && errors.As(err, &pgErr) && pgErr.Code == "40001" {
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,64 @@
+// Package dataloader batches the loads of a request by key, so that
+// resolving a field of every item of a list takes one query instead of
+// one per item.
+//
+// Load records a key and returns a thunk. The first thunk called fetches
+// every key recorded since the last fetch at once; executors that call
+// thunks breadth-first, such as graphql-go's, thereby fetch each level of
+// a query in one batch. Loaders cache what they fetched and are meant to
+// live for one request.
+package dataloader
+
+import "sync"
+
+// Fetch returns the values of keys. Keys without a value may be left out.
+type Fetch func(keys []int) (map[int]interface{}, error)
+
+// Loader batches and caches the loads of one kind of value.
+type Loader struct {
+	fetch Fetch
+
+	mu    sync.Mutex
+	batch *batch
+	cache map[int]*batch
+}
+
+type batch struct {
+	keys   []int
+	once   sync.Once
+	values map[int]interface{}
+	err    error
+}
+
+// New creates a Loader that fetches with fetch.
+func New(fetch Fetch) *Loader {
+	return &Loader{fetch: fetch, cache: make(map[int]*batch)}
+}
+
+// Load returns a thunk that returns the value of key, or nil if it has
+// none.
+func (l *Loader) Load(key int) func() (interface{}, error) {
+	l.mu.Lock()
+	b, ok := l.cache[key]
+	if !ok {
+		if l.batch == nil {
+			l.batch = &batch{}
+		}
+		b = l.batch
+		b.keys = append(b.keys, key)
+		l.cache[key] = b
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		b.once.Do(func() {
+			l.mu.Lock()
+			if l.batch == b {
+				l.batch = nil
+			}
+			l.mu.Unlock()
+			b.values, b.err = l.fetch(b.keys)
+		})
+		return b.values[key], b.err
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ----------------------------  Diagnosis Server Methods ---------------------------------//
+
+func (s *Server) getDiagnoses(c *gin.Context) {
+	var diagnoses []Diagnosis
+	err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("diagnosed_on, id").Find(&diagnoses).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diagnoses)
+}
+
+// createDiagnosis records that a user was diagnosed with a disease, today
+// unless diagnosedOn is given.
+func (s *Server) createDiagnosis(c *gin.Context) {
+	var diagnosis Diagnosis
+	if err := BindJSON(c, &diagnosis); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if diagnosis.DiagnosedOn == "" {
+		diagnosis.DiagnosedOn = time.Now().UTC().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", diagnosis.DiagnosedOn); err != nil {
+		c.String(http.StatusBadRequest, "error: diagnosedOn must be written as YYYY-MM-DD")
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	diagnosis.UserID = userID
+
+	db := s.dbFor(c)
+	var n int64
+	if err := db.Model(&User{}).Where("id = ?", userID).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	// A disease merged into another is diagnosed as the one it was
+	// merged into.
+	diagnosis.DiseaseID, err = resolveCatalogID(db, diseaseCatalog, diagnosis.DiseaseID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if err := db.Model(&Disease{}).Where("id = ?", diagnosis.DiseaseID).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n == 0 {
+		c.String(http.StatusUnprocessableEntity, "error: unknown disease")
+		return
+	}
+
+	if err := db.Create(&diagnosis).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diagnosis)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
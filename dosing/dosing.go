@@ -0,0 +1,150 @@
+// Package dosing derives when the doses of a prescribed medication are
+// due and measures how closely a patient keeps to it.
+package dosing
+
+import (
+	"sort"
+	"time"
+
+	"medically-core/scheduling"
+)
+
+// waking is the part of the day over which doses are spread by default.
+var (
+	firstDose = scheduling.Clock{Hour: 8}
+	lastDose  = scheduling.Clock{Hour: 22}
+)
+
+// DefaultTimes returns the times of day of n doses a day: one in the
+// morning, two twelve hours apart, or else spread evenly from 08:00 to
+// 22:00.
+func DefaultTimes(n int) []scheduling.Clock {
+	switch {
+	case n <= 0:
+		return nil
+	case n == 1:
+		return []scheduling.Clock{firstDose}
+	case n == 2:
+		return []scheduling.Clock{firstDose, {Hour: 20}}
+	}
+	start := firstDose.Hour * 60
+	span := lastDose.Hour*60 - start
+	times := make([]scheduling.Clock, n)
+	for i := range times {
+		m := start + span*i/(n-1)
+		times[i] = scheduling.Clock{Hour: m / 60, Minute: m % 60}
+	}
+	return times
+}
+
+// Regimen is when the doses of a medication are due: at Times every day
+// from Start for Days days, or with no end if Days is 0, until Stop if it
+// is set. Start is a date in Location.
+type Regimen struct {
+	Times    []scheduling.Clock
+	Start    time.Time
+	Days     int
+	Stop     time.Time
+	Location *time.Location
+}
+
+// end returns when the regimen ends, or the zero time if it does not.
+func (r Regimen) end() time.Time {
+	var end time.Time
+	if r.Days > 0 {
+		y, m, d := r.Start.Date()
+		end = time.Date(y, m, d+r.Days, 0, 0, 0, 0, r.Location)
+	}
+	if !r.Stop.IsZero() && (end.IsZero() || r.Stop.Before(end)) {
+		end = r.Stop
+	}
+	return end
+}
+
+// Due returns the times doses are due in [from, to), in order.
+func (r Regimen) Due(from, to time.Time) []time.Time {
+	if end := r.end(); !end.IsZero() && end.Before(to) {
+		to = end
+	}
+	y, m, d := r.Start.Date()
+	first := time.Date(y, m, d, 0, 0, 0, 0, r.Location)
+	day := from.In(r.Location)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, r.Location)
+	if day.Before(first) {
+		day = first
+	}
+	var due []time.Time
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		y, m, d := day.Date()
+		for _, c := range r.Times {
+			t := time.Date(y, m, d, c.Hour, c.Minute, 0, 0, r.Location)
+			if !t.Before(from) && t.Before(to) {
+				due = append(due, t)
+			}
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Before(due[j]) })
+	return due
+}
+
+// Nearest returns the due time nearest to t, within a day of it.
+func (r Regimen) Nearest(t time.Time) (time.Time, bool) {
+	var best time.Time
+	for _, due := range r.Due(t.Add(-24*time.Hour), t.Add(24*time.Hour)) {
+		if best.IsZero() || abs(due.Sub(t)) < abs(best.Sub(t)) {
+			best = due
+		}
+	}
+	return best, !best.IsZero()
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Day counts the doses due on a date and those of them taken.
+type Day struct {
+	Due, Taken int
+}
+
+// Covered reports whether every dose due on the day was taken.
+func (d Day) Covered() bool {
+	return d.Taken >= d.Due
+}
+
+// Count adds the doses of r due in [from, to) to days, keyed by their
+// date in r's location. taken reports whether the dose due at a time was
+// taken.
+func (r Regimen) Count(days map[string]*Day, from, to time.Time, taken func(due time.Time) bool) {
+	for _, due := range r.Due(from, to) {
+		date := due.In(r.Location).Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &Day{}
+			days[date] = day
+		}
+		day.Due++
+		if taken(due) {
+			day.Taken++
+		}
+	}
+}
+
+// PDC returns the proportion of days covered: the share of the days on
+// which doses were due that every dose was taken. It is 0 if no dose was
+// due.
+func PDC(days map[string]*Day) float64 {
+	if len(days) == 0 {
+		return 0
+	}
+	covered := 0
+	for _, d := range days {
+		if d.Covered() {
+			covered++
+		}
+	}
+	return float64(covered) / float64(len(days))
+}
@@ -0,0 +1,162 @@
+package dosing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"medically-core/scheduling"
+)
+
+func TestDefaultTimes(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{0, nil},
+		{1, []string{"08:00"}},
+		{2, []string{"08:00", "20:00"}},
+		{3, []string{"08:00", "15:00", "22:00"}},
+		{4, []string{"08:00", "12:40", "17:20", "22:00"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range DefaultTimes(tt.n) {
+			got = append(got, c.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DefaultTimes(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func date(y int, m time.Month, d, h, min int, loc *time.Location) time.Time {
+	return time.Date(y, m, d, h, min, 0, 0, loc)
+}
+
+func TestDue(t *testing.T) {
+	loc := time.UTC
+	twice := []scheduling.Clock{{Hour: 20}, {Hour: 8}}
+	tests := []struct {
+		name     string
+		r        Regimen
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name: "in order within the window",
+			r:    Regimen{Times: twice, Start: date(2024, 1, 1, 0, 0, loc), Location: loc},
+			from: date(2024, 1, 1, 12, 0, loc),
+			to:   date(2024, 1, 3, 8, 0, loc),
+			want: []time.Time{date(2024, 1, 1, 20, 0, loc), date(2024, 1, 2, 8, 0, loc), date(2024, 1, 2, 20, 0, loc)},
+		},
+		{
+			name: "not before the start",
+			r:    Regimen{Times: twice, Start: date(2024, 1, 2, 0, 0, loc), Location: loc},
+			from: date(2024, 1, 1, 0, 0, loc),
+			to:   date(2024, 1, 3, 0, 0, loc),
+			want: []time.Time{date(2024, 1, 2, 8, 0, loc), date(2024, 1, 2, 20, 0, loc)},
+		},
+		{
+			name: "for a number of days",
+			r:    Regimen{Times: twice, Start: date(2024, 1, 1, 0, 0, loc), Days: 1, Location: loc},
+			from: date(2024, 1, 1, 0, 0, loc),
+			to:   date(2024, 1, 5, 0, 0, loc),
+			want: []time.Time{date(2024, 1, 1, 8, 0, loc), date(2024, 1, 1, 20, 0, loc)},
+		},
+		{
+			name: "until stopped",
+			r:    Regimen{Times: twice, Start: date(2024, 1, 1, 0, 0, loc), Days: 10, Stop: date(2024, 1, 2, 12, 0, loc), Location: loc},
+			from: date(2024, 1, 1, 0, 0, loc),
+			to:   date(2024, 1, 5, 0, 0, loc),
+			want: []time.Time{date(2024, 1, 1, 8, 0, loc), date(2024, 1, 1, 20, 0, loc), date(2024, 1, 2, 8, 0, loc)},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Due(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Due = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDueAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	// Clocks go forward at 02:00 on 31 March 2024; doses stay at 08:00
+	// local time.
+	r := Regimen{Times: []scheduling.Clock{{Hour: 8}}, Start: date(2024, 3, 30, 0, 0, loc), Location: loc}
+	due := r.Due(date(2024, 3, 30, 0, 0, loc), date(2024, 4, 1, 0, 0, loc))
+	if len(due) != 2 {
+		t.Fatalf("Due = %v, want 2 doses", due)
+	}
+	for _, d := range due {
+		if d.Hour() != 8 {
+			t.Errorf("dose due at %v, want 08:00", d)
+		}
+	}
+	if gap := due[1].Sub(due[0]); gap != 23*time.Hour {
+		t.Errorf("doses are %v apart, want 23h", gap)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	loc := time.UTC
+	r := Regimen{Times: DefaultTimes(2), Start: date(2024, 1, 1, 0, 0, loc), Days: 2, Location: loc}
+	tests := []struct {
+		at   time.Time
+		want time.Time
+		ok   bool
+	}{
+		{date(2024, 1, 1, 9, 0, loc), date(2024, 1, 1, 8, 0, loc), true},
+		{date(2024, 1, 1, 15, 0, loc), date(2024, 1, 1, 20, 0, loc), true},
+		{date(2024, 1, 2, 1, 0, loc), date(2024, 1, 1, 20, 0, loc), true},
+		{date(2024, 1, 4, 12, 0, loc), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := r.Nearest(tt.at)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("Nearest(%v) = %v, %v, want %v, %v", tt.at, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCountAndPDC(t *testing.T) {
+	loc := time.UTC
+	r := Regimen{Times: DefaultTimes(2), Start: date(2024, 1, 1, 0, 0, loc), Location: loc}
+	// Every dose is taken except the evening dose of 2 January.
+	missed := date(2024, 1, 2, 20, 0, loc)
+	days := map[string]*Day{}
+	r.Count(days, date(2024, 1, 1, 0, 0, loc), date(2024, 1, 5, 0, 0, loc), func(due time.Time) bool {
+		return !due.Equal(missed)
+	})
+
+	want := map[string]*Day{
+		"2024-01-01": {Due: 2, Taken: 2},
+		"2024-01-02": {Due: 2, Taken: 1},
+		"2024-01-03": {Due: 2, Taken: 2},
+		"2024-01-04": {Due: 2, Taken: 2},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("Count = %v, want %v", days, want)
+	}
+	if got := PDC(days); got != 0.75 {
+		t.Errorf("PDC = %v, want 0.75", got)
+	}
+
+	// A second regimen on the same days must be kept to as well.
+	other := Regimen{Times: DefaultTimes(1), Start: date(2024, 1, 1, 0, 0, loc), Location: loc}
+	other.Count(days, date(2024, 1, 1, 0, 0, loc), date(2024, 1, 5, 0, 0, loc), func(due time.Time) bool {
+		return due.Day() != 3
+	})
+	if got := PDC(days); got != 0.5 {
+		t.Errorf("PDC of both = %v, want 0.5", got)
+	}
+}
+
+func TestPDCWithoutDoses(t *testing.T) {
+	if got := PDC(map[string]*Day{}); got != 0 {
+		t.Errorf("PDC = %v, want 0", got)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"medically-core/changefeed"
+	"medically-core/hl7"
+	"medically-core/mpi"
+	"medically-core/notifications"
+	"medically-core/userexport"
+	"medically-core/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// duplicateScore is the least score of the pairs in the review queue,
+// unless the minScore query parameter says otherwise.
+const duplicateScore = 0.5
+
+// duplicateBatch is how many users are read at a time when searching for
+// duplicates.
+const duplicateBatch = 500
+
+// userRecords are the models that refer to a user, which a merge moves
+// to the surviving user. Every model with a UserID belongs here.
+var userRecords = []struct {
+	typ   string
+	model interface{}
+}{
+	{"patient_identifiers", &PatientIdentifier{}},
+	{"observations", &Observation{}},
+	{"appointments", &Appointment{}},
+	{"prescriptions", &Prescription{}},
+	{"doses", &Dose{}},
+	{"reminders", &Reminder{}},
+	{"diagnoses", &Diagnosis{}},
+	{"hl7_messages", &hl7.StoredMessage{}},
+	{"notifications", &notifications.Delivery{}},
+	{"notification_preferences", &notifications.Preferences{}},
+	{"webhook_deliveries", &webhooks.Delivery{}},
+	{"consents", &Consent{}},
+	{"legal_holds", &LegalHold{}},
+	{"erasure_requests", &ErasureRequest{}},
+	{"user_exports", &userexport.Export{}},
+	{"record_accesses", &RecordAccess{}},
+}
+
+// validateUser checks the date of birth of a user.
+func validateUser(u *User) error {
+	if u.BirthDate == nil {
+		return nil
+	}
+	born, err := time.Parse("2006-01-02", *u.BirthDate)
+	if err != nil {
+		return errors.New("birthDate must be a date as 2006-01-02")
+	}
+	if born.After(time.Now()) {
+		return errors.New("birthDate must not be in the future")
+	}
+	return nil
+}
+
+// matchRecord returns what user u is matched on.
+func matchRecord(u *User) mpi.Record {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return mpi.Record{ID: u.ID, Name: value(u.Name), Email: value(u.Email), Contact: value(u.Contact), BirthDate: value(u.BirthDate)}
+}
+
+// duplicateCandidate is a pair of users in the review queue. User is the
+// older record, which a merge of the pair would keep.
+type duplicateCandidate struct {
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+	User      *User    `json:"user"`
+	Duplicate *User    `json:"duplicate"`
+}
+
+// findDuplicates returns the pairs of users on db that score at least
+// min, best first. Erased users and dismissed pairs are left out.
+func findDuplicates(db *gorm.DB, min float64) ([]duplicateCandidate, error) {
+	users := map[int]*User{}
+	var records []mpi.Record
+	var batch []User
+	err := db.Where("NOT EXISTS (SELECT 1 FROM erasure_requests WHERE erasure_requests.user_id = users.id AND erasure_requests.status = ?)", ErasureCompleted).
+		FindInBatches(&batch, duplicateBatch, func(*gorm.DB, int) error {
+			for i := range batch {
+				u := batch[i]
+				users[u.ID] = &u
+				records = append(records, matchRecord(&u))
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var dismissals []DuplicateDismissal
+	if err := db.Find(&dismissals).Error; err != nil {
+		return nil, err
+	}
+	dismissed := map[[2]int]bool{}
+	for _, d := range dismissals {
+		dismissed[[2]int{d.UserID, d.OtherID}] = true
+	}
+
+	candidates := []duplicateCandidate{}
+	for _, m := range mpi.Find(records, min) {
+		if dismissed[[2]int{m.ID, m.OtherID}] {
+			continue
+		}
+		candidates = append(candidates, duplicateCandidate{Score: m.Score, Reasons: m.Reasons, User: users[m.ID], Duplicate: users[m.OtherID]})
+	}
+	return candidates, nil
+}
+
+// mergeError refuses a merge for a reason the client can act on, with
+// the status to answer.
+type mergeError struct {
+	status int
+	msg    string
+}
+
+func (e *mergeError) Error() string { return e.msg }
+
+func mergeFailed(c *gin.Context, err error) {
+	var refused *mergeError
+	if errors.As(err, &refused) {
+		c.String(refused.status, "error: "+refused.msg)
+		return
+	}
+	internalError(c, err)
+}
+
+// mergeUsers merges user retiredID into user survivorID on tx: the
+// records of the retired user move to the survivor, which takes its date
+// of birth if it has none, and the retired user is deleted, leaving a
+// redirect to the survivor and change feed snapshots holding only its ID.
+func (s *Server) mergeUsers(tx *gorm.DB, survivorID, retiredID int, mergedBy string) (*UserMerge, error) {
+	var users []User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", []int{survivorID, retiredID}).Order("id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != 2 {
+		var earlier UserMerge
+		if err := tx.Where("retired_id = ?", retiredID).Limit(1).Find(&earlier).Error; err != nil {
+			return nil, err
+		}
+		if earlier.ID != 0 {
+			return nil, &mergeError{http.StatusConflict, fmt.Sprintf("user %d was already merged into user %d", retiredID, earlier.SurvivorID)}
+		}
+		return nil, &mergeError{http.StatusNotFound, "record not found"}
+	}
+	survivor, retired := &users[0], &users[1]
+	if survivor.ID != survivorID {
+		survivor, retired = retired, survivor
+	}
+
+	var erasures int64
+	err = tx.Model(&ErasureRequest{}).Where("user_id IN ? AND status IN ?", []int{survivorID, retiredID}, []string{ErasurePending, ErasureCompleted}).
+		Count(&erasures).Error
+	if err != nil {
+		return nil, err
+	}
+	if erasures > 0 {
+		return nil, &mergeError{http.StatusConflict, "users with a pending or completed erasure cannot be merged"}
+	}
+
+	score, _ := mpi.Score(matchRecord(survivor), matchRecord(retired))
+	merge := UserMerge{RetiredID: retiredID, SurvivorID: survivorID, MergedBy: mergedBy, Score: &score, Moved: map[string]int64{}}
+
+	// A user has one set of notification preferences; the survivor's win.
+	var prefs int64
+	if err := tx.Model(&notifications.Preferences{}).Where("user_id = ?", survivorID).Count(&prefs).Error; err != nil {
+		return nil, err
+	}
+	if prefs > 0 {
+		if err := tx.Where("user_id = ?", retiredID).Delete(&notifications.Preferences{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range userRecords {
+		res := tx.Model(m.model).Where("user_id = ?", retiredID).Update("user_id", survivorID)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		merge.Moved[m.typ] = res.RowsAffected
+	}
+
+	// Users merged into the retired user before now redirect to the
+	// survivor, and pairs with the retired user leave the review queue.
+	if err := tx.Model(&UserMerge{}).Where("survivor_id = ?", retiredID).Update("survivor_id", survivorID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ? OR other_id = ?", retiredID, retiredID).Delete(&DuplicateDismissal{}).Error; err != nil {
+		return nil, err
+	}
+
+	if survivor.BirthDate == nil && retired.BirthDate != nil {
+		survivor.BirthDate = retired.BirthDate
+		if err := tx.Save(survivor).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Delete(retired).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&merge).Error; err != nil {
+		return nil, err
+	}
+	if err := s.changes.publish(tx, "user.deleted", retired); err != nil {
+		return nil, err
+	}
+	if err := s.changes.publish(tx, "user.updated", survivor); err != nil {
+		return nil, err
+	}
+
+	// The retired user's snapshots in the change feed hold what is the
+	// survivor's record now, which erasing the survivor would miss; only
+	// the retired ID is kept.
+	stub, err := json.Marshal(&User{ID: retiredID, TenantID: retired.TenantID})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&changefeed.Change{}).Where("clinic_id = ? AND entity_id = ? AND type LIKE ?", retired.TenantID, retiredID, "user.%").
+		Updates(&changefeed.Change{Payload: string(stub)}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &merge, nil
+}
+
+// redirectMerged redirects requests for a user that was merged into
+// another to the same route of the surviving user.
+func (s *Server) redirectMerged(c *gin.Context) {
+	param := c.Param("userID")
+	userID, err := strconv.Atoi(param)
+	if err != nil {
+		return
+	}
+	survivor, err := survivorID(s.dbFor(c), userID)
+	if err != nil {
+		internalError(c, err)
+		c.Abort()
+		return
+	}
+	if survivor != userID {
+		redirectID(c, "/user/", param, survivor)
+	}
+}
+
+// survivorID returns the user that user id was merged into, or id if it
+// was not merged. Merges are flattened, so one lookup is enough.
+func survivorID(db *gorm.DB, id int) (int, error) {
+	var merge UserMerge
+	if err := db.Where("retired_id = ?", id).Limit(1).Find(&merge).Error; err != nil {
+		return 0, err
+	}
+	if merge.ID != 0 {
+		return merge.SurvivorID, nil
+	}
+	return id, nil
+}
+
+// redirectID redirects the request permanently to the same path with the
+// ID from after prefix replaced by to, keeping the method and body.
+func redirectID(c *gin.Context, prefix, from string, to int) {
+	u := *c.Request.URL
+	u.Path = prefix + strconv.Itoa(to) + strings.TrimPrefix(u.Path, prefix+from)
+	u.RawPath = ""
+	c.Redirect(http.StatusPermanentRedirect, u.RequestURI())
+	c.Abort()
+}
+
+// minScore returns the minScore query parameter, or def if it is not
+// set. It answers 400 itself if the parameter is not a score.
+func minScore(c *gin.Context, def float64) (float64, bool) {
+	v, ok := c.GetQuery("minScore")
+	if !ok {
+		return def, true
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		c.String(http.StatusBadRequest, "error: minScore must be a number from 0 to 1")
+		return 0, false
+	}
+	return f, true
+}
+
+// ----------------------------  Duplicate Server Methods ---------------------------------//
+
+// getDuplicates is the review queue of users that are likely the same
+// patient.
+func (s *Server) getDuplicates(c *gin.Context) {
+	min, ok := minScore(c, duplicateScore)
+	if !ok {
+		return
+	}
+	candidates, err := findDuplicates(s.dbFor(c), min)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, candidates)
+}
+
+// duplicateDismissal takes a pair of users out of the review queue.
+type duplicateDismissal struct {
+	UserID      int    `json:"userId"`
+	DuplicateID int    `json:"duplicateId"`
+	DismissedBy string `json:"dismissedBy"`
+}
+
+// dismissDuplicate records that a pair of users are different patients.
+// Dismissing a pair again changes nothing.
+func (s *Server) dismissDuplicate(c *gin.Context) {
+	var req duplicateDismissal
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	switch {
+	case req.UserID == 0 || req.DuplicateID == 0:
+		c.String(http.StatusBadRequest, "error: userId and duplicateId are required")
+		return
+	case req.UserID == req.DuplicateID:
+		c.String(http.StatusBadRequest, "error: userId and duplicateId must differ")
+		return
+	case req.DismissedBy == "":
+		c.String(http.StatusBadRequest, "error: dismissedBy is required")
+		return
+	}
+	d := DuplicateDismissal{UserID: req.UserID, OtherID: req.DuplicateID, DismissedBy: req.DismissedBy}
+	if d.UserID > d.OtherID {
+		d.UserID, d.OtherID = d.OtherID, d.UserID
+	}
+
+	db := s.dbFor(c)
+	var n int64
+	if err := db.Model(&User{}).Where("id IN ?", []int{d.UserID, d.OtherID}).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n != 2 {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&d).Error
+	if err == nil {
+		err = db.Take(&d, "user_id = ? AND other_id = ?", d.UserID, d.OtherID).Error
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// mergeRequest names the user to merge into the user of the route.
+type mergeRequest struct {
+	DuplicateID int    `json:"duplicateId"`
+	MergedBy    string `json:"mergedBy"`
+}
+
+// mergeUser merges a duplicate into the user of the route, in one
+// transaction, and answers the merge.
+func (s *Server) mergeUser(c *gin.Context) {
+	var req mergeRequest
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	switch {
+	case req.DuplicateID == 0:
+		c.String(http.StatusBadRequest, "error: duplicateId is required")
+		return
+	case req.MergedBy == "":
+		c.String(http.StatusBadRequest, "error: mergedBy is required")
+		return
+	}
+	survivorID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	if req.DuplicateID == survivorID {
+		c.String(http.StatusBadRequest, "error: a user cannot be merged into itself")
+		return
+	}
+
+	var merge *UserMerge
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		merge, err = s.mergeUsers(tx, survivorID, req.DuplicateID, req.MergedBy)
+		return err
+	})
+	if err != nil {
+		mergeFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, merge)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
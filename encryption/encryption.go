@@ -0,0 +1,286 @@
+// Package encryption encrypts sensitive model fields with envelope
+// encryption.
+//
+// Values are encrypted with AES-GCM under a data key. Data keys are stored
+// in the "encryption_keys" table, wrapped by a master key held by a
+// KeyProvider, so rotating the master key only rewraps data keys. Fields
+// tagged `gorm:"serializer:encrypted"` are encrypted and decrypted
+// transparently, and fields tagged `blindindex:"Field"` hold a keyed hash
+// of Field so rows can still be looked up by its value.
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const keySize = 32
+
+// prefix starts every ciphertext, followed by the data key ID, a colon
+// and the base64 sealed value. Values without it are legacy plaintext.
+const prefix = "v1:"
+
+// dataKey is a wrapped data key in the "encryption_keys" table. The most
+// recent one is current; older ones decrypt values written before a
+// rotation.
+type dataKey struct {
+	ID          string `gorm:"primaryKey"`
+	MasterKeyID string `gorm:"not null"`
+	WrappedKey  []byte `gorm:"not null"`
+	CreatedAt   time.Time
+}
+
+func (dataKey) TableName() string {
+	return "encryption_keys"
+}
+
+// Keyring encrypts and decrypts values with the data keys.
+type Keyring struct {
+	db       *gorm.DB
+	provider KeyProvider
+	indexKey []byte
+
+	mu      sync.RWMutex
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// NewKeyring loads the data keys, creating the table and a first data key
+// if needed.
+func NewKeyring(ctx context.Context, db *gorm.DB, provider KeyProvider) (*Keyring, error) {
+	if err := db.AutoMigrate(&dataKey{}); err != nil {
+		return nil, err
+	}
+	indexKey, err := provider.IndexKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{db: db, provider: provider, indexKey: indexKey, keys: make(map[string]cipher.AEAD)}
+	if err := k.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if k.CurrentKeyID() == "" {
+		if _, err := k.RotateDataKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Refresh loads data keys created since the last call, e.g. by a
+// rotation on another replica.
+func (k *Keyring) Refresh(ctx context.Context) error {
+	var rows []dataKey
+	if err := k.db.WithContext(ctx).Order("created_at, id").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, row := range rows {
+		if _, ok := k.keys[row.ID]; ok {
+			continue
+		}
+		key, err := k.provider.Unwrap(ctx, row.MasterKeyID, row.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("unwrapping data key %s: %w", row.ID, err)
+		}
+		if k.keys[row.ID], err = newAEAD(key); err != nil {
+			return err
+		}
+	}
+	if len(rows) > 0 {
+		k.current = rows[len(rows)-1].ID
+	}
+	return nil
+}
+
+// Watch refreshes the data keys every interval until ctx is done.
+func (k *Keyring) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("encryption: refreshing data keys: %v", err)
+			}
+		}
+	}
+}
+
+// CurrentKeyID returns the ID of the data key new values are encrypted
+// with.
+func (k *Keyring) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// RotateDataKey creates a new data key and makes it current. Existing
+// values stay readable; Reencrypt moves them to the new key.
+func (k *Keyring) RotateDataKey(ctx context.Context) (string, error) {
+	key, err := randomKey()
+	if err != nil {
+		return "", err
+	}
+	masterKeyID, wrapped, err := k.provider.Wrap(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	row := dataKey{ID: hex.EncodeToString(id[:]), MasterKeyID: masterKeyID, WrappedKey: wrapped}
+	if err := k.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return "", err
+	}
+	return row.ID, k.Refresh(ctx)
+}
+
+// Rewrap wraps every data key under the provider's current master key,
+// so retired master keys can be removed. It returns the number of data
+// keys rewrapped.
+func (k *Keyring) Rewrap(ctx context.Context) (int, error) {
+	var rows []dataKey
+	if err := k.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, row := range rows {
+		key, err := k.provider.Unwrap(ctx, row.MasterKeyID, row.WrappedKey)
+		if err != nil {
+			return n, fmt.Errorf("unwrapping data key %s: %w", row.ID, err)
+		}
+		masterKeyID, wrapped, err := k.provider.Wrap(ctx, key)
+		if err != nil {
+			return n, err
+		}
+		if masterKeyID == row.MasterKeyID {
+			continue
+		}
+		err = k.db.WithContext(ctx).Model(&row).Updates(map[string]interface{}{
+			"master_key_id": masterKeyID,
+			"wrapped_key":   wrapped,
+		}).Error
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Encrypt encrypts plaintext under the current data key. aad binds the
+// ciphertext to its context, such as the column it is stored in.
+func (k *Keyring) Encrypt(plaintext, aad []byte) (string, error) {
+	k.mu.RLock()
+	id := k.current
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead == nil {
+		return "", errors.New("no current data key")
+	}
+
+	sealed, err := seal(aead, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+	return prefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the output of Encrypt.
+func (k *Keyring) Decrypt(ctx context.Context, ciphertext string, aad []byte) ([]byte, error) {
+	id, sealed, err := parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := k.key(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, aad)
+}
+
+func (k *Keyring) key(ctx context.Context, id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead != nil {
+		return aead, nil
+	}
+	// The key may have been created by another replica.
+	if err := k.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if aead = k.keys[id]; aead == nil {
+		return nil, fmt.Errorf("unknown data key %q", id)
+	}
+	return aead, nil
+}
+
+// BlindIndex returns a keyed hash of value, normalised for case and
+// surrounding space, that can be stored and compared in place of it.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Sign returns a keyed hash of message for purpose, such as a download
+// link, that only holders of the keys can produce.
+func (k *Keyring) Sign(purpose string, message []byte) string {
+	mac := hmac.New(sha256.New, k.signingKey(purpose))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the Sign of message for purpose.
+func (k *Keyring) Verify(purpose string, message []byte, signature string) bool {
+	return hmac.Equal([]byte(k.Sign(purpose, message)), []byte(signature))
+}
+
+// signingKey derives the key of purpose from the index key. It is not an
+// HMAC of the index key, so no blind index can reveal it.
+func (k *Keyring) signingKey(purpose string) []byte {
+	key := sha256.Sum256(append([]byte("sign:"+purpose+":"), k.indexKey...))
+	return key[:]
+}
+
+func isCiphertext(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+func parse(ciphertext string) (string, []byte, error) {
+	if !isCiphertext(ciphertext) {
+		return "", nil, errors.New("not a ciphertext")
+	}
+	rest := ciphertext[len(prefix):]
+	i := strings.IndexByte(rest, ':')
+	if i < 0 {
+		return "", nil, errors.New("malformed ciphertext")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(rest[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	return rest[:i], sealed, nil
+}
@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKeyring returns a Keyring with a single data key, k1, and no
+// database, registered for the serializer.
+func testKeyring(t *testing.T) *Keyring {
+	k := &Keyring{indexKey: []byte("test index key"), keys: map[string]cipher.AEAD{}}
+	addKey(t, k, "k1")
+	Register(k)
+	return k
+}
+
+// addKey adds a data key to k and makes it current, as RotateDataKey
+// does.
+func addKey(t *testing.T, k *Keyring, id string) {
+	key, err := randomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.keys[id], k.current = aead, id
+}
+
+func TestEncryptRotation(t *testing.T) {
+	k := testKeyring(t)
+	ctx := context.Background()
+	aad := []byte("users.email")
+
+	old, err := k.Encrypt([]byte("jane@example.org"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(old, "v1:k1:") || strings.Contains(old, "jane") {
+		t.Errorf("Encrypt = %q", old)
+	}
+
+	addKey(t, k, "k2")
+	rotated, err := k.Encrypt([]byte("jane@example.org"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rotated, "v1:k2:") {
+		t.Errorf("Encrypt after rotation = %q, want it under k2", rotated)
+	}
+	for _, ciphertext := range []string{old, rotated} {
+		plaintext, err := k.Decrypt(ctx, ciphertext, aad)
+		if err != nil || string(plaintext) != "jane@example.org" {
+			t.Errorf("Decrypt(%q) = %q, %v", ciphertext, plaintext, err)
+		}
+	}
+	if _, err := k.Decrypt(ctx, old, []byte("users.contact")); err == nil {
+		t.Error("a ciphertext was decrypted for another column")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := testKeyring(t)
+	index := k.BlindIndex("jane@example.org")
+	if len(index) != 32 {
+		t.Errorf("BlindIndex = %q, want 32 hex digits", index)
+	}
+	if got := k.BlindIndex("  Jane@Example.ORG "); got != index {
+		t.Errorf("BlindIndex is not normalised: %q, want %q", got, index)
+	}
+	if k.BlindIndex("john@example.org") == index {
+		t.Error("different values have the same index")
+	}
+	// Rotating data keys leaves indexes alone; only the index key counts.
+	addKey(t, k, "k2")
+	if got := k.BlindIndex("jane@example.org"); got != index {
+		t.Error("rotating data keys changed the index")
+	}
+	other := &Keyring{indexKey: []byte("another index key")}
+	if other.BlindIndex("jane@example.org") == index {
+		t.Error("another index key gives the same index")
+	}
+}
+
+func TestSign(t *testing.T) {
+	k := testKeyring(t)
+	msg := []byte("export 42")
+	sig := k.Sign("download", msg)
+	if !k.Verify("download", msg, sig) {
+		t.Error("Verify rejected the signature")
+	}
+	if k.Verify("erasure-certificate", msg, sig) {
+		t.Error("Verify accepted the signature for another purpose")
+	}
+	if k.Verify("download", []byte("export 43"), sig) {
+		t.Error("Verify accepted the signature of another message")
+	}
+	if sig == k.BlindIndex(string(msg)) {
+		t.Error("the signature is the blind index")
+	}
+}
+
+// writeKeyFile writes a key file holding keys, with current as the
+// current master key.
+func writeKeyFile(t *testing.T, path string, keys map[string]string, current string) {
+	index := base64.StdEncoding.EncodeToString(make([]byte, keySize))
+	data, err := json.Marshal(keyFile{Current: current, Keys: keys, IndexKey: index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalProviderRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	encoded := func() string {
+		key, err := randomKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	keys := map[string]string{"m1": encoded()}
+	writeKeyFile(t, path, keys, "m1")
+	p, err := NewLocalProvider(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	id, wrapped, err := p.Wrap(ctx, dataKey)
+	if err != nil || id != "m1" {
+		t.Fatalf("Wrap = %q, %v", id, err)
+	}
+
+	// A new current master key still unwraps what the old one wrapped.
+	keys["m2"] = encoded()
+	writeKeyFile(t, path, keys, "m2")
+	if p, err = NewLocalProvider(path, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Unwrap(ctx, id, wrapped)
+	if err != nil || string(got) != string(dataKey) {
+		t.Errorf("Unwrap after rotation = %q, %v", got, err)
+	}
+	if id, _, _ := p.Wrap(ctx, dataKey); id != "m2" {
+		t.Errorf("Wrap after rotation used %q, want m2", id)
+	}
+
+	writeKeyFile(t, path, keys, "m3")
+	if _, err := NewLocalProvider(path, false); err == nil {
+		t.Error("a key file whose current key is missing was accepted")
+	}
+}
+
+func TestGenerateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if _, err := NewLocalProvider(path, false); err == nil {
+		t.Fatal("a missing key file was accepted without generate")
+	}
+	if _, err := NewLocalProvider(path, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalProvider(path, false); err != nil {
+		t.Errorf("reading the generated key file: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package encryption
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// indexTag names the field a blind index field indexes, as in
+// `blindindex:"Email"`.
+const indexTag = "blindindex"
+
+// RegisterCallbacks installs the callbacks that keep blind index fields
+// in step with the fields they index, and that encrypt fields written
+// with a map, which bypasses serializers.
+func RegisterCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("encryption:create", prepare),
+		cb.Update().Before("gorm:update").Register("encryption:update", prepare),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prepare(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		prepareMap(db, dest)
+		return
+	case []map[string]interface{}:
+		for _, m := range dest {
+			prepareMap(db, m)
+		}
+		return
+	}
+	switch rv := stmt.ReflectValue; rv.Kind() {
+	case reflect.Struct:
+		indexRow(db, rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			indexRow(db, reflect.Indirect(rv.Index(i)))
+		}
+	}
+}
+
+// indexed returns the pairs of blind index fields and the fields they
+// index.
+func indexed(s *schema.Schema) (indexes, sources []*schema.Field) {
+	for _, index := range s.Fields {
+		if name := index.Tag.Get(indexTag); name != "" {
+			if source := s.LookUpField(name); source != nil {
+				indexes = append(indexes, index)
+				sources = append(sources, source)
+			}
+		}
+	}
+	return indexes, sources
+}
+
+func indexRow(db *gorm.DB, rv reflect.Value) {
+	ctx := db.Statement.Context
+	indexes, sources := indexed(db.Statement.Schema)
+	for i, index := range indexes {
+		v := reflect.Indirect(sources[i].ReflectValueOf(ctx, rv))
+		if !v.IsValid() || v.Kind() != reflect.String || v.String() == "" {
+			continue
+		}
+		s, err := BlindIndex(v.String())
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		db.AddError(index.Set(ctx, rv, s))
+	}
+}
+
+func prepareMap(db *gorm.DB, m map[string]interface{}) {
+	ctx := db.Statement.Context
+	s := db.Statement.Schema
+
+	indexes, sources := indexed(s)
+	for i, index := range indexes {
+		for _, key := range []string{sources[i].Name, sources[i].DBName} {
+			if v, ok := stringValue(m[key]); ok {
+				idx, err := BlindIndex(v)
+				if err != nil {
+					db.AddError(err)
+					return
+				}
+				delete(m, index.Name)
+				m[index.DBName] = idx
+				break
+			}
+		}
+	}
+
+	for key, value := range m {
+		field := s.LookUpField(key)
+		if field == nil {
+			continue
+		}
+		if _, ok := field.Serializer.(Serializer); !ok {
+			continue
+		}
+		if _, ok := stringValue(value); !ok {
+			continue
+		}
+		encrypted, err := Serializer{}.Value(ctx, field, db.Statement.ReflectValue, value)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		m[key] = encrypted
+	}
+}
+
+func stringValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case *string:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,175 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// KeyProvider holds the master keys that wrap data keys. Implementations
+// may keep master keys in a KMS or HSM; LocalProvider keeps them in a file
+// for development.
+type KeyProvider interface {
+	// Wrap encrypts a data key under the current master key and returns
+	// the ID of that master key.
+	Wrap(ctx context.Context, dataKey []byte) (masterKeyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped under the given master key.
+	Unwrap(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error)
+	// IndexKey returns the secret of blind indexes. Changing it requires
+	// rebuilding every blind index.
+	IndexKey(ctx context.Context) ([]byte, error)
+}
+
+// keyFile is the format of the file read by LocalProvider. Keys are
+// base64-encoded 32 byte AES keys. To rotate the master key, add a key and
+// make it current, then run rotate-keys.
+type keyFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// LocalProvider keeps master keys in a local JSON file.
+type LocalProvider struct {
+	current  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// wrapAAD binds wrapped data keys to their purpose.
+var wrapAAD = []byte("medically-core data key")
+
+// NewLocalProvider loads the key file at path. If the file does not exist
+// and generate is set, a file with fresh keys is created.
+func NewLocalProvider(path string, generate bool) (*LocalProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && generate {
+		data, err = generateKeyFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("parsing key file %s: %w", path, err)
+	}
+	p := &LocalProvider{current: kf.Current, keys: make(map[string]cipher.AEAD, len(kf.Keys))}
+	for id, encoded := range kf.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: key %q: %w", path, id, err)
+		}
+		if p.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := p.keys[p.current]; !ok {
+		return nil, fmt.Errorf("key file %s: current key %q is not defined", path, p.current)
+	}
+	if p.indexKey, err = decodeKey(kf.IndexKey); err != nil {
+		return nil, fmt.Errorf("key file %s: index_key: %w", path, err)
+	}
+	return p, nil
+}
+
+// Wrap implements KeyProvider.
+func (p *LocalProvider) Wrap(_ context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.current], dataKey, wrapAAD)
+	return p.current, wrapped, err
+}
+
+// Unwrap implements KeyProvider.
+func (p *LocalProvider) Unwrap(_ context.Context, masterKeyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not in the key file", masterKeyID)
+	}
+	return open(aead, wrapped, wrapAAD)
+}
+
+// IndexKey implements KeyProvider.
+func (p *LocalProvider) IndexKey(context.Context) ([]byte, error) {
+	return p.indexKey, nil
+}
+
+func generateKeyFile(path string) ([]byte, error) {
+	master, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	index, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	id := time.Now().UTC().Format("20060102")
+	data, err := json.MarshalIndent(keyFile{
+		Current:  id,
+		Keys:     map[string]string{id: base64.StdEncoding.EncodeToString(master)},
+		IndexKey: base64.StdEncoding.EncodeToString(index),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL so that concurrent replicas cannot overwrite each other's key.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return data, f.Close()
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, errors.New("keys must be 32 bytes")
+	}
+	return key, nil
+}
+
+func randomKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixing the result with a random nonce.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts the output of seal.
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], aad)
+}
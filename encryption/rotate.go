@@ -0,0 +1,98 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Reencrypt rewrites the encrypted fields of every row of model that is
+// not yet encrypted under the current data key, batchSize rows at a time,
+// and refreshes their blind indexes. Rows written before a field was
+// encrypted are encrypted. It returns the number of rows rewritten.
+func Reencrypt(ctx context.Context, db *gorm.DB, model interface{}, batchSize int) (int, error) {
+	k, err := current()
+	if err != nil {
+		return 0, err
+	}
+	s, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return 0, err
+	}
+	if len(s.PrimaryFields) == 0 {
+		return 0, errors.New("encryption: model has no primary key")
+	}
+
+	var (
+		columns []string
+		stale   []clause.Expression
+		pattern = prefix + k.CurrentKeyID() + ":%"
+	)
+	for _, field := range s.Fields {
+		if _, ok := field.Serializer.(Serializer); ok {
+			columns = append(columns, field.DBName)
+			stale = append(stale, clause.Expr{
+				SQL:  "(? IS NOT NULL AND ? NOT LIKE ?)",
+				Vars: []interface{}{clause.Column{Name: field.DBName}, clause.Column{Name: field.DBName}, pattern},
+			})
+		}
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	indexes, _ := indexed(s)
+	for _, index := range indexes {
+		columns = append(columns, index.DBName)
+	}
+
+	// Rows are read in primary key order, so each batch starts after the
+	// key of the last row of the one before.
+	var (
+		pk    []string
+		pkCol []interface{}
+	)
+	for _, field := range s.PrimaryFields {
+		pk = append(pk, field.DBName)
+		pkCol = append(pkCol, clause.Column{Name: field.DBName})
+	}
+	rowType := reflect.TypeOf(model)
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	db = db.WithContext(ctx)
+	n := 0
+	var last []interface{}
+	for {
+		batch := reflect.New(reflect.SliceOf(rowType))
+		q := db.Where(clause.Or(stale...)).Order(strings.Join(pk, ", ")).Limit(batchSize)
+		if last != nil {
+			q = q.Where("? > ?", pkCol, last)
+		}
+		if err := q.Find(batch.Interface()).Error; err != nil {
+			return n, err
+		}
+		rows := batch.Elem()
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i).Addr().Interface()
+			if err := db.Model(row).Select(columns).Updates(row).Error; err != nil {
+				return n, err
+			}
+			n++
+		}
+		if rows.Len() < batchSize {
+			return n, nil
+		}
+		last = nil
+		for _, field := range s.PrimaryFields {
+			v, _ := field.ValueOf(ctx, rows.Index(rows.Len()-1))
+			last = append(last, v)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// keyring is the Keyring used by the "encrypted" serializer.
+var keyring atomic.Value
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Register makes k the Keyring of the "encrypted" serializer and blind
+// indexes. It must be called before models with encrypted fields are
+// read or written.
+func Register(k *Keyring) {
+	keyring.Store(k)
+}
+
+func current() (*Keyring, error) {
+	k, _ := keyring.Load().(*Keyring)
+	if k == nil {
+		return nil, errors.New("encryption: no keyring registered")
+	}
+	return k, nil
+}
+
+// BlindIndex returns the blind index of value under the registered
+// Keyring, for looking up rows by an encrypted field.
+func BlindIndex(value string) (string, error) {
+	k, err := current()
+	if err != nil {
+		return "", err
+	}
+	return k.BlindIndex(value), nil
+}
+
+// Sign signs message for purpose under the registered Keyring.
+func Sign(purpose string, message []byte) (string, error) {
+	k, err := current()
+	if err != nil {
+		return "", err
+	}
+	return k.Sign(purpose, message), nil
+}
+
+// Verify verifies a signature made by Sign.
+func Verify(purpose string, message []byte, signature string) (bool, error) {
+	k, err := current()
+	if err != nil {
+		return false, err
+	}
+	return k.Verify(purpose, message, signature), nil
+}
+
+// Serializer is the gorm serializer registered as "encrypted". It stores
+// string, *string and []byte fields encrypted, bound to their table and
+// column.
+// Values stored before the field was encrypted are read as they are.
+type Serializer struct{}
+
+// Scan implements schema.SerializerInterface.
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	value := reflect.New(field.FieldType).Elem()
+	if dbValue != nil {
+		var s string
+		switch v := dbValue.(type) {
+		case []byte:
+			s = string(v)
+		case string:
+			s = v
+		default:
+			return fmt.Errorf("encryption: cannot scan %T into %s", dbValue, field.Name)
+		}
+		if isCiphertext(s) {
+			k, err := current()
+			if err != nil {
+				return err
+			}
+			plaintext, err := k.Decrypt(ctx, s, aad(field))
+			if err != nil {
+				return fmt.Errorf("encryption: decrypting %s: %w", field.Name, err)
+			}
+			s = string(plaintext)
+		}
+		switch value.Kind() {
+		case reflect.Ptr:
+			value.Set(reflect.New(field.FieldType.Elem()))
+			value.Elem().SetString(s)
+		case reflect.Slice:
+			value.SetBytes([]byte(s))
+		default:
+			value.SetString(s)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(value)
+	return nil
+}
+
+// Value implements schema.SerializerInterface.
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var s string
+	switch v := fieldValue.(type) {
+	case string:
+		s = v
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		s = *v
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		s = string(v)
+	default:
+		return nil, fmt.Errorf("encryption: cannot encrypt %T field %s", fieldValue, field.Name)
+	}
+	k, err := current()
+	if err != nil {
+		return nil, err
+	}
+	return k.Encrypt([]byte(s), aad(field))
+}
+
+// aad binds a value to its column, so that ciphertexts cannot be moved
+// between columns.
+func aad(field *schema.Field) []byte {
+	return []byte(field.Schema.Table + "." + field.DBName)
+}
@@ -0,0 +1,136 @@
+package encryption
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type secretRow struct {
+	ID        int
+	Note      string  `gorm:"serializer:encrypted"`
+	Optional  *string `gorm:"serializer:encrypted"`
+	Body      []byte  `gorm:"serializer:encrypted"`
+	NoteIndex string  `blindindex:"Note"`
+}
+
+func secretSchema(t *testing.T) *schema.Schema {
+	s, err := schema.Parse(&secretRow{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// roundTrip stores field of row and reads it back into a new row.
+func roundTrip(t *testing.T, s *schema.Schema, field string, row *secretRow) (interface{}, *secretRow) {
+	ctx := context.Background()
+	f := s.LookUpField(field)
+	stored, err := Serializer{}.Value(ctx, f, reflect.ValueOf(row).Elem(), reflect.ValueOf(row).Elem().FieldByName(field).Interface())
+	if err != nil {
+		t.Fatalf("Value(%s): %v", field, err)
+	}
+	var got secretRow
+	if err := (Serializer{}).Scan(ctx, f, reflect.ValueOf(&got).Elem(), stored); err != nil {
+		t.Fatalf("Scan(%s): %v", field, err)
+	}
+	return stored, &got
+}
+
+func TestSerializer(t *testing.T) {
+	testKeyring(t)
+	s := secretSchema(t)
+	optional := "call after 5pm"
+	row := &secretRow{Note: "allergic to penicillin", Optional: &optional, Body: []byte{0, 1, 2, 0xff}}
+
+	for _, field := range []string{"Note", "Optional", "Body"} {
+		stored, got := roundTrip(t, s, field, row)
+		ciphertext, ok := stored.(string)
+		if !ok || !isCiphertext(ciphertext) {
+			t.Errorf("%s is stored as %v, want a ciphertext", field, stored)
+		}
+		want := reflect.ValueOf(row).Elem().FieldByName(field).Interface()
+		if v := reflect.ValueOf(got).Elem().FieldByName(field).Interface(); !reflect.DeepEqual(v, want) {
+			t.Errorf("%s reads back as %v, want %v", field, v, want)
+		}
+	}
+
+	// Unset values stay NULL.
+	for _, field := range []string{"Optional", "Body"} {
+		if stored, got := roundTrip(t, s, field, &secretRow{}); stored != nil || !reflect.DeepEqual(got, &secretRow{}) {
+			t.Errorf("unset %s is stored as %v and read as %+v", field, stored, got)
+		}
+	}
+}
+
+func TestSerializerRotation(t *testing.T) {
+	k := testKeyring(t)
+	s := secretSchema(t)
+	ctx := context.Background()
+	note := s.LookUpField("Note")
+
+	old, _ := roundTrip(t, s, "Note", &secretRow{Note: "before"})
+	addKey(t, k, "k2")
+	rotated, _ := roundTrip(t, s, "Note", &secretRow{Note: "after"})
+	if !strings.HasPrefix(old.(string), "v1:k1:") || !strings.HasPrefix(rotated.(string), "v1:k2:") {
+		t.Errorf("stored %q and %q, want them under k1 and k2", old, rotated)
+	}
+	for want, stored := range map[string]interface{}{"before": old, "after": rotated, "legacy": []byte("legacy")} {
+		var got secretRow
+		if err := (Serializer{}).Scan(ctx, note, reflect.ValueOf(&got).Elem(), stored); err != nil || got.Note != want {
+			t.Errorf("Scan(%v) = %q, %v, want %q", stored, got.Note, err, want)
+		}
+	}
+
+	// Ciphertexts are bound to their column.
+	var got secretRow
+	if err := (Serializer{}).Scan(ctx, s.LookUpField("Body"), reflect.ValueOf(&got).Elem(), old); err == nil {
+		t.Error("a Note ciphertext was read into Body")
+	}
+}
+
+// dryRunDB returns a database with the callbacks that builds statements
+// without running them.
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCallbacks(t *testing.T) {
+	k := testKeyring(t)
+	db := dryRunDB(t)
+
+	row := secretRow{Note: "Jane@Example.org"}
+	stmt := db.Create(&row).Statement
+	if row.NoteIndex != k.BlindIndex("jane@example.org") {
+		t.Errorf("Create set NoteIndex to %q", row.NoteIndex)
+	}
+	for _, v := range stmt.Vars {
+		if v == row.Note {
+			t.Errorf("Create wrote the plaintext: %v", stmt.Vars)
+		}
+	}
+
+	// Map updates bypass the serializer; the callbacks encrypt them and
+	// keep the index in step.
+	updates := map[string]interface{}{"note": "john@example.org"}
+	db.Model(&secretRow{ID: 1}).Updates(updates)
+	if !isCiphertext(updates["note"].(string)) {
+		t.Errorf("Updates wrote note as %q", updates["note"])
+	}
+	if updates["note_index"] != k.BlindIndex("john@example.org") {
+		t.Errorf("Updates wrote note_index as %v", updates["note_index"])
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"medically-core/encryption"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The writes to users, meds, diseases and clinics are shared by the REST,
+// GraphQL and gRPC APIs. Each announces the change it makes, as
+// "<name>.created" and so on, in the transaction that makes it.
+
+// createEntity creates entity, a *User, *Med, *Disease or *Clinic.
+func (s *Server) createEntity(db *gorm.DB, name string, entity interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entity).Error; err != nil {
+			return err
+		}
+		return s.changes.publish(tx, name+".created", entity)
+	})
+}
+
+// saveEntity writes every field of entity.
+func (s *Server) saveEntity(db *gorm.DB, name string, entity interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(entity).Error; err != nil {
+			return err
+		}
+		return s.changes.publish(tx, name+".updated", entity)
+	})
+}
+
+// deleteEntity deletes the entity with id, reading it into entity. It
+// returns gorm.ErrRecordNotFound if there is none.
+func (s *Server) deleteEntity(db *gorm.DB, name string, entity interface{}, id interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		req := tx.Clauses(clause.Returning{}).Delete(entity, "ID = ?", id)
+		if req.Error != nil {
+			return req.Error
+		}
+		if req.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return s.changes.publish(tx, name+".deleted", entity)
+	})
+}
+
+// usersWithEmail restricts a query of users to those with email, if set.
+// Emails are encrypted, so they are matched on their blind index.
+func usersWithEmail(db *gorm.DB, email string) (*gorm.DB, error) {
+	if email == "" {
+		return db, nil
+	}
+	index, err := encryption.BlindIndex(email)
+	if err != nil {
+		return nil, err
+	}
+	return db.Where("email_index = ?", index), nil
+}
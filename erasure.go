@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"medically-core/changefeed"
+	"medically-core/encryption"
+	"medically-core/hl7"
+	"medically-core/notifications"
+	"medically-core/tenant"
+	"medically-core/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// erasureCertificatePurpose is the purpose erasure certificates are
+// signed for.
+const erasureCertificatePurpose = "erasure-certificate"
+
+// erasedName replaces the name of erased users.
+const erasedName = "Erased user"
+
+// Actions taken on the records of an erased user.
+const (
+	erasureDeleted    = "deleted"
+	erasureAnonymized = "anonymized"
+	erasureRetained   = "retained"
+)
+
+// ErasureCertificate records what erasing a user did, for the user and
+// supervisory authorities. It is signed, so its holders can have it
+// verified.
+type ErasureCertificate struct {
+	RequestID   int             `json:"requestId"`
+	ClinicID    int             `json:"clinicId"`
+	UserID      int             `json:"userId"`
+	RequestedBy string          `json:"requestedBy"`
+	ApprovedBy  string          `json:"approvedBy,omitempty"`
+	RequestedAt time.Time       `json:"requestedAt"`
+	ErasedAt    time.Time       `json:"erasedAt"`
+	Records     []ErasedRecords `json:"records"`
+}
+
+// ErasedRecords is what erasing a user did to one kind of their records,
+// and on what basis records were kept.
+type ErasedRecords struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Count  int64  `json:"count"`
+	Basis  string `json:"basis,omitempty"`
+}
+
+// erasureError refuses an erasure request or decision for a reason the
+// client can act on, with the status to answer.
+type erasureError struct {
+	status int
+	msg    string
+}
+
+func (e *erasureError) Error() string { return e.msg }
+
+// eraseUser erases the personal data of a user on tx. Records that only
+// identify or reach the user, including their export archives and the
+// webhook deliveries about them, are deleted, and free text they wrote
+// and HL7 messages about them are removed. Clinical records made within
+// erasure.clinical_retention are kept, as medical record laws require,
+// and are no longer linked to a person once the user is anonymized;
+// older ones are deleted. The access log and the erasure itself are
+// kept as an audit trail.
+func (s *Server) eraseUser(tx *gorm.DB, userID int, now time.Time) ([]ErasedRecords, error) {
+	var records []ErasedRecords
+	add := func(typ, action, basis string, res *gorm.DB) error {
+		if res.Error != nil {
+			return res.Error
+		}
+		records = append(records, ErasedRecords{Type: typ, Action: action, Count: res.RowsAffected, Basis: basis})
+		return nil
+	}
+
+	identifying := []struct {
+		typ   string
+		model interface{}
+	}{
+		{"patient_identifiers", &PatientIdentifier{}},
+		{"reminders", &Reminder{}},
+		{"notifications", &notifications.Delivery{}},
+		{"notification_preferences", &notifications.Preferences{}},
+	}
+	for _, m := range identifying {
+		if err := add(m.typ, erasureDeleted, "", tx.Where("user_id = ?", userID).Delete(m.model)); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("webhook_deliveries", erasureDeleted, "",
+		tx.Where("user_id = ?", userID).Delete(&webhooks.Delivery{})); err != nil {
+		return nil, err
+	}
+	exports, err := s.userExports.Erase(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, ErasedRecords{Type: "user_exports", Action: erasureDeleted, Count: exports})
+	if err := add("hl7_messages", erasureAnonymized, "message content removed; kept as the interface log",
+		tx.Model(&hl7.StoredMessage{}).Where("user_id = ?", userID).Update("raw", "")); err != nil {
+		return nil, err
+	}
+	if err := add("appointments", erasureAnonymized, "reasons removed; kept as the clinic's schedule history",
+		tx.Model(&Appointment{}).Where("user_id = ?", userID).Update("reason", "")); err != nil {
+		return nil, err
+	}
+
+	// Doses go first, as they refer to prescriptions, and prescriptions
+	// with doses that are kept are kept with them.
+	cutoff := now.Add(-s.erasure.ClinicalRetention)
+	basis := fmt.Sprintf("medical record retention of %s", s.erasure.ClinicalRetention)
+	clinical := []struct {
+		typ   string
+		model interface{}
+		kept  string
+	}{
+		{"doses", &Dose{}, ""},
+		{"diagnoses", &Diagnosis{}, ""},
+		{"observations", &Observation{}, ""},
+		{"prescriptions", &Prescription{}, "EXISTS (SELECT 1 FROM doses WHERE doses.prescription_id = prescriptions.id)"},
+	}
+	for _, m := range clinical {
+		old := tx.Where("user_id = ? AND created_at < ?", userID, cutoff)
+		if m.kept != "" {
+			old = old.Where("NOT " + m.kept)
+		}
+		if err := add(m.typ, erasureDeleted, "", old.Delete(m.model)); err != nil {
+			return nil, err
+		}
+		var kept int64
+		if err := tx.Model(m.model).Where("user_id = ?", userID).Count(&kept).Error; err != nil {
+			return nil, err
+		}
+		records = append(records, ErasedRecords{Type: m.typ, Action: erasureRetained, Count: kept, Basis: basis})
+	}
+	if err := add("dose_notes", erasureAnonymized, "notes written by the user removed",
+		tx.Model(&Dose{}).Where("user_id = ?", userID).Update("note", "")); err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := tx.Take(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	name, email, contact := erasedName, fmt.Sprintf("erased-%d@invalid", userID), ""
+	user.Name, user.Email, user.Contact, user.BirthDate = &name, &email, &contact, nil
+	if err := tx.Save(&user).Error; err != nil {
+		return nil, err
+	}
+	// Earlier changes of the user carry snapshots of them; they are
+	// replaced with the anonymized user.
+	clinicID, _ := tenant.FromContext(tx.Statement.Context)
+	snapshot, err := json.Marshal(&user)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("changes", erasureAnonymized, "user snapshots replaced with the anonymized user",
+		tx.Model(&changefeed.Change{}).Where("clinic_id = ? AND entity_id = ? AND type LIKE ?", clinicID, userID, "user.%").
+			Updates(&changefeed.Change{Payload: string(snapshot)})); err != nil {
+		return nil, err
+	}
+	if err := s.changes.publish(tx, "user.updated", &user); err != nil {
+		return nil, err
+	}
+	records = append(records, ErasedRecords{Type: "users", Action: erasureAnonymized, Count: 1, Basis: "kept so retained records refer to no person"})
+
+	// Consents end with the erasure, but are kept as proof of what was
+	// consented to before.
+	if err := add("consents", erasureRetained, "revoked; kept as proof of past consent",
+		tx.Model(&Consent{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+			Updates(map[string]interface{}{"revoked_at": now, "revocation_reason": "user erased"})); err != nil {
+		return nil, err
+	}
+
+	var accesses int64
+	if err := tx.Model(&RecordAccess{}).Where("user_id = ?", userID).Count(&accesses).Error; err != nil {
+		return nil, err
+	}
+	records = append(records, ErasedRecords{Type: "record_accesses", Action: erasureRetained, Count: accesses, Basis: "audit trail"})
+	return records, nil
+}
+
+// carryOutErasure erases the user of r on tx, unless they are under a
+// legal hold, and completes r with its signed certificate.
+func (s *Server) carryOutErasure(tx *gorm.DB, r *ErasureRequest) error {
+	var holds int64
+	if err := tx.Model(&LegalHold{}).Where("user_id = ? AND released_at IS NULL", r.UserID).Count(&holds).Error; err != nil {
+		return err
+	}
+	if holds > 0 {
+		return &erasureError{http.StatusConflict, "the user is under legal hold"}
+	}
+
+	now := time.Now().UTC()
+	records, err := s.eraseUser(tx, r.UserID, now)
+	if err != nil {
+		return err
+	}
+	cert := &ErasureCertificate{
+		RequestID:   r.ID,
+		ClinicID:    r.TenantID,
+		UserID:      r.UserID,
+		RequestedBy: r.RequestedBy,
+		ApprovedBy:  r.DecidedBy,
+		RequestedAt: r.CreatedAt.UTC(),
+		ErasedAt:    now,
+		Records:     records,
+	}
+	signature, err := signErasureCertificate(cert)
+	if err != nil {
+		return err
+	}
+	r.Status, r.Certificate, r.Signature = ErasureCompleted, cert, signature
+	return tx.Save(r).Error
+}
+
+func signErasureCertificate(cert *ErasureCertificate) (string, error) {
+	data, err := json.Marshal(cert)
+	if err != nil {
+		return "", err
+	}
+	return encryption.Sign(erasureCertificatePurpose, data)
+}
+
+// erasureFailed answers a failed erasure request or decision.
+func erasureFailed(c *gin.Context, err error) {
+	var refused *erasureError
+	if errors.As(err, &refused) {
+		c.String(refused.status, "error: "+refused.msg)
+		return
+	}
+	internalError(c, err)
+}
+
+// ----------------------------  Erasure Server Methods ---------------------------------//
+
+// erasureRequest asks for the erasure of a user.
+type erasureRequest struct {
+	RequestedBy string `json:"requestedBy"`
+	Reason      string `json:"reason"`
+}
+
+// erasureDecision approves or rejects an erasure request.
+type erasureDecision struct {
+	DecidedBy string `json:"decidedBy"`
+	Note      string `json:"note"`
+}
+
+// requestErasure records a request to erase a user, carrying it out at
+// once unless erasure.require_approval is set. Users are never deleted,
+// so DELETE /user/:userID is served by it too.
+func (s *Server) requestErasure(c *gin.Context) {
+	var req erasureRequest
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if req.RequestedBy == "" {
+		c.String(http.StatusBadRequest, "error: requestedBy is required")
+		return
+	}
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+
+	r := ErasureRequest{UserID: userID, Reason: req.Reason, RequestedBy: req.RequestedBy, Status: ErasurePending}
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		// The user is locked so concurrent requests see each other.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		var pending int64
+		if err := tx.Model(&ErasureRequest{}).Where("user_id = ? AND status = ?", userID, ErasurePending).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return &erasureError{http.StatusConflict, "an erasure of the user is already pending"}
+		}
+		if err := tx.Create(&r).Error; err != nil {
+			return err
+		}
+		if s.erasure.RequireApproval {
+			return nil
+		}
+		return s.carryOutErasure(tx, &r)
+	})
+	if err != nil {
+		erasureFailed(c, err)
+		return
+	}
+	status := http.StatusOK
+	if r.Status == ErasurePending {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, r)
+}
+
+func (s *Server) getErasureRequests(c *gin.Context) {
+	var requests []ErasureRequest
+	if err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("id").Find(&requests).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// approveErasure approves a pending erasure request and carries it out.
+// A request cannot be approved by its requester.
+func (s *Server) approveErasure(c *gin.Context) {
+	s.decideErasure(c, func(tx *gorm.DB, r *ErasureRequest) error {
+		if r.DecidedBy == r.RequestedBy {
+			return &erasureError{http.StatusForbidden, "an erasure must be approved by someone other than its requester"}
+		}
+		return s.carryOutErasure(tx, r)
+	})
+}
+
+func (s *Server) rejectErasure(c *gin.Context) {
+	s.decideErasure(c, func(tx *gorm.DB, r *ErasureRequest) error {
+		r.Status = ErasureRejected
+		return tx.Save(r).Error
+	})
+}
+
+// decideErasure records the decision on the pending erasure request named
+// by the requestID parameter, then runs decide.
+func (s *Server) decideErasure(c *gin.Context, decide func(tx *gorm.DB, r *ErasureRequest) error) {
+	var decision erasureDecision
+	if err := BindJSON(c, &decision); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if decision.DecidedBy == "" {
+		c.String(http.StatusBadRequest, "error: decidedBy is required")
+		return
+	}
+
+	var r ErasureRequest
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&r, "id = ? AND user_id = ?", c.Param("requestID"), c.Param("userID")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &erasureError{http.StatusNotFound, "record not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if r.Status != ErasurePending {
+			return &erasureError{http.StatusConflict, "erasure request is " + r.Status}
+		}
+		now := time.Now()
+		r.DecidedBy, r.DecisionNote, r.DecidedAt = decision.DecidedBy, decision.Note, &now
+		return decide(tx, &r)
+	})
+	if err != nil {
+		erasureFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// verifyErasureCertificate reports whether an erasure certificate was
+// issued by this service as it is.
+func (s *Server) verifyErasureCertificate(c *gin.Context) {
+	var body struct {
+		Certificate *ErasureCertificate `json:"certificate"`
+		Signature   string              `json:"signature"`
+	}
+	if err := BindJSON(c, &body); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if body.Certificate == nil {
+		c.String(http.StatusBadRequest, "error: certificate is required")
+		return
+	}
+	data, err := json.Marshal(body.Certificate)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	valid, err := encryption.Verify(erasureCertificatePurpose, data, body.Signature)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": valid})
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Legal Hold Server Methods ---------------------------------//
+
+func (s *Server) getLegalHolds(c *gin.Context) {
+	var holds []LegalHold
+	if err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("id").Find(&holds).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, holds)
+}
+
+// createLegalHold places a legal hold on a user, keeping them from being
+// erased until it is released.
+func (s *Server) createLegalHold(c *gin.Context) {
+	var hold LegalHold
+	if err := BindJSON(c, &hold); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if hold.Reason == "" || hold.PlacedBy == "" {
+		c.String(http.StatusBadRequest, "error: reason and placedBy are required")
+		return
+	}
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	hold.ID, hold.UserID, hold.ReleasedBy, hold.ReleasedAt = 0, userID, "", nil
+	if err := s.dbFor(c).Create(&hold).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+func (s *Server) releaseLegalHold(c *gin.Context) {
+	var body struct {
+		ReleasedBy string `json:"releasedBy"`
+	}
+	if err := BindJSON(c, &body); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if body.ReleasedBy == "" {
+		c.String(http.StatusBadRequest, "error: releasedBy is required")
+		return
+	}
+	var hold LegalHold
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&hold, "id = ? AND user_id = ?", c.Param("holdID"), c.Param("userID")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &erasureError{http.StatusNotFound, "record not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if hold.ReleasedAt != nil {
+			return &erasureError{http.StatusConflict, "the legal hold is already released"}
+		}
+		now := time.Now()
+		hold.ReleasedBy, hold.ReleasedAt = body.ReleasedBy, &now
+		return tx.Model(&hold).Select("released_by", "released_at").Updates(&hold).Error
+	})
+	if err != nil {
+		erasureFailed(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/logging"
+	"medically-core/notifications"
+	"medically-core/userexport"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// userExportSections are the parts of the record of a user written to
+// their export. Notes are part of the diagnoses and doses they were
+// written on.
+func userExportSections() []userexport.Section {
+	return []userexport.Section{
+		{Name: "profile", Export: func(db *gorm.DB, userID int) (interface{}, error) {
+			var users []User
+			return &users, db.Where("id = ?", userID).Find(&users).Error
+		}},
+		userExportSection("identifiers", "id", func() interface{} { return &[]PatientIdentifier{} }),
+		userExportSection("diagnoses", "diagnosed_on, id", func() interface{} { return &[]Diagnosis{} }),
+		userExportSection("prescriptions", "start_date, id", func() interface{} { return &[]Prescription{} }),
+		userExportSection("doses", "taken_at, id", func() interface{} { return &[]Dose{} }),
+		userExportSection("observations", "effective_at, id", func() interface{} { return &[]Observation{} }),
+		userExportSection("appointments", "start_at, id", func() interface{} { return &[]Appointment{} }),
+		userExportSection("notifications", "id", func() interface{} { return &[]notifications.Delivery{} }),
+		userExportSection("notification_preferences", "id", func() interface{} { return &[]notifications.Preferences{} }),
+		userExportSection("consents", "id", func() interface{} { return &[]Consent{} }),
+		userExportSection("access_log", "accessed_at, id", func() interface{} { return &[]RecordAccess{} }),
+	}
+}
+
+// userExportSection exports the rows of a model with a UserID, in order.
+// newRecords returns a pointer to an empty slice of the model.
+func userExportSection(name, order string, newRecords func() interface{}) userexport.Section {
+	return userexport.Section{Name: name, Export: func(db *gorm.DB, userID int) (interface{}, error) {
+		records := newRecords()
+		return records, db.Where("user_id = ?", userID).Order(order).Find(records).Error
+	}}
+}
+
+// notifyUserExport tells a user that their export is ready, with its
+// link.
+func notifyUserExport(notifier *notifications.Notifier) userexport.ReadyFunc {
+	return func(db *gorm.DB, x *userexport.Export) error {
+		var user User
+		if err := db.Take(&user, "id = ?", x.UserID).Error; err != nil {
+			return err
+		}
+		data := map[string]interface{}{"URL": x.URL, "ExpiresAt": *x.ExpiresAt}
+		return notifyUser(notifier, db, &user, "export_ready", "export:"+x.ID, data)
+	}
+}
+
+// auditAccess records the requests that read or changed the record of a
+// user, once they succeed.
+func (s *Server) auditAccess(c *gin.Context) {
+	c.Next()
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil || c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	recordAccess(s.dbFor(c), requestAccess(c, c.FullPath()), userID)
+}
+
+// requestAccess returns the access of the request of c to route, to be
+// recorded for each user whose record it read or changed.
+func requestAccess(c *gin.Context, route string) RecordAccess {
+	return RecordAccess{
+		Method:    c.Request.Method,
+		Route:     route,
+		Status:    c.Writer.Status(),
+		ClientIP:  c.ClientIP(),
+		RequestID: logging.RequestIDFrom(c.Request.Context()),
+	}
+}
+
+// recordAccess records access for each of userIDs. Failing to record it
+// is logged, as the request has already been served.
+func recordAccess(db *gorm.DB, access RecordAccess, userIDs ...int) {
+	if len(userIDs) == 0 {
+		return
+	}
+	accesses := make([]RecordAccess, len(userIDs))
+	for i, id := range userIDs {
+		accesses[i] = access
+		accesses[i].UserID, accesses[i].AccessedAt = id, time.Now()
+	}
+	if err := db.Create(&accesses).Error; err != nil {
+		logging.FromContext(db.Statement.Context).Error("recording record access failed", logging.Err(err))
+	}
+}
+
+// ----------------------------  User Export Server Methods ---------------------------------//
+
+// requestUserExport starts an export of everything held about a user.
+func (s *Server) requestUserExport(c *gin.Context) {
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	s.userExports.Request(c, s.dbFor(c), userID)
+}
+
+func (s *Server) getUserExport(c *gin.Context) {
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	s.userExports.Status(c, s.dbFor(c), userID)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
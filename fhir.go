@@ -0,0 +1,672 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"medically-core/bulkexport"
+	"medically-core/encryption"
+	"medically-core/fhir"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fhirResource maps a FHIR resource type onto a model.
+type fhirResource struct {
+	capability fhir.ResourceCapability
+	// entity names the webhook events of changes to the model, such as
+	// "user" for "user.updated".
+	entity string
+	// newModel returns a pointer to a new model, and newModels a pointer
+	// to an empty slice of them.
+	newModel  func() interface{}
+	newModels func() interface{}
+	// each calls fn with a pointer to every model in the slice made by
+	// newModels.
+	each func(models interface{}, fn func(model interface{}))
+	// toFHIR converts a model to its resource, returning the resource ID.
+	toFHIR func(model interface{}) (string, interface{})
+	// fromFHIR sets the fields of a model from resource JSON, leaving its
+	// ID alone. Its errors are the client's.
+	fromFHIR func(data []byte, model interface{}) (id string, err error)
+	// search maps each search parameter to a condition.
+	search map[string]fhirSearchParam
+	// tenants are resources that are the tenants themselves: writes to
+	// them need a tenant, and a tenant only updates its own resource, as
+	// on /clinic.
+	tenants bool
+	// validate, if set, checks a model before it is written. Its errors
+	// are the client's.
+	validate func(model interface{}) error
+	// audited resources are the records of users: their reads, writes
+	// and exports are added to the access log, as on /user.
+	audited bool
+	// exportConsent is the consent scope that the users of exported
+	// resources must consent to for any grantee, if set. Bulk exports are
+	// for research, so they only hold the users who consent to it.
+	exportConsent string
+}
+
+// fhirSearchParam turns a search parameter value into a condition, or
+// reports why the value is invalid.
+type fhirSearchParam func(value string) (func(*gorm.DB) *gorm.DB, error)
+
+// fhirResultParams are the search result parameters, which shape the
+// response rather than select resources. Those other than _count and
+// _offset are not supported and, as FHIR allows, ignored.
+var fhirResultParams = map[string]bool{
+	"_count": true, "_offset": true, "_format": true, "_pretty": true,
+	"_sort": true, "_summary": true, "_elements": true, "_total": true,
+	"_include": true, "_revinclude": true, "_contained": true, "_containedType": true,
+}
+
+// fhirResources are the resource types served under /fhir.
+var fhirResources = []*fhirResource{
+	{
+		capability: fhir.ResourceCapability{
+			Type:          fhir.TypePatient,
+			Documentation: "Patients of the clinic of the request, from /user.",
+			Interaction:   fhir.Interactions,
+			SearchParam: []fhir.SearchParam{
+				{Name: "_id", Type: "token"},
+				{Name: "name", Type: "string"},
+				{Name: "email", Type: "token", Documentation: "Exact, case-insensitive match."},
+			},
+		},
+		entity:        "user",
+		audited:       true,
+		exportConsent: ConsentResearch,
+		newModel:      func() interface{} { return &User{} },
+		newModels:     func() interface{} { return &[]User{} },
+		each: func(models interface{}, fn func(interface{})) {
+			for i := range *models.(*[]User) {
+				fn(&(*models.(*[]User))[i])
+			}
+		},
+		toFHIR:   func(m interface{}) (string, interface{}) { return patientFromUser(m.(*User)) },
+		fromFHIR: func(data []byte, m interface{}) (string, error) { return userFromPatient(data, m.(*User)) },
+		search: map[string]fhirSearchParam{
+			"_id":   searchID,
+			"name":  searchPrefix("name"),
+			"email": searchEmail,
+		},
+	},
+	{
+		capability: fhir.ResourceCapability{
+			Type:          fhir.TypeMedication,
+			Documentation: "Medications of the catalog, from /med.",
+			Interaction:   fhir.Interactions,
+			SearchParam: []fhir.SearchParam{
+				{Name: "_id", Type: "token"},
+				{Name: "code:text", Type: "token", Documentation: "Prefix of the medication name."},
+			},
+		},
+		entity:    "med",
+		newModel:  func() interface{} { return &Med{} },
+		newModels: func() interface{} { return &[]Med{} },
+		each: func(models interface{}, fn func(interface{})) {
+			for i := range *models.(*[]Med) {
+				fn(&(*models.(*[]Med))[i])
+			}
+		},
+		toFHIR:   func(m interface{}) (string, interface{}) { return medicationFromMed(m.(*Med)) },
+		fromFHIR: func(data []byte, m interface{}) (string, error) { return medFromMedication(data, m.(*Med)) },
+		search: map[string]fhirSearchParam{
+			"_id":       searchID,
+			"code:text": searchPrefix("name"),
+		},
+	},
+	{
+		capability: fhir.ResourceCapability{
+			Type: fhir.TypeCondition,
+			Documentation: "Conditions of the catalog, from /disease. They describe a condition " +
+				"rather than a patient's diagnosis, so they have no subject.",
+			Interaction: fhir.Interactions,
+			SearchParam: []fhir.SearchParam{
+				{Name: "_id", Type: "token"},
+				{Name: "code:text", Type: "token", Documentation: "Prefix of the condition name."},
+			},
+		},
+		entity:    "disease",
+		newModel:  func() interface{} { return &Disease{} },
+		newModels: func() interface{} { return &[]Disease{} },
+		each: func(models interface{}, fn func(interface{})) {
+			for i := range *models.(*[]Disease) {
+				fn(&(*models.(*[]Disease))[i])
+			}
+		},
+		toFHIR:   func(m interface{}) (string, interface{}) { return conditionFromDisease(m.(*Disease)) },
+		fromFHIR: func(data []byte, m interface{}) (string, error) { return diseaseFromCondition(data, m.(*Disease)) },
+		search: map[string]fhirSearchParam{
+			"_id":       searchID,
+			"code:text": searchPrefix("name"),
+		},
+	},
+	{
+		capability: fhir.ResourceCapability{
+			Type:          fhir.TypeOrganization,
+			Documentation: "Clinics, from /clinic.",
+			Interaction:   fhir.Interactions,
+			SearchParam: []fhir.SearchParam{
+				{Name: "_id", Type: "token"},
+				{Name: "name", Type: "string"},
+			},
+		},
+		entity:    "clinic",
+		tenants:   true,
+		validate:  func(m interface{}) error { return validateClinic(m.(*Clinic)) },
+		newModel:  func() interface{} { return &Clinic{} },
+		newModels: func() interface{} { return &[]Clinic{} },
+		each: func(models interface{}, fn func(interface{})) {
+			for i := range *models.(*[]Clinic) {
+				fn(&(*models.(*[]Clinic))[i])
+			}
+		},
+		toFHIR:   func(m interface{}) (string, interface{}) { return organizationFromClinic(m.(*Clinic)) },
+		fromFHIR: func(data []byte, m interface{}) (string, error) { return clinicFromOrganization(data, m.(*Clinic)) },
+		search: map[string]fhirSearchParam{
+			"_id":  searchID,
+			"name": searchPrefix("name"),
+		},
+	},
+}
+
+// registerFHIR registers the /fhir routes. Patients are tenant-owned, so
+// their routes resolve the tenant like /user does, and Organizations are
+// written by the clinics they are, like /clinic.
+func (s *Server) registerFHIR(router *gin.Engine) {
+	group := router.Group("/fhir", s.limiter.MiddlewareWith("fhir", fhir.Fail))
+	group.GET("/metadata", s.fhirMetadata)
+	for _, r := range fhirResources {
+		routes := group.Group("/" + r.capability.Type)
+		if r.capability.Type == fhir.TypePatient {
+			routes.Use(s.tenancy.MiddlewareWith(fhir.Fail))
+		}
+		routes.GET("", s.fhirSearch(r))
+		routes.GET("/:id", s.fhirRead(r))
+		writes := routes
+		if r.tenants {
+			writes = routes.Group("", s.tenancy.MiddlewareWith(fhir.Fail))
+		}
+		writes.POST("", s.idempotency.MiddlewareWith(fhir.Fail), s.fhirCreate(r))
+		if r.tenants {
+			writes.PUT("/:id", fhirTenant, s.fhirUpdate(r))
+		} else {
+			writes.PUT("/:id", s.fhirUpdate(r))
+		}
+	}
+
+	export := group.Group("", s.tenancy.MiddlewareWith(fhir.Fail))
+	export.GET("/$export", s.exporter.KickOff)
+	export.GET("/$export-status/:jobID", s.exporter.Status)
+	export.DELETE("/$export-status/:jobID", s.exporter.Cancel)
+	export.GET("/$export-file/:jobID/:file", s.exporter.Download)
+}
+
+// fhirTenant is clinicTenant for the id of a resource that is a tenant.
+func fhirTenant(c *gin.Context) {
+	id, _ := tenant.FromContext(c.Request.Context())
+	if c.Param("id") != strconv.Itoa(id) {
+		fhir.Error(c, http.StatusForbidden, fhir.IssueSecurity, "tenant does not match the resource")
+		c.Abort()
+	}
+}
+
+// fhirExportBatchSize is the number of rows read at a time by exports.
+const fhirExportBatchSize = 500
+
+// fhirExportSources returns the bulk export sources of the resource types
+// served under /fhir.
+func fhirExportSources() []bulkexport.Source {
+	sources := make([]bulkexport.Source, len(fhirResources))
+	for i, r := range fhirResources {
+		sources[i] = bulkexport.Source{Type: r.capability.Type, Export: r.export}
+	}
+	return sources
+}
+
+// export calls fn with every resource updated after since, reading the
+// models in batches. Rows without an update time are always included.
+// Users are only included with their exportConsent.
+func (r *fhirResource) export(db *gorm.DB, since *time.Time, fn func(interface{}) error) error {
+	last := 0
+	for {
+		q := db.Where("id > ?", last).Order("id").Limit(fhirExportBatchSize)
+		if since != nil {
+			q = q.Where("(updated_at > ? OR updated_at IS NULL)", *since)
+		}
+		if r.exportConsent != "" {
+			q = q.Where("id IN (?)", consenting(db, r.exportConsent, "", time.Now()).Select("user_id"))
+		}
+		models := r.newModels()
+		if err := q.Find(models).Error; err != nil {
+			return err
+		}
+		n := 0
+		var ids []string
+		var err error
+		r.each(models, func(m interface{}) {
+			if err != nil {
+				return
+			}
+			id, resource := r.toFHIR(m)
+			last, _ = strconv.Atoi(id)
+			n++
+			if err = fn(resource); err == nil {
+				ids = append(ids, id)
+			}
+		})
+		if r.audited {
+			recordAccess(db, RecordAccess{Method: http.MethodGet, Route: "/fhir/$export", Status: http.StatusOK}, fhirIDs(ids)...)
+		}
+		if err != nil || n < fhirExportBatchSize {
+			return err
+		}
+	}
+}
+
+func (s *Server) fhirMetadata(c *gin.Context) {
+	resources := make([]fhir.ResourceCapability, len(fhirResources))
+	for i, r := range fhirResources {
+		resources[i] = r.capability
+	}
+	fhir.Write(c, http.StatusOK, fhir.NewCapabilityStatement(c, resources))
+}
+
+func (s *Server) fhirRead(r *fhirResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model, ok := s.fhirFind(c, r)
+		if !ok {
+			return
+		}
+		id, resource := r.toFHIR(model)
+		fhir.Write(c, http.StatusOK, resource)
+		s.fhirAudit(c, r, id)
+	}
+}
+
+func (s *Server) fhirSearch(r *fhirResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := fhir.ParsePage(c)
+		if err != nil {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+			return
+		}
+		var scopes []func(*gorm.DB) *gorm.DB
+		for name, values := range c.Request.URL.Query() {
+			if fhirResultParams[name] {
+				continue
+			}
+			param, ok := r.search[name]
+			if !ok {
+				fhir.Error(c, http.StatusBadRequest, fhir.IssueNotSupported, fmt.Sprintf("unknown search parameter %q", name))
+				return
+			}
+			for _, v := range values {
+				scope, err := param(v)
+				if err != nil {
+					fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, fmt.Sprintf("search parameter %q: %s", name, err))
+					return
+				}
+				scopes = append(scopes, scope)
+			}
+		}
+
+		var total int64
+		if err := s.dbFor(c).Model(r.newModel()).Scopes(scopes...).Count(&total).Error; err != nil {
+			fhir.InternalError(c, err)
+			return
+		}
+		models := r.newModels()
+		err = s.dbFor(c).Scopes(scopes...).Order("id").Limit(page.Count).Offset(page.Offset).Find(models).Error
+		if err != nil {
+			fhir.InternalError(c, err)
+			return
+		}
+		var ids []string
+		var resources []interface{}
+		r.each(models, func(m interface{}) {
+			id, resource := r.toFHIR(m)
+			ids = append(ids, id)
+			resources = append(resources, resource)
+		})
+		fhir.Write(c, http.StatusOK, fhir.NewSearchset(c, r.capability.Type, page, total, ids, resources))
+		s.fhirAudit(c, r, ids...)
+	}
+}
+
+func (s *Server) fhirCreate(r *fhirResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+			return
+		}
+		model := r.newModel()
+		// The server assigns IDs, so an ID in the body is ignored.
+		if _, err := r.fromFHIR(data, model); err != nil {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+			return
+		}
+		if !fhirValid(c, r, model) {
+			return
+		}
+		err = s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(model).Error; err != nil {
+				return err
+			}
+			return s.changes.publish(tx, r.entity+".created", model)
+		})
+		if err != nil {
+			fhir.InternalError(c, err)
+			return
+		}
+		id, resource := r.toFHIR(model)
+		c.Header("Location", fhir.BaseURL(c)+"/"+r.capability.Type+"/"+id)
+		fhir.Write(c, http.StatusCreated, resource)
+		s.fhirAudit(c, r, id)
+	}
+}
+
+func (s *Server) fhirUpdate(r *fhirResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+			return
+		}
+		model, ok := s.fhirFind(c, r)
+		if !ok {
+			return
+		}
+		id, err := r.fromFHIR(data, model)
+		if err != nil {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+			return
+		}
+		if id != c.Param("id") {
+			fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, "resource id does not match the URL")
+			return
+		}
+		if !fhirValid(c, r, model) {
+			return
+		}
+		err = s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(model).Error; err != nil {
+				return err
+			}
+			return s.changes.publish(tx, r.entity+".updated", model)
+		})
+		if err != nil {
+			fhir.InternalError(c, err)
+			return
+		}
+		_, resource := r.toFHIR(model)
+		fhir.Write(c, http.StatusOK, resource)
+		s.fhirAudit(c, r, id)
+	}
+}
+
+// fhirValid validates model if r has a check, answering 400 if it fails.
+func fhirValid(c *gin.Context, r *fhirResource, model interface{}) bool {
+	if r.validate == nil {
+		return true
+	}
+	if err := r.validate(model); err != nil {
+		fhir.Error(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+		return false
+	}
+	return true
+}
+
+// fhirAudit records the access of a request to the resources ids, if r is
+// audited.
+func (s *Server) fhirAudit(c *gin.Context, r *fhirResource, ids ...string) {
+	if r.audited {
+		recordAccess(s.dbFor(c), requestAccess(c, c.FullPath()), fhirIDs(ids)...)
+	}
+}
+
+// fhirIDs returns the user IDs of resource IDs.
+func fhirIDs(ids []string) []int {
+	userIDs := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil {
+			userIDs = append(userIDs, n)
+		}
+	}
+	return userIDs
+}
+
+// fhirFind loads the model named by the id parameter, answering 404 if
+// there is none.
+func (s *Server) fhirFind(c *gin.Context, r *fhirResource) (interface{}, bool) {
+	notFound := func() {
+		fhir.Error(c, http.StatusNotFound, fhir.IssueNotFound, fmt.Sprintf("%s/%s not found", r.capability.Type, c.Param("id")))
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		notFound()
+		return nil, false
+	}
+	model := r.newModel()
+	err = s.dbFor(c).First(model, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		notFound()
+		return nil, false
+	}
+	if err != nil {
+		fhir.InternalError(c, err)
+		return nil, false
+	}
+	return model, true
+}
+
+// searchID matches a comma-separated list of IDs.
+func searchID(value string) (func(*gorm.DB) *gorm.DB, error) {
+	var ids []int
+	for _, v := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.New("ids are integers")
+		}
+		ids = append(ids, id)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id IN ?", ids)
+	}, nil
+}
+
+// searchPrefix matches values of column starting with the parameter,
+// ignoring case, as FHIR string parameters do.
+func searchPrefix(column string) fhirSearchParam {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return func(value string) (func(*gorm.DB) *gorm.DB, error) {
+		pattern := strings.ToLower(escape.Replace(value)) + "%"
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("LOWER("+column+") LIKE ?", pattern)
+		}, nil
+	}
+}
+
+// searchEmail matches emails on their blind index, since they are
+// encrypted.
+func searchEmail(value string) (func(*gorm.DB) *gorm.DB, error) {
+	index, err := encryption.BlindIndex(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("email_index = ?", index)
+	}, nil
+}
+
+// decodeFHIR decodes resource JSON into v, checking its resourceType.
+func decodeFHIR(data []byte, resourceType string, v interface{}) error {
+	var header struct {
+		ResourceType string `json:"resourceType"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.ResourceType != resourceType {
+		return fmt.Errorf("resourceType must be %s", resourceType)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func patientFromUser(u *User) (string, interface{}) {
+	id := strconv.Itoa(u.ID)
+	p := fhir.Patient{ResourceType: fhir.TypePatient, ID: id, Meta: fhir.NewMeta(u.UpdatedAt)}
+	if u.Name != nil {
+		p.Name = []fhir.HumanName{{Text: *u.Name}}
+	}
+	if u.Email != nil {
+		p.Telecom = append(p.Telecom, fhir.ContactPoint{System: fhir.SystemEmail, Value: *u.Email})
+	}
+	if u.Contact != nil {
+		p.Telecom = append(p.Telecom, fhir.ContactPoint{System: fhir.SystemPhone, Value: *u.Contact})
+	}
+	if u.BirthDate != nil {
+		p.BirthDate = *u.BirthDate
+	}
+	if u.TenantID != 0 {
+		p.ManagingOrganization = &fhir.Reference{Reference: fhir.TypeOrganization + "/" + strconv.Itoa(u.TenantID)}
+	}
+	return id, p
+}
+
+func userFromPatient(data []byte, u *User) (string, error) {
+	var p fhir.Patient
+	if err := decodeFHIR(data, fhir.TypePatient, &p); err != nil {
+		return "", err
+	}
+	var name, email, contact string
+	if len(p.Name) > 0 {
+		name = p.Name[0].String()
+	}
+	for _, t := range p.Telecom {
+		switch {
+		case t.System == fhir.SystemEmail && email == "":
+			email = t.Value
+		case t.System != fhir.SystemEmail && contact == "":
+			contact = t.Value
+		}
+	}
+	switch {
+	case name == "":
+		return "", errors.New("Patient.name is required")
+	case email == "":
+		return "", errors.New("Patient.telecom with system email is required")
+	case contact == "":
+		return "", errors.New("Patient.telecom with system phone is required")
+	}
+	u.Name, u.Email, u.Contact = &name, &email, &contact
+	u.BirthDate = nil
+	if p.BirthDate != "" {
+		u.BirthDate = &p.BirthDate
+	}
+	if err := validateUser(u); err != nil {
+		return "", fmt.Errorf("Patient.%s", err)
+	}
+	return p.ID, nil
+}
+
+func medicationFromMed(m *Med) (string, interface{}) {
+	id := strconv.Itoa(m.ID)
+	r := fhir.Medication{ResourceType: fhir.TypeMedication, ID: id, Meta: fhir.NewMeta(m.UpdatedAt)}
+	if m.Name != nil {
+		r.Code = &fhir.CodeableConcept{Text: *m.Name}
+	}
+	if m.Desc != nil {
+		r.Text = fhir.NewNarrative(*m.Desc)
+	}
+	return id, r
+}
+
+func medFromMedication(data []byte, m *Med) (string, error) {
+	var r fhir.Medication
+	if err := decodeFHIR(data, fhir.TypeMedication, &r); err != nil {
+		return "", err
+	}
+	if r.Code == nil || r.Code.Text == "" {
+		return "", errors.New("Medication.code.text is required")
+	}
+	name, desc := r.Code.Text, r.Text.Text()
+	m.Name, m.Desc = &name, &desc
+	return r.ID, nil
+}
+
+func conditionFromDisease(d *Disease) (string, interface{}) {
+	id := strconv.Itoa(d.ID)
+	r := fhir.Condition{ResourceType: fhir.TypeCondition, ID: id, Meta: fhir.NewMeta(d.UpdatedAt)}
+	if d.Name != nil {
+		r.Code = &fhir.CodeableConcept{Text: *d.Name}
+	}
+	if d.Desc != nil && *d.Desc != "" {
+		r.Note = []fhir.Annotation{{Text: *d.Desc}}
+	}
+	return id, r
+}
+
+func diseaseFromCondition(data []byte, d *Disease) (string, error) {
+	var r fhir.Condition
+	if err := decodeFHIR(data, fhir.TypeCondition, &r); err != nil {
+		return "", err
+	}
+	if r.Code == nil || r.Code.Text == "" {
+		return "", errors.New("Condition.code.text is required")
+	}
+	name, desc := r.Code.Text, ""
+	if len(r.Note) > 0 {
+		desc = r.Note[0].Text
+	}
+	d.Name, d.Desc = &name, &desc
+	return r.ID, nil
+}
+
+func organizationFromClinic(cl *Clinic) (string, interface{}) {
+	id := strconv.Itoa(cl.ID)
+	r := fhir.Organization{ResourceType: fhir.TypeOrganization, ID: id, Meta: fhir.NewMeta(cl.UpdatedAt)}
+	if cl.Name != nil {
+		r.Name = *cl.Name
+	}
+	if cl.Desc != nil {
+		r.Text = fhir.NewNarrative(*cl.Desc)
+	}
+	if a := cl.Address; a != (Address{}) {
+		addr := fhir.Address{City: a.City, PostalCode: a.PostalCode, Country: a.Country}
+		if a.Line != "" {
+			addr.Line = []string{a.Line}
+		}
+		r.Address = []fhir.Address{addr}
+	}
+	return id, r
+}
+
+func clinicFromOrganization(data []byte, cl *Clinic) (string, error) {
+	var r fhir.Organization
+	if err := decodeFHIR(data, fhir.TypeOrganization, &r); err != nil {
+		return "", err
+	}
+	if r.Name == "" {
+		return "", errors.New("Organization.name is required")
+	}
+	name, desc := r.Name, r.Text.Text()
+	cl.Name, cl.Desc = &name, &desc
+	// An update replaces the whole resource, so a missing address is
+	// cleared.
+	cl.Address = Address{}
+	if len(r.Address) > 0 {
+		a := r.Address[0]
+		cl.Address = Address{Line: strings.Join(a.Line, ", "), City: a.City, PostalCode: a.PostalCode, Country: a.Country}
+	}
+	return r.ID, nil
+}
@@ -0,0 +1,116 @@
+package fhir
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bundle is a Bundle resource of type searchset.
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int64         `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+// BundleLink is a link of a Bundle, such as the next page of results.
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+// BundleEntry is an entry of a Bundle.
+type BundleEntry struct {
+	FullURL  string       `json:"fullUrl"`
+	Resource interface{}  `json:"resource"`
+	Search   *EntrySearch `json:"search,omitempty"`
+}
+
+// EntrySearch tells why an entry is in a searchset.
+type EntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+// BaseURL returns the absolute URL of the FHIR endpoint serving c, which
+// is mounted at /fhir.
+func BaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/fhir"
+}
+
+// Page is the page of search results asked for by the _count and _offset
+// parameters.
+type Page struct {
+	Count  int
+	Offset int
+}
+
+// Page sizes.
+const (
+	DefaultCount = 50
+	MaxCount     = 500
+)
+
+// ParsePage reads the page asked for by c.
+func ParsePage(c *gin.Context) (Page, error) {
+	p := Page{Count: DefaultCount}
+	if v, ok := c.GetQuery("_count"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, errInvalidParam("_count")
+		}
+		if n > MaxCount {
+			n = MaxCount
+		}
+		p.Count = n
+	}
+	if v, ok := c.GetQuery("_offset"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, errInvalidParam("_offset")
+		}
+		p.Offset = n
+	}
+	return p, nil
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return "invalid " + string(e) + " parameter"
+}
+
+// NewSearchset returns the searchset Bundle of one page of results out of
+// total, with self and next links.
+func NewSearchset(c *gin.Context, resourceType string, page Page, total int64, ids []string, resources []interface{}) Bundle {
+	base := BaseURL(c)
+	b := Bundle{ResourceType: "Bundle", Type: "searchset", Total: total}
+	self := base + "/" + resourceType
+	if c.Request.URL.RawQuery != "" {
+		self += "?" + c.Request.URL.RawQuery
+	}
+	b.Link = append(b.Link, BundleLink{Relation: "self", URL: self})
+	if next := page.Offset + page.Count; page.Count > 0 && int64(next) < total {
+		q := c.Request.URL.Query()
+		q.Set("_offset", strconv.Itoa(next))
+		q.Set("_count", strconv.Itoa(page.Count))
+		b.Link = append(b.Link, BundleLink{Relation: "next", URL: base + "/" + resourceType + "?" + q.Encode()})
+	}
+	for i, r := range resources {
+		b.Entry = append(b.Entry, BundleEntry{
+			FullURL:  base + "/" + resourceType + "/" + url.PathEscape(ids[i]),
+			Resource: r,
+			Search:   &EntrySearch{Mode: "match"},
+		})
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+package fhir
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CapabilityStatement is a CapabilityStatement resource, served at
+// /fhir/metadata.
+type CapabilityStatement struct {
+	ResourceType   string           `json:"resourceType"`
+	Status         string           `json:"status"`
+	Date           string           `json:"date"`
+	Kind           string           `json:"kind"`
+	Software       Software         `json:"software"`
+	Implementation Implementation   `json:"implementation"`
+	FHIRVersion    string           `json:"fhirVersion"`
+	Format         []string         `json:"format"`
+	Rest           []CapabilityRest `json:"rest"`
+}
+
+// Software describes the server software.
+type Software struct {
+	Name string `json:"name"`
+}
+
+// Implementation describes the server instance.
+type Implementation struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// CapabilityRest describes the RESTful endpoint.
+type CapabilityRest struct {
+	Mode     string               `json:"mode"`
+	Resource []ResourceCapability `json:"resource"`
+}
+
+// ResourceCapability describes what the endpoint supports for a resource
+// type.
+type ResourceCapability struct {
+	Type          string        `json:"type"`
+	Documentation string        `json:"documentation,omitempty"`
+	Interaction   []Interaction `json:"interaction"`
+	UpdateCreate  bool          `json:"updateCreate"`
+	SearchParam   []SearchParam `json:"searchParam,omitempty"`
+}
+
+// Interaction is a RESTful interaction, such as read or search-type.
+type Interaction struct {
+	Code string `json:"code"`
+}
+
+// SearchParam is a search parameter supported for a resource type.
+type SearchParam struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+// Interactions supported by every resource type of the facade.
+var Interactions = []Interaction{{"read"}, {"search-type"}, {"create"}, {"update"}}
+
+// started is reported as the date of the CapabilityStatement, which
+// cannot change while the process runs.
+var started = time.Now().UTC().Format(time.RFC3339)
+
+// NewCapabilityStatement returns the CapabilityStatement of a server
+// supporting resources.
+func NewCapabilityStatement(c *gin.Context, resources []ResourceCapability) CapabilityStatement {
+	return CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         started,
+		Kind:         "instance",
+		Software:     Software{Name: "medically-core"},
+		Implementation: Implementation{
+			Description: "FHIR facade over the medically core service",
+			URL:         BaseURL(c),
+		},
+		FHIRVersion: Version,
+		Format:      []string{"json"},
+		Rest:        []CapabilityRest{{Mode: "server", Resource: resources}},
+	}
+}
@@ -0,0 +1,85 @@
+package fhir
+
+import (
+	"fmt"
+	"net/http"
+
+	"medically-core/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of FHIR JSON.
+const ContentType = "application/fhir+json; charset=utf-8"
+
+// Issue types of OperationOutcome issues.
+const (
+	IssueInvalid      = "invalid"
+	IssueNotFound     = "not-found"
+	IssueNotSupported = "not-supported"
+	IssueTooLong      = "too-long"
+	IssueConflict     = "conflict"
+	IssueSecurity     = "security"
+	IssueThrottled    = "throttled"
+	IssueTransient    = "transient"
+	IssueException    = "exception"
+)
+
+// OperationOutcome is an OperationOutcome resource, the body of every
+// error response.
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+// Issue is an issue of an OperationOutcome.
+type Issue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// Write answers with resource as FHIR JSON.
+func Write(c *gin.Context, status int, resource interface{}) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(status, resource)
+}
+
+// Error answers with an OperationOutcome holding a single error.
+func Error(c *gin.Context, status int, code, diagnostics string) {
+	Write(c, status, OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []Issue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	})
+}
+
+// Fail is Error with the issue type derived from status, for middleware
+// that only knows the status.
+func Fail(c *gin.Context, status int, msg string) {
+	code := IssueException
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = IssueInvalid
+	case http.StatusUnauthorized, http.StatusForbidden:
+		code = IssueSecurity
+	case http.StatusNotFound:
+		code = IssueNotFound
+	case http.StatusConflict:
+		code = IssueConflict
+	case http.StatusRequestEntityTooLarge:
+		code = IssueTooLong
+	case http.StatusTooManyRequests:
+		code = IssueThrottled
+	case http.StatusServiceUnavailable:
+		code = IssueTransient
+	}
+	Error(c, status, code, msg)
+}
+
+// InternalError logs err and answers 500 without echoing it, since
+// database errors can contain patient data.
+func InternalError(c *gin.Context, err error) {
+	ctx := c.Request.Context()
+	logging.FromContext(ctx).Error("request failed", logging.Err(err))
+	Error(c, http.StatusInternalServerError, IssueException, fmt.Sprintf("internal error (request id %s)", logging.RequestIDFrom(ctx)))
+}
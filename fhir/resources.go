@@ -0,0 +1,170 @@
+// Package fhir implements the parts of HL7 FHIR R4 used by the /fhir
+// facade: resource and datatype JSON, search Bundles, the
+// CapabilityStatement and OperationOutcome errors.
+//
+// Only the elements the core models can fill are declared. Empty elements
+// are omitted, as FHIR JSON forbids empty strings, arrays and objects.
+package fhir
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Version is the FHIR version implemented.
+const Version = "4.0.1"
+
+// Resource types served by the facade.
+const (
+	TypePatient      = "Patient"
+	TypeMedication   = "Medication"
+	TypeCondition    = "Condition"
+	TypeOrganization = "Organization"
+)
+
+// Patient is a Patient resource.
+type Patient struct {
+	ResourceType         string         `json:"resourceType"`
+	ID                   string         `json:"id,omitempty"`
+	Meta                 *Meta          `json:"meta,omitempty"`
+	Name                 []HumanName    `json:"name,omitempty"`
+	Telecom              []ContactPoint `json:"telecom,omitempty"`
+	BirthDate            string         `json:"birthDate,omitempty"`
+	ManagingOrganization *Reference     `json:"managingOrganization,omitempty"`
+}
+
+// Medication is a Medication resource.
+type Medication struct {
+	ResourceType string           `json:"resourceType"`
+	ID           string           `json:"id,omitempty"`
+	Meta         *Meta            `json:"meta,omitempty"`
+	Text         *Narrative       `json:"text,omitempty"`
+	Code         *CodeableConcept `json:"code,omitempty"`
+}
+
+// Condition is a Condition resource.
+type Condition struct {
+	ResourceType string           `json:"resourceType"`
+	ID           string           `json:"id,omitempty"`
+	Meta         *Meta            `json:"meta,omitempty"`
+	Code         *CodeableConcept `json:"code,omitempty"`
+	Subject      *Reference       `json:"subject,omitempty"`
+	Note         []Annotation     `json:"note,omitempty"`
+}
+
+// Organization is an Organization resource.
+type Organization struct {
+	ResourceType string     `json:"resourceType"`
+	ID           string     `json:"id,omitempty"`
+	Meta         *Meta      `json:"meta,omitempty"`
+	Text         *Narrative `json:"text,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	Address      []Address  `json:"address,omitempty"`
+}
+
+// Meta is the metadata of a resource.
+type Meta struct {
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+// NewMeta returns the metadata of a resource last updated at t, or nil
+// if that is unknown.
+func NewMeta(t *time.Time) *Meta {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return &Meta{LastUpdated: t.UTC().Format(time.RFC3339Nano)}
+}
+
+// HumanName is a HumanName datatype.
+type HumanName struct {
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+// String returns the name as written, from text or else from its parts.
+func (n HumanName) String() string {
+	if n.Text != "" {
+		return n.Text
+	}
+	parts := append([]string(nil), n.Given...)
+	if n.Family != "" {
+		parts = append(parts, n.Family)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ContactPoint systems.
+const (
+	SystemEmail = "email"
+	SystemPhone = "phone"
+)
+
+// ContactPoint is a ContactPoint datatype.
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// Address is an Address datatype.
+type Address struct {
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+// Reference is a Reference datatype.
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+// CodeableConcept is a CodeableConcept datatype.
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Coding is a Coding datatype.
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Annotation is an Annotation datatype.
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+// Narrative is the human-readable summary of a resource.
+type Narrative struct {
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+// NewNarrative returns a generated narrative showing text, or nil if text
+// is empty.
+func NewNarrative(text string) *Narrative {
+	if text == "" {
+		return nil
+	}
+	return &Narrative{
+		Status: "generated",
+		Div:    `<div xmlns="http://www.w3.org/1999/xhtml">` + html.EscapeString(text) + `</div>`,
+	}
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// Text returns the text shown by the narrative, without markup.
+func (n *Narrative) Text() string {
+	if n == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(tags.ReplaceAllString(n.Div, "")))
+}
@@ -0,0 +1,185 @@
+// Package gqlcost bounds the depth and complexity of GraphQL queries
+// before they are executed, so a single request cannot make the server
+// load arbitrarily many rows.
+//
+// Every field costs 1. The fields selected below a list cost as many
+// times as the list is expected to be long: the value of its "first"
+// argument if it has one, and the default of the Limits otherwise.
+// Introspection fields are free.
+package gqlcost
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound a query.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+	// ListSize is the expected length of lists without a "first"
+	// argument.
+	ListSize int
+}
+
+// Check returns an error if the operation of doc named operationName, or
+// its only operation, exceeds the limits. Values of variables are used
+// for "first" arguments. doc must have been validated.
+func Check(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}, limits Limits) error {
+	w := walker{schema: schema, fragments: make(map[string]*ast.FragmentDefinition), variables: variables, limits: limits}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			w.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || def.Name != nil && def.Name.Value == operationName {
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		return nil
+	}
+	var root *graphql.Object
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	default:
+		root = schema.QueryType()
+	}
+	if root == nil {
+		return nil
+	}
+	depth, cost := w.selections(root, op.SelectionSet, 1)
+	if depth > limits.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, limits.MaxDepth)
+	}
+	if cost > limits.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", cost, limits.MaxComplexity)
+	}
+	return nil
+}
+
+type walker struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	limits    Limits
+}
+
+// selections returns the depth and cost of set, selected on parent at
+// depth.
+func (w *walker) selections(parent graphql.Type, set *ast.SelectionSet, depth int) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, cost := 0, 0
+	add := func(d, c int) {
+		if d > maxDepth {
+			maxDepth = d
+		}
+		cost += c
+	}
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			add(w.field(parent, sel, depth))
+		case *ast.InlineFragment:
+			t := parent
+			if sel.TypeCondition != nil {
+				t = w.typeNamed(sel.TypeCondition.Name.Value, parent)
+			}
+			add(w.selections(t, sel.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			if f, ok := w.fragments[sel.Name.Value]; ok {
+				add(w.selections(w.typeNamed(f.TypeCondition.Name.Value, parent), f.SelectionSet, depth))
+			}
+		}
+	}
+	return maxDepth, cost
+}
+
+// field returns the depth and cost of f, selected on parent at depth.
+func (w *walker) field(parent graphql.Type, f *ast.Field, depth int) (int, int) {
+	if strings.HasPrefix(f.Name.Value, "__") {
+		return 0, 0
+	}
+	var t graphql.Type
+	var def *graphql.FieldDefinition
+	if obj, ok := parent.(*graphql.Object); ok {
+		if def = obj.Fields()[f.Name.Value]; def != nil {
+			t = def.Type
+		}
+	}
+	size, list := 1, false
+	for {
+		if nn, ok := t.(*graphql.NonNull); ok {
+			t = nn.OfType
+			continue
+		}
+		if l, ok := t.(*graphql.List); ok {
+			t, list = l.OfType, true
+			continue
+		}
+		break
+	}
+	if list {
+		// Resolvers refuse negative sizes, which must not lower the
+		// cost of the rest of the query.
+		if size = w.first(f, def); size < 0 {
+			size = 0
+		}
+	}
+	d, c := w.selections(t, f.SelectionSet, depth+1)
+	if d < depth {
+		d = depth
+	}
+	return d, 1 + size*c
+}
+
+// first returns the "first" argument of a list field, or its default, or
+// the default list size.
+func (w *walker) first(f *ast.Field, def *graphql.FieldDefinition) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return n
+			}
+		case *ast.Variable:
+			switch n := w.variables[v.Name.Value].(type) {
+			case int:
+				return n
+			case float64:
+				return int(n)
+			}
+		}
+	}
+	if def != nil {
+		for _, arg := range def.Args {
+			if n, ok := arg.DefaultValue.(int); ok && arg.Name() == "first" {
+				return n
+			}
+		}
+	}
+	return w.limits.ListSize
+}
+
+// typeNamed returns the type named name, or parent if the schema has
+// none.
+func (w *walker) typeNamed(name string, parent graphql.Type) graphql.Type {
+	if t := w.schema.Type(name); t != nil {
+		return t
+	}
+	return parent
+}
@@ -0,0 +1,100 @@
+package gqlcost
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// testSchema has users with lists of prescriptions, which have a med.
+func testSchema(t *testing.T) *graphql.Schema {
+	med := graphql.NewObject(graphql.ObjectConfig{Name: "Med", Fields: graphql.Fields{
+		"id":   {Type: graphql.Int},
+		"name": {Type: graphql.String},
+	}})
+	prescription := graphql.NewObject(graphql.ObjectConfig{Name: "Prescription", Fields: graphql.Fields{
+		"id":  {Type: graphql.Int},
+		"med": {Type: med},
+	}})
+	user := graphql.NewObject(graphql.ObjectConfig{Name: "User", Fields: graphql.Fields{
+		"id":            {Type: graphql.Int},
+		"name":          {Type: graphql.String},
+		"prescriptions": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(prescription)))},
+	}})
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"user": {Type: user, Args: graphql.FieldConfigArgument{"id": {Type: graphql.Int}}},
+		"users": {Type: graphql.NewList(user), Args: graphql.FieldConfigArgument{
+			"first": {Type: graphql.Int, DefaultValue: 20},
+		}},
+	}})
+	mutation := graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: graphql.Fields{
+		"deleteUser": {Type: user, Args: graphql.FieldConfigArgument{"id": {Type: graphql.Int}}},
+	}})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &schema
+}
+
+func parse(t *testing.T, query string) *ast.Document {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("parsing %q: %v", query, err)
+	}
+	return doc
+}
+
+func TestCheck(t *testing.T) {
+	schema := testSchema(t)
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]interface{}
+		depth     int
+		cost      int
+	}{
+		{"one field", `{ user(id: 1) { name } }`, "", nil, 2, 2},
+		// users and name and prescriptions of each of 20 users, and id
+		// and med of each of 10 prescriptions.
+		{"default sizes", `{ users { name prescriptions { id med { name } } } }`, "", nil, 4, 1 + 20*(1+1+10*(1+1+1))},
+		{"first argument", `{ users(first: 2) { name } }`, "", nil, 2, 1 + 2*1},
+		{"first variable", `query($n: Int) { users(first: $n) { name } }`, "", map[string]interface{}{"n": 3}, 2, 1 + 3*1},
+		{"JSON number variable", `query($n: Int) { users(first: $n) { name } }`, "", map[string]interface{}{"n": float64(4)}, 2, 1 + 4*1},
+		{"negative first", `{ a: users(first: -1000) { name } b: user(id: 1) { name } }`, "", nil, 2, 1 + 2},
+		{"fragments", `{ user(id: 1) { ...f ... on User { id } } } fragment f on User { name }`, "", nil, 2, 3},
+		{"introspection is free", `{ __schema { types { name } } user(id: 1) { __typename name } }`, "", nil, 2, 2},
+		{"named operation", `query a { user(id: 1) { name } } query b { users { name } }`, "b", nil, 2, 1 + 20},
+		{"mutation", `mutation { deleteUser(id: 1) { prescriptions { id } } }`, "", nil, 3, 1 + 1 + 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parse(t, tt.query)
+			fits := Limits{MaxDepth: tt.depth, MaxComplexity: tt.cost, ListSize: 10}
+			if err := Check(schema, doc, tt.operation, tt.variables, fits); err != nil {
+				t.Errorf("at the limits: %v", err)
+			}
+			deep := fits
+			deep.MaxDepth--
+			if err := Check(schema, doc, tt.operation, tt.variables, deep); err == nil || !strings.Contains(err.Error(), "depth") {
+				t.Errorf("below the depth: %v, want a depth error", err)
+			}
+			costly := fits
+			costly.MaxComplexity--
+			if err := Check(schema, doc, tt.operation, tt.variables, costly); err == nil || !strings.Contains(err.Error(), "complexity") {
+				t.Errorf("below the complexity: %v, want a complexity error", err)
+			}
+		})
+	}
+}
+
+func TestCheckUnknownOperation(t *testing.T) {
+	doc := parse(t, `query a { users { name } }`)
+	if err := Check(testSchema(t), doc, "b", nil, Limits{}); err != nil {
+		t.Errorf("Check = %v, want nil for an operation the document lacks", err)
+	}
+}
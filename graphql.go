@@ -0,0 +1,642 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"medically-core/dataloader"
+	"medically-core/gqlcost"
+	"medically-core/logging"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// graphQLPage is the default and maxGraphQLPage the largest number of
+	// entities a list query returns.
+	graphQLPage    = 50
+	maxGraphQLPage = 100
+	// graphQLListSize is the number of items the query limits expect of
+	// lists without a "first" argument, such as the prescriptions of a
+	// user.
+	graphQLListSize = 10
+)
+
+// errInvalidInput is returned for mutations whose input is rejected; its
+// message is shown to the client.
+var errInvalidInput = errors.New("invalid input")
+
+// errClinicTenant is returned for changes to a clinic other than the
+// tenant of the request.
+var errClinicTenant = errors.New("tenant does not match the clinic")
+
+// graphQLEntity is an entity that can be queried and changed through
+// GraphQL, under the same event names as the REST routes.
+type graphQLEntity struct {
+	name     string
+	model    interface{}
+	validate func(interface{}) error
+	// ownClinic entities are clinics, which only their own tenant may
+	// change, as on /clinic/:clinicID.
+	ownClinic bool
+	// audited entities are the records of users. As on /user, access to
+	// them is recorded, and the IDs of users merged into others resolve
+	// to the survivors.
+	audited bool
+	// erased entities have no delete mutation: users are erased through
+	// erasure requests instead.
+	erased bool
+}
+
+var graphQLEntities = []graphQLEntity{
+	{name: "user", model: &User{}, erased: true, audited: true, validate: func(v interface{}) error { return validateUser(v.(*User)) }},
+	{name: "med", model: &Med{}},
+	{name: "disease", model: &Disease{}},
+	{name: "clinic", model: &Clinic{}, ownClinic: true, validate: func(v interface{}) error { return validateClinic(v.(*Clinic)) }},
+}
+
+// newModel returns a new value of the entity's model.
+func (e graphQLEntity) newModel() interface{} {
+	return reflect.New(reflect.TypeOf(e.model).Elem()).Interface()
+}
+
+// typeName returns the GraphQL type name of the entity, such as "User".
+func (e graphQLEntity) typeName() string {
+	return reflect.TypeOf(e.model).Elem().Name()
+}
+
+// graphQLContext is the state of one request: its database handle, the
+// access it records to the records of users and the loaders that batch
+// the relations it resolves.
+type graphQLContext struct {
+	db            *gorm.DB
+	access        RecordAccess
+	clinics       *dataloader.Loader
+	meds          *dataloader.Loader
+	diseases      *dataloader.Loader
+	prescriptions *dataloader.Loader
+	diagnoses     *dataloader.Loader
+}
+
+type graphQLContextKey struct{}
+
+// newGraphQLContext creates the state of a request reading from db.
+func newGraphQLContext(db *gorm.DB, access RecordAccess) *graphQLContext {
+	return &graphQLContext{
+		db:     db,
+		access: access,
+		clinics: dataloader.New(func(ids []int) (map[int]interface{}, error) {
+			var clinics []Clinic
+			if err := db.Find(&clinics, ids).Error; err != nil {
+				return nil, err
+			}
+			values := make(map[int]interface{}, len(clinics))
+			for i := range clinics {
+				values[clinics[i].ID] = &clinics[i]
+			}
+			return values, nil
+		}),
+		meds: dataloader.New(func(ids []int) (map[int]interface{}, error) {
+			var meds []Med
+			if err := db.Find(&meds, ids).Error; err != nil {
+				return nil, err
+			}
+			values := make(map[int]interface{}, len(meds))
+			for i := range meds {
+				values[meds[i].ID] = &meds[i]
+			}
+			return values, nil
+		}),
+		diseases: dataloader.New(func(ids []int) (map[int]interface{}, error) {
+			var diseases []Disease
+			if err := db.Find(&diseases, ids).Error; err != nil {
+				return nil, err
+			}
+			values := make(map[int]interface{}, len(diseases))
+			for i := range diseases {
+				values[diseases[i].ID] = &diseases[i]
+			}
+			return values, nil
+		}),
+		prescriptions: dataloader.New(func(userIDs []int) (map[int]interface{}, error) {
+			var prescriptions []Prescription
+			if err := db.Where("user_id IN ?", userIDs).Order("id").Find(&prescriptions).Error; err != nil {
+				return nil, err
+			}
+			byUser := make(map[int][]*Prescription)
+			for i := range prescriptions {
+				p := &prescriptions[i]
+				byUser[p.UserID] = append(byUser[p.UserID], p)
+			}
+			values := make(map[int]interface{}, len(byUser))
+			for id, ps := range byUser {
+				values[id] = ps
+			}
+			return values, nil
+		}),
+		diagnoses: dataloader.New(func(userIDs []int) (map[int]interface{}, error) {
+			var diagnoses []Diagnosis
+			if err := db.Where("user_id IN ?", userIDs).Order("diagnosed_on, id").Find(&diagnoses).Error; err != nil {
+				return nil, err
+			}
+			byUser := make(map[int][]*Diagnosis)
+			for i := range diagnoses {
+				d := &diagnoses[i]
+				byUser[d.UserID] = append(byUser[d.UserID], d)
+			}
+			values := make(map[int]interface{}, len(byUser))
+			for id, ds := range byUser {
+				values[id] = ds
+			}
+			return values, nil
+		}),
+	}
+}
+
+// graphQLRequest is a GraphQL request as posted by clients.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// ----------------------------  GraphQL Server Methods ---------------------------------//
+
+// graphQLHandler serves GraphQL queries over the models. Users and the
+// relations below them are only served to requests with a tenant, as on
+// the REST routes.
+func (s *Server) graphQLHandler() gin.HandlerFunc {
+	schema, err := s.graphQLSchema()
+	if err != nil {
+		// The schema is derived from the models, so this is a bug.
+		panic(fmt.Sprintf("graphql: %v", err))
+	}
+	limits := gqlcost.Limits{
+		MaxDepth:      s.graphQL.MaxDepth,
+		MaxComplexity: s.graphQL.MaxComplexity,
+		ListSize:      graphQLListSize,
+	}
+
+	return func(c *gin.Context) {
+		var req graphQLRequest
+		if c.Request.Method == http.MethodGet {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if v := c.Query("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					graphQLFail(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+					return
+				}
+			}
+		} else if err := BindJSON(c, &req); err != nil {
+			graphQLFail(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			graphQLFail(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+			return
+		}
+		if res := graphql.ValidateDocument(&schema, doc, nil); !res.IsValid {
+			graphQLFail(c, http.StatusBadRequest, res.Errors)
+			return
+		}
+		// GET requests must not change anything, as caches and browsers
+		// repeat them.
+		if op := graphQLOperation(doc, req.OperationName); op != nil && op.Operation != ast.OperationTypeQuery && c.Request.Method == http.MethodGet {
+			graphQLFail(c, http.StatusMethodNotAllowed, gqlerrors.FormatErrors(errors.New("mutations must be posted")))
+			return
+		}
+		if err := gqlcost.Check(&schema, doc, req.OperationName, req.Variables, limits); err != nil {
+			graphQLFail(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), graphQLContextKey{}, newGraphQLContext(s.dbFor(c), requestAccess(c, "")))
+		res := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       ctx,
+		})
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// graphQLFail answers a request that cannot be executed.
+func graphQLFail(c *gin.Context, status int, errs []gqlerrors.FormattedError) {
+	c.JSON(status, gin.H{"errors": errs})
+}
+
+// graphQLOperation returns the operation of doc named name, or its only
+// operation.
+func graphQLOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		if def, ok := def.(*ast.OperationDefinition); ok && (name == "" || def.Name != nil && def.Name.Value == name) {
+			op = def
+		}
+	}
+	return op
+}
+
+// graphQLSchema derives the schema from the models. Each entity has a
+// query by ID, a paged list query and create, update and, except for
+// users, delete mutations; users also resolve their clinic,
+// prescriptions and diagnoses.
+func (s *Server) graphQLSchema() (graphql.Schema, error) {
+	objects := make(map[reflect.Type]*graphql.Object)
+	inputs := make(map[reflect.Type]*graphql.InputObject)
+	object := func(model interface{}) *graphql.Object {
+		return graphQLObject(reflect.TypeOf(model).Elem(), objects)
+	}
+
+	user, med, disease, clinic := object(&User{}), object(&Med{}), object(&Disease{}), object(&Clinic{})
+	prescription, diagnosis := object(&Prescription{}), object(&Diagnosis{})
+
+	user.AddFieldConfig("clinic", &graphql.Field{
+		Type: clinic,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphQLLoad(p.Context, graphQLContextFrom(p.Context).clinics, p.Source.(*User).TenantID, nil), nil
+		},
+	})
+	user.AddFieldConfig("prescriptions", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(prescription))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphQLLoad(p.Context, graphQLContextFrom(p.Context).prescriptions, p.Source.(*User).ID, []*Prescription{}), nil
+		},
+	})
+	user.AddFieldConfig("diagnoses", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(diagnosis))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphQLLoad(p.Context, graphQLContextFrom(p.Context).diagnoses, p.Source.(*User).ID, []*Diagnosis{}), nil
+		},
+	})
+	prescription.AddFieldConfig("med", &graphql.Field{
+		Type: med,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphQLLoad(p.Context, graphQLContextFrom(p.Context).meds, p.Source.(*Prescription).MedID, nil), nil
+		},
+	})
+	diagnosis.AddFieldConfig("disease", &graphql.Field{
+		Type: disease,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphQLLoad(p.Context, graphQLContextFrom(p.Context).diseases, p.Source.(*Diagnosis).DiseaseID, nil), nil
+		},
+	})
+
+	queries, mutations := graphql.Fields{}, graphql.Fields{}
+	for _, e := range graphQLEntities {
+		e := e
+		t := reflect.TypeOf(e.model).Elem()
+		obj := objects[t]
+		input := graphQLInput(t, inputs)
+		plural := e.name + "s"
+
+		queries[e.name] = &graphql.Field{
+			Type: obj,
+			Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := e.id(p)
+				if err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				v := e.newModel()
+				err = graphQLDB(p).Take(v, "id = ?", id).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, nil
+				}
+				if err == nil {
+					e.audit(p, v)
+				}
+				return v, graphQLError(p.Context, err)
+			},
+		}
+		args := graphql.FieldConfigArgument{
+			"first": {Type: graphql.Int, DefaultValue: graphQLPage},
+			"after": {Type: graphql.Int, DefaultValue: 0, Description: "Only return entities with a greater ID."},
+		}
+		if e.name == "user" {
+			args["email"] = &graphql.ArgumentConfig{Type: graphql.String}
+		}
+		queries[plural] = &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(obj))),
+			Args: args,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				first, _ := p.Args["first"].(int)
+				if first < 1 || first > maxGraphQLPage {
+					return nil, fmt.Errorf("first must be between 1 and %d", maxGraphQLPage)
+				}
+				email, _ := p.Args["email"].(string)
+				db, err := usersWithEmail(graphQLDB(p), email)
+				if err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				db = db.Where("id > ?", p.Args["after"]).Order("id").Limit(first)
+				list := reflect.New(reflect.SliceOf(reflect.TypeOf(e.model)))
+				if err := db.Find(list.Interface()).Error; err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				models := make([]interface{}, list.Elem().Len())
+				for i := range models {
+					models[i] = list.Elem().Index(i).Interface()
+				}
+				e.audit(p, models...)
+				return list.Elem().Interface(), nil
+			},
+		}
+
+		name := e.typeName()
+		mutations["create"+name] = &graphql.Field{
+			Type: obj,
+			Args: graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(input)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				v := e.newModel()
+				if err := e.decode(p.Args["input"], v); err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				err := s.createEntity(graphQLDB(p), e.name, v)
+				if err == nil {
+					e.audit(p, v)
+				}
+				return v, graphQLError(p.Context, err)
+			},
+		}
+		mutations["update"+name] = &graphql.Field{
+			Type:        obj,
+			Description: "Changes the fields given in input.",
+			Args: graphql.FieldConfigArgument{
+				"id":    {Type: graphql.NewNonNull(graphql.Int)},
+				"input": {Type: graphql.NewNonNull(input)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := e.id(p)
+				if err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				v := e.newModel()
+				err = graphQLDB(p).Transaction(func(tx *gorm.DB) error {
+					if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(v, "id = ?", id).Error; err != nil {
+						return err
+					}
+					if err := e.decode(p.Args["input"], v); err != nil {
+						return err
+					}
+					if err := tx.Save(v).Error; err != nil {
+						return err
+					}
+					return s.changes.publish(tx, e.name+".updated", v)
+				})
+				if err == nil {
+					e.audit(p, v)
+				}
+				return v, graphQLError(p.Context, err)
+			},
+		}
+		if e.erased {
+			continue
+		}
+		mutations["delete"+name] = &graphql.Field{
+			Type:        obj,
+			Description: "Returns the deleted entity.",
+			Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := e.id(p)
+				if err != nil {
+					return nil, graphQLError(p.Context, err)
+				}
+				v := e.newModel()
+				err = s.deleteEntity(graphQLDB(p), e.name, v, id)
+				return v, graphQLError(p.Context, err)
+			},
+		}
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queries}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutations}),
+	})
+}
+
+// id returns the id argument of a resolver of the entity. Users merged
+// into others resolve to the survivors, and clinics are only changed by
+// their own tenant.
+func (e graphQLEntity) id(p graphql.ResolveParams) (int, error) {
+	id, _ := p.Args["id"].(int)
+	if e.ownClinic && p.Info.Operation.GetOperation() == ast.OperationTypeMutation {
+		if tenantID, ok := tenant.FromContext(p.Context); !ok || tenantID != id {
+			return 0, errClinicTenant
+		}
+	}
+	if e.audited {
+		return survivorID(graphQLDB(p), id)
+	}
+	return id, nil
+}
+
+// audit records the access of a resolver to models, if the entity is
+// audited.
+func (e graphQLEntity) audit(p graphql.ResolveParams, models ...interface{}) {
+	if !e.audited {
+		return
+	}
+	ids := make([]int, len(models))
+	for i, m := range models {
+		ids[i] = int(reflect.ValueOf(m).Elem().FieldByName("ID").Int())
+	}
+	access := graphQLContextFrom(p.Context).access
+	access.Route = "/graphql/" + p.Info.FieldName
+	recordAccess(graphQLDB(p), access, ids...)
+}
+
+// decode sets the fields of the model v given in input and validates it.
+// Input fields are named as in JSON, so input is decoded as JSON.
+func (e graphQLEntity) decode(input interface{}, v interface{}) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidInput, err)
+	}
+	if e.validate != nil {
+		if err := e.validate(v); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidInput, err)
+		}
+	}
+	return nil
+}
+
+// graphQLDB returns the database handle of the request of a resolver,
+// scoped to its tenant as on the REST routes.
+func graphQLDB(p graphql.ResolveParams) *gorm.DB {
+	return graphQLContextFrom(p.Context).db
+}
+
+// graphQLContextFrom returns the state of the request of ctx.
+func graphQLContextFrom(ctx context.Context) *graphQLContext {
+	return ctx.Value(graphQLContextKey{}).(*graphQLContext)
+}
+
+// graphQLLoad returns a thunk resolving to the value of key, or to empty
+// if it has none.
+func graphQLLoad(ctx context.Context, l *dataloader.Loader, key int, empty interface{}) func() (interface{}, error) {
+	load := l.Load(key)
+	return func() (interface{}, error) {
+		v, err := load()
+		if err != nil {
+			return nil, graphQLError(ctx, err)
+		}
+		if v == nil {
+			return empty, nil
+		}
+		return v, nil
+	}
+}
+
+// graphQLError returns the error the client is shown for err. Unexpected
+// errors are logged and not echoed, as in internalError.
+func graphQLError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, tenant.ErrMissing):
+		return errors.New("tenant required")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return errors.New("record not found")
+	case errors.Is(err, errInvalidInput), errors.Is(err, errClinicTenant):
+		return err
+	}
+	logging.FromContext(ctx).Error("graphql resolver failed", logging.Err(err))
+	return fmt.Errorf("internal error (request id %s)", logging.RequestIDFrom(ctx))
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// graphQLObject derives an object type from the JSON fields of a struct
+// type, caching it in objects.
+func graphQLObject(t reflect.Type, objects map[reflect.Type]*graphql.Object) *graphql.Object {
+	if obj, ok := objects[t]; ok {
+		return obj
+	}
+	fields := graphql.Fields{}
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := graphQLFieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		typ := graphQLOutput(t.Field(i).Type, objects)
+		if typ == nil {
+			continue
+		}
+		if name == "id" {
+			typ = graphql.NewNonNull(typ)
+		}
+		fields[name] = &graphql.Field{Type: typ}
+	}
+	obj := graphql.NewObject(graphql.ObjectConfig{Name: t.Name(), Fields: fields})
+	objects[t] = obj
+	return obj
+}
+
+func graphQLOutput(t reflect.Type, objects map[reflect.Type]*graphql.Object) graphql.Output {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s := graphQLScalar(t); s != nil {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if elem := graphQLOutput(t.Elem(), objects); elem != nil {
+			return graphql.NewList(elem)
+		}
+	case reflect.Struct:
+		return graphQLObject(t, objects)
+	}
+	return nil
+}
+
+// graphQLInput derives an input type from the JSON fields of a struct
+// type, without the ID and tenant, which clients do not set, caching it
+// in inputs.
+func graphQLInput(t reflect.Type, inputs map[reflect.Type]*graphql.InputObject) *graphql.InputObject {
+	if in, ok := inputs[t]; ok {
+		return in
+	}
+	fields := graphql.InputObjectConfigFieldMap{}
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := graphQLFieldName(t.Field(i))
+		if !ok || name == "id" || name == "tenantId" {
+			continue
+		}
+		if typ := graphQLInputType(t.Field(i).Type, inputs); typ != nil {
+			fields[name] = &graphql.InputObjectFieldConfig{Type: typ}
+		}
+	}
+	in := graphql.NewInputObject(graphql.InputObjectConfig{Name: t.Name() + "Input", Fields: fields})
+	inputs[t] = in
+	return in
+}
+
+func graphQLInputType(t reflect.Type, inputs map[reflect.Type]*graphql.InputObject) graphql.Input {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s := graphQLScalar(t); s != nil {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if elem := graphQLInputType(t.Elem(), inputs); elem != nil {
+			return graphql.NewList(elem)
+		}
+	case reflect.Struct:
+		return graphQLInput(t, inputs)
+	}
+	return nil
+}
+
+func graphQLScalar(t reflect.Type) *graphql.Scalar {
+	if t == timeType {
+		return graphql.DateTime
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return graphql.Int
+	case reflect.String:
+		return graphql.String
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Float64:
+		return graphql.Float
+	}
+	return nil
+}
+
+// graphQLFieldName returns the JSON name of a struct field, reporting
+// false for fields left out of JSON.
+func graphQLFieldName(f reflect.StructField) (string, bool) {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" || name == "" || f.PkgPath != "" {
+		return "", false
+	}
+	return name, true
+}
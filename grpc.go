@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"medically-core/client"
+	"medically-core/config"
+	"medically-core/health"
+	"medically-core/logging"
+	pb "medically-core/medicallypb"
+	"medically-core/tenant"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	// grpcListBatch is the number of rows list streams read at a time.
+	grpcListBatch = 500
+	// grpcHealthInterval is how often the health service runs the
+	// readiness checks.
+	grpcHealthInterval = 10 * time.Second
+)
+
+// grpcServices are the names the health service reports on, besides the
+// server as a whole.
+var grpcServices = []string{
+	pb.UserService_ServiceDesc.ServiceName,
+	pb.MedService_ServiceDesc.ServiceName,
+	pb.DiseaseService_ServiceDesc.ServiceName,
+	pb.ClinicService_ServiceDesc.ServiceName,
+}
+
+// grpcServer is the gRPC server of the API and its health service.
+type grpcServer struct {
+	srv    *grpc.Server
+	health *grpchealth.Server
+}
+
+// newGRPCServer creates the gRPC server of the API, with the health
+// service and, if configured, reflection. Calls are logged, traced, rate
+// limited and scoped to the tenant in their metadata, calls with an
+// idempotency key are idempotent, and access to the records of users is
+// recorded, as on the REST routes.
+func newGRPCServer(s *Server, logger *logging.Logger, cfg config.GRPCConfig) *grpcServer {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor(logger),
+			otelgrpc.UnaryServerInterceptor(),
+			s.limiter.UnaryServerInterceptor("grpc"),
+			s.tenancy.UnaryServerInterceptor(),
+			s.idempotency.UnaryServerInterceptor(),
+			s.auditUnaryCall,
+		),
+		grpc.ChainStreamInterceptor(
+			logging.StreamServerInterceptor(logger),
+			otelgrpc.StreamServerInterceptor(),
+			s.limiter.StreamServerInterceptor("grpc"),
+			s.tenancy.StreamServerInterceptor(),
+			s.auditStreamCall,
+		),
+	)
+	api := &grpcAPI{s: s}
+	pb.RegisterUserServiceServer(srv, api)
+	pb.RegisterMedServiceServer(srv, api)
+	pb.RegisterDiseaseServiceServer(srv, api)
+	pb.RegisterClinicServiceServer(srv, api)
+
+	hs := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	if cfg.Reflection {
+		reflection.Register(srv)
+	}
+	return &grpcServer{srv: srv, health: hs}
+}
+
+// Serve serves calls on lis until the server stops.
+func (g *grpcServer) Serve(lis net.Listener) error {
+	return g.srv.Serve(lis)
+}
+
+// Drain marks every service as not serving, so clients that watch their
+// health stop sending calls.
+func (g *grpcServer) Drain() {
+	g.health.Shutdown()
+}
+
+// Stop stops the server once the calls in progress are done, cancelling
+// those still running when ctx is done.
+func (g *grpcServer) Stop(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		g.srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		g.srv.Stop()
+	}
+}
+
+// WatchHealth reports the readiness checks of probes on the health
+// service until ctx is done or the server drains.
+func (g *grpcServer) WatchHealth(ctx context.Context, probes *health.Registry) {
+	ticker := time.NewTicker(grpcHealthInterval)
+	defer ticker.Stop()
+	for {
+		serving := healthpb.HealthCheckResponse_NOT_SERVING
+		if probes.Run(ctx).OK() {
+			serving = healthpb.HealthCheckResponse_SERVING
+		}
+		g.health.SetServingStatus("", serving)
+		for _, name := range grpcServices {
+			g.health.SetServingStatus(name, serving)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// grpcAPI implements the gRPC services with the logic of the REST
+// handlers.
+type grpcAPI struct {
+	pb.UnimplementedUserServiceServer
+	pb.UnimplementedMedServiceServer
+	pb.UnimplementedDiseaseServiceServer
+	pb.UnimplementedClinicServiceServer
+
+	s *Server
+}
+
+// db returns the database handle of a call, scoped to its tenant.
+func (a *grpcAPI) db(ctx context.Context) *gorm.DB {
+	return tenant.DBFromContext(ctx, a.s.db)
+}
+
+// auditUnaryCall records the calls that read or changed the record of a
+// user, once they succeed, as auditAccess does for /user.
+func (s *Server) auditUnaryCall(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if user, ok := resp.(*pb.User); ok && err == nil {
+		recordAccess(tenant.DBFromContext(ctx, s.db), callAccess(ctx, info.FullMethod), int(user.GetId()))
+	}
+	return resp, err
+}
+
+// auditStreamCall is auditUnaryCall for streaming calls, recording the
+// users sent once the stream ends without error.
+func (s *Server) auditStreamCall(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	stream := &auditedStream{ServerStream: ss}
+	err := handler(srv, stream)
+	if err == nil {
+		ctx := ss.Context()
+		recordAccess(tenant.DBFromContext(ctx, s.db), callAccess(ctx, info.FullMethod), stream.userIDs...)
+	}
+	return err
+}
+
+// callAccess returns the access of the call of ctx to method, to be
+// recorded for each user whose record it read or changed.
+func callAccess(ctx context.Context, method string) RecordAccess {
+	return RecordAccess{
+		Method:    "GRPC",
+		Route:     method,
+		Status:    http.StatusOK,
+		ClientIP:  client.CallIP(ctx),
+		RequestID: logging.RequestIDFrom(ctx),
+	}
+}
+
+// auditedStream is a server stream that notes the users it sends.
+type auditedStream struct {
+	grpc.ServerStream
+	userIDs []int
+}
+
+func (s *auditedStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if user, ok := m.(*pb.User); ok && err == nil {
+		s.userIDs = append(s.userIDs, int(user.GetId()))
+	}
+	return err
+}
+
+// ----------------------------  User gRPC Methods ---------------------------------//
+
+func (a *grpcAPI) GetUser(ctx context.Context, req *pb.GetRequest) (*pb.User, error) {
+	var user User
+	if err := a.db(ctx).Take(&user, "id = ?", req.GetId()).Error; err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return userToProto(&user), nil
+}
+
+func (a *grpcAPI) ListUsers(req *pb.ListUsersRequest, stream pb.UserService_ListUsersServer) error {
+	ctx := stream.Context()
+	db, err := usersWithEmail(a.db(ctx), req.GetEmail())
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+	var users []User
+	err = db.FindInBatches(&users, grpcListBatch, func(*gorm.DB, int) error {
+		for i := range users {
+			if err := stream.Send(userToProto(&users[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	return grpcError(ctx, err)
+}
+
+func (a *grpcAPI) CreateUser(ctx context.Context, req *pb.User) (*pb.User, error) {
+	user := userFromProto(req)
+	user.ID = 0
+	if err := validateUser(user); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := a.s.createEntity(a.db(ctx), "user", user); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return userToProto(user), nil
+}
+
+func (a *grpcAPI) UpdateUser(ctx context.Context, req *pb.User) (*pb.User, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	user := userFromProto(req)
+	if err := validateUser(user); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := a.s.saveEntity(a.db(ctx), "user", user); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return userToProto(user), nil
+}
+
+func userToProto(u *User) *pb.User {
+	return &pb.User{Id: int64(u.ID), TenantId: int64(u.TenantID), Name: u.Name, Email: u.Email, Contact: u.Contact, BirthDate: u.BirthDate}
+}
+
+// userFromProto returns the user of a request. Its tenant is that of the
+// call.
+func userFromProto(m *pb.User) *User {
+	return &User{ID: int(m.GetId()), Name: m.Name, Email: m.Email, Contact: m.Contact, BirthDate: m.BirthDate}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Medication gRPC Methods ---------------------------------//
+
+func (a *grpcAPI) GetMed(ctx context.Context, req *pb.GetRequest) (*pb.Med, error) {
+	var med Med
+	if err := a.db(ctx).Take(&med, "id = ?", req.GetId()).Error; err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return medToProto(&med), nil
+}
+
+func (a *grpcAPI) ListMeds(_ *pb.ListRequest, stream pb.MedService_ListMedsServer) error {
+	ctx := stream.Context()
+	var meds []Med
+	err := a.db(ctx).FindInBatches(&meds, grpcListBatch, func(*gorm.DB, int) error {
+		for i := range meds {
+			if err := stream.Send(medToProto(&meds[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	return grpcError(ctx, err)
+}
+
+func (a *grpcAPI) CreateMed(ctx context.Context, req *pb.Med) (*pb.Med, error) {
+	med := medFromProto(req)
+	med.ID = 0
+	if err := a.s.createEntity(a.db(ctx), "med", med); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return medToProto(med), nil
+}
+
+func (a *grpcAPI) UpdateMed(ctx context.Context, req *pb.Med) (*pb.Med, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	med := medFromProto(req)
+	if err := a.s.saveEntity(a.db(ctx), "med", med); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return medToProto(med), nil
+}
+
+func (a *grpcAPI) DeleteMed(ctx context.Context, req *pb.DeleteRequest) (*pb.Med, error) {
+	var med Med
+	if err := a.s.deleteEntity(a.db(ctx), "med", &med, req.GetId()); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return medToProto(&med), nil
+}
+
+func medToProto(m *Med) *pb.Med {
+	return &pb.Med{Id: int64(m.ID), Name: m.Name, Desc: m.Desc}
+}
+
+func medFromProto(m *pb.Med) *Med {
+	return &Med{ID: int(m.GetId()), Name: m.Name, Desc: m.Desc}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Disease gRPC Methods ---------------------------------//
+
+func (a *grpcAPI) GetDisease(ctx context.Context, req *pb.GetRequest) (*pb.Disease, error) {
+	var disease Disease
+	if err := a.db(ctx).Take(&disease, "id = ?", req.GetId()).Error; err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return diseaseToProto(&disease), nil
+}
+
+func (a *grpcAPI) ListDiseases(_ *pb.ListRequest, stream pb.DiseaseService_ListDiseasesServer) error {
+	ctx := stream.Context()
+	var diseases []Disease
+	err := a.db(ctx).FindInBatches(&diseases, grpcListBatch, func(*gorm.DB, int) error {
+		for i := range diseases {
+			if err := stream.Send(diseaseToProto(&diseases[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	return grpcError(ctx, err)
+}
+
+func (a *grpcAPI) CreateDisease(ctx context.Context, req *pb.Disease) (*pb.Disease, error) {
+	disease := diseaseFromProto(req)
+	disease.ID = 0
+	if err := a.s.createEntity(a.db(ctx), "disease", disease); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return diseaseToProto(disease), nil
+}
+
+func (a *grpcAPI) UpdateDisease(ctx context.Context, req *pb.Disease) (*pb.Disease, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	disease := diseaseFromProto(req)
+	if err := a.s.saveEntity(a.db(ctx), "disease", disease); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return diseaseToProto(disease), nil
+}
+
+func (a *grpcAPI) DeleteDisease(ctx context.Context, req *pb.DeleteRequest) (*pb.Disease, error) {
+	var disease Disease
+	if err := a.s.deleteEntity(a.db(ctx), "disease", &disease, req.GetId()); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return diseaseToProto(&disease), nil
+}
+
+func diseaseToProto(d *Disease) *pb.Disease {
+	return &pb.Disease{Id: int64(d.ID), Name: d.Name, Desc: d.Desc}
+}
+
+func diseaseFromProto(m *pb.Disease) *Disease {
+	return &Disease{ID: int(m.GetId()), Name: m.Name, Desc: m.Desc}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Clinic gRPC Methods ---------------------------------//
+
+func (a *grpcAPI) GetClinic(ctx context.Context, req *pb.GetRequest) (*pb.Clinic, error) {
+	var clinic Clinic
+	if err := a.db(ctx).Take(&clinic, "id = ?", req.GetId()).Error; err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return clinicToProto(&clinic), nil
+}
+
+func (a *grpcAPI) ListClinics(_ *pb.ListRequest, stream pb.ClinicService_ListClinicsServer) error {
+	ctx := stream.Context()
+	var clinics []Clinic
+	err := a.db(ctx).FindInBatches(&clinics, grpcListBatch, func(*gorm.DB, int) error {
+		for i := range clinics {
+			if err := stream.Send(clinicToProto(&clinics[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	return grpcError(ctx, err)
+}
+
+func (a *grpcAPI) CreateClinic(ctx context.Context, req *pb.Clinic) (*pb.Clinic, error) {
+	clinic := clinicFromProto(req)
+	clinic.ID = 0
+	if err := validateClinic(clinic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := a.s.createEntity(a.db(ctx), "clinic", clinic); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return clinicToProto(clinic), nil
+}
+
+func (a *grpcAPI) UpdateClinic(ctx context.Context, req *pb.Clinic) (*pb.Clinic, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if err := ownClinic(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	clinic := clinicFromProto(req)
+	if err := validateClinic(clinic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := a.s.saveEntity(a.db(ctx), "clinic", clinic); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return clinicToProto(clinic), nil
+}
+
+func (a *grpcAPI) DeleteClinic(ctx context.Context, req *pb.DeleteRequest) (*pb.Clinic, error) {
+	if err := ownClinic(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	var clinic Clinic
+	if err := a.s.deleteEntity(a.db(ctx), "clinic", &clinic, req.GetId()); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return clinicToProto(&clinic), nil
+}
+
+// ownClinic rejects calls that change a clinic other than their tenant,
+// as clinicTenant does for /clinic/:clinicID.
+func ownClinic(ctx context.Context, id int64) error {
+	if tenantID, ok := tenant.FromContext(ctx); !ok || int64(tenantID) != id {
+		return status.Error(codes.PermissionDenied, "tenant does not match the clinic")
+	}
+	return nil
+}
+
+func clinicToProto(cl *Clinic) *pb.Clinic {
+	return &pb.Clinic{
+		Id:   int64(cl.ID),
+		Name: cl.Name,
+		Desc: cl.Desc,
+		Address: &pb.Address{
+			Line:       cl.Address.Line,
+			City:       cl.Address.City,
+			PostalCode: cl.Address.PostalCode,
+			Country:    cl.Address.Country,
+		},
+		Latitude:  cl.Latitude,
+		Longitude: cl.Longitude,
+		Timezone:  cl.Timezone,
+	}
+}
+
+func clinicFromProto(m *pb.Clinic) *Clinic {
+	return &Clinic{
+		ID:   int(m.GetId()),
+		Name: m.Name,
+		Desc: m.Desc,
+		Address: Address{
+			Line:       m.GetAddress().GetLine(),
+			City:       m.GetAddress().GetCity(),
+			PostalCode: m.GetAddress().GetPostalCode(),
+			Country:    m.GetAddress().GetCountry(),
+		},
+		Latitude:  m.Latitude,
+		Longitude: m.Longitude,
+		Timezone:  m.GetTimezone(),
+	}
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// grpcError returns the status a call fails with for err. Unexpected
+// errors are logged and not echoed, as in internalError.
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, tenant.ErrMissing):
+		return status.Error(codes.Unauthenticated, "tenant required")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "record not found")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "canceled")
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	logging.FromContext(ctx).Error("rpc failed", logging.Err(err))
+	return status.Error(codes.Internal, fmt.Sprintf("internal error (request id %s)", logging.RequestIDFrom(ctx)))
+}
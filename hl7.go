@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"medically-core/config"
+	"medically-core/encryption"
+	"medically-core/hl7"
+
+	"gorm.io/gorm"
+)
+
+// hl7Handler applies ADT messages to users and ORU messages to their
+// observations.
+type hl7Handler struct {
+	patientID, authority hl7.Path
+	name                 []hl7.Path
+	email, contact       hl7.Path
+
+	obsCode, obsName, obsSystem, obsValue, obsUnit hl7.Path
+	obsRange, obsFlag, obsStatus, obsTime          hl7.Path
+
+	changes *changePublisher
+}
+
+// obrTime is the observation time of the whole order, used for OBX
+// segments without their own.
+var obrTime = hl7.MustParsePath("OBR-7")
+
+func newHL7Handler(m config.HL7Mapping, changes *changePublisher) (*hl7Handler, error) {
+	h := &hl7Handler{changes: changes}
+	var err error
+	parse := func(dst *hl7.Path, s string) {
+		if err == nil {
+			*dst, err = hl7.ParsePath(s)
+		}
+	}
+	parse(&h.patientID, m.PatientID)
+	parse(&h.authority, m.PatientIDAuthority)
+	h.name = make([]hl7.Path, len(m.Name))
+	for i, s := range m.Name {
+		parse(&h.name[i], s)
+	}
+	parse(&h.email, m.Email)
+	parse(&h.contact, m.Contact)
+	parse(&h.obsCode, m.ObservationCode)
+	parse(&h.obsName, m.ObservationName)
+	parse(&h.obsSystem, m.ObservationSystem)
+	parse(&h.obsValue, m.ObservationValue)
+	parse(&h.obsUnit, m.ObservationUnit)
+	parse(&h.obsRange, m.ObservationRange)
+	parse(&h.obsFlag, m.ObservationFlag)
+	parse(&h.obsStatus, m.ObservationStatus)
+	parse(&h.obsTime, m.ObservationTime)
+	return h, err
+}
+
+// Handle implements hl7.Handler.
+func (h *hl7Handler) Handle(db *gorm.DB, msg *hl7.Message, stored *hl7.StoredMessage) error {
+	switch t := msg.Type(); t {
+	case "ADT^A01", "ADT^A04", "ADT^A08":
+		// Admissions and registrations create the patient if needed.
+		user, err := h.upsertPatient(db, msg, t != "ADT^A08")
+		if err != nil {
+			return err
+		}
+		stored.UserID = &user.ID
+		return nil
+	case "ORU^R01":
+		return h.saveResults(db, msg, stored)
+	default:
+		return hl7.Reject(fmt.Errorf("unsupported message type %s", t))
+	}
+}
+
+// upsertPatient updates the user identified by the PID segment with the
+// values the message holds, creating the user if create is set. Unknown
+// patients fail otherwise, so the message can be replayed once the
+// patient is registered.
+func (h *hl7Handler) upsertPatient(db *gorm.DB, msg *hl7.Message, create bool) (*User, error) {
+	ident, err := h.identifier(msg)
+	if err != nil {
+		return nil, err
+	}
+	name, email, contact := h.join(msg, h.name...), msg.Value(h.email), msg.Value(h.contact)
+
+	// Identifiers are encrypted, so they are looked up by blind index.
+	index, err := encryption.BlindIndex(ident.Value)
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	err = db.Joins("JOIN patient_identifiers ON patient_identifiers.user_id = users.id").
+		Where("patient_identifiers.system = ? AND patient_identifiers.value_index = ?", ident.System, index).
+		Take(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && create:
+		if name == "" {
+			return nil, hl7.Reject(errors.New("patient name is missing"))
+		}
+		user = User{Name: &name, Email: &email, Contact: &contact}
+		if err := db.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		ident.UserID = user.ID
+		if err := db.Create(ident).Error; err != nil {
+			return nil, err
+		}
+		return &user, h.changes.publish(db, "user.created", &user)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("unknown patient %s", h.patientID)
+	case err != nil:
+		return nil, err
+	}
+
+	// Values the message leaves empty are kept.
+	changed := false
+	for _, f := range []struct {
+		dst **string
+		v   string
+	}{{&user.Name, name}, {&user.Email, email}, {&user.Contact, contact}} {
+		if f.v != "" {
+			changed = changed || *f.dst == nil || **f.dst != f.v
+			v := f.v
+			*f.dst = &v
+		}
+	}
+	if err := db.Save(&user).Error; err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &user, nil
+	}
+	return &user, h.changes.publish(db, "user.updated", &user)
+}
+
+// saveResults stores the OBX segments of a result message as observations
+// of the patient. Observations of an earlier attempt at the same message
+// are replaced.
+func (h *hl7Handler) saveResults(db *gorm.DB, msg *hl7.Message, stored *hl7.StoredMessage) error {
+	user, err := h.upsertPatient(db, msg, false)
+	if err != nil {
+		return err
+	}
+	stored.UserID = &user.ID
+	if err := db.Where("message_id = ?", stored.ID).Delete(&Observation{}).Error; err != nil {
+		return err
+	}
+
+	var observations []Observation
+	for i, obx := range msg.All("OBX") {
+		o := Observation{
+			UserID:         user.ID,
+			MessageID:      stored.ID,
+			Code:           obx.Value(h.obsCode),
+			CodeSystem:     obx.Value(h.obsSystem),
+			Name:           obx.Value(h.obsName),
+			Value:          obx.Value(h.obsValue),
+			Unit:           obx.Value(h.obsUnit),
+			ReferenceRange: obx.Value(h.obsRange),
+			Flag:           obx.Value(h.obsFlag),
+			Status:         obx.Value(h.obsStatus),
+		}
+		if o.Code == "" {
+			return hl7.Reject(fmt.Errorf("OBX %d has no code at %s", i+1, h.obsCode))
+		}
+		ts := obx.Value(h.obsTime)
+		if ts == "" {
+			ts = msg.Value(obrTime)
+		}
+		if ts != "" {
+			// Timestamps without an offset are taken as the server's
+			// local time.
+			t, err := hl7.ParseTime(ts, time.Local)
+			if err != nil {
+				return hl7.Reject(fmt.Errorf("OBX %d: %w", i+1, err))
+			}
+			o.EffectiveAt = &t
+		}
+		observations = append(observations, o)
+	}
+	if len(observations) == 0 {
+		return nil
+	}
+	return db.Create(&observations).Error
+}
+
+// identifier returns the patient identifier of the PID segment.
+func (h *hl7Handler) identifier(msg *hl7.Message) (*PatientIdentifier, error) {
+	value := msg.Value(h.patientID)
+	if value == "" {
+		return nil, hl7.Reject(fmt.Errorf("patient identifier %s is missing", h.patientID))
+	}
+	return &PatientIdentifier{System: msg.Value(h.authority), Value: value}, nil
+}
+
+// join returns the non-empty values at paths, separated by spaces.
+func (h *hl7Handler) join(msg *hl7.Message, paths ...hl7.Path) string {
+	var parts []string
+	for _, p := range paths {
+		if v := msg.Value(p); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,71 @@
+package hl7
+
+import (
+	"strings"
+	"time"
+)
+
+// Acknowledgment codes of MSA-1.
+const (
+	// AckAccept means the message was processed.
+	AckAccept = "AA"
+	// AckError means processing failed; the sender may retry.
+	AckError = "AE"
+	// AckReject means the message is invalid or unsupported and must not
+	// be sent again as it is.
+	AckReject = "AR"
+)
+
+// Ack builds the acknowledgment of m, which may be nil if it could not be
+// parsed, with code and text in MSA.
+func Ack(m *Message, code, text string) []byte {
+	enc := defaultEncoding
+	get := func(p Path) string { return "" }
+	if m != nil {
+		enc = m.enc
+		get = func(p Path) string {
+			for _, s := range m.Segments {
+				if s.Fields[0] == p.Segment && p.Field < len(s.Fields) {
+					// Values are copied escaped, as they were received.
+					return nth(s.Fields[p.Field], enc.component, 1)
+				}
+			}
+			return ""
+		}
+	}
+	processing := get(Path{Segment: "MSH", Field: 11})
+	if processing == "" {
+		processing = "P"
+	}
+	version := get(Path{Segment: "MSH", Field: 12})
+	if version == "" {
+		version = "2.5.1"
+	}
+	trigger := ""
+	if m != nil {
+		trigger = m.enc.quote(m.Value(Path{"MSH", 9, 2, 1}))
+	}
+
+	sep := string(enc.field)
+	msh := []string{
+		"MSH",
+		string([]byte{enc.component, enc.repetition, enc.escape, enc.subcomponent}),
+		// The acknowledgment goes back to the sender.
+		get(Path{Segment: "MSH", Field: 5}),
+		get(Path{Segment: "MSH", Field: 6}),
+		get(Path{Segment: "MSH", Field: 3}),
+		get(Path{Segment: "MSH", Field: 4}),
+		time.Now().Format("20060102150405-0700"),
+		"",
+		"ACK" + string(enc.component) + trigger + string(enc.component) + "ACK",
+		randomControlID(),
+		processing,
+		version,
+	}
+	// MSA-3 is limited to 80 characters.
+	if r := []rune(text); len(r) > 80 {
+		text = string(r[:80])
+	}
+	msa := []string{"MSA", code, get(Path{Segment: "MSH", Field: 10}), enc.quote(text)}
+	return []byte(strings.Join(msh, sep) + "\r" + strings.Join(msa, sep) + "\r")
+}
@@ -0,0 +1,231 @@
+// Package hl7 receives HL7 v2 messages over MLLP.
+//
+// It parses messages into segments and fields addressed by paths such as
+// "PID-5.1", acknowledges each message with an ACK, and keeps the raw
+// messages so that they can be replayed. Interpreting the messages is up
+// to a Handler.
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a parsed HL7 v2 message.
+type Message struct {
+	Segments []Segment
+	enc      encoding
+}
+
+// Segment is a segment of a message. Fields[0] is the segment name, so
+// Fields[n] is field n. Field values are kept escaped.
+type Segment struct {
+	Fields []string
+	enc    encoding
+}
+
+// encoding holds the separators declared in MSH-1 and MSH-2.
+type encoding struct {
+	field, component, repetition, escape, subcomponent byte
+}
+
+var defaultEncoding = encoding{'|', '^', '~', '\\', '&'}
+
+// Parse parses a message. Segments may end with CR, LF or CRLF.
+func Parse(raw []byte) (*Message, error) {
+	text := strings.ReplaceAll(strings.ReplaceAll(string(raw), "\r\n", "\r"), "\n", "\r")
+	if !strings.HasPrefix(text, "MSH") || len(text) < 8 {
+		return nil, errors.New("hl7: message does not start with an MSH segment")
+	}
+	enc := encoding{field: text[3], component: text[4], repetition: text[5], escape: text[6], subcomponent: text[7]}
+
+	m := &Message{enc: enc}
+	for _, line := range strings.Split(text, "\r") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, string(enc.field))
+		if len(fields[0]) != 3 {
+			return nil, fmt.Errorf("hl7: invalid segment name %q", fields[0])
+		}
+		if fields[0] == "MSH" {
+			// MSH-1 is the field separator itself.
+			fields = append([]string{"MSH", string(enc.field)}, fields[1:]...)
+		}
+		m.Segments = append(m.Segments, Segment{Fields: fields, enc: enc})
+	}
+	return m, nil
+}
+
+// Type returns the message type and trigger event, as in "ADT^A01".
+func (m *Message) Type() string {
+	return m.Value(Path{"MSH", 9, 1, 1}) + "^" + m.Value(Path{"MSH", 9, 2, 1})
+}
+
+// ControlID returns the message control ID, MSH-10.
+func (m *Message) ControlID() string {
+	return m.Value(Path{"MSH", 10, 1, 1})
+}
+
+// All returns the segments named name.
+func (m *Message) All(name string) []Segment {
+	var segs []Segment
+	for _, s := range m.Segments {
+		if s.Fields[0] == name {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// Value returns the value at p in the first segment it names, or "".
+func (m *Message) Value(p Path) string {
+	for _, s := range m.Segments {
+		if s.Fields[0] == p.Segment {
+			return s.Value(p)
+		}
+	}
+	return ""
+}
+
+// Value returns the value at p in s, ignoring the segment p names. Only
+// the first repetition of a field is read.
+func (s Segment) Value(p Path) string {
+	if p.Field >= len(s.Fields) {
+		return ""
+	}
+	v := s.Fields[p.Field]
+	if s.Fields[0] == "MSH" && p.Field <= 2 {
+		return v
+	}
+	v = nth(v, s.enc.repetition, 1)
+	if p.Component > 0 {
+		v = nth(v, s.enc.component, p.Component)
+	}
+	if p.Subcomponent > 0 {
+		v = nth(v, s.enc.subcomponent, p.Subcomponent)
+	}
+	return s.enc.unescape(v)
+}
+
+// nth returns the nth (from 1) part of v split by sep.
+func nth(v string, sep byte, n int) string {
+	for i := 1; i < n; i++ {
+		j := strings.IndexByte(v, sep)
+		if j < 0 {
+			return ""
+		}
+		v = v[j+1:]
+	}
+	if j := strings.IndexByte(v, sep); j >= 0 {
+		v = v[:j]
+	}
+	return v
+}
+
+// unescape replaces the escape sequences for separators in v.
+func (e encoding) unescape(v string) string {
+	if strings.IndexByte(v, e.escape) < 0 {
+		return v
+	}
+	esc := string(e.escape)
+	return strings.NewReplacer(
+		esc+"F"+esc, string(e.field),
+		esc+"S"+esc, string(e.component),
+		esc+"R"+esc, string(e.repetition),
+		esc+"T"+esc, string(e.subcomponent),
+		esc+"E"+esc, esc,
+	).Replace(v)
+}
+
+// quote escapes the separators in v.
+func (e encoding) quote(v string) string {
+	esc := string(e.escape)
+	return strings.NewReplacer(
+		esc, esc+"E"+esc,
+		string(e.field), esc+"F"+esc,
+		string(e.component), esc+"S"+esc,
+		string(e.repetition), esc+"R"+esc,
+		string(e.subcomponent), esc+"T"+esc,
+	).Replace(v)
+}
+
+// Path addresses a value in a message, written as SEG-field, optionally
+// followed by .component and .subcomponent, all counted from 1.
+type Path struct {
+	Segment                        string
+	Field, Component, Subcomponent int
+}
+
+var pathPattern = regexp.MustCompile(`^([A-Z][A-Z0-9]{2})-(\d+)(?:\.(\d+))?(?:\.(\d+))?$`)
+
+// ParsePath parses a path such as "PID-5.1".
+func ParsePath(s string) (Path, error) {
+	m := pathPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Path{}, fmt.Errorf("hl7: invalid path %q", s)
+	}
+	p := Path{Segment: m[1]}
+	p.Field, _ = strconv.Atoi(m[2])
+	p.Component, _ = strconv.Atoi(m[3])
+	p.Subcomponent, _ = strconv.Atoi(m[4])
+	if p.Field == 0 {
+		return Path{}, fmt.Errorf("hl7: invalid path %q", s)
+	}
+	return p, nil
+}
+
+// MustParsePath is ParsePath for paths known to be valid.
+func MustParsePath(s string) Path {
+	p, err := ParsePath(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p Path) String() string {
+	s := fmt.Sprintf("%s-%d", p.Segment, p.Field)
+	if p.Component > 0 {
+		s += fmt.Sprintf(".%d", p.Component)
+	}
+	if p.Subcomponent > 0 {
+		s += fmt.Sprintf(".%d", p.Subcomponent)
+	}
+	return s
+}
+
+// ParseTime parses an HL7 timestamp (YYYY[MM[DD[HH[MM[SS[.S]]]]]][+/-ZZZZ]).
+// Timestamps without an offset are read in loc.
+func ParseTime(v string, loc *time.Location) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, errors.New("hl7: empty timestamp")
+	}
+	zone := ""
+	if i := strings.IndexAny(v, "+-"); i >= 0 {
+		v, zone = v[:i], v[i:]
+	}
+	frac := ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		v, frac = v[:i], v[i:]
+	}
+	layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(v)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("hl7: invalid timestamp %q", v+frac+zone)
+	}
+	if frac != "" {
+		if len(v) != 14 {
+			return time.Time{}, fmt.Errorf("hl7: invalid timestamp %q", v+frac+zone)
+		}
+		layout += "." + strings.Repeat("0", len(frac)-1)
+	}
+	if zone != "" {
+		return time.Parse(layout+"-0700", v+frac+zone)
+	}
+	return time.ParseInLocation(layout, v+frac, loc)
+}
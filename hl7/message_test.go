@@ -0,0 +1,205 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const admission = "MSH|^~\\&|EHR|HOSP|MEDICALLY|CLINIC|20240102103000||ADT^A01^ADT_A01|MSG00001|P|2.5.1\r" +
+	"PID|1||12345^^^HOSP^MR~67890^^^NAT^NI||Doe^John^Q||19800412|M|||Main St 1\\S\\2^^Utrecht\r" +
+	"OBX|1|NM|718-7^Hemoglobin^LN||13.5|g/dL\r" +
+	"OBX|2|NM|789-8^Erythrocytes^LN||4.6|10*12/L\r"
+
+func TestParse(t *testing.T) {
+	for name, raw := range map[string]string{
+		"CR":   admission,
+		"LF":   strings.ReplaceAll(admission, "\r", "\n"),
+		"CRLF": strings.ReplaceAll(admission, "\r", "\r\n"),
+	} {
+		m, err := Parse([]byte(raw))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", name, err)
+		}
+		if len(m.Segments) != 4 {
+			t.Errorf("%s: got %d segments, want 4", name, len(m.Segments))
+		}
+		if got := m.Type(); got != "ADT^A01" {
+			t.Errorf("%s: Type = %q, want ADT^A01", name, got)
+		}
+		if got := m.ControlID(); got != "MSG00001" {
+			t.Errorf("%s: ControlID = %q, want MSG00001", name, got)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"MSH|^~",
+		"PID|1||12345\rMSH|^~\\&|EHR\r",
+		"MSH|^~\\&|EHR\rPIDX|1\r",
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	m, err := Parse([]byte(admission))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"MSH-1", "|"},
+		{"MSH-2", "^~\\&"},
+		{"MSH-3", "EHR"},
+		{"MSH-9.2", "A01"},
+		{"PID-3.1", "12345"},
+		{"PID-3.4", "HOSP"},
+		{"PID-5", "Doe^John^Q"},
+		{"PID-5.1", "Doe"},
+		{"PID-5.2", "John"},
+		{"PID-5.9", ""},
+		{"PID-7", "19800412"},
+		{"PID-11.1", "Main St 1^2"},
+		{"PID-11.3", "Utrecht"},
+		{"PID-30", ""},
+		{"OBX-5", "13.5"},
+		{"ZZZ-1", ""},
+	}
+	for _, tt := range tests {
+		if got := m.Value(MustParsePath(tt.path)); got != tt.want {
+			t.Errorf("Value(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	obx := m.All("OBX")
+	if len(obx) != 2 {
+		t.Fatalf("All(OBX) returned %d segments, want 2", len(obx))
+	}
+	if got := obx[1].Value(MustParsePath("OBX-3.2")); got != "Erythrocytes" {
+		t.Errorf("second OBX-3.2 = %q, want Erythrocytes", got)
+	}
+}
+
+func TestCustomEncoding(t *testing.T) {
+	m, err := Parse([]byte("MSH#:~\\&#EHR#HOSP#####ORU:R01#42\rPID#1##7:::HOSP\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Type(); got != "ORU^R01" {
+		t.Errorf("Type = %q, want ORU^R01", got)
+	}
+	if got := m.Value(MustParsePath("PID-3.4")); got != "HOSP" {
+		t.Errorf("PID-3.4 = %q, want HOSP", got)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	e := defaultEncoding
+	for _, v := range []string{"plain", "a|b", "x^y~z&w", `back\slash`, ""} {
+		if got := e.unescape(e.quote(v)); got != v {
+			t.Errorf("unescape(quote(%q)) = %q", v, got)
+		}
+	}
+	if got := e.quote("a|b^c"); got != `a\F\b\S\c` {
+		t.Errorf("quote = %q", got)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	p, err := ParsePath("OBX-5.1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Path{"OBX", 5, 1, 2}); p != want {
+		t.Errorf("ParsePath = %+v, want %+v", p, want)
+	}
+	if got := p.String(); got != "OBX-5.1.2" {
+		t.Errorf("String = %q", got)
+	}
+	for _, s := range []string{"", "PID", "PID-0", "pid-3", "PID-3.", "PID-x", "PID-3.1.2.3"} {
+		if _, err := ParsePath(s); err == nil {
+			t.Errorf("ParsePath(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	tests := []struct {
+		v    string
+		want time.Time
+	}{
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, loc)},
+		{"20240102", time.Date(2024, 1, 2, 0, 0, 0, 0, loc)},
+		{"202401021030", time.Date(2024, 1, 2, 10, 30, 0, 0, loc)},
+		{"20240102103045.25", time.Date(2024, 1, 2, 10, 30, 45, 250e6, loc)},
+		{"20240102103045-0500", time.Date(2024, 1, 2, 10, 30, 45, 0, time.FixedZone("", -5*3600))},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.v, loc)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", tt.v, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+	for _, v := range []string{"", "202", "2024010", "20240102.5", "2024-01-02"} {
+		if _, err := ParseTime(v, loc); err == nil {
+			t.Errorf("ParseTime(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestAck(t *testing.T) {
+	m, err := Parse([]byte(admission))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, err := Parse(Ack(m, AckReject, "unknown patient|id"))
+	if err != nil {
+		t.Fatalf("parsing the ACK: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"MSH-3", "MEDICALLY"},
+		{"MSH-4", "CLINIC"},
+		{"MSH-5", "EHR"},
+		{"MSH-6", "HOSP"},
+		{"MSH-9.1", "ACK"},
+		{"MSH-9.2", "A01"},
+		{"MSH-11", "P"},
+		{"MSH-12", "2.5.1"},
+		{"MSA-1", AckReject},
+		{"MSA-2", "MSG00001"},
+		{"MSA-3", "unknown patient|id"},
+	}
+	for _, tt := range tests {
+		if got := ack.Value(MustParsePath(tt.path)); got != tt.want {
+			t.Errorf("ACK %s = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAckUnparsed(t *testing.T) {
+	ack, err := Parse(Ack(nil, AckReject, strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatalf("parsing the ACK: %v", err)
+	}
+	if got := ack.Value(MustParsePath("MSA-1")); got != AckReject {
+		t.Errorf("MSA-1 = %q, want %s", got, AckReject)
+	}
+	if got := ack.Value(MustParsePath("MSA-3")); len(got) != 80 {
+		t.Errorf("MSA-3 is %d characters, want 80", len(got))
+	}
+}
@@ -0,0 +1,63 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MLLP frames each message between a start block and an end block
+// followed by a carriage return.
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+)
+
+// maxFrameSize bounds the size of a message.
+const maxFrameSize = 1 << 20
+
+// readFrame reads the next MLLP frame and returns its content.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	// Anything before the start block, such as a stray CR, is skipped.
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+	var frame []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == endBlock {
+			if next, err := r.ReadByte(); err != nil || next != carriageReturn {
+				return nil, errors.New("mllp: end block not followed by CR")
+			}
+			return frame, nil
+		}
+		if len(frame) >= maxFrameSize {
+			return nil, fmt.Errorf("mllp: message larger than %d bytes", maxFrameSize)
+		}
+		frame = append(frame, b)
+	}
+}
+
+// writeFrame writes msg as an MLLP frame.
+func writeFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
@@ -0,0 +1,78 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	msgs := []string{admission, "MSH|^~\\&|EHR\r", ""}
+	for _, m := range msgs {
+		if err := writeFrame(&buf, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bufio.NewReader(&buf)
+	for _, want := range msgs {
+		got, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("readFrame = %q, want %q", got, want)
+		}
+	}
+	if _, err := readFrame(r); err != io.EOF {
+		t.Errorf("readFrame at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadFrameSkipsNoise(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\r\n junk\x0bMSH|^~\\&\x1c\r"))
+	got, err := readFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "MSH|^~\\&" {
+		t.Errorf("readFrame = %q", got)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"truncated", "\x0bMSH|^~\\&|EHR", io.ErrUnexpectedEOF},
+		{"end block without CR", "\x0bMSH\x1cX", nil},
+		{"end block at EOF", "\x0bMSH\x1c", nil},
+		{"too large", "\x0b" + strings.Repeat("x", maxFrameSize+1) + "\x1c\r", nil},
+	}
+	for _, tt := range tests {
+		_, err := readFrame(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil {
+			t.Errorf("%s: readFrame succeeded, want an error", tt.name)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: readFrame = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReadFrameAtLimit(t *testing.T) {
+	msg := strings.Repeat("x", maxFrameSize)
+	got, err := readFrame(bufio.NewReader(strings.NewReader("\x0b" + msg + "\x1c\r")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != maxFrameSize {
+		t.Errorf("read %d bytes, want %d", len(got), maxFrameSize)
+	}
+}
@@ -0,0 +1,227 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"medically-core/config"
+	"medically-core/logging"
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+)
+
+// Handler interprets messages.
+type Handler interface {
+	// Handle applies msg, stored as stored, through db, which is scoped
+	// to the clinic the message was sent to and runs in a transaction.
+	// Errors wrapped by Reject are answered AR, others AE.
+	Handle(db *gorm.DB, msg *Message, stored *StoredMessage) error
+}
+
+type rejectError struct {
+	err error
+}
+
+func (e rejectError) Error() string { return e.err.Error() }
+func (e rejectError) Unwrap() error { return e.err }
+
+// Reject marks err as caused by the message itself, which must not be
+// sent again as it is.
+func Reject(err error) error {
+	return rejectError{err}
+}
+
+// Server receives messages over MLLP, stores them, hands them to a
+// Handler and acknowledges them.
+type Server struct {
+	db          *gorm.DB
+	tenancy     *tenant.Resolver
+	handler     Handler
+	facilities  map[string]int
+	idleTimeout time.Duration
+}
+
+// NewServer creates a Server, creating the messages table if needed.
+// Messages are attributed to clinics by their sending facility, MSH-4.
+func NewServer(db *gorm.DB, tenancy *tenant.Resolver, handler Handler, cfg config.HL7Config) (*Server, error) {
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	return &Server{db: db, tenancy: tenancy, handler: handler, facilities: cfg.Facilities, idleTimeout: cfg.IdleTimeout}, nil
+}
+
+// ListenAndServe accepts MLLP connections on addr until ctx is done, then
+// waits for the messages being processed.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	log := logging.FromContext(ctx).With(logging.String("remote_addr", conn.RemoteAddr().String()))
+	ctx = logging.NewContext(ctx, log)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock the read; a message being processed is still answered.
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		raw, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Warn("hl7 connection closed", logging.Err(err))
+			}
+			return
+		}
+		ack := s.receive(ctx, raw)
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		if err := writeFrame(conn, ack); err != nil {
+			log.Warn("sending hl7 acknowledgment failed", logging.Err(err))
+			return
+		}
+	}
+}
+
+// receive stores and processes a message and returns its acknowledgment.
+func (s *Server) receive(ctx context.Context, raw []byte) []byte {
+	ctx = tenant.System(ctx)
+	log := logging.FromContext(ctx)
+	db := s.db.WithContext(ctx)
+
+	stored := &StoredMessage{Raw: string(raw), Status: StatusReceived, ReceivedAt: time.Now()}
+	msg, err := Parse(raw)
+	if err != nil {
+		stored.Status, stored.Error = StatusRejected, err.Error()
+		if err := db.Create(stored).Error; err != nil {
+			log.Error("storing hl7 message failed", logging.Err(err))
+		}
+		return Ack(nil, AckReject, err.Error())
+	}
+	stored.Sender = msg.Value(Path{"MSH", 4, 1, 0})
+	stored.ControlID = msg.ControlID()
+	stored.Type = msg.Type()
+	log = log.With(logging.String("hl7_type", stored.Type), logging.String("hl7_control_id", stored.ControlID))
+
+	id, ok := s.facilities[stored.Sender]
+	if !ok {
+		stored.Status, stored.Error = StatusRejected, fmt.Sprintf("unknown sending facility %q", stored.Sender)
+		if err := db.Create(stored).Error; err != nil {
+			log.Error("storing hl7 message failed", logging.Err(err))
+		}
+		return Ack(msg, AckReject, stored.Error)
+	}
+	stored.TenantID = id
+
+	// Senders resend messages they got no acknowledgment for; one that
+	// was already processed is acknowledged again without reprocessing.
+	var dup int64
+	err = db.Model(&StoredMessage{}).
+		Where("tenant_id = ? AND sender = ? AND control_id = ? AND status = ?", id, stored.Sender, stored.ControlID, StatusProcessed).
+		Count(&dup).Error
+	if err != nil {
+		log.Error("looking up hl7 message failed", logging.Err(err))
+		return Ack(msg, AckError, "temporary failure")
+	}
+	if dup > 0 {
+		return Ack(msg, AckAccept, "duplicate")
+	}
+
+	if err := db.Create(stored).Error; err != nil {
+		log.Error("storing hl7 message failed", logging.Err(err))
+		return Ack(msg, AckError, "temporary failure")
+	}
+	code, text, _ := s.process(ctx, msg, stored)
+	return Ack(msg, code, text)
+}
+
+// process hands a stored message to the handler, records the outcome
+// and returns the acknowledgment code and text and the new status.
+func (s *Server) process(ctx context.Context, msg *Message, stored *StoredMessage) (string, string, string) {
+	log := logging.FromContext(ctx).With(logging.Int("hl7_message_id", stored.ID))
+	err := s.tenancy.Run(ctx, stored.TenantID, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return s.handler.Handle(tx, msg, stored)
+		})
+	})
+
+	code, text, status := AckAccept, "", StatusProcessed
+	var rejected rejectError
+	switch {
+	case errors.As(err, &rejected):
+		code, text, status = AckReject, err.Error(), StatusRejected
+		log.Warn("hl7 message rejected", logging.Err(err))
+	case err != nil:
+		code, text, status = AckError, "processing failed", StatusFailed
+		log.Error("processing hl7 message failed", logging.Err(err))
+	}
+	errText := text
+	if status == StatusFailed {
+		errText = logging.ScrubError(err)
+	}
+	if err := record(tenant.System(ctx), s.db, stored, status, errText); err != nil {
+		log.Error("recording hl7 message outcome failed", logging.Err(err))
+	}
+	return code, text, status
+}
+
+// ErrErased is returned when replaying a message whose content was
+// removed with its patient.
+var ErrErased = errors.New("hl7: message was erased")
+
+// Replay processes a stored message again, e.g. after the error that
+// failed it was fixed, and returns its new status.
+func (s *Server) Replay(ctx context.Context, stored *StoredMessage) (string, error) {
+	if stored.Raw == "" {
+		return "", ErrErased
+	}
+	msg, err := Parse([]byte(stored.Raw))
+	if err != nil {
+		return "", Reject(err)
+	}
+	_, _, status := s.process(ctx, msg, stored)
+	return status, nil
+}
@@ -0,0 +1,70 @@
+package hl7
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of stored messages.
+const (
+	StatusReceived  = "received"
+	StatusProcessed = "processed"
+	StatusFailed    = "failed"
+	StatusRejected  = "rejected"
+)
+
+// StoredMessage is a received message in the "hl7_messages" table. It
+// belongs to the clinic its sending facility is mapped to; messages that
+// could not be attributed to one have none. Raw holds the message as
+// received, encrypted, for replay. UserID is the patient the message was
+// processed for; erasing the patient removes Raw.
+type StoredMessage struct {
+	ID          int        `json:"id"`
+	TenantID    int        `json:"tenantId,omitempty" gorm:"index"`
+	Sender      string     `json:"sender" gorm:"index:idx_hl7_messages_control"`
+	ControlID   string     `json:"controlId" gorm:"index:idx_hl7_messages_control"`
+	Type        string     `json:"type"`
+	UserID      *int       `json:"userId,omitempty" gorm:"index"`
+	Raw         string     `json:"-" gorm:"not null;serializer:encrypted" phi:"true"`
+	Status      string     `json:"status" gorm:"not null;index"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ReceivedAt  time.Time  `json:"receivedAt"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
+
+func (StoredMessage) TableName() string {
+	return "hl7_messages"
+}
+
+// migrate creates the messages table if needed.
+func migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&StoredMessage{})
+}
+
+// record stores the outcome of processing msg.
+func record(ctx context.Context, db *gorm.DB, msg *StoredMessage, status, errText string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       status,
+		"error":        errText,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"processed_at": &now,
+	}
+	if msg.UserID != nil {
+		updates["user_id"] = *msg.UserID
+	}
+	return db.WithContext(ctx).Model(msg).Updates(updates).Error
+}
+
+func randomControlID() string {
+	var b [10]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+
+	"medically-core/client"
+	"medically-core/logging"
+	"medically-core/tenant"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// MetadataKey carries the idempotency key of a gRPC call, as Header does
+// for HTTP requests.
+const MetadataKey = "idempotency-key"
+
+// ReplayedMetadataKey is set in the header metadata of replayed calls.
+const ReplayedMetadataKey = "idempotent-replayed"
+
+// grpcContentType marks stored gRPC responses. Their body is the response
+// message, or the status of the error the call failed with, wrapped in an
+// Any so it can be decoded without knowing the method.
+const grpcContentType = "application/grpc+proto"
+
+// UnaryServerInterceptor is Middleware for unary gRPC calls that carry
+// the idempotency-key metadata. Their response, or the status of their
+// error, is stored and replayed like that of a request, and calls that
+// fail with a server error release the key.
+func (s *Store) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(MetadataKey)
+		msg, ok := req.(proto.Message)
+		if len(keys) == 0 || keys[0] == "" || !ok {
+			return handler(ctx, req)
+		}
+		if len(keys[0]) > maxKeyLength {
+			return nil, status.Error(codes.InvalidArgument, "idempotency-key is too long")
+		}
+
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h := sha256.New()
+		h.Write([]byte(info.FullMethod + "\n"))
+		h.Write(body)
+		rec := Record{
+			Client:      callClientKey(ctx),
+			Key:         keys[0],
+			RequestHash: h.Sum(nil),
+		}
+		owned, existing, err := s.claim(ctx, rec)
+		if err != nil {
+			logging.FromContext(ctx).Error("idempotency store failed", logging.Err(err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		if !owned {
+			return replayCall(ctx, rec, existing)
+		}
+
+		defer func() {
+			if p := recover(); p != nil {
+				s.release(ctx, rec)
+				panic(p)
+			}
+			s.completeCall(ctx, rec, resp, err)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// replayCall answers a call with the response stored for its key.
+func replayCall(ctx context.Context, rec Record, existing *Record) (interface{}, error) {
+	switch {
+	case !bytes.Equal(existing.RequestHash, rec.RequestHash):
+		return nil, status.Error(codes.FailedPrecondition, "idempotency-key was already used for a different call")
+	case existing.Status == 0:
+		return nil, status.Error(codes.Aborted, "a call with this idempotency-key is in progress")
+	}
+	var stored anypb.Any
+	if err := proto.Unmarshal(existing.Body, &stored); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	msg, err := stored.UnmarshalNew()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadataKey, "true"))
+	if st, ok := msg.(*spb.Status); ok {
+		return nil, status.ErrorProto(st)
+	}
+	return msg, nil
+}
+
+// completeCall stores the response or error of a call, or releases the
+// key when the call failed with a server error.
+func (s *Store) completeCall(ctx context.Context, rec Record, resp interface{}, callErr error) {
+	var msg proto.Message
+	if callErr != nil {
+		st := status.Convert(callErr)
+		switch st.Code() {
+		case codes.Internal, codes.Unknown, codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted, codes.DataLoss:
+			s.release(ctx, rec)
+			return
+		}
+		msg = st.Proto()
+	} else if m, ok := resp.(proto.Message); ok {
+		msg = m
+	} else {
+		s.release(ctx, rec)
+		return
+	}
+	wrapped, err := anypb.New(msg)
+	var body []byte
+	if err == nil {
+		body, err = proto.Marshal(wrapped)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("storing idempotent response failed", logging.Err(err))
+		s.release(ctx, rec)
+		return
+	}
+	db, cancel := s.finishing(rec)
+	defer cancel()
+	err = db.Updates(&Record{
+		Status:      http.StatusOK,
+		ContentType: grpcContentType,
+		Body:        body,
+	}).Error
+	if err != nil {
+		logging.FromContext(ctx).Error("storing idempotent response failed", logging.Err(err))
+	}
+}
+
+// callClientKey is clientKey for gRPC calls.
+func callClientKey(ctx context.Context) string {
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		return tenantKey(tenantID)
+	}
+	return client.CallKey(ctx)
+}
@@ -0,0 +1,61 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+
+	"medically-core/tenant"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCallClientKey(t *testing.T) {
+	ctx := tenant.NewContext(context.Background(), 7)
+	if got := callClientKey(ctx); got != "tenant:7" {
+		t.Errorf("callClientKey = %q, want tenant:7", got)
+	}
+}
+
+// stored returns msg as it is stored for replays.
+func stored(t *testing.T, msg proto.Message) []byte {
+	wrapped, err := anypb.New(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := proto.Marshal(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestReplayCall(t *testing.T) {
+	rec := Record{Client: "tenant:7", Key: "k", RequestHash: []byte("hash")}
+	tests := []struct {
+		name     string
+		existing Record
+		code     codes.Code
+		want     string
+	}{
+		{"response", Record{RequestHash: []byte("hash"), Status: 200, Body: stored(t, wrapperspb.String("created"))}, codes.OK, "created"},
+		{"error", Record{RequestHash: []byte("hash"), Status: 200, Body: stored(t, status.New(codes.NotFound, "no such user").Proto())}, codes.NotFound, ""},
+		{"in progress", Record{RequestHash: []byte("hash")}, codes.Aborted, ""},
+		{"another call", Record{RequestHash: []byte("other"), Status: 200}, codes.FailedPrecondition, ""},
+	}
+	for _, tt := range tests {
+		resp, err := replayCall(context.Background(), rec, &tt.existing)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.code)
+			continue
+		}
+		if tt.want != "" {
+			if s, ok := resp.(*wrapperspb.StringValue); !ok || s.GetValue() != tt.want {
+				t.Errorf("%s: replayed %v, want %q", tt.name, resp, tt.want)
+			}
+		}
+	}
+}
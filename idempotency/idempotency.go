@@ -0,0 +1,282 @@
+// Package idempotency lets clients retry POST requests safely.
+//
+// A client sends an Idempotency-Key header with a unique value per logical
+// operation. The first response for a (client, key) pair is stored and
+// replayed for every retry within the expiry window, so a retried create
+// never creates a second row. On the routes of a clinic, the client is the
+// clinic.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/client"
+	"medically-core/logging"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Header carries the idempotency key of a request.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	maxKeyLength = 255
+	maxBodySize  = 1 << 20
+)
+
+// Record is a stored response in the "idempotency_keys" table. A record
+// without a status is a request still in progress. Responses may hold
+// PHI, so their body is stored encrypted.
+type Record struct {
+	Client      string `gorm:"primaryKey"`
+	Key         string `gorm:"primaryKey"`
+	RequestHash []byte `gorm:"not null"`
+	Status      int
+	ContentType string
+	Body        []byte    `gorm:"serializer:encrypted"`
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
+
+// Store keeps the responses of idempotent requests in Postgres.
+type Store struct {
+	db     *gorm.DB
+	window time.Duration
+}
+
+// NewStore creates a Store whose keys expire after window, creating its
+// table if needed.
+func NewStore(db *gorm.DB, window time.Duration) (*Store, error) {
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, window: window}, nil
+}
+
+// Middleware makes the request idempotent when it carries an
+// Idempotency-Key header:
+//
+//   - the first request runs and its response is stored, unless it failed
+//     with a server error, so the client can try again;
+//   - a retry with the same body gets the stored response back;
+//   - a retry with a different body is rejected with 422;
+//   - a retry while the first request still runs is rejected with 409.
+func (s *Store) Middleware() gin.HandlerFunc {
+	return s.MiddlewareWith(func(c *gin.Context, status int, msg string) {
+		c.String(status, "error: "+msg)
+	})
+}
+
+// MiddlewareWith is Middleware answering rejected requests with fail, for
+// APIs with their own error format. Replayed responses are sent as they
+// were stored.
+func (s *Store) MiddlewareWith(fail func(c *gin.Context, status int, msg string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			fail(c, http.StatusBadRequest, "Idempotency-Key is too long")
+			c.Abort()
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+		if err != nil {
+			fail(c, http.StatusRequestEntityTooLarge, "request body too large")
+			c.Abort()
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		rec := Record{
+			Client:      clientKey(c),
+			Key:         key,
+			RequestHash: requestHash(c, body),
+		}
+		owned, existing, err := s.claim(ctx, rec)
+		if err != nil {
+			logging.FromContext(ctx).Error("idempotency store failed", logging.Err(err))
+			fail(c, http.StatusInternalServerError, "internal error")
+			c.Abort()
+			return
+		}
+		if !owned {
+			s.replay(c, rec, existing, fail)
+			return
+		}
+
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// A handler that panicked answered nothing worth replaying:
+			// release the key so the client can try again.
+			if p := recover(); p != nil {
+				s.release(ctx, rec)
+				panic(p)
+			}
+			s.complete(ctx, rec, w)
+		}()
+		c.Next()
+	}
+}
+
+// claim inserts rec unless a live record exists for the same client and
+// key. It reports whether rec was inserted, or the existing record.
+func (s *Store) claim(ctx context.Context, rec Record) (bool, *Record, error) {
+	db := s.db.WithContext(ctx)
+	for attempt := 0; attempt < 2; attempt++ {
+		rec.CreatedAt = time.Now()
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+		if res.Error != nil {
+			return false, nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			return true, nil, nil
+		}
+
+		var existing Record
+		err := db.Where("client = ? AND key = ?", rec.Client, rec.Key).Take(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // deleted in between, e.g. a failed first request
+		}
+		if err != nil {
+			return false, nil, err
+		}
+		if time.Since(existing.CreatedAt) <= s.window {
+			return false, &existing, nil
+		}
+		// The key expired but was not swept yet: start over.
+		if err := db.Delete(&existing).Error; err != nil {
+			return false, nil, err
+		}
+	}
+	return false, nil, errors.New("idempotency key is contended")
+}
+
+func (s *Store) replay(c *gin.Context, rec Record, existing *Record, fail func(c *gin.Context, status int, msg string)) {
+	switch {
+	case !bytes.Equal(existing.RequestHash, rec.RequestHash):
+		fail(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case existing.Status == 0:
+		fail(c, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+	default:
+		c.Header(ReplayedHeader, "true")
+		c.Data(existing.Status, existing.ContentType, existing.Body)
+	}
+	c.Abort()
+}
+
+// complete stores the response recorded by w, or releases the key when
+// the request failed with a server error.
+func (s *Store) complete(ctx context.Context, rec Record, w *recorder) {
+	if w.Status() >= http.StatusInternalServerError {
+		s.release(ctx, rec)
+		return
+	}
+	db, cancel := s.finishing(rec)
+	defer cancel()
+	err := db.Updates(&Record{
+		Status:      w.Status(),
+		ContentType: w.Header().Get("Content-Type"),
+		Body:        w.body.Bytes(),
+	}).Error
+	if err != nil {
+		logging.FromContext(ctx).Error("storing idempotent response failed", logging.Err(err))
+	}
+}
+
+// release deletes the record of a request that failed, so the client can
+// try again.
+func (s *Store) release(ctx context.Context, rec Record) {
+	db, cancel := s.finishing(rec)
+	defer cancel()
+	if err := db.Delete(&Record{}).Error; err != nil {
+		logging.FromContext(ctx).Error("releasing idempotency key failed", logging.Err(err))
+	}
+}
+
+// finishing returns a query of rec that runs even if the client went
+// away, or the key would stay in progress until it expires.
+func (s *Store) finishing(rec Record) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return s.db.WithContext(ctx).Model(&Record{}).Where("client = ? AND key = ?", rec.Client, rec.Key), cancel
+}
+
+// Sweep deletes expired keys every interval until ctx is done.
+func (s *Store) Sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-s.window)).Delete(&Record{}).Error
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("idempotency: sweeping keys: %v", err)
+			}
+		}
+	}
+}
+
+// clientKey scopes the keys of a request. On routes of a clinic that is
+// the clinic, not the client's address, which a mobile client may change
+// between retries; the request hash keeps a key from being reused for a
+// different request. Other routes are scoped to the client.
+func clientKey(c *gin.Context) string {
+	if tenantID, ok := tenant.FromContext(c.Request.Context()); ok {
+		return tenantKey(tenantID)
+	}
+	return client.Key(c)
+}
+
+// tenantKey scopes the keys of the requests of a clinic.
+func tenantKey(tenantID int) string {
+	return "tenant:" + strconv.Itoa(tenantID)
+}
+
+// requestHash fingerprints the route and body of a request, so a key
+// cannot be reused for a different operation.
+func requestHash(c *gin.Context, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,120 @@
+package idempotency
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"medically-core/client"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testContext returns a context for a request from ip, with the tenant
+// if it is set.
+func testContext(method, path, ip string, tenantID int) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, nil)
+	c.Request.RemoteAddr = ip + ":1234"
+	if tenantID != 0 {
+		c.Request = c.Request.WithContext(tenant.NewContext(c.Request.Context(), tenantID))
+	}
+	return c, w
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		tenantID  int
+		principal string
+		want      string
+	}{
+		{"by address", "192.0.2.1", 0, "", "ip:192.0.2.1"},
+		{"by principal", "192.0.2.1", 0, "42", "user:42"},
+		// A clinic's retries share keys whatever address they come from.
+		{"by tenant", "192.0.2.1", 7, "", "tenant:7"},
+		{"by tenant from another address", "198.51.100.9", 7, "", "tenant:7"},
+		{"by tenant with a principal", "192.0.2.1", 7, "42", "tenant:7"},
+	}
+	for _, tt := range tests {
+		c, _ := testContext(http.MethodPost, "/user", tt.ip, tt.tenantID)
+		if tt.principal != "" {
+			c.Set(client.PrincipalKey, tt.principal)
+		}
+		if got := clientKey(c); got != tt.want {
+			t.Errorf("%s: clientKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	hash := func(method, path, body string) []byte {
+		c, _ := testContext(method, path, "192.0.2.1", 0)
+		return requestHash(c, []byte(body))
+	}
+	h := hash(http.MethodPost, "/user", `{"name":"Jane"}`)
+	if !bytes.Equal(h, hash(http.MethodPost, "/user?x=1", `{"name":"Jane"}`)) {
+		t.Error("the query string changed the hash")
+	}
+	for name, other := range map[string][]byte{
+		"another body":   hash(http.MethodPost, "/user", `{"name":"John"}`),
+		"another route":  hash(http.MethodPost, "/clinic", `{"name":"Jane"}`),
+		"another method": hash(http.MethodPut, "/user", `{"name":"Jane"}`),
+	} {
+		if bytes.Equal(h, other) {
+			t.Errorf("%s has the same hash", name)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := &Store{}
+	fail := func(c *gin.Context, status int, msg string) { c.String(status, "error: "+msg) }
+	rec := Record{Client: "tenant:7", Key: "k", RequestHash: []byte("hash")}
+	tests := []struct {
+		name     string
+		existing Record
+		status   int
+		body     string
+		replayed bool
+	}{
+		{"completed", Record{RequestHash: []byte("hash"), Status: http.StatusCreated, ContentType: "application/json", Body: []byte(`{"id":1}`)},
+			http.StatusCreated, `{"id":1}`, true},
+		{"in progress", Record{RequestHash: []byte("hash")}, http.StatusConflict, "in progress", false},
+		{"another request", Record{RequestHash: []byte("other"), Status: http.StatusCreated, Body: []byte(`{"id":1}`)},
+			http.StatusUnprocessableEntity, "different request", false},
+	}
+	for _, tt := range tests {
+		c, w := testContext(http.MethodPost, "/user", "192.0.2.1", 7)
+		s.replay(c, rec, &tt.existing, fail)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: %d %q, want %d with %q", tt.name, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.replayed {
+			t.Errorf("%s: replayed header %v, want %v", tt.name, replayed, tt.replayed)
+		}
+		if !c.IsAborted() {
+			t.Errorf("%s: the handler was not skipped", tt.name)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	c, w := testContext(http.MethodPost, "/user", "192.0.2.1", 0)
+	r := &recorder{ResponseWriter: c.Writer}
+	r.WriteHeader(http.StatusCreated)
+	r.Write([]byte(`{"id":`))
+	r.WriteString(`1}`)
+	if got := r.body.String(); got != `{"id":1}` {
+		t.Errorf("recorded %q", got)
+	}
+	if w.Body.String() != `{"id":1}` {
+		t.Errorf("wrote %q", w.Body.String())
+	}
+}
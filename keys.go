@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"medically-core/changefeed"
+	"medically-core/config"
+	"medically-core/encryption"
+	"medically-core/hl7"
+	"medically-core/idempotency"
+	"medically-core/notifications"
+	"medically-core/tenant"
+	"medically-core/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// reencryptBatchSize is the number of rows rotate-keys rewrites at a time.
+const reencryptBatchSize = 500
+
+// encryptedModels lists every model with encrypted fields, which
+// rotate-keys re-encrypts. A model that gains an encrypted field must be
+// added here, or its rows stay under the old data keys.
+var encryptedModels = []interface{}{
+	&User{},
+	&PatientIdentifier{},
+	&Observation{},
+	&hl7.StoredMessage{},
+	&Appointment{},
+	&Prescription{},
+	&Dose{},
+	&notifications.Delivery{},
+	&webhooks.Subscription{},
+	&webhooks.Delivery{},
+	&changefeed.Change{},
+	&Diagnosis{},
+	&idempotency.Record{},
+}
+
+// setupEncryption loads the data keys and installs them for encrypted
+// fields and blind indexes.
+func setupEncryption(ctx context.Context, db *gorm.DB, cfg config.EncryptionConfig) (*encryption.Keyring, error) {
+	provider, err := encryption.NewLocalProvider(cfg.KeyFile, cfg.GenerateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := encryption.NewKeyring(ctx, db, provider)
+	if err != nil {
+		return nil, err
+	}
+	encryption.Register(keyring)
+	if err := encryption.RegisterCallbacks(db); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// rotateKeys implements the rotate-keys command. It creates a new data
+// key, rewraps every data key under the current master key and then
+// re-encrypts existing rows with the new data key while the service keeps
+// running. Running replicas pick up the new key on their next refresh.
+func rotateKeys(args []string) {
+	cfg, _, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := connectDB(ctx, cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := migrate(db, cfg.Tenancy.RowLevelSecurity); err != nil {
+		log.Fatal(err)
+	}
+	if err := tenant.Register(db); err != nil {
+		log.Fatal(err)
+	}
+	keyring, err := setupEncryption(ctx, db, cfg.Encryption)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	id, err := keyring.RotateDataKey(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rotate-keys: new data key %s", id)
+	n, err := keyring.Rewrap(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rotate-keys: rewrapped %d data keys", n)
+
+	// Rows of every clinic are re-encrypted, so Reencrypt needs the
+	// system context rather than ctx, which has no tenant.
+	ctx = tenant.System(ctx)
+	err = tenant.AsSystem(ctx, db, func(db *gorm.DB) error {
+		for _, m := range encryptedModels {
+			stmt := &gorm.Statement{DB: db}
+			if err := stmt.Parse(m); err != nil {
+				return err
+			}
+			n, err := encryption.Reencrypt(ctx, db, m, reencryptBatchSize)
+			log.Printf("rotate-keys: re-encrypted %d rows of %s", n, stmt.Schema.Table)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
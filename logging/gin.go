@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits client supplied IDs to a safe charset and length,
+// so they cannot be used to inject content into logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestID propagates the X-Request-ID header, generating an ID when the
+// client sent none or an invalid one. The ID is echoed in the response and
+// added to the logger carried by the request context.
+func RequestID(l *Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, id)
+		ctx = NewContext(ctx, l.With(String("request_id", id)))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RequestIDFrom returns the request ID carried by ctx, if any.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// AccessLog logs every request once it completes. It logs the route
+// template rather than the URL, whose path and query may hold patient
+// identifiers.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		level := LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = LevelError
+		}
+		FromContext(c.Request.Context()).Log(level, "request",
+			String("method", c.Request.Method),
+			String("route", route),
+			Int("status", status),
+			Duration("duration_ms", time.Since(start)),
+			Int("bytes", c.Writer.Size()),
+			String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns panics into 500 responses. Unlike gin.Recovery it does
+// not dump the request, whose headers and body may hold credentials or
+// patient data.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				FromContext(c.Request.Context()).Error("panic", Any("panic", r))
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
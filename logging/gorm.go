@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQuery is the duration above which a query is logged as a warning.
+const slowQuery = 200 * time.Millisecond
+
+// GormLogger adapts the logger of each request context to gorm's logger
+// interface. SQL is scrubbed with ScrubSQL because GORM interpolates the
+// query parameters into it.
+type GormLogger struct{}
+
+// NewGormLogger creates a GormLogger.
+func NewGormLogger() GormLogger {
+	return GormLogger{}
+}
+
+// LogMode implements gormlogger.Interface. Levels are controlled by the
+// Logger instead.
+func (g GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return g
+}
+
+// Info implements gormlogger.Interface.
+func (GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Info(ScrubSQL(fmt.Sprintf(msg, args...)), String("component", "gorm"))
+}
+
+// Warn implements gormlogger.Interface.
+func (GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Warn(ScrubSQL(fmt.Sprintf(msg, args...)), String("component", "gorm"))
+}
+
+// Error implements gormlogger.Interface.
+func (GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Error(ScrubSQL(fmt.Sprintf(msg, args...)), String("component", "gorm"))
+}
+
+// Trace implements gormlogger.Interface. Failed queries are logged as
+// errors, slow ones as warnings and the rest at debug level.
+func (GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l := FromContext(ctx)
+	elapsed := time.Since(begin)
+
+	var level Level
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = LevelError, "query failed"
+	case elapsed > slowQuery:
+		level, msg = LevelWarn, "slow query"
+	default:
+		level, msg = LevelDebug, "query"
+	}
+	if !l.Enabled(level) {
+		return
+	}
+
+	sql, rows := fc()
+	fields := []Field{
+		String("component", "gorm"),
+		String("sql", ScrubSQL(sql)),
+		Int64("rows", rows),
+		Duration("duration_ms", elapsed),
+	}
+	if level == LevelError {
+		fields = append(fields, Err(err))
+	}
+	l.Log(level, msg, fields...)
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata carries the request ID of gRPC calls, as
+// RequestIDHeader does for HTTP requests.
+const requestIDMetadata = "x-request-id"
+
+// UnaryServerInterceptor does for unary gRPC calls what RequestID,
+// AccessLog and Recovery do for HTTP requests: it propagates or generates
+// the request ID, logs every call once it completes and turns panics into
+// Internal errors.
+func UnaryServerInterceptor(l *Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx = withCallID(ctx, l)
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				FromContext(ctx).Error("panic", Any("panic", r))
+				err = status.Error(codes.Internal, "internal error")
+			}
+			logCall(ctx, info.FullMethod, start, err)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+func StreamServerInterceptor(l *Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := withCallID(ss.Context(), l)
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				FromContext(ctx).Error("panic", Any("panic", r))
+				err = status.Error(codes.Internal, "internal error")
+			}
+			logCall(ctx, info.FullMethod, start, err)
+		}()
+		return handler(srv, &callStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// withCallID returns ctx with the request ID of a call and a logger that
+// adds it, and sends the ID back in the response header.
+func withCallID(ctx context.Context, l *Logger) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if values := md.Get(requestIDMetadata); len(values) > 0 {
+		id = values[0]
+	}
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return NewContext(ctx, l.With(String("request_id", id)))
+}
+
+// logCall logs a completed call. Only its method is logged, as requests
+// may hold patient data.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = LevelError
+	}
+	FromContext(ctx).Log(level, "rpc",
+		String("method", method),
+		String("code", code.String()),
+		Duration("duration_ms", time.Since(start)),
+	)
+}
+
+// callStream is a server stream with the context of its call.
+type callStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *callStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,225 @@
+// Package logging writes structured JSON logs.
+//
+// Its API follows log/slog (levels, key/value fields, loggers carried in a
+// context) so call sites can move to slog once the module targets Go 1.21.
+// Every value is passed through Redact before it is encoded, so fields
+// tagged phi in models never reach the log output.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log record. The values match log/slog.
+type Level int32
+
+// Log levels.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// String returns the level name as written to the log.
+func (l Level) String() string {
+	switch {
+	case l <= LevelDebug:
+		return "DEBUG"
+	case l <= LevelInfo:
+		return "INFO"
+	case l <= LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// ParseLevel parses a level name such as "info", case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Field is a key/value pair attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string field.
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns an integer field.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int64 returns an integer field.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration returns a duration field, written in milliseconds.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: float64(value) / float64(time.Millisecond)}
+}
+
+// Err returns an "error" field holding the scrubbed message of err.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: ScrubError(err)}
+}
+
+// Any returns a field holding an arbitrary value. Structs are redacted
+// according to their phi tags.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// sink is the destination shared by a Logger and everything derived from
+// it with With.
+type sink struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level int32
+}
+
+// Logger writes JSON log records at or above its level.
+type Logger struct {
+	sink   *sink
+	fields []Field
+}
+
+// New creates a Logger writing to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{sink: &sink{w: w, level: int32(level)}}
+}
+
+// SetLevel changes the minimum level of l and of every logger derived
+// from it. It is safe to call while logging.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.sink.level, int32(level))
+}
+
+// Enabled reports whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return int32(level) >= atomic.LoadInt32(&l.sink.level)
+}
+
+// With returns a Logger that adds fields to every record.
+func (l *Logger) With(fields ...Field) *Logger {
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+	return &Logger{sink: l.sink, fields: all}
+}
+
+// Debug logs at LevelDebug.
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.Log(LevelDebug, msg, fields...)
+}
+
+// Info logs at LevelInfo.
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.Log(LevelInfo, msg, fields...)
+}
+
+// Warn logs at LevelWarn.
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.Log(LevelWarn, msg, fields...)
+}
+
+// Error logs at LevelError.
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.Log(LevelError, msg, fields...)
+}
+
+// Log writes a record at level.
+func (l *Logger) Log(level Level, msg string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, msg)
+	for _, fs := range [][]Field{l.fields, fields} {
+		for _, f := range fs {
+			buf.WriteByte(',')
+			writeJSON(&buf, f.Key)
+			buf.WriteByte(':')
+			writeJSON(&buf, Redact(f.Value))
+		}
+	}
+	buf.WriteString("}\n")
+
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.w.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("!logging: %v", err))
+	}
+	buf.Write(data)
+}
+
+type contextKey struct{}
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(New(os.Stderr, LevelInfo))
+}
+
+// Default returns the logger used when a context carries none.
+func Default() *Logger {
+	return defaultLogger.Load().(*Logger)
+}
+
+// SetDefault makes l the default logger.
+func SetDefault(l *Logger) {
+	defaultLogger.Store(l)
+}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
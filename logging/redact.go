@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+)
+
+// Redacted replaces values that must not be logged.
+const Redacted = "[REDACTED]"
+
+// phiTag is the struct tag marking a field as protected health
+// information, e.g. `phi:"true"`.
+const phiTag = "phi"
+
+// Redact returns v with every field tagged phi masked. Values whose type
+// holds no phi field, at any depth, are returned unchanged.
+func Redact(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if !hasPHI(rv.Type()) {
+		return v
+	}
+	return redactValue(rv)
+}
+
+func redactValue(rv reflect.Value) interface{} {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return redactValue(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = redactValue(rv.Index(i))
+		}
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			b, _ := json.Marshal(iter.Key().Interface())
+			out[strings.Trim(string(b), `"`)] = redactValue(iter.Value())
+		}
+		return out
+	case reflect.Struct:
+		if !hasPHI(rv.Type()) {
+			return rv.Interface()
+		}
+		t := rv.Type()
+		out := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			name, skip := jsonName(sf)
+			if skip {
+				continue
+			}
+			fv := rv.Field(i)
+			if isPHI(sf) {
+				if !fv.IsZero() {
+					out[name] = Redacted
+				} else {
+					out[name] = nil
+				}
+				continue
+			}
+			out[name] = redactValue(fv)
+		}
+		return out
+	}
+	if rv.CanInterface() {
+		return rv.Interface()
+	}
+	return nil
+}
+
+func jsonName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "" {
+		return sf.Name, false
+	}
+	return tag, false
+}
+
+func isPHI(sf reflect.StructField) bool {
+	return sf.Tag.Get(phiTag) == "true"
+}
+
+var phiTypes sync.Map // reflect.Type -> bool
+
+// hasPHI reports whether t holds a phi field at any depth. Only final
+// answers are cached, so concurrent callers never see a guess.
+func hasPHI(t reflect.Type) bool {
+	if v, ok := phiTypes.Load(t); ok {
+		return v.(bool)
+	}
+	found := scanPHI(t, map[reflect.Type]bool{})
+	phiTypes.Store(t, found)
+	return found
+}
+
+// scanPHI reports whether t holds a phi field at any depth. Types being
+// visited count as holding none, so recursive types terminate; whatever
+// they hold is found where they are first visited.
+func scanPHI(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if v, ok := phiTypes.Load(t); ok {
+		return v.(bool)
+	}
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return scanPHI(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath == "" && (isPHI(sf) || scanPHI(sf.Type, visiting)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quoted matches SQL string literals, including '' escapes.
+var quoted = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// ScrubSQL masks every string literal in sql. GORM interpolates query
+// parameters into the SQL it logs, so literals may hold patient data.
+func ScrubSQL(sql string) string {
+	return quoted.ReplaceAllString(sql, "'"+Redacted+"'")
+}
+
+// ScrubError returns a message for err that is safe to log. Postgres
+// errors keep their code and message but drop the detail, which echoes
+// the offending row values.
+func ScrubError(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		msg := pgErr.Severity + ": " + pgErr.Message + " (SQLSTATE " + pgErr.Code + ")"
+		return ScrubSQL(msg)
+	}
+	return ScrubSQL(err.Error())
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log"
+)
+
+// RedirectStdLog sends the output of the standard library logger, and of
+// anything else given the returned writer, to l at LevelInfo.
+func RedirectStdLog(l *Logger) io.Writer {
+	w := &lineWriter{logger: l}
+	log.SetFlags(0)
+	log.SetOutput(w)
+	return w
+}
+
+// lineWriter logs each write as one record.
+type lineWriter struct {
+	logger *Logger
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimRight(p, "\n"))
+	if msg != "" {
+		w.logger.Info(msg)
+	}
+	return len(p), nil
+}
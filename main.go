@@ -1,36 +1,271 @@
 package main
 
 import (
-	"os"
-	"log"
+	"context"
+	"errors"
 	"fmt"
-
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"medically-core/bulkexport"
+	"medically-core/changefeed"
+	"medically-core/config"
+	"medically-core/health"
+	"medically-core/hl7"
+	"medically-core/idempotency"
+	"medically-core/logging"
+	"medically-core/metrics"
+	"medically-core/nlp_processor"
+	"medically-core/notifications"
+	"medically-core/ratelimit"
+	"medically-core/storage"
+	"medically-core/tenant"
+	"medically-core/tracing"
+	"medically-core/userexport"
+	"medically-core/webhooks"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
+
 func main() {
-	db := setupDB()
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(os.Args[2:])
+		return
+	}
 
-	router := gin.Default()
+	cfg, opts, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.PrintConfig {
+		out, err := cfg.Redacted()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
 
-	server := NewServer(db)
-	server.RegisterRouter(router)
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, level)
+	logging.SetDefault(logger)
+	stdlog := logging.RedirectStdLog(logger)
 
-	log.Fatal(http.ListenAndServe(":9000", router))
-}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	conf := config.NewManager(cfg, opts)
+	conf.OnReload(func(cfg *config.Config) {
+		level, _ := logging.ParseLevel(cfg.Log.Level)
+		logger.SetLevel(level)
+	})
+	conf.WatchSignals(ctx)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func setupDB() *gorm.DB {
-	db, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_URL")), &gorm.Config{})
+	db, err := connectDB(ctx, cfg.Database)
 	if err != nil {
-		panic(fmt.Sprintf("failed to connect to database: %v", err))
+		log.Fatal(err)
+	}
+	if err := migrate(db, cfg.Tenancy.RowLevelSecurity); err != nil {
+		log.Fatal(err)
+	}
+	if err := tenant.Register(db); err != nil {
+		log.Fatal(err)
+	}
+	if err := metrics.InstrumentGORM(db); err != nil {
+		log.Fatal(err)
+	}
+	if err := tracing.InstrumentGORM(db); err != nil {
+		log.Fatal(err)
 	}
+	keyring, err := setupEncryption(ctx, db, cfg.Encryption)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keyring.Watch(ctx, time.Minute)
 
-	// Migrate the schema
-	if err := db.AutoMigrate(&User{}, &Disease{}, &Med{}, &Clinic{}); err != nil {
-		panic(err)
+	tenancy := tenant.NewResolver(db, cfg.Tenancy)
+	probes := health.NewRegistry(5 * time.Second)
+	probes.Register("database", pingDB(db))
+	probes.Register("migrations", checkMigrations(db))
+	if cfg.NLP.Enabled {
+		nlp, err := nlp_processor.New(ctx, cfg.NLP.CredentialsFile, requireNLPConsent(tenancy))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer nlp.Close()
+		probes.Register("nlp", nlp.Ping)
 	}
 
-	return db
-}
\ No newline at end of file
+	limiter, err := newLimiter(ctx, db, cfg.RateLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.OnReload(func(cfg *config.Config) {
+		limiter.Update(cfg.RateLimit)
+	})
+
+	idem, err := idempotency.NewStore(db, cfg.Idempotency.Window)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go idem.Sweep(ctx, time.Hour)
+
+	gin.SetMode(cfg.Server.Mode)
+	gin.DefaultWriter = stdlog
+	gin.DefaultErrorWriter = stdlog
+	router := gin.New()
+	// Only trusted proxies may name the client, which rate limits and
+	// the access log rely on.
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
+	router.Use(
+		logging.RequestID(logger),
+		tracing.Middleware(),
+		logging.AccessLog(),
+		// Metrics wrap Recovery so that panics count as the 500s they
+		// are answered with.
+		metrics.Middleware(),
+		logging.Recovery(),
+	)
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter, err := bulkexport.NewExporter(db, store, tenancy, cfg.BulkExport, fhirExportSources()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go exporter.Run(ctx)
+	notifier, err := notifications.New(db, cfg.Notifications)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go notifier.Run(ctx)
+	go generateReminders(ctx, db, tenancy, notifier, cfg.Reminders)
+	userExports, err := userexport.New(db, store, tenancy, keyring, cfg.UserExport, notifyUserExport(notifier), userExportSections()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go userExports.Run(ctx)
+	hooks, err := webhooks.New(db, cfg.Webhooks, webhookEvents...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go hooks.Run(ctx)
+	feed, err := changefeed.New(db, cfg.Changes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go feed.Run(ctx)
+	changes := &changePublisher{feed: feed, hooks: hooks}
+
+	var hl7Server *hl7.Server
+	hl7Done := make(chan struct{})
+	if cfg.HL7.Enabled {
+		handler, err := newHL7Handler(cfg.HL7.Mapping, changes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if hl7Server, err = hl7.NewServer(db, tenancy, handler, cfg.HL7); err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer close(hl7Done)
+			if err := hl7Server.ListenAndServe(ctx, cfg.HL7.Listen); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	} else {
+		close(hl7Done)
+	}
+
+	server := NewServer(db, probes, limiter, idem, tenancy, exporter, hl7Server, cfg.Scheduling, notifier, changes, cfg.GraphQL, userExports, cfg.Erasure)
+	server.RegisterRouter(router)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+	}
+	// Change streams only end when their client leaves.
+	srv.RegisterOnShutdown(feed.Close)
+	errc := make(chan error, 2)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	var grpcSrv *grpcServer
+	if cfg.GRPC.Enabled {
+		lis, err := net.Listen("tcp", cfg.GRPC.Listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcSrv = newGRPCServer(server, logger, cfg.GRPC)
+		go grpcSrv.WatchHealth(ctx, probes)
+		go func() {
+			errc <- grpcSrv.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("shutting down, draining requests for up to %s", cfg.Server.ShutdownTimeout)
+	probes.Drain()
+	if grpcSrv != nil {
+		grpcSrv.Drain()
+	}
+	// Keep serving until load balancers have seen that the service is
+	// no longer ready.
+	time.Sleep(cfg.Server.DrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("shutdown: %v", err)
+	}
+	if grpcSrv != nil {
+		grpcSrv.Stop(shutdownCtx)
+	}
+	// Messages being processed are still acknowledged.
+	select {
+	case <-hl7Done:
+	case <-shutdownCtx.Done():
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("flushing traces: %v", err)
+	}
+}
+
+// newLimiter creates the rate limiter with the store selected by cfg.
+func newLimiter(ctx context.Context, db *gorm.DB, cfg config.RateLimitConfig) (*ratelimit.Limiter, error) {
+	if cfg.Store != "postgres" {
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), cfg), nil
+	}
+	store, err := ratelimit.NewPostgresStore(db)
+	if err != nil {
+		return nil, err
+	}
+	go store.Sweep(ctx, time.Hour, 10*time.Minute)
+	return ratelimit.NewLimiter(store, cfg), nil
+}
@@ -0,0 +1,3 @@
+// Package medicallypb holds the messages and services of the gRPC API,
+// generated from medically.proto by "make proto".
+package medicallypb
@@ -0,0 +1,1037 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: medically.proto
+
+package medicallypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// UserServiceClient is the client API for UserService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UserServiceClient interface {
+	GetUser(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*User, error)
+	// ListUsers streams the users in order of ID.
+	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (UserService_ListUsersClient, error)
+	CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error)
+	// UpdateUser replaces the user with the ID of the request.
+	UpdateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error)
+}
+
+type userServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserServiceClient(cc grpc.ClientConnInterface) UserServiceClient {
+	return &userServiceClient{cc}
+}
+
+func (c *userServiceClient) GetUser(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/medically.v1.UserService/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (UserService_ListUsersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[0], "/medically.v1.UserService/ListUsers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &userServiceListUsersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UserService_ListUsersClient interface {
+	Recv() (*User, error)
+	grpc.ClientStream
+}
+
+type userServiceListUsersClient struct {
+	grpc.ClientStream
+}
+
+func (x *userServiceListUsersClient) Recv() (*User, error) {
+	m := new(User)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *userServiceClient) CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/medically.v1.UserService/CreateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UpdateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/medically.v1.UserService/UpdateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserServiceServer is the server API for UserService service.
+// All implementations must embed UnimplementedUserServiceServer
+// for forward compatibility
+type UserServiceServer interface {
+	GetUser(context.Context, *GetRequest) (*User, error)
+	// ListUsers streams the users in order of ID.
+	ListUsers(*ListUsersRequest, UserService_ListUsersServer) error
+	CreateUser(context.Context, *User) (*User, error)
+	// UpdateUser replaces the user with the ID of the request.
+	UpdateUser(context.Context, *User) (*User, error)
+	mustEmbedUnimplementedUserServiceServer()
+}
+
+// UnimplementedUserServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedUserServiceServer struct {
+}
+
+func (UnimplementedUserServiceServer) GetUser(context.Context, *GetRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedUserServiceServer) ListUsers(*ListUsersRequest, UserService_ListUsersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedUserServiceServer) CreateUser(context.Context, *User) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedUserServiceServer) UpdateUser(context.Context, *User) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
+
+// UnsafeUserServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserServiceServer will
+// result in compilation errors.
+type UnsafeUserServiceServer interface {
+	mustEmbedUnimplementedUserServiceServer()
+}
+
+func RegisterUserServiceServer(s grpc.ServiceRegistrar, srv UserServiceServer) {
+	s.RegisterService(&UserService_ServiceDesc, srv)
+}
+
+func _UserService_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.UserService/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).GetUser(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ListUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListUsersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserServiceServer).ListUsers(m, &userServiceListUsersServer{stream})
+}
+
+type UserService_ListUsersServer interface {
+	Send(*User) error
+	grpc.ServerStream
+}
+
+type userServiceListUsersServer struct {
+	grpc.ServerStream
+}
+
+func (x *userServiceListUsersServer) Send(m *User) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _UserService_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.UserService/CreateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).CreateUser(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.UserService/UpdateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UpdateUser(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "medically.v1.UserService",
+	HandlerType: (*UserServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUser",
+			Handler:    _UserService_GetUser_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _UserService_CreateUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _UserService_UpdateUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListUsers",
+			Handler:       _UserService_ListUsers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "medically.proto",
+}
+
+// MedServiceClient is the client API for MedService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MedServiceClient interface {
+	GetMed(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Med, error)
+	// ListMeds streams the meds in order of ID.
+	ListMeds(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (MedService_ListMedsClient, error)
+	CreateMed(ctx context.Context, in *Med, opts ...grpc.CallOption) (*Med, error)
+	// UpdateMed replaces the med with the ID of the request.
+	UpdateMed(ctx context.Context, in *Med, opts ...grpc.CallOption) (*Med, error)
+	// DeleteMed returns the deleted med.
+	DeleteMed(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Med, error)
+}
+
+type medServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMedServiceClient(cc grpc.ClientConnInterface) MedServiceClient {
+	return &medServiceClient{cc}
+}
+
+func (c *medServiceClient) GetMed(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Med, error) {
+	out := new(Med)
+	err := c.cc.Invoke(ctx, "/medically.v1.MedService/GetMed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *medServiceClient) ListMeds(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (MedService_ListMedsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MedService_ServiceDesc.Streams[0], "/medically.v1.MedService/ListMeds", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &medServiceListMedsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MedService_ListMedsClient interface {
+	Recv() (*Med, error)
+	grpc.ClientStream
+}
+
+type medServiceListMedsClient struct {
+	grpc.ClientStream
+}
+
+func (x *medServiceListMedsClient) Recv() (*Med, error) {
+	m := new(Med)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *medServiceClient) CreateMed(ctx context.Context, in *Med, opts ...grpc.CallOption) (*Med, error) {
+	out := new(Med)
+	err := c.cc.Invoke(ctx, "/medically.v1.MedService/CreateMed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *medServiceClient) UpdateMed(ctx context.Context, in *Med, opts ...grpc.CallOption) (*Med, error) {
+	out := new(Med)
+	err := c.cc.Invoke(ctx, "/medically.v1.MedService/UpdateMed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *medServiceClient) DeleteMed(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Med, error) {
+	out := new(Med)
+	err := c.cc.Invoke(ctx, "/medically.v1.MedService/DeleteMed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MedServiceServer is the server API for MedService service.
+// All implementations must embed UnimplementedMedServiceServer
+// for forward compatibility
+type MedServiceServer interface {
+	GetMed(context.Context, *GetRequest) (*Med, error)
+	// ListMeds streams the meds in order of ID.
+	ListMeds(*ListRequest, MedService_ListMedsServer) error
+	CreateMed(context.Context, *Med) (*Med, error)
+	// UpdateMed replaces the med with the ID of the request.
+	UpdateMed(context.Context, *Med) (*Med, error)
+	// DeleteMed returns the deleted med.
+	DeleteMed(context.Context, *DeleteRequest) (*Med, error)
+	mustEmbedUnimplementedMedServiceServer()
+}
+
+// UnimplementedMedServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMedServiceServer struct {
+}
+
+func (UnimplementedMedServiceServer) GetMed(context.Context, *GetRequest) (*Med, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMed not implemented")
+}
+func (UnimplementedMedServiceServer) ListMeds(*ListRequest, MedService_ListMedsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListMeds not implemented")
+}
+func (UnimplementedMedServiceServer) CreateMed(context.Context, *Med) (*Med, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateMed not implemented")
+}
+func (UnimplementedMedServiceServer) UpdateMed(context.Context, *Med) (*Med, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMed not implemented")
+}
+func (UnimplementedMedServiceServer) DeleteMed(context.Context, *DeleteRequest) (*Med, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMed not implemented")
+}
+func (UnimplementedMedServiceServer) mustEmbedUnimplementedMedServiceServer() {}
+
+// UnsafeMedServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MedServiceServer will
+// result in compilation errors.
+type UnsafeMedServiceServer interface {
+	mustEmbedUnimplementedMedServiceServer()
+}
+
+func RegisterMedServiceServer(s grpc.ServiceRegistrar, srv MedServiceServer) {
+	s.RegisterService(&MedService_ServiceDesc, srv)
+}
+
+func _MedService_GetMed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MedServiceServer).GetMed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.MedService/GetMed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MedServiceServer).GetMed(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MedService_ListMeds_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MedServiceServer).ListMeds(m, &medServiceListMedsServer{stream})
+}
+
+type MedService_ListMedsServer interface {
+	Send(*Med) error
+	grpc.ServerStream
+}
+
+type medServiceListMedsServer struct {
+	grpc.ServerStream
+}
+
+func (x *medServiceListMedsServer) Send(m *Med) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MedService_CreateMed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Med)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MedServiceServer).CreateMed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.MedService/CreateMed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MedServiceServer).CreateMed(ctx, req.(*Med))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MedService_UpdateMed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Med)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MedServiceServer).UpdateMed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.MedService/UpdateMed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MedServiceServer).UpdateMed(ctx, req.(*Med))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MedService_DeleteMed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MedServiceServer).DeleteMed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.MedService/DeleteMed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MedServiceServer).DeleteMed(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MedService_ServiceDesc is the grpc.ServiceDesc for MedService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MedService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "medically.v1.MedService",
+	HandlerType: (*MedServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMed",
+			Handler:    _MedService_GetMed_Handler,
+		},
+		{
+			MethodName: "CreateMed",
+			Handler:    _MedService_CreateMed_Handler,
+		},
+		{
+			MethodName: "UpdateMed",
+			Handler:    _MedService_UpdateMed_Handler,
+		},
+		{
+			MethodName: "DeleteMed",
+			Handler:    _MedService_DeleteMed_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListMeds",
+			Handler:       _MedService_ListMeds_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "medically.proto",
+}
+
+// DiseaseServiceClient is the client API for DiseaseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DiseaseServiceClient interface {
+	GetDisease(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Disease, error)
+	// ListDiseases streams the diseases in order of ID.
+	ListDiseases(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (DiseaseService_ListDiseasesClient, error)
+	CreateDisease(ctx context.Context, in *Disease, opts ...grpc.CallOption) (*Disease, error)
+	// UpdateDisease replaces the disease with the ID of the request.
+	UpdateDisease(ctx context.Context, in *Disease, opts ...grpc.CallOption) (*Disease, error)
+	// DeleteDisease returns the deleted disease.
+	DeleteDisease(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Disease, error)
+}
+
+type diseaseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDiseaseServiceClient(cc grpc.ClientConnInterface) DiseaseServiceClient {
+	return &diseaseServiceClient{cc}
+}
+
+func (c *diseaseServiceClient) GetDisease(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Disease, error) {
+	out := new(Disease)
+	err := c.cc.Invoke(ctx, "/medically.v1.DiseaseService/GetDisease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *diseaseServiceClient) ListDiseases(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (DiseaseService_ListDiseasesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DiseaseService_ServiceDesc.Streams[0], "/medically.v1.DiseaseService/ListDiseases", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &diseaseServiceListDiseasesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DiseaseService_ListDiseasesClient interface {
+	Recv() (*Disease, error)
+	grpc.ClientStream
+}
+
+type diseaseServiceListDiseasesClient struct {
+	grpc.ClientStream
+}
+
+func (x *diseaseServiceListDiseasesClient) Recv() (*Disease, error) {
+	m := new(Disease)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *diseaseServiceClient) CreateDisease(ctx context.Context, in *Disease, opts ...grpc.CallOption) (*Disease, error) {
+	out := new(Disease)
+	err := c.cc.Invoke(ctx, "/medically.v1.DiseaseService/CreateDisease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *diseaseServiceClient) UpdateDisease(ctx context.Context, in *Disease, opts ...grpc.CallOption) (*Disease, error) {
+	out := new(Disease)
+	err := c.cc.Invoke(ctx, "/medically.v1.DiseaseService/UpdateDisease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *diseaseServiceClient) DeleteDisease(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Disease, error) {
+	out := new(Disease)
+	err := c.cc.Invoke(ctx, "/medically.v1.DiseaseService/DeleteDisease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DiseaseServiceServer is the server API for DiseaseService service.
+// All implementations must embed UnimplementedDiseaseServiceServer
+// for forward compatibility
+type DiseaseServiceServer interface {
+	GetDisease(context.Context, *GetRequest) (*Disease, error)
+	// ListDiseases streams the diseases in order of ID.
+	ListDiseases(*ListRequest, DiseaseService_ListDiseasesServer) error
+	CreateDisease(context.Context, *Disease) (*Disease, error)
+	// UpdateDisease replaces the disease with the ID of the request.
+	UpdateDisease(context.Context, *Disease) (*Disease, error)
+	// DeleteDisease returns the deleted disease.
+	DeleteDisease(context.Context, *DeleteRequest) (*Disease, error)
+	mustEmbedUnimplementedDiseaseServiceServer()
+}
+
+// UnimplementedDiseaseServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDiseaseServiceServer struct {
+}
+
+func (UnimplementedDiseaseServiceServer) GetDisease(context.Context, *GetRequest) (*Disease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDisease not implemented")
+}
+func (UnimplementedDiseaseServiceServer) ListDiseases(*ListRequest, DiseaseService_ListDiseasesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListDiseases not implemented")
+}
+func (UnimplementedDiseaseServiceServer) CreateDisease(context.Context, *Disease) (*Disease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDisease not implemented")
+}
+func (UnimplementedDiseaseServiceServer) UpdateDisease(context.Context, *Disease) (*Disease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateDisease not implemented")
+}
+func (UnimplementedDiseaseServiceServer) DeleteDisease(context.Context, *DeleteRequest) (*Disease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDisease not implemented")
+}
+func (UnimplementedDiseaseServiceServer) mustEmbedUnimplementedDiseaseServiceServer() {}
+
+// UnsafeDiseaseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DiseaseServiceServer will
+// result in compilation errors.
+type UnsafeDiseaseServiceServer interface {
+	mustEmbedUnimplementedDiseaseServiceServer()
+}
+
+func RegisterDiseaseServiceServer(s grpc.ServiceRegistrar, srv DiseaseServiceServer) {
+	s.RegisterService(&DiseaseService_ServiceDesc, srv)
+}
+
+func _DiseaseService_GetDisease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DiseaseServiceServer).GetDisease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.DiseaseService/GetDisease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DiseaseServiceServer).GetDisease(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DiseaseService_ListDiseases_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DiseaseServiceServer).ListDiseases(m, &diseaseServiceListDiseasesServer{stream})
+}
+
+type DiseaseService_ListDiseasesServer interface {
+	Send(*Disease) error
+	grpc.ServerStream
+}
+
+type diseaseServiceListDiseasesServer struct {
+	grpc.ServerStream
+}
+
+func (x *diseaseServiceListDiseasesServer) Send(m *Disease) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _DiseaseService_CreateDisease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Disease)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DiseaseServiceServer).CreateDisease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.DiseaseService/CreateDisease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DiseaseServiceServer).CreateDisease(ctx, req.(*Disease))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DiseaseService_UpdateDisease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Disease)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DiseaseServiceServer).UpdateDisease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.DiseaseService/UpdateDisease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DiseaseServiceServer).UpdateDisease(ctx, req.(*Disease))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DiseaseService_DeleteDisease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DiseaseServiceServer).DeleteDisease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.DiseaseService/DeleteDisease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DiseaseServiceServer).DeleteDisease(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DiseaseService_ServiceDesc is the grpc.ServiceDesc for DiseaseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DiseaseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "medically.v1.DiseaseService",
+	HandlerType: (*DiseaseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDisease",
+			Handler:    _DiseaseService_GetDisease_Handler,
+		},
+		{
+			MethodName: "CreateDisease",
+			Handler:    _DiseaseService_CreateDisease_Handler,
+		},
+		{
+			MethodName: "UpdateDisease",
+			Handler:    _DiseaseService_UpdateDisease_Handler,
+		},
+		{
+			MethodName: "DeleteDisease",
+			Handler:    _DiseaseService_DeleteDisease_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListDiseases",
+			Handler:       _DiseaseService_ListDiseases_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "medically.proto",
+}
+
+// ClinicServiceClient is the client API for ClinicService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClinicServiceClient interface {
+	GetClinic(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Clinic, error)
+	// ListClinics streams the clinics in order of ID.
+	ListClinics(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (ClinicService_ListClinicsClient, error)
+	CreateClinic(ctx context.Context, in *Clinic, opts ...grpc.CallOption) (*Clinic, error)
+	// UpdateClinic replaces the clinic with the ID of the request.
+	UpdateClinic(ctx context.Context, in *Clinic, opts ...grpc.CallOption) (*Clinic, error)
+	// DeleteClinic returns the deleted clinic.
+	DeleteClinic(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Clinic, error)
+}
+
+type clinicServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClinicServiceClient(cc grpc.ClientConnInterface) ClinicServiceClient {
+	return &clinicServiceClient{cc}
+}
+
+func (c *clinicServiceClient) GetClinic(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Clinic, error) {
+	out := new(Clinic)
+	err := c.cc.Invoke(ctx, "/medically.v1.ClinicService/GetClinic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clinicServiceClient) ListClinics(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (ClinicService_ListClinicsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ClinicService_ServiceDesc.Streams[0], "/medically.v1.ClinicService/ListClinics", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clinicServiceListClinicsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ClinicService_ListClinicsClient interface {
+	Recv() (*Clinic, error)
+	grpc.ClientStream
+}
+
+type clinicServiceListClinicsClient struct {
+	grpc.ClientStream
+}
+
+func (x *clinicServiceListClinicsClient) Recv() (*Clinic, error) {
+	m := new(Clinic)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *clinicServiceClient) CreateClinic(ctx context.Context, in *Clinic, opts ...grpc.CallOption) (*Clinic, error) {
+	out := new(Clinic)
+	err := c.cc.Invoke(ctx, "/medically.v1.ClinicService/CreateClinic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clinicServiceClient) UpdateClinic(ctx context.Context, in *Clinic, opts ...grpc.CallOption) (*Clinic, error) {
+	out := new(Clinic)
+	err := c.cc.Invoke(ctx, "/medically.v1.ClinicService/UpdateClinic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clinicServiceClient) DeleteClinic(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*Clinic, error) {
+	out := new(Clinic)
+	err := c.cc.Invoke(ctx, "/medically.v1.ClinicService/DeleteClinic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClinicServiceServer is the server API for ClinicService service.
+// All implementations must embed UnimplementedClinicServiceServer
+// for forward compatibility
+type ClinicServiceServer interface {
+	GetClinic(context.Context, *GetRequest) (*Clinic, error)
+	// ListClinics streams the clinics in order of ID.
+	ListClinics(*ListRequest, ClinicService_ListClinicsServer) error
+	CreateClinic(context.Context, *Clinic) (*Clinic, error)
+	// UpdateClinic replaces the clinic with the ID of the request.
+	UpdateClinic(context.Context, *Clinic) (*Clinic, error)
+	// DeleteClinic returns the deleted clinic.
+	DeleteClinic(context.Context, *DeleteRequest) (*Clinic, error)
+	mustEmbedUnimplementedClinicServiceServer()
+}
+
+// UnimplementedClinicServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedClinicServiceServer struct {
+}
+
+func (UnimplementedClinicServiceServer) GetClinic(context.Context, *GetRequest) (*Clinic, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClinic not implemented")
+}
+func (UnimplementedClinicServiceServer) ListClinics(*ListRequest, ClinicService_ListClinicsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListClinics not implemented")
+}
+func (UnimplementedClinicServiceServer) CreateClinic(context.Context, *Clinic) (*Clinic, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateClinic not implemented")
+}
+func (UnimplementedClinicServiceServer) UpdateClinic(context.Context, *Clinic) (*Clinic, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateClinic not implemented")
+}
+func (UnimplementedClinicServiceServer) DeleteClinic(context.Context, *DeleteRequest) (*Clinic, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteClinic not implemented")
+}
+func (UnimplementedClinicServiceServer) mustEmbedUnimplementedClinicServiceServer() {}
+
+// UnsafeClinicServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClinicServiceServer will
+// result in compilation errors.
+type UnsafeClinicServiceServer interface {
+	mustEmbedUnimplementedClinicServiceServer()
+}
+
+func RegisterClinicServiceServer(s grpc.ServiceRegistrar, srv ClinicServiceServer) {
+	s.RegisterService(&ClinicService_ServiceDesc, srv)
+}
+
+func _ClinicService_GetClinic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClinicServiceServer).GetClinic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.ClinicService/GetClinic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClinicServiceServer).GetClinic(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClinicService_ListClinics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClinicServiceServer).ListClinics(m, &clinicServiceListClinicsServer{stream})
+}
+
+type ClinicService_ListClinicsServer interface {
+	Send(*Clinic) error
+	grpc.ServerStream
+}
+
+type clinicServiceListClinicsServer struct {
+	grpc.ServerStream
+}
+
+func (x *clinicServiceListClinicsServer) Send(m *Clinic) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ClinicService_CreateClinic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Clinic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClinicServiceServer).CreateClinic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.ClinicService/CreateClinic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClinicServiceServer).CreateClinic(ctx, req.(*Clinic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClinicService_UpdateClinic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Clinic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClinicServiceServer).UpdateClinic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.ClinicService/UpdateClinic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClinicServiceServer).UpdateClinic(ctx, req.(*Clinic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClinicService_DeleteClinic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClinicServiceServer).DeleteClinic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/medically.v1.ClinicService/DeleteClinic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClinicServiceServer).DeleteClinic(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ClinicService_ServiceDesc is the grpc.ServiceDesc for ClinicService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ClinicService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "medically.v1.ClinicService",
+	HandlerType: (*ClinicServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetClinic",
+			Handler:    _ClinicService_GetClinic_Handler,
+		},
+		{
+			MethodName: "CreateClinic",
+			Handler:    _ClinicService_CreateClinic_Handler,
+		},
+		{
+			MethodName: "UpdateClinic",
+			Handler:    _ClinicService_UpdateClinic_Handler,
+		},
+		{
+			MethodName: "DeleteClinic",
+			Handler:    _ClinicService_DeleteClinic_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListClinics",
+			Handler:       _ClinicService_ListClinics_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "medically.proto",
+}
@@ -0,0 +1,33 @@
+// Package metrics exposes Prometheus metrics for HTTP requests, database
+// queries and NLP calls.
+//
+// Labels are restricted to bounded, non-identifying values: HTTP requests
+// are labelled with the route template (e.g. /user/:userID), never the
+// raw path, so patient IDs cannot end up in a time series.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "medically"
+
+// registry holds every metric of the service. A private registry keeps
+// metrics of vendored libraries out unless added deliberately.
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	nlpCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nlp",
+		Name:      "calls_total",
+		Help:      "Calls to the language API by method.",
+	}, []string{"method"})
+
+	nlpErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nlp",
+		Name:      "errors_total",
+		Help:      "Failed calls to the language API by method and gRPC status code.",
+	}, []string{"method", "code"})
+
+	nlpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "nlp",
+		Name:      "call_duration_seconds",
+		Help:      "Language API call latency by method.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method"})
+)
+
+func init() {
+	registry.MustRegister(nlpCalls, nlpErrors, nlpDuration)
+}
+
+// ObserveNLPCall records a language API call to method that started at
+// start and returned err.
+func ObserveNLPCall(method string, start time.Time, err error) {
+	nlpCalls.WithLabelValues(method).Inc()
+	nlpDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		nlpErrors.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
@@ -1,30 +1,411 @@
 package main
 
+import "time"
+
+// Fields tagged `phi:"true"` hold protected health information. The
+// logging package masks them before anything is written to the logs.
+
+// Fields with the "encrypted" serializer are stored encrypted by the
+// encryption package. A field tagged `blindindex:"Field"` holds a keyed
+// hash of Field, so rows can be looked up by its value.
+
+// UpdatedAt is maintained by GORM and backs incremental exports. Rows
+// written before it was added have none.
+
+// Models with a TenantID field are owned by a clinic, and the tenant
+// package restricts every access to them to the clinic of the request.
+
 // User is a model in the "users" table.
 type User struct {
 	ID   	int     `json:"id,omitempty"`
-	Name 	*string `json:"name" gorm:"not null"`
-	Email 	*string `json:"email" gorm:"not null"`
-	Contact *string `json:"contact" gorm:"not null"`
+	TenantID int    `json:"tenantId,omitempty" gorm:"index"`
+	Tenant  *Clinic `json:"-" gorm:"foreignKey:TenantID"`
+	Name 	*string `json:"name" gorm:"not null" phi:"true"`
+	Email 	*string `json:"email" gorm:"not null;serializer:encrypted" phi:"true"`
+	EmailIndex string `json:"-" gorm:"index" blindindex:"Email"`
+	Contact *string `json:"contact" gorm:"not null;serializer:encrypted" phi:"true"`
+	BirthDate *string `json:"birthDate,omitempty" gorm:"serializer:encrypted" phi:"true"`
+	UpdatedAt *time.Time `json:"-"`
+}
+
+// PatientIdentifier is an identifier a partner system knows a user by,
+// such as a hospital's medical record number, in the
+// "patient_identifiers" table.
+type PatientIdentifier struct {
+	ID       int    `json:"id,omitempty"`
+	TenantID int    `json:"tenantId,omitempty" gorm:"uniqueIndex:idx_patient_identifiers_value"`
+	UserID   int    `json:"userId" gorm:"not null;index"`
+	User     *User  `json:"-"`
+	System   string `json:"system" gorm:"not null;uniqueIndex:idx_patient_identifiers_value"`
+	Value    string `json:"value" gorm:"not null;serializer:encrypted" phi:"true"`
+	ValueIndex string `json:"-" gorm:"uniqueIndex:idx_patient_identifiers_value" blindindex:"Value"`
+}
+
+// Observation is a lab result of a user in the "observations" table.
+// MessageID is the HL7 message it was received in.
+type Observation struct {
+	ID             int        `json:"id,omitempty"`
+	TenantID       int        `json:"tenantId,omitempty" gorm:"index"`
+	UserID         int        `json:"userId" gorm:"not null;index"`
+	User           *User      `json:"-"`
+	MessageID      int        `json:"messageId,omitempty" gorm:"index"`
+	Code           string     `json:"code" gorm:"not null"`
+	CodeSystem     string     `json:"codeSystem,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	Value          string     `json:"value" gorm:"serializer:encrypted" phi:"true"`
+	Unit           string     `json:"unit,omitempty"`
+	ReferenceRange string     `json:"referenceRange,omitempty"`
+	Flag           string     `json:"flag,omitempty"`
+	Status         string     `json:"status,omitempty"`
+	EffectiveAt    *time.Time `json:"effectiveAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
 }
 
 // Med is a model in the "medications" table.
 type Med struct {
 	ID    int     `json:"id,omitempty"`
 	Name  *string `json:"name"  gorm:"not null"`
-	Desc  *string `json:"desc" 	gorm:"not null"`
+	Desc  *string `json:"desc"  gorm:"not null"`
+	UpdatedAt *time.Time `json:"-"`
 }
 
 // Disease is a model in the "diseases" table.
 type Disease struct {
 	ID    int     `json:"id,omitempty"`
 	Name  *string `json:"name"  gorm:"not null"`
-	Desc  *string `json:"desc" 	gorm:"not null"`
+	Desc  *string `json:"desc"  gorm:"not null"`
+	UpdatedAt *time.Time `json:"-"`
 }
 
-// Clinics is a model in the "clinics" table.
+// Clinics is a model in the "clinics" table. Timezone is the IANA
+// timezone of its opening hours, UTC if empty.
 type Clinic struct {
 	ID    int     `json:"id,omitempty"`
 	Name  *string `json:"name"  gorm:"not null"`
-	Desc  *string `json:"desc" 	gorm:"not null"`
+	Desc  *string `json:"desc"  gorm:"not null"`
+	Address   Address  `json:"address" gorm:"embedded;embeddedPrefix:address_"`
+	Latitude  *float64 `json:"latitude" gorm:"index:idx_clinics_location"`
+	Longitude *float64 `json:"longitude" gorm:"index:idx_clinics_location"`
+	Timezone  string   `json:"timezone"`
+	UpdatedAt *time.Time `json:"-"`
+}
+
+// Address is a postal address.
+type Address struct {
+	Line       string `json:"line,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// OpeningHours is a weekly period in which a clinic is open, in the
+// "opening_hours" table. Opens and Closes are times of day such as "08:00"
+// in the clinic's timezone, and Weekday counts from Sunday (0). A day may
+// have several periods, e.g. around a lunch break.
+type OpeningHours struct {
+	ID       int    `json:"id,omitempty"`
+	ClinicID int    `json:"clinicId" gorm:"not null;index"`
+	Clinic   *Clinic `json:"-"`
+	Weekday  int    `json:"weekday"`
+	Opens    string `json:"opens" gorm:"not null"`
+	Closes   string `json:"closes" gorm:"not null"`
+}
+
+// Holiday is a date on which a clinic deviates from its opening hours, in
+// the "holidays" table: it is closed, or only open from Opens until
+// Closes if they are set. Date is written as "2006-01-02".
+type Holiday struct {
+	ID       int     `json:"id,omitempty"`
+	ClinicID int     `json:"clinicId" gorm:"not null;uniqueIndex:idx_holidays_date"`
+	Clinic   *Clinic `json:"-"`
+	Date     string  `json:"date" gorm:"not null;uniqueIndex:idx_holidays_date"`
+	Name     string  `json:"name,omitempty"`
+	Opens    string  `json:"opens,omitempty"`
+	Closes   string  `json:"closes,omitempty"`
+}
+
+// ClinicService is a service a clinic offers, such as "vaccination", in
+// the "clinic_services" table.
+type ClinicService struct {
+	ID       int     `json:"id,omitempty"`
+	ClinicID int     `json:"clinicId" gorm:"not null;uniqueIndex:idx_clinic_services_name"`
+	Clinic   *Clinic `json:"-"`
+	Name     string  `json:"name" gorm:"not null;uniqueIndex:idx_clinic_services_name"`
+	Desc     string  `json:"desc,omitempty"`
+}
+
+// Clinician is a member of a clinic's staff whom patients book
+// appointments with, in the "clinicians" table.
+type Clinician struct {
+	ID        int    `json:"id,omitempty"`
+	TenantID  int    `json:"tenantId,omitempty" gorm:"index"`
+	Name      string `json:"name" gorm:"not null"`
+	Specialty string `json:"specialty,omitempty"`
+}
+
+// Schedule is a weekly period in which a clinician takes appointments of
+// SlotMinutes each, in the "schedules" table. StartTime and EndTime are
+// times of day such as "09:00" in Timezone, and Weekday counts from Sunday (0).
+type Schedule struct {
+	ID          int        `json:"id,omitempty"`
+	TenantID    int        `json:"tenantId,omitempty" gorm:"index"`
+	ClinicianID int        `json:"clinicianId" gorm:"not null;index"`
+	Clinician   *Clinician `json:"-"`
+	Weekday     int        `json:"weekday"`
+	StartTime   string     `json:"start" gorm:"not null"`
+	EndTime     string     `json:"end" gorm:"not null"`
+	SlotMinutes int        `json:"slotMinutes" gorm:"not null"`
+	Timezone    string     `json:"timezone" gorm:"not null"`
+}
+
+// Appointment statuses.
+const (
+	AppointmentBooked    = "booked"
+	AppointmentCancelled = "cancelled"
+)
+
+// Appointment is a slot of a clinician booked by a user, in the
+// "appointments" table. Sequence counts the changes since it was booked,
+// so calendars replace their copy of it.
+type Appointment struct {
+	ID          int        `json:"id,omitempty"`
+	TenantID    int        `json:"tenantId,omitempty" gorm:"index"`
+	UserID      int        `json:"userId" gorm:"not null;index"`
+	User        *User      `json:"-"`
+	ClinicianID int        `json:"clinicianId" gorm:"not null;index:idx_appointments_clinician_start"`
+	Clinician   *Clinician `json:"-"`
+	StartAt     time.Time  `json:"startAt" gorm:"not null;index:idx_appointments_clinician_start"`
+	EndAt       time.Time  `json:"endAt" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null"`
+	Reason      string     `json:"reason,omitempty" gorm:"serializer:encrypted" phi:"true"`
+	Sequence    int        `json:"sequence"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"-"`
+}
+
+// Prescription is a medication prescribed to a user, in the
+// "prescriptions" table. Doses are due every day at Times, times of day
+// such as "08:00" in Timezone, derived from TimesPerDay when not given,
+// from StartDate for DurationDays days (with no end if 0) or until the
+// prescription is stopped. PRN medications are taken as needed, so no
+// doses are due.
+type Prescription struct {
+	ID           int        `json:"id,omitempty"`
+	TenantID     int        `json:"tenantId,omitempty" gorm:"index"`
+	UserID       int        `json:"userId" gorm:"not null;index"`
+	User         *User      `json:"-"`
+	MedID        int        `json:"medId" gorm:"not null;index"`
+	Med          *Med       `json:"-"`
+	Dose         string     `json:"dose,omitempty"`
+	TimesPerDay  int        `json:"timesPerDay"`
+	Times        []string   `json:"times" gorm:"serializer:json"`
+	StartDate    string     `json:"startDate" gorm:"not null"`
+	DurationDays int        `json:"durationDays,omitempty"`
+	PRN          bool       `json:"prn"`
+	Timezone     string     `json:"timezone" gorm:"not null"`
+	Instructions string     `json:"instructions,omitempty" gorm:"serializer:encrypted" phi:"true"`
+	StoppedAt    *time.Time `json:"stoppedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    *time.Time `json:"-"`
+}
+
+// Dose statuses.
+const (
+	DoseTaken   = "taken"
+	DoseSkipped = "skipped"
+)
+
+// Dose is a dose a user logged as taken or skipped, in the "doses" table.
+// ScheduledAt is when the dose was due, and is nil for PRN medications.
+type Dose struct {
+	ID             int           `json:"id,omitempty"`
+	TenantID       int           `json:"tenantId,omitempty" gorm:"index"`
+	UserID         int           `json:"userId" gorm:"not null;index"`
+	User           *User         `json:"-"`
+	PrescriptionID int           `json:"prescriptionId" gorm:"not null;uniqueIndex:idx_doses_scheduled"`
+	Prescription   *Prescription `json:"-"`
+	ScheduledAt    *time.Time    `json:"scheduledAt,omitempty" gorm:"uniqueIndex:idx_doses_scheduled"`
+	TakenAt        time.Time     `json:"takenAt" gorm:"not null"`
+	Status         string        `json:"status" gorm:"not null"`
+	Note           string        `json:"note,omitempty" gorm:"serializer:encrypted" phi:"true"`
+	CreatedAt      time.Time     `json:"createdAt"`
+}
+
+// Reminder statuses. A reminder is pending until its dose is logged.
+const (
+	ReminderPending = "pending"
+	ReminderLogged  = "logged"
+)
+
+// Reminder is a dose due for a user, generated ahead of time from their
+// prescriptions so it can be announced, in the "reminders" table.
+// NotifiedAt is when the user was notified of it.
+type Reminder struct {
+	ID             int           `json:"id,omitempty"`
+	TenantID       int           `json:"tenantId,omitempty" gorm:"index"`
+	UserID         int           `json:"userId" gorm:"not null;index"`
+	User           *User         `json:"-"`
+	PrescriptionID int           `json:"prescriptionId" gorm:"not null;uniqueIndex:idx_reminders_due"`
+	Prescription   *Prescription `json:"-"`
+	DueAt          time.Time     `json:"dueAt" gorm:"not null;uniqueIndex:idx_reminders_due;index"`
+	Status         string        `json:"status" gorm:"not null"`
+	NotifiedAt     *time.Time    `json:"notifiedAt,omitempty"`
+}
+
+// Diagnosis is a disease a user was diagnosed with, in the "diagnoses"
+// table. DiagnosedOn is written as "2006-01-02".
+type Diagnosis struct {
+	ID          int       `json:"id,omitempty"`
+	TenantID    int       `json:"tenantId,omitempty" gorm:"index"`
+	UserID      int       `json:"userId" gorm:"not null;index"`
+	User        *User     `json:"-"`
+	DiseaseID   int       `json:"diseaseId" gorm:"not null;index"`
+	Disease     *Disease  `json:"-"`
+	DiagnosedOn string    `json:"diagnosedOn" gorm:"not null"`
+	Note        string    `json:"note,omitempty" gorm:"serializer:encrypted" phi:"true"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// RecordAccess is a request that read or changed the record of a user, in
+// the "record_accesses" table, so the user can learn which clinic
+// accessed it and when. ClinicID is the clinic that accessed it when that
+// is not the user's own, through sharing.
+type RecordAccess struct {
+	ID         int       `json:"id,omitempty"`
+	TenantID   int       `json:"tenantId,omitempty" gorm:"index"`
+	UserID     int       `json:"userId" gorm:"not null;index"`
+	Method     string    `json:"method" gorm:"not null"`
+	Route      string    `json:"route" gorm:"not null"`
+	Status     int       `json:"status"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	ClinicID   int       `json:"clinicId,omitempty"`
+	AccessedAt time.Time `json:"accessedAt" gorm:"not null"`
+}
+
+// Erasure request statuses. A request is pending until it is approved
+// and carried out, or rejected.
+const (
+	ErasurePending   = "pending"
+	ErasureRejected  = "rejected"
+	ErasureCompleted = "completed"
+)
+
+// ErasureRequest is a request to erase the personal data of a user, in
+// the "erasure_requests" table. Once it is carried out, Certificate
+// records what was erased and what was kept, and Signature lets the
+// certificate be verified.
+type ErasureRequest struct {
+	ID           int                 `json:"id,omitempty"`
+	TenantID     int                 `json:"tenantId,omitempty" gorm:"index"`
+	UserID       int                 `json:"userId" gorm:"not null;index"`
+	User         *User               `json:"-"`
+	Reason       string              `json:"reason,omitempty"`
+	RequestedBy  string              `json:"requestedBy" gorm:"not null"`
+	Status       string              `json:"status" gorm:"not null"`
+	DecidedBy    string              `json:"decidedBy,omitempty"`
+	DecisionNote string              `json:"decisionNote,omitempty"`
+	DecidedAt    *time.Time          `json:"decidedAt,omitempty"`
+	Certificate  *ErasureCertificate `json:"certificate,omitempty" gorm:"serializer:json"`
+	Signature    string              `json:"signature,omitempty"`
+	CreatedAt    time.Time           `json:"createdAt"`
+}
+
+// LegalHold keeps the record of a user from being erased, e.g. during
+// litigation, until it is released, in the "legal_holds" table.
+type LegalHold struct {
+	ID         int        `json:"id,omitempty"`
+	TenantID   int        `json:"tenantId,omitempty" gorm:"index"`
+	UserID     int        `json:"userId" gorm:"not null;index"`
+	User       *User      `json:"-"`
+	Reason     string     `json:"reason" gorm:"not null"`
+	PlacedBy   string     `json:"placedBy" gorm:"not null"`
+	ReleasedBy string     `json:"releasedBy,omitempty"`
+	ReleasedAt *time.Time `json:"releasedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Consent scopes. Grantee names whom a consent is given to.
+const (
+	// ConsentClinicSharing allows sharing the record of the user with
+	// the clinic whose ID is Grantee.
+	ConsentClinicSharing = "clinic-sharing"
+	// ConsentCloudProcessing allows processing by the third-party cloud
+	// service named by Grantee, such as "google-cloud-language".
+	ConsentCloudProcessing = "cloud-processing"
+	// ConsentResearch allows research use in the study named by Grantee
+	// or, if it is empty, in any study.
+	ConsentResearch = "research"
+)
+
+// Consent is something a user consented to, in the "consents" table. It
+// holds from ValidFrom until ValidUntil, if set, unless it is revoked.
+type Consent struct {
+	ID               int        `json:"id,omitempty"`
+	TenantID         int        `json:"tenantId,omitempty" gorm:"index"`
+	UserID           int        `json:"userId" gorm:"not null;index"`
+	User             *User      `json:"-"`
+	Scope            string     `json:"scope" gorm:"not null"`
+	Grantee          string     `json:"grantee,omitempty"`
+	ValidFrom        time.Time  `json:"validFrom" gorm:"not null"`
+	ValidUntil       *time.Time `json:"validUntil,omitempty"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// UserMerge records that a duplicate user was merged into another, in the
+// "user_merges" table. It redirects the retired ID to the surviving one,
+// and Moved counts the records that were moved, by table.
+type UserMerge struct {
+	ID         int              `json:"id,omitempty"`
+	TenantID   int              `json:"tenantId,omitempty" gorm:"index"`
+	RetiredID  int              `json:"retiredId" gorm:"not null;uniqueIndex"`
+	SurvivorID int              `json:"survivorId" gorm:"not null;index"`
+	MergedBy   string           `json:"mergedBy" gorm:"not null"`
+	Score      *float64         `json:"score,omitempty"`
+	Moved      map[string]int64 `json:"moved" gorm:"serializer:json"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// DuplicateDismissal records that two users found alike are different
+// patients, in the "duplicate_dismissals" table, so the pair leaves the
+// review queue. UserID is the lower of the two IDs.
+type DuplicateDismissal struct {
+	ID          int       `json:"id,omitempty"`
+	TenantID    int       `json:"tenantId,omitempty" gorm:"index"`
+	UserID      int       `json:"userId" gorm:"not null;uniqueIndex:idx_duplicate_dismissals_pair"`
+	OtherID     int       `json:"otherId" gorm:"not null;uniqueIndex:idx_duplicate_dismissals_pair"`
+	DismissedBy string    `json:"dismissedBy" gorm:"not null"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// CatalogMerge records that a duplicate entry of the med or disease
+// catalog was merged into another, in the "catalog_merges" table. It
+// redirects the retired ID to the surviving one, and RetiredName is kept
+// as a synonym of the survivor. Moved counts the records that were moved,
+// by table.
+type CatalogMerge struct {
+	ID          int              `json:"id,omitempty"`
+	Catalog     string           `json:"catalog" gorm:"not null;uniqueIndex:idx_catalog_merges_retired"`
+	RetiredID   int              `json:"retiredId" gorm:"not null;uniqueIndex:idx_catalog_merges_retired"`
+	RetiredName string           `json:"retiredName"`
+	SurvivorID  int              `json:"survivorId" gorm:"not null;index"`
+	MergedBy    string           `json:"mergedBy" gorm:"not null"`
+	Score       *float64         `json:"score,omitempty"`
+	Moved       map[string]int64 `json:"moved" gorm:"serializer:json"`
+	CreatedAt   time.Time        `json:"createdAt"`
+}
+
+// CatalogDismissal records that two entries of the med or disease catalog
+// found alike are different, in the "catalog_dismissals" table, so the
+// pair leaves the review queue. EntryID is the lower of the two IDs.
+type CatalogDismissal struct {
+	ID          int       `json:"id,omitempty"`
+	Catalog     string    `json:"catalog" gorm:"not null;uniqueIndex:idx_catalog_dismissals_pair"`
+	EntryID     int       `json:"entryId" gorm:"not null;uniqueIndex:idx_catalog_dismissals_pair"`
+	OtherID     int       `json:"otherId" gorm:"not null;uniqueIndex:idx_catalog_dismissals_pair"`
+	DismissedBy string    `json:"dismissedBy" gorm:"not null"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
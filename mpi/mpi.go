@@ -0,0 +1,160 @@
+// Package mpi finds the users of a clinic that are likely to be the same
+// patient, for a master patient index. Pairs of records are scored on the
+// agreement of their names, emails, contact numbers and dates of birth.
+package mpi
+
+import (
+	"math"
+	"sort"
+)
+
+// Record is what a user is matched on. Empty fields are unknown.
+type Record struct {
+	ID        int
+	Name      string
+	Email     string
+	Contact   string
+	BirthDate string // as 2006-01-02
+}
+
+// Match is a pair of records that are likely the same patient.
+type Match struct {
+	ID      int
+	OtherID int
+	// Score is the probability, from 0 to 1, that they are.
+	Score   float64
+	Reasons []string
+}
+
+// The weights of the evidence for and against two records being the same
+// patient, as log odds. A shared email is strong evidence, as clinics
+// rarely see two patients with one; a different date of birth is strong
+// evidence against, as twins are rarer than typing errors in names.
+const (
+	prior = -3.0
+
+	nameSame      = 3.0
+	nameSimilar   = 2.0
+	nameSoundsAs  = 1.0
+	nameDifferent = -3.0
+
+	emailSame      = 4.0
+	emailDifferent = -1.0
+
+	contactSame      = 3.0
+	contactDifferent = -1.0
+
+	birthSame      = 3.0
+	birthSwapped   = 1.0
+	birthDifferent = -4.0
+)
+
+// Score returns the probability that a and b are the same patient, and
+// the evidence it rests on. Fields unknown on either record count neither
+// way.
+func Score(a, b Record) (float64, []string) {
+	na, nb := newNormalized(a), newNormalized(b)
+	w := prior
+	var reasons []string
+	add := func(weight float64, reason string) {
+		w += weight
+		reasons = append(reasons, reason)
+	}
+
+	if na.name != "" && nb.name != "" {
+		switch sim := jaroWinkler(na.name, nb.name); {
+		case sim >= 0.97:
+			add(nameSame, "names match")
+		case sim >= 0.9:
+			add(nameSimilar, "names are similar")
+		case na.phonetic == nb.phonetic:
+			add(nameSoundsAs, "names sound alike")
+		default:
+			add(nameDifferent, "names differ")
+		}
+	}
+	if na.email != "" && nb.email != "" {
+		if na.email == nb.email {
+			add(emailSame, "emails match")
+		} else {
+			add(emailDifferent, "emails differ")
+		}
+	}
+	if na.contact != "" && nb.contact != "" {
+		if na.contact == nb.contact {
+			add(contactSame, "contacts match")
+		} else {
+			add(contactDifferent, "contacts differ")
+		}
+	}
+	if na.birthDate != "" && nb.birthDate != "" {
+		switch {
+		case na.birthDate == nb.birthDate:
+			add(birthSame, "dates of birth match")
+		case swapped(na.birthDate, nb.birthDate):
+			add(birthSwapped, "dates of birth match with day and month swapped")
+		default:
+			add(birthDifferent, "dates of birth differ")
+		}
+	}
+	return 1 / (1 + math.Exp(-w)), reasons
+}
+
+// Find returns the pairs of records that score at least min, best first.
+// Only pairs that share an email, a contact number, a date of birth or
+// the sound of their name are compared, so that clinics of any size can
+// be searched.
+func Find(records []Record, min float64) []Match {
+	blocks := map[string][]int{}
+	for i, r := range records {
+		for _, key := range newNormalized(r).blockingKeys() {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	type pair struct{ i, j int }
+	compared := map[pair]bool{}
+	var matches []Match
+	for _, block := range blocks {
+		for x := 0; x < len(block); x++ {
+			for y := x + 1; y < len(block); y++ {
+				p := pair{block[x], block[y]}
+				if compared[p] {
+					continue
+				}
+				compared[p] = true
+				a, b := records[p.i], records[p.j]
+				if a.ID == b.ID {
+					continue
+				}
+				score, reasons := Score(a, b)
+				if score < min {
+					continue
+				}
+				if a.ID > b.ID {
+					a, b = b, a
+				}
+				matches = append(matches, Match{ID: a.ID, OtherID: b.ID, Score: score, Reasons: reasons})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].ID != matches[j].ID {
+			return matches[i].ID < matches[j].ID
+		}
+		return matches[i].OtherID < matches[j].OtherID
+	})
+	return matches
+}
+
+// swapped reports whether dates of birth a and b are the same but for
+// their day and month, a common slip between date formats.
+func swapped(a, b string) bool {
+	if len(a) != 10 || len(b) != 10 {
+		return false
+	}
+	return a[:4] == b[:4] && a[5:7] == b[8:10] && a[8:10] == b[5:7]
+}
@@ -0,0 +1,150 @@
+package mpi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Record
+		min     float64
+		max     float64
+		reasons []string
+	}{
+		{
+			name:    "same person entered twice",
+			a:       Record{Name: "John Doe", Email: "john@example.com", Contact: "+31 6 1234 5678", BirthDate: "1980-04-12"},
+			b:       Record{Name: "Doe, John", Email: " JOHN@example.com", Contact: "06-12345678", BirthDate: "1980-04-12"},
+			min:     0.99,
+			max:     1,
+			reasons: []string{"names match", "emails match", "contacts match", "dates of birth match"},
+		},
+		{
+			name:    "accents and a typing error",
+			a:       Record{Name: "José Müller", BirthDate: "1975-01-02"},
+			b:       Record{Name: "Jose Mueller", BirthDate: "1975-01-02"},
+			min:     0.5,
+			max:     0.99,
+			reasons: []string{"names are similar", "dates of birth match"},
+		},
+		{
+			name:    "day and month swapped",
+			a:       Record{Name: "Anna Smit", BirthDate: "1990-03-07"},
+			b:       Record{Name: "Anna Smit", BirthDate: "1990-07-03"},
+			min:     0.7,
+			max:     0.8,
+			reasons: []string{"names match", "dates of birth match with day and month swapped"},
+		},
+		{
+			name:    "different people sharing a phone",
+			a:       Record{Name: "Peter Jansen", Contact: "0612345678", BirthDate: "1960-05-05"},
+			b:       Record{Name: "Maria Jansen", Contact: "0612345678", BirthDate: "1962-11-30"},
+			min:     0,
+			max:     0.05,
+			reasons: []string{"names differ", "contacts match", "dates of birth differ"},
+		},
+		{
+			name: "nothing known",
+			a:    Record{ID: 1},
+			b:    Record{ID: 2},
+			min:  0.04,
+			max:  0.05,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, reasons := Score(tt.a, tt.b)
+			if score < tt.min || score > tt.max {
+				t.Errorf("Score = %.3f, want between %.2f and %.2f", score, tt.min, tt.max)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("reasons = %q, want %q", reasons, tt.reasons)
+			}
+			if back, _ := Score(tt.b, tt.a); back != score {
+				t.Errorf("Score is not symmetric: %.3f and %.3f", score, back)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	records := []Record{
+		{ID: 1, Name: "John Doe", Email: "john@example.com", BirthDate: "1980-04-12"},
+		{ID: 2, Name: "Maria Jansen", Contact: "0612345678", BirthDate: "1962-11-30"},
+		{ID: 3, Name: "Doe, Jon", Email: "john@example.com", BirthDate: "1980-04-12"},
+		{ID: 4, Name: "Peter Jansen", Contact: "0612345678", BirthDate: "1960-05-05"},
+		{ID: 5, Name: "Mária Janssen", BirthDate: "1962-11-30"},
+	}
+	matches := Find(records, 0.5)
+	var got [][2]int
+	for i, m := range matches {
+		got = append(got, [2]int{m.ID, m.OtherID})
+		if i > 0 && m.Score > matches[i-1].Score {
+			t.Errorf("matches are not sorted by score: %v", matches)
+		}
+		if m.Score < 0.5 {
+			t.Errorf("match %d-%d scores %.3f, below the minimum", m.ID, m.OtherID, m.Score)
+		}
+	}
+	want := [][2]int{{1, 3}, {2, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %v, want %v", got, want)
+	}
+}
+
+func TestFindSkips(t *testing.T) {
+	for name, records := range map[string][]Record{
+		// Nothing in common, so the records are never compared, whatever
+		// the minimum.
+		"unrelated records": {
+			{ID: 1, Name: "John Doe"},
+			{ID: 2, Name: "Maria Jansen"},
+		},
+		"the same user twice": {
+			{ID: 1, Name: "John Doe", Email: "john@example.com"},
+			{ID: 1, Name: "John Doe", Email: "john@example.com"},
+		},
+	} {
+		if matches := Find(records, 0); len(matches) != 0 {
+			t.Errorf("%s: Find = %v, want none", name, matches)
+		}
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	for word, want := range map[string]string{
+		"robert":   "R163",
+		"rupert":   "R163",
+		"rubin":    "R150",
+		"ashcraft": "A261",
+		"tymczak":  "T522",
+		"pfister":  "P236",
+		"lee":      "L000",
+		"":         "",
+	} {
+		if got := soundex(word); got != want {
+			t.Errorf("soundex(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.84},
+		{"dixon", "dicksonx", 0.813},
+		{"same", "same", 1},
+		{"", "", 1},
+		{"abc", "", 0},
+	}
+	for _, tt := range tests {
+		if got := jaroWinkler(tt.a, tt.b); got < tt.want-0.001 || got > tt.want+0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f, want %.3f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
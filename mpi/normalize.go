@@ -0,0 +1,132 @@
+package mpi
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalized is a record in the form it is compared in.
+type normalized struct {
+	name      string // lower case, without accents or punctuation, its words sorted
+	phonetic  string // the Soundex codes of the words of the name, sorted
+	email     string
+	contact   string // the last digits of the number
+	birthDate string
+}
+
+// contactDigits is how many of the last digits of contact numbers are
+// compared, so that national and international forms of a number match.
+const contactDigits = 9
+
+func newNormalized(r Record) normalized {
+	words := nameWords(r.Name)
+	codes := make([]string, 0, len(words))
+	for _, w := range words {
+		codes = append(codes, soundex(w))
+	}
+	sort.Strings(codes)
+	return normalized{
+		name:      strings.Join(words, " "),
+		phonetic:  strings.Join(codes, " "),
+		email:     strings.ToLower(strings.TrimSpace(r.Email)),
+		contact:   contactNumber(r.Contact),
+		birthDate: strings.TrimSpace(r.BirthDate),
+	}
+}
+
+// blockingKeys returns the keys of the blocks the record is compared
+// within.
+func (n normalized) blockingKeys() []string {
+	var keys []string
+	for prefix, v := range map[string]string{"name:": n.phonetic, "email:": n.email, "contact:": n.contact, "birth:": n.birthDate} {
+		if v != "" {
+			keys = append(keys, prefix+v)
+		}
+	}
+	return keys
+}
+
+// nameWords returns the words of name in lower case without accents,
+// sorted so that "Doe, John" and "John Doe" compare equal.
+func nameWords(name string) []string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// The accents split off the letters they were on.
+		case unicode.IsLetter(r):
+			b.WriteRune(unicode.ToLower(r))
+		case r == '\'':
+			// O'Brien is OBrien.
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	sort.Strings(words)
+	return words
+}
+
+// contactNumber returns the last digits of a contact number.
+func contactNumber(contact string) string {
+	var digits []rune
+	for _, r := range contact {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) > contactDigits {
+		digits = digits[len(digits)-contactDigits:]
+	}
+	return string(digits)
+}
+
+// soundexCodes are the Soundex digits of the letters; vowels and h, w and
+// y have none.
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// soundex returns the American Soundex code of a lower case word, such as
+// R163 for both robert and rupert. Letters outside a to z are skipped.
+func soundex(word string) string {
+	code := make([]byte, 0, 4)
+	var last byte
+	for _, r := range word {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		digit := soundexCodes[r]
+		if len(code) == 0 {
+			code = append(code, byte(unicode.ToUpper(r)))
+			last = digit
+			continue
+		}
+		switch {
+		case digit != 0 && digit != last:
+			code = append(code, digit)
+		case r == 'h' || r == 'w':
+			// Letters coded alike either side of h or w are coded once.
+			continue
+		}
+		last = digit
+		if len(code) == 4 {
+			break
+		}
+	}
+	if len(code) == 0 {
+		return ""
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
@@ -1,46 +1,97 @@
 package nlp_processor
 
 import (
-        "context"
-		"log"
+	"context"
+	"errors"
+	"fmt"
+	"time"
 
-        language "cloud.google.com/go/language/apiv1"
-        languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
-		"google.golang.org/api/option"
+	"medically-core/metrics"
+
+	language "cloud.google.com/go/language/apiv1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
+// ErrNoConsent is returned when a patient has not consented to having
+// their data processed by the language API.
+var ErrNoConsent = errors.New("nlp_processor: patient has not consented to cloud processing")
+
+// ConsentFunc returns nil if user userID, of the tenant of ctx, consented
+// to having their data processed by the language API, ErrNoConsent if
+// they did not, or another error if that cannot be told.
+type ConsentFunc func(ctx context.Context, userID int) error
+
 type MCGCL struct {
-	client *language.Client
+	client  *language.Client
+	consent ConsentFunc
 }
 
-var (
-	credentialsFile = "credentials.json"
-)
-
-func (gcl *MCGCL) analyzeEntities(ctx context.Context) error {
+// AnalyzeEntities finds the entities, such as medications and
+// conditions, in notes of user userID. Notes are only sent to the
+// language API if the user consented to it.
+func (gcl *MCGCL) AnalyzeEntities(ctx context.Context, userID int, notes string) ([]*languagepb.Entity, error) {
+	if err := gcl.consent(ctx, userID); err != nil {
+		return nil, err
+	}
 	req := &languagepb.AnalyzeEntitiesRequest{
-		// TODO: Fill request struct fields.
-		// See https://pkg.go.dev/google.golang.org/genproto/googleapis/cloud/language/v1#AnalyzeEntitiesRequest.
+		Document: &languagepb.Document{
+			Type:   languagepb.Document_PLAIN_TEXT,
+			Source: &languagepb.Document_Content{Content: notes},
+		},
+		EncodingType: languagepb.EncodingType_UTF8,
 	}
+	start := time.Now()
 	resp, err := gcl.client.AnalyzeEntities(ctx, req)
+	metrics.ObserveNLPCall("AnalyzeEntities", start, err)
 	if err != nil {
-		// TODO: Handle error.
+		return nil, err
 	}
-	// TODO: Use resp.
-	_ = resp
-	return nil
+	return resp.GetEntities(), nil
 }
 
+// Ping reports whether the gRPC connection to the language API can be
+// established, without issuing a (billed) API call.
+func (gcl *MCGCL) Ping(ctx context.Context) error {
+	conn := gcl.client.Connection()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.Shutdown:
+			return errors.New("language client is closed")
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("language API unreachable, connection %s", state)
+		}
+	}
+}
 
-func New(ctx context.Context) (MCGCL, error)  {
-	c, err := language.NewClient(ctx, option.WithCredentialsFile(credentialsFile))
+// Close releases the underlying gRPC connection.
+func (gcl *MCGCL) Close() error {
+	return gcl.client.Close()
+}
+
+// New creates a client of the language API that checks consent with
+// consent before sending patient data.
+func New(ctx context.Context, credentialsFile string, consent ConsentFunc) (MCGCL, error) {
+	c, err := language.NewClient(ctx,
+		option.WithCredentialsFile(credentialsFile),
+		option.WithGRPCDialOption(grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor())),
+		option.WithGRPCDialOption(grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor())),
+	)
 	if err != nil {
-		log.Panicf("error in setting up GCS client with credentials %v", credentialsFile)
-		return MCGCL{}, err
+		return MCGCL{}, fmt.Errorf("error in setting up GCS client with credentials %v: %w", credentialsFile, err)
 	}
-	defer c.Close()
 	gcl := MCGCL{}
 	gcl.client = c
+	gcl.consent = consent
 
 	return gcl, nil
-}
\ No newline at end of file
+}
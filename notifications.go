@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/notifications"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// reminderGrace is how late a reminder may still be announced, e.g.
+// after the service was down.
+const reminderGrace = time.Hour
+
+// notifyUser queues a notification for user, reaching them at their email
+// and contact number.
+func notifyUser(notifier *notifications.Notifier, db *gorm.DB, user *User, template, key string, data map[string]interface{}) error {
+	note := notifications.Notification{UserID: user.ID, Template: template, Key: key, Data: data}
+	if user.Email != nil {
+		note.Email = *user.Email
+	}
+	if user.Contact != nil {
+		note.Phone = *user.Contact
+	}
+	if user.Name != nil {
+		data["Name"] = *user.Name
+	}
+	return notifier.Enqueue(db, note)
+}
+
+// notifyReminders announces the pending reminders that are due.
+func notifyReminders(db *gorm.DB, notifier *notifications.Notifier, now time.Time) error {
+	var due []Reminder
+	err := db.Preload("User").Preload("Prescription.Med").
+		Where("status = ? AND notified_at IS NULL AND due_at <= ? AND due_at > ?", ReminderPending, now, now.Add(-reminderGrace)).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		r := &due[i]
+		if r.User == nil || r.Prescription == nil || r.Prescription.Med == nil {
+			continue
+		}
+		data := map[string]interface{}{"Med": "", "Dose": r.Prescription.Dose, "DueAt": r.DueAt}
+		if name := r.Prescription.Med.Name; name != nil {
+			data["Med"] = *name
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := notifyUser(notifier, tx, r.User, "dose_reminder", fmt.Sprintf("reminder:%d", r.ID), data); err != nil {
+				return err
+			}
+			return tx.Model(r).Update("notified_at", now).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reminder %d: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// ----------------------------  Notification Server Methods ---------------------------------//
+
+// getNotifications lists the latest notifications of a user with their
+// delivery status, without their content.
+func (s *Server) getNotifications(c *gin.Context) {
+	var deliveries []notifications.Delivery
+	err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("id DESC").Limit(100).Find(&deliveries).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (s *Server) getNotificationPreferences(c *gin.Context) {
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	prefs, err := s.notifier.Preferences(s.dbFor(c), userID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func (s *Server) putNotificationPreferences(c *gin.Context) {
+	var prefs notifications.Preferences
+	if err := BindJSON(c, &prefs); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	userID, ok := s.findUserID(c)
+	if !ok {
+		return
+	}
+	prefs.UserID = userID
+	err := s.notifier.SetPreferences(s.dbFor(c), &prefs)
+	if errors.Is(err, notifications.ErrInvalidPreferences) {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// findUserID returns the userID parameter, answering 404 unless the
+// clinic has that user.
+func (s *Server) findUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("userID"))
+	var n int64
+	if err == nil {
+		err = s.dbFor(c).Model(&User{}).Where("id = ?", userID).Count(&n).Error
+		if err != nil {
+			internalError(c, err)
+			return 0, false
+		}
+	}
+	if n == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+		return 0, false
+	}
+	return userID, true
+}
+
+// ------------------------------- ------------------- ------------------------------------//
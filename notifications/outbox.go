@@ -0,0 +1,239 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"medically-core/config"
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Delivery statuses. A delivery is sending while a worker holds it; if
+// the worker stops, it is taken over once sendLease expires.
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	sendLease    = time.Minute
+	batchSize    = 50
+	// Retries back off exponentially from firstRetry up to maxRetry.
+	firstRetry = 30 * time.Second
+	maxRetry   = time.Hour
+)
+
+// Delivery is a message to a user on one channel, in the "notifications"
+// table. Its recipient and content are encrypted.
+type Delivery struct {
+	ID            int        `json:"id"`
+	TenantID      int        `json:"-" gorm:"uniqueIndex:idx_notifications_key"`
+	UserID        int        `json:"userId" gorm:"index"`
+	Key           *string    `json:"-" gorm:"uniqueIndex:idx_notifications_key"`
+	Channel       string     `json:"channel" gorm:"not null"`
+	Template      string     `json:"template" gorm:"not null"`
+	To            string     `json:"-" gorm:"serializer:encrypted" phi:"true"`
+	Subject       string     `json:"-" gorm:"serializer:encrypted" phi:"true"`
+	Body          string     `json:"-" gorm:"serializer:encrypted" phi:"true"`
+	Status        string     `json:"status" gorm:"not null;index:idx_notifications_due"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index:idx_notifications_due"`
+	LastError     string     `json:"lastError,omitempty" phi:"true"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"-"`
+}
+
+// TableName implements gorm's tabler.
+func (Delivery) TableName() string {
+	return "notifications"
+}
+
+// Notification is a message for a user, rendered from Template with Data.
+// Key, if set, makes queueing it idempotent. Urgent notifications ignore
+// quiet hours.
+type Notification struct {
+	UserID   int
+	Email    string
+	Phone    string
+	Template string
+	Data     interface{}
+	Key      string
+	Urgent   bool
+}
+
+// Notifier queues notifications and delivers them.
+type Notifier struct {
+	db          *gorm.DB
+	providers   map[string]Provider
+	templates   *templates
+	maxAttempts int
+	wake        chan struct{}
+}
+
+// New creates a Notifier with the providers cfg selects, creating its
+// tables if needed.
+func New(db *gorm.DB, cfg config.NotificationsConfig) (*Notifier, error) {
+	if err := db.AutoMigrate(&Delivery{}, &Preferences{}); err != nil {
+		return nil, err
+	}
+	providers, err := newProviders(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t, err := loadTemplates(cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{db: db, providers: providers, templates: t, maxAttempts: cfg.MaxAttempts, wake: make(chan struct{}, 1)}, nil
+}
+
+// Enqueue renders a notification for each channel the user accepts and
+// has an address for, and queues it on db. Queued in a transaction, it
+// is only sent if the transaction commits.
+func (n *Notifier) Enqueue(db *gorm.DB, note Notification) error {
+	prefs, err := n.Preferences(db, note.UserID)
+	if err != nil {
+		return err
+	}
+	next := time.Now()
+	if until, quiet := prefs.quietUntil(next); quiet && !note.Urgent {
+		next = until
+	}
+
+	channels := []struct {
+		name, to string
+		enabled  bool
+	}{
+		{Email, note.Email, prefs.Email},
+		{SMS, note.Phone, prefs.SMS},
+	}
+	for _, ch := range channels {
+		if !ch.enabled || ch.to == "" || n.providers[ch.name] == nil {
+			continue
+		}
+		msg, err := n.templates.render(note.Template, prefs.Locale, ch.name, prefs.location(), note.Data)
+		if err != nil {
+			return err
+		}
+		d := Delivery{
+			UserID:        note.UserID,
+			Channel:       ch.name,
+			Template:      note.Template,
+			To:            ch.to,
+			Subject:       msg.Subject,
+			Body:          msg.Body,
+			Status:        StatusPending,
+			NextAttemptAt: next,
+		}
+		if note.Key != "" {
+			key := note.Key + ":" + ch.name
+			d.Key = &key
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&d).Error; err != nil {
+			return err
+		}
+	}
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run sends due deliveries until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	ctx = tenant.System(ctx)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			sent, err := n.sendDue(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("notifications: sending: %v", err)
+			}
+			if err != nil || sent < batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-n.wake:
+		}
+	}
+}
+
+// sendDue sends a batch of due deliveries and returns how many it
+// claimed.
+func (n *Notifier) sendDue(ctx context.Context) (int, error) {
+	db := n.db.WithContext(ctx)
+	now := time.Now()
+	var due []Delivery
+	err := db.Where("status IN ? AND next_attempt_at <= ?", []string{StatusPending, StatusSending}, now).
+		Order("next_attempt_at").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range due {
+		d := &due[i]
+		// Only one worker can move the delivery from the state it was
+		// read in.
+		res := db.Model(&Delivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", d.ID, d.Status, d.Attempts).
+			Updates(map[string]interface{}{"status": StatusSending, "attempts": d.Attempts + 1, "next_attempt_at": now.Add(sendLease)})
+		if res.Error != nil {
+			return i, res.Error
+		}
+		if res.RowsAffected == 1 {
+			d.Attempts++
+			n.send(ctx, d)
+		}
+	}
+	return len(due), nil
+}
+
+// send delivers d and records the outcome.
+func (n *Notifier) send(ctx context.Context, d *Delivery) {
+	var err error
+	if p := n.providers[d.Channel]; p == nil {
+		err = Permanent(errors.New("no provider for channel " + d.Channel))
+	} else {
+		sendCtx, cancel := context.WithTimeout(ctx, sendLease/2)
+		err = p.Send(sendCtx, Message{To: d.To, Subject: d.Subject, Body: d.Body})
+		cancel()
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{"status": StatusSent, "sent_at": now, "last_error": ""}
+	if err != nil {
+		update = map[string]interface{}{"status": StatusPending, "next_attempt_at": now.Add(backoff(d.Attempts)), "last_error": err.Error()}
+		if isPermanent(err) || d.Attempts >= n.maxAttempts {
+			update["status"] = StatusFailed
+		}
+	}
+	if err := n.db.WithContext(ctx).Model(&Delivery{}).Where("id = ?", d.ID).Updates(update).Error; err != nil {
+		log.Printf("notifications: recording delivery %d: %v", d.ID, err)
+	}
+}
+
+// backoff returns how long to wait before the next of attempts.
+func backoff(attempts int) time.Duration {
+	d := firstRetry
+	for i := 1; i < attempts && d < maxRetry; i++ {
+		d *= 2
+	}
+	if d > maxRetry {
+		d = maxRetry
+	}
+	return d
+}
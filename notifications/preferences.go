@@ -0,0 +1,137 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"medically-core/scheduling"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Preferences are how a user wants to be notified, in the
+// "notification_preferences" table. During quiet hours, from QuietStart
+// until QuietEnd (times of day such as "22:00" in Timezone, possibly
+// across midnight), messages wait until the quiet hours end.
+type Preferences struct {
+	ID         int        `json:"-"`
+	TenantID   int        `json:"-" gorm:"index"`
+	UserID     int        `json:"userId" gorm:"uniqueIndex"`
+	Email      bool       `json:"email"`
+	SMS        bool       `json:"sms"`
+	Locale     string     `json:"locale"`
+	Timezone   string     `json:"timezone"`
+	QuietStart string     `json:"quietStart,omitempty"`
+	QuietEnd   string     `json:"quietEnd,omitempty"`
+	UpdatedAt  *time.Time `json:"-"`
+}
+
+// TableName implements gorm's tabler.
+func (Preferences) TableName() string {
+	return "notification_preferences"
+}
+
+// Preferences returns the preferences of a user, or the defaults (every
+// channel, the default locale, UTC and no quiet hours) if they set none.
+func (n *Notifier) Preferences(db *gorm.DB, userID int) (Preferences, error) {
+	var p Preferences
+	err := db.Take(&p, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Preferences{UserID: userID, Email: true, SMS: true, Locale: n.templates.defaultLocale, Timezone: "UTC"}, nil
+	}
+	return p, err
+}
+
+// ErrInvalidPreferences is wrapped by the errors of SetPreferences about
+// invalid preferences.
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// SetPreferences validates and stores the preferences of a user.
+func (n *Notifier) SetPreferences(db *gorm.DB, p *Preferences) error {
+	if err := n.validate(p); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	p.ID = 0
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "sms", "locale", "timezone", "quiet_start", "quiet_end", "updated_at"}),
+	}).Create(p).Error
+}
+
+// validate checks p and fills in the default locale and timezone.
+func (n *Notifier) validate(p *Preferences) error {
+	if p.Locale == "" {
+		p.Locale = n.templates.defaultLocale
+	}
+	if _, ok := timeLayouts[p.Locale]; !ok {
+		return fmt.Errorf("unsupported locale %q", p.Locale)
+	}
+	if p.Timezone == "" {
+		p.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return errors.New("quietStart and quietEnd must be set together")
+	}
+	if p.QuietStart != "" {
+		if _, _, err := p.quietHours(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p Preferences) location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		// Timezones are validated when preferences are set.
+		return time.UTC
+	}
+	return loc
+}
+
+func (p Preferences) quietHours() (scheduling.Clock, scheduling.Clock, error) {
+	start, err := scheduling.ParseClock(p.QuietStart)
+	if err != nil {
+		return start, start, fmt.Errorf("quietStart: %w", err)
+	}
+	end, err := scheduling.ParseClock(p.QuietEnd)
+	if err != nil {
+		return start, end, fmt.Errorf("quietEnd: %w", err)
+	}
+	if start == end {
+		return start, end, errors.New("quietStart and quietEnd must differ")
+	}
+	return start, end, nil
+}
+
+// quietUntil returns when the quiet hours around t end, and reports
+// whether t is within quiet hours at all.
+func (p Preferences) quietUntil(t time.Time) (time.Time, bool) {
+	if p.QuietStart == "" {
+		return time.Time{}, false
+	}
+	start, end, err := p.quietHours()
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.In(p.location())
+	now := scheduling.Clock{Hour: t.Hour(), Minute: t.Minute()}
+	y, m, d := t.Date()
+	until := time.Date(y, m, d, end.Hour, end.Minute, 0, 0, t.Location())
+	switch {
+	case start.Before(end):
+		// Quiet within the day, e.g. 13:00-14:00.
+		return until, !now.Before(start) && now.Before(end)
+	case now.Before(end):
+		// Quiet across midnight, e.g. 22:00-07:00, in the morning.
+		return until, true
+	case !now.Before(start):
+		return until.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
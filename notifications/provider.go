@@ -0,0 +1,137 @@
+// Package notifications reaches users by email and SMS. Messages are
+// rendered from localized templates into a persistent outbox, in the
+// transaction of the change they announce, and sent from it by a worker
+// that retries failed deliveries. Users choose their channels, language
+// and quiet hours.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"medically-core/config"
+)
+
+// Channels.
+const (
+	Email = "email"
+	SMS   = "sms"
+)
+
+// Message is a rendered message to one recipient. Subject is only set
+// for email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Provider delivers messages on a channel.
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// permanentError is a delivery failure that retrying cannot fix, such as
+// a rejected address.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that is not retried.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// newProviders returns the providers of the channels cfg enables.
+func newProviders(cfg config.NotificationsConfig) (map[string]Provider, error) {
+	providers := make(map[string]Provider)
+	var sink *LogProvider
+	logSink := func(channel string) (Provider, error) {
+		if sink == nil {
+			var err error
+			if sink, err = NewLogProvider(cfg.LogFile); err != nil {
+				return nil, err
+			}
+		}
+		return sink.Channel(channel), nil
+	}
+
+	var err error
+	switch cfg.Email.Provider {
+	case "smtp":
+		providers[Email], err = NewSMTPProvider(cfg.Email.SMTP, cfg.Email.From)
+	case "log":
+		providers[Email], err = logSink(Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.SMS.Provider {
+	case "http":
+		providers[SMS] = NewHTTPSMSProvider(cfg.SMS.HTTP, cfg.SMS.From)
+	case "log":
+		providers[SMS], err = logSink(SMS)
+	}
+	return providers, err
+}
+
+// LogProvider writes messages as JSON lines to a file or stdout instead
+// of sending them, for development and tests. The lines hold the full
+// messages, patient data included.
+type LogProvider struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogProvider creates a LogProvider appending to the file at path, or
+// writing to stdout if path is "-".
+func NewLogProvider(path string) (*LogProvider, error) {
+	if path == "-" {
+		return &LogProvider{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("notifications: opening log file: %w", err)
+	}
+	return &LogProvider{w: f}, nil
+}
+
+// Channel returns the Provider writing the messages of channel.
+func (p *LogProvider) Channel(channel string) Provider {
+	return logChannel{p, channel}
+}
+
+type logChannel struct {
+	*LogProvider
+	channel string
+}
+
+// Send implements Provider.
+func (c logChannel) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(map[string]string{
+		"time":    time.Now().UTC().Format(time.RFC3339),
+		"channel": c.channel,
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.w.Write(append(line, '\n'))
+	return err
+}
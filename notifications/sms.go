@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"medically-core/config"
+)
+
+// HTTPSMSProvider sends text messages through a generic HTTP gateway. It
+// posts a JSON object with from, to and body, authenticated with the
+// token as a bearer token if one is set.
+type HTTPSMSProvider struct {
+	url    string
+	token  config.Secret
+	from   string
+	client *http.Client
+}
+
+// NewHTTPSMSProvider creates an HTTPSMSProvider sending from the sender
+// ID from.
+func NewHTTPSMSProvider(cfg config.SMSGatewayConfig, from string) *HTTPSMSProvider {
+	return &HTTPSMSProvider{url: cfg.URL, token: cfg.Token, from: from, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Send implements Provider. Client errors other than 408 and 429 are
+// permanent.
+func (p *HTTPSMSProvider) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]string{"from": p.from, "to": msg.To, "body": msg.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token.Value())
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("sms gateway answered %s: %s", resp.Status, bytes.TrimSpace(detail))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"medically-core/config"
+)
+
+// SMTPProvider sends email through an SMTP relay.
+type SMTPProvider struct {
+	addr string
+	auth smtp.Auth
+	from *mail.Address
+}
+
+// NewSMTPProvider creates an SMTPProvider sending from the address from.
+func NewSMTPProvider(cfg config.SMTPConfig, from string) (*SMTPProvider, error) {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("notifications: email from: %w", err)
+	}
+	p := &SMTPProvider{addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), from: addr}
+	if cfg.Username != "" {
+		// PlainAuth refuses to send the password without TLS, except to
+		// localhost.
+		p.auth = smtp.PlainAuth("", cfg.Username, cfg.Password.Value(), cfg.Host)
+	}
+	return p, nil
+}
+
+// Send implements Provider. Rejections of the message (5xx replies) are
+// permanent.
+func (p *SMTPProvider) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid address: %w", err))
+	}
+	err = smtp.SendMail(p.addr, p.auth, p.from.Address, []string{to.Address}, p.compose(to, msg))
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// compose writes msg as a plain text email.
+func (p *SMTPProvider) compose(to *mail.Address, msg Message) []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := p.from.Address[strings.LastIndex(p.from.Address, "@")+1:]
+
+	header("From", p.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	w.Close()
+	return b.Bytes()
+}
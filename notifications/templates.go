@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// timeLayouts are the layouts of times in messages, by locale.
+var timeLayouts = map[string]string{
+	"en": "Mon 2 Jan 2006 15:04",
+	"nl": "02-01-2006 15:04",
+}
+
+// templates holds the message templates, named "<name>.<locale>". Each
+// defines a "subject" and a body per channel.
+type templates struct {
+	byName        map[string]*template.Template
+	defaultLocale string
+}
+
+func loadTemplates(defaultLocale string) (*templates, error) {
+	files, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	t := &templates{byName: make(map[string]*template.Template), defaultLocale: defaultLocale}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".tmpl")
+		// The time function is bound to the recipient when rendering.
+		tmpl, err := template.New(name).Funcs(template.FuncMap{"time": formatTime(time.UTC, "")}).
+			ParseFS(templateFiles, path.Join("templates", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t.byName[name] = tmpl
+	}
+	if _, ok := timeLayouts[defaultLocale]; !ok {
+		return nil, fmt.Errorf("notifications: no templates for locale %q", defaultLocale)
+	}
+	return t, nil
+}
+
+// render renders the message name for channel in locale, falling back to
+// the default locale, with times shown in loc.
+func (t *templates) render(name, locale, channel string, loc *time.Location, data interface{}) (Message, error) {
+	tmpl, ok := t.byName[name+"."+locale]
+	if !ok {
+		locale = t.defaultLocale
+		if tmpl, ok = t.byName[name+"."+locale]; !ok {
+			return Message{}, fmt.Errorf("notifications: no template %s", name)
+		}
+	}
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	tmpl.Funcs(template.FuncMap{"time": formatTime(loc, timeLayouts[locale])})
+
+	var msg Message
+	exec := func(block string) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+			return "", fmt.Errorf("notifications: rendering %s: %w", name, err)
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+	if channel == Email {
+		if msg.Subject, err = exec("subject"); err != nil {
+			return msg, err
+		}
+	}
+	msg.Body, err = exec(channel)
+	return msg, err
+}
+
+func formatTime(loc *time.Location, layout string) func(time.Time) string {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return func(t time.Time) string {
+		return t.In(loc).Format(layout)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"medically-core/config"
+	"medically-core/dosing"
+	"medically-core/notifications"
+	"medically-core/scheduling"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxAdherenceRange bounds the period adherence is measured over.
+const maxAdherenceRange = 366 * 24 * time.Hour
+
+// normalizePrescription validates a prescription and fills in its
+// defaults: the UTC timezone, today as start date and, unless the
+// medication is PRN, the times of its doses.
+func normalizePrescription(p *Prescription) error {
+	if p.Timezone == "" {
+		p.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	if p.StartDate == "" {
+		p.StartDate = time.Now().In(loc).Format("2006-01-02")
+	}
+	if p.DurationDays < 0 {
+		return errors.New("durationDays must not be negative")
+	}
+	if p.PRN {
+		p.TimesPerDay, p.Times = 0, nil
+	} else if len(p.Times) == 0 {
+		if p.TimesPerDay <= 0 {
+			return errors.New("timesPerDay or times is required unless the medication is prn")
+		}
+		for _, c := range dosing.DefaultTimes(p.TimesPerDay) {
+			p.Times = append(p.Times, c.String())
+		}
+	}
+	r, err := regimenOf(p)
+	if err != nil {
+		return err
+	}
+	// Times are stored in order, as written by ParseClock.
+	p.Times = p.Times[:0]
+	for i, c := range r.Times {
+		if i > 0 && !r.Times[i-1].Before(c) {
+			return fmt.Errorf("times: %s is given twice", c)
+		}
+		p.Times = append(p.Times, c.String())
+	}
+	p.TimesPerDay = len(p.Times)
+	return nil
+}
+
+// regimenOf returns when the doses of a prescription are due.
+func regimenOf(p *Prescription) (dosing.Regimen, error) {
+	r := dosing.Regimen{Days: p.DurationDays}
+	var err error
+	if r.Location, err = time.LoadLocation(p.Timezone); err != nil {
+		return r, fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	if r.Start, err = time.ParseInLocation("2006-01-02", p.StartDate, r.Location); err != nil {
+		return r, errors.New("startDate must be written as YYYY-MM-DD")
+	}
+	if p.StoppedAt != nil {
+		r.Stop = *p.StoppedAt
+	}
+	for _, s := range p.Times {
+		c, err := scheduling.ParseClock(s)
+		if err != nil {
+			return r, fmt.Errorf("times: %w", err)
+		}
+		r.Times = append(r.Times, c)
+	}
+	sort.Slice(r.Times, func(i, j int) bool { return r.Times[i].Before(r.Times[j]) })
+	return r, nil
+}
+
+// ----------------------------  Prescription Server Methods ---------------------------------//
+
+func (s *Server) getPrescriptions(c *gin.Context) {
+	var prescriptions []Prescription
+	err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("id").Find(&prescriptions).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prescriptions)
+}
+
+func (s *Server) createPrescription(c *gin.Context) {
+	var prescription Prescription
+	if err := BindJSON(c, &prescription); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if err := normalizePrescription(&prescription); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	prescription.UserID = userID
+	prescription.StoppedAt = nil
+
+	db := s.dbFor(c)
+	var n int64
+	if err := db.Model(&User{}).Where("id = ?", userID).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	// A med merged into another is prescribed as the one it was merged
+	// into.
+	prescription.MedID, err = resolveCatalogID(db, medCatalog, prescription.MedID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if err := db.Model(&Med{}).Where("id = ?", prescription.MedID).Count(&n).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	if n == 0 {
+		c.String(http.StatusUnprocessableEntity, "error: unknown med")
+		return
+	}
+
+	if err := db.Create(&prescription).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prescription)
+}
+
+// stopPrescription ends a prescription now, dropping the reminders of
+// its later doses.
+func (s *Server) stopPrescription(c *gin.Context) {
+	var prescription Prescription
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Take(&prescription, "id = ? AND user_id = ?", c.Param("prescriptionID"), c.Param("userID")).Error
+		if err != nil {
+			return err
+		}
+		if prescription.StoppedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		prescription.StoppedAt = &now
+		if err := tx.Model(&prescription).Select("stopped_at").Updates(&prescription).Error; err != nil {
+			return err
+		}
+		return tx.Delete(Reminder{}, "prescription_id = ? AND status = ? AND due_at >= ?", prescription.ID, ReminderPending, now).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prescription)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// ----------------------------  Dose Server Methods ---------------------------------//
+
+// doseRequest logs a dose. ScheduledAt defaults to the due time nearest to
+// TakenAt, which defaults to now.
+type doseRequest struct {
+	PrescriptionID int        `json:"prescriptionId"`
+	Status         string     `json:"status"`
+	ScheduledAt    *time.Time `json:"scheduledAt"`
+	TakenAt        *time.Time `json:"takenAt"`
+	Note           string     `json:"note"`
+}
+
+// createDose logs a dose as taken or skipped. Logging a scheduled dose
+// again replaces the earlier entry, and settles its reminder.
+func (s *Server) createDose(c *gin.Context) {
+	var req doseRequest
+	if err := BindJSON(c, &req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if req.Status == "" {
+		req.Status = DoseTaken
+	}
+	if req.Status != DoseTaken && req.Status != DoseSkipped {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: status must be %s or %s", DoseTaken, DoseSkipped))
+		return
+	}
+	takenAt := time.Now()
+	if req.TakenAt != nil {
+		takenAt = *req.TakenAt
+	}
+
+	db := s.dbFor(c)
+	var prescription Prescription
+	err := db.Take(&prescription, "id = ? AND user_id = ?", req.PrescriptionID, c.Param("userID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusUnprocessableEntity, "error: unknown prescription")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	dose := Dose{
+		UserID:         prescription.UserID,
+		PrescriptionID: prescription.ID,
+		TakenAt:        takenAt,
+		Status:         req.Status,
+		Note:           req.Note,
+	}
+	if prescription.PRN {
+		if req.Status != DoseTaken {
+			c.String(http.StatusBadRequest, "error: doses of prn medications can only be logged as taken")
+			return
+		}
+		if err := db.Create(&dose).Error; err != nil {
+			internalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, dose)
+		return
+	}
+
+	r, err := regimenOf(&prescription)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	var scheduled time.Time
+	if req.ScheduledAt != nil {
+		due := r.Due(*req.ScheduledAt, req.ScheduledAt.Add(time.Second))
+		if len(due) == 0 || !due[0].Equal(*req.ScheduledAt) {
+			c.String(http.StatusUnprocessableEntity, "error: scheduledAt is not a due time of the prescription")
+			return
+		}
+		scheduled = due[0]
+	} else {
+		var ok bool
+		if scheduled, ok = r.Nearest(takenAt); !ok {
+			c.String(http.StatusUnprocessableEntity, "error: no dose of the prescription is due around takenAt")
+			return
+		}
+	}
+	dose.ScheduledAt = &scheduled
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "prescription_id"}, {Name: "scheduled_at"}},
+			DoUpdates: clause.AssignmentColumns([]string{"taken_at", "status", "note"}),
+		}).Create(&dose).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Reminder{}).
+			Where("prescription_id = ? AND due_at = ?", prescription.ID, scheduled).
+			Update("status", ReminderLogged).Error
+	})
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dose)
+}
+
+// getDoses lists the doses a user logged, filtered by ?prescriptionId and
+// by ?from and ?to on when they were taken.
+func (s *Server) getDoses(c *gin.Context) {
+	db := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("taken_at, id")
+	if v, ok := c.GetQuery("prescriptionId"); ok {
+		db = db.Where("prescription_id = ?", v)
+	}
+	db, ok := rangeQuery(c, db, "taken_at")
+	if !ok {
+		return
+	}
+	var doses []Dose
+	if err := db.Find(&doses).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, doses)
+}
+
+// getReminders lists the reminders of a user, filtered by ?status and by
+// ?from and ?to on when their dose is due.
+func (s *Server) getReminders(c *gin.Context) {
+	db := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("due_at, id")
+	if v, ok := c.GetQuery("status"); ok {
+		db = db.Where("status = ?", v)
+	}
+	db, ok := rangeQuery(c, db, "due_at")
+	if !ok {
+		return
+	}
+	var reminders []Reminder
+	if err := db.Find(&reminders).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, reminders)
+}
+
+// rangeQuery restricts column to the ?from and ?to parameters, answering
+// 400 if they are invalid.
+func rangeQuery(c *gin.Context, db *gorm.DB, column string) (*gorm.DB, bool) {
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		if _, ok := c.GetQuery(param); !ok {
+			continue
+		}
+		t, err := timeQuery(c, param, time.Time{})
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+			return nil, false
+		}
+		db = db.Where(column+" "+op+" ?", t)
+	}
+	return db, true
+}
+
+// adherence is how closely a user took a medication.
+type adherence struct {
+	MedID int `json:"medId"`
+	// PDC is the proportion of days covered: the share of the days on
+	// which doses were due that every dose was taken. It is absent for
+	// medications with no doses due, such as PRN ones.
+	PDC          *float64 `json:"pdc,omitempty"`
+	DaysDue      int      `json:"daysDue"`
+	DaysCovered  int      `json:"daysCovered"`
+	DosesDue     int      `json:"dosesDue"`
+	DosesTaken   int      `json:"dosesTaken"`
+	DosesSkipped int      `json:"dosesSkipped"`
+}
+
+// getAdherence measures, per medication, how closely a user took their
+// prescriptions between ?from and ?to, by default the last 30 days.
+func (s *Server) getAdherence(c *gin.Context) {
+	now := time.Now()
+	to, err := timeQuery(c, "to", now)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	from, err := timeQuery(c, "from", to.AddDate(0, 0, -30))
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if !from.Before(to) || to.Sub(from) > maxAdherenceRange {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: to must be after from, by at most %s", maxAdherenceRange))
+		return
+	}
+	// Doses that are not due yet cannot have been missed.
+	if to.After(now) {
+		to = now
+	}
+
+	db := s.dbFor(c)
+	userID := c.Param("userID")
+	var prescriptions []Prescription
+	err = db.Select("id, med_id, times, start_date, duration_days, prn, timezone, stopped_at").
+		Where("user_id = ?", userID).Order("id").Find(&prescriptions).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	var doses []Dose
+	err = db.Select("prescription_id, scheduled_at, taken_at, status").
+		Where("user_id = ? AND ((scheduled_at >= ? AND scheduled_at < ?) OR (scheduled_at IS NULL AND taken_at >= ? AND taken_at < ?))", userID, from, to, from, to).
+		Find(&doses).Error
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	medOf := make(map[int]int, len(prescriptions))
+	for _, p := range prescriptions {
+		medOf[p.ID] = p.MedID
+	}
+	type key struct {
+		prescriptionID int
+		due            int64
+	}
+	taken := make(map[key]bool)
+	byMed := make(map[int]*adherence)
+	result := func(medID int) *adherence {
+		a, ok := byMed[medID]
+		if !ok {
+			a = &adherence{MedID: medID}
+			byMed[medID] = a
+		}
+		return a
+	}
+	for _, d := range doses {
+		a := result(medOf[d.PrescriptionID])
+		switch d.Status {
+		case DoseTaken:
+			a.DosesTaken++
+			if d.ScheduledAt != nil {
+				taken[key{d.PrescriptionID, d.ScheduledAt.Unix()}] = true
+			}
+		case DoseSkipped:
+			a.DosesSkipped++
+		}
+	}
+
+	days := make(map[int]map[string]*dosing.Day)
+	for i := range prescriptions {
+		p := &prescriptions[i]
+		if p.PRN {
+			continue
+		}
+		r, err := regimenOf(p)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if days[p.MedID] == nil {
+			days[p.MedID] = make(map[string]*dosing.Day)
+		}
+		r.Count(days[p.MedID], from, to, func(due time.Time) bool {
+			return taken[key{p.ID, due.Unix()}]
+		})
+	}
+	for medID, medDays := range days {
+		if len(medDays) == 0 {
+			continue
+		}
+		a := result(medID)
+		for _, d := range medDays {
+			a.DaysDue++
+			a.DosesDue += d.Due
+			if d.Covered() {
+				a.DaysCovered++
+			}
+		}
+		pdc := math.Round(dosing.PDC(medDays)*1000) / 1000
+		a.PDC = &pdc
+	}
+
+	results := make([]*adherence, 0, len(byMed))
+	for _, a := range byMed {
+		results = append(results, a)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].MedID < results[j].MedID })
+	c.JSON(http.StatusOK, results)
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
+// generateReminders creates the reminders of the doses due within
+// cfg.Lookahead and announces those that are due, for every clinic, every
+// cfg.Interval until ctx is done.
+func generateReminders(ctx context.Context, db *gorm.DB, tenancy *tenant.Resolver, notifier *notifications.Notifier, cfg config.RemindersConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := remindClinics(ctx, db, tenancy, notifier, cfg.Lookahead); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func remindClinics(ctx context.Context, db *gorm.DB, tenancy *tenant.Resolver, notifier *notifications.Notifier, lookahead time.Duration) error {
+	var clinicIDs []int
+	if err := db.WithContext(ctx).Model(&Clinic{}).Order("id").Pluck("id", &clinicIDs).Error; err != nil {
+		return err
+	}
+	from := time.Now()
+	for _, id := range clinicIDs {
+		err := tenancy.Run(ctx, id, func(db *gorm.DB) error {
+			if err := remind(db, from, from.Add(lookahead)); err != nil {
+				return err
+			}
+			return notifyReminders(db, notifier, from)
+		})
+		if err != nil {
+			return fmt.Errorf("clinic %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// remind creates the missing reminders of the doses due in [from, to)
+// that were not logged yet.
+func remind(db *gorm.DB, from, to time.Time) error {
+	var prescriptions []Prescription
+	err := db.Select("id, user_id, times, start_date, duration_days, timezone, stopped_at").
+		Where("prn = ? AND (stopped_at IS NULL OR stopped_at > ?)", false, from).
+		Find(&prescriptions).Error
+	if err != nil || len(prescriptions) == 0 {
+		return err
+	}
+	var logged []Dose
+	err = db.Select("prescription_id, scheduled_at").
+		Where("scheduled_at >= ? AND scheduled_at < ?", from, to).
+		Find(&logged).Error
+	if err != nil {
+		return err
+	}
+	done := make(map[int]map[int64]bool)
+	for _, d := range logged {
+		if done[d.PrescriptionID] == nil {
+			done[d.PrescriptionID] = make(map[int64]bool)
+		}
+		done[d.PrescriptionID][d.ScheduledAt.Unix()] = true
+	}
+
+	var reminders []Reminder
+	for i := range prescriptions {
+		p := &prescriptions[i]
+		r, err := regimenOf(p)
+		if err != nil {
+			return fmt.Errorf("prescription %d: %w", p.ID, err)
+		}
+		for _, due := range r.Due(from, to) {
+			if !done[p.ID][due.Unix()] {
+				reminders = append(reminders, Reminder{UserID: p.UserID, PrescriptionID: p.ID, DueAt: due, Status: ReminderPending})
+			}
+		}
+	}
+	if len(reminders) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&reminders, 500).Error
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+
+	"medically-core/client"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor is Middleware for unary gRPC calls, limiting
+// the calls of group for each client as identified by client.CallKey. The
+// limits are sent in the ratelimit-* header metadata, and limited calls
+// fail with ResourceExhausted and retry-after.
+func (l *Limiter) UnaryServerInterceptor(group string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.call(ctx, group); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+// A stream takes one token, however many messages it carries.
+func (l *Limiter) StreamServerInterceptor(group string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.call(ss.Context(), group); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// call takes a token for the call of ctx, returning the status it fails
+// with once the client's bucket is empty.
+func (l *Limiter) call(ctx context.Context, group string) error {
+	limit, res, ok := l.take(ctx, group, client.CallKey(ctx))
+	if !ok {
+		return nil
+	}
+	md := metadata.Pairs(
+		"ratelimit-limit", strconv.Itoa(limit.Burst),
+		"ratelimit-remaining", strconv.Itoa(res.Remaining),
+		"ratelimit-reset", strconv.Itoa(ceilSeconds(res.Reset)),
+	)
+	if !res.Allowed {
+		md.Set("retry-after", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+	grpc.SetHeader(ctx, md)
+	if !res.Allowed {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
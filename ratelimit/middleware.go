@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"medically-core/client"
+	"medically-core/config"
+	"medically-core/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGroup is the rule applied to route groups without their own.
+const defaultGroup = "default"
+
+// Limiter enforces per route group limits on each client.
+type Limiter struct {
+	store Store
+
+	mu      sync.RWMutex
+	enabled bool
+	rules   map[string]Limit
+}
+
+// NewLimiter creates a Limiter backed by store.
+func NewLimiter(store Store, cfg config.RateLimitConfig) *Limiter {
+	l := &Limiter{store: store}
+	l.Update(cfg)
+	return l
+}
+
+// Update replaces the limits, e.g. after a configuration reload.
+func (l *Limiter) Update(cfg config.RateLimitConfig) {
+	rules := make(map[string]Limit, len(cfg.Groups))
+	for name, r := range cfg.Groups {
+		rules[name] = Limit{Rate: r.Rate, Burst: r.Burst}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = cfg.Enabled
+	l.rules = rules
+}
+
+func (l *Limiter) limit(group string) (Limit, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.enabled {
+		return Limit{}, false
+	}
+	if r, ok := l.rules[group]; ok {
+		return r, true
+	}
+	r, ok := l.rules[defaultGroup]
+	return r, ok
+}
+
+// Middleware limits the routes of group for each client, as identified by
+// client.Key. It sets the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers on every response, and answers 429 with
+// Retry-After once the client's bucket is empty. If the store fails the
+// request is let through.
+func (l *Limiter) Middleware(group string) gin.HandlerFunc {
+	return l.MiddlewareWith(group, func(c *gin.Context, status int, msg string) {
+		c.String(status, "error: "+msg)
+	})
+}
+
+// MiddlewareWith is Middleware answering limited requests with fail, for
+// APIs with their own error format.
+func (l *Limiter) MiddlewareWith(group string, fail func(c *gin.Context, status int, msg string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, res, ok := l.take(c.Request.Context(), group, client.Key(c))
+		if !ok {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			fail(c, http.StatusTooManyRequests, "rate limit exceeded")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// take takes a token from the bucket of the client key in group. It
+// reports false, letting the request through, when group is not limited
+// or the store fails.
+func (l *Limiter) take(ctx context.Context, group, key string) (Limit, Result, bool) {
+	limit, ok := l.limit(group)
+	if !ok {
+		return Limit{}, Result{}, false
+	}
+	res, err := l.store.Take(ctx, group+"|"+key, limit)
+	if err != nil {
+		logging.FromContext(ctx).Warn("rate limit store failed, allowing request", logging.Err(err))
+		return Limit{}, Result{}, false
+	}
+	return limit, res, true
+}
+
+func ceilSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 0 {
+		return 0
+	}
+	return s
+}
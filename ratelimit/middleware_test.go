@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"medically-core/config"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingStore is a Store that is down.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("store is down")
+}
+
+func newTestRouter(l *Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/user", l.Middleware("user"), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/med", l.Middleware("med"), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return r
+}
+
+func get(r http.Handler, path, ip string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func testConfig() config.RateLimitConfig {
+	return config.RateLimitConfig{
+		Enabled: true,
+		Groups: map[string]config.RateLimitRule{
+			"user":    {Rate: 0.001, Burst: 2},
+			"default": {Rate: 0.001, Burst: 1},
+		},
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := newTestRouter(NewLimiter(NewMemoryStore(), testConfig()))
+
+	w := get(r, "/user", "192.0.2.1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+	for header, want := range map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "1"} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	get(r, "/user", "192.0.2.1", nil)
+	w = get(r, "/user", "192.0.2.1", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("limited response has no Retry-After")
+	}
+
+	// Another client, or another group, has its own bucket.
+	if w := get(r, "/user", "192.0.2.2", nil); w.Code != http.StatusOK {
+		t.Errorf("another client: status %d", w.Code)
+	}
+	if w := get(r, "/med", "192.0.2.1", nil); w.Code != http.StatusOK {
+		t.Errorf("another group: status %d", w.Code)
+	}
+	if w := get(r, "/med", "192.0.2.1", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("the default limit was not applied: status %d", w.Code)
+	}
+}
+
+func TestMiddlewareIgnoresAPIKey(t *testing.T) {
+	// Unauthenticated headers do not give a client a fresh bucket.
+	r := newTestRouter(NewLimiter(NewMemoryStore(), testConfig()))
+	var w *httptest.ResponseRecorder
+	for _, key := range []string{"a", "b", "c"} {
+		w = get(r, "/user", "192.0.2.1", map[string]string{"X-API-Key": key})
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("third request: status %d, want 429", w.Code)
+	}
+}
+
+func TestMiddlewareLetsThrough(t *testing.T) {
+	disabled := testConfig()
+	disabled.Enabled = false
+	for name, l := range map[string]*Limiter{
+		"disabled":     NewLimiter(NewMemoryStore(), disabled),
+		"store failed": NewLimiter(failingStore{}, testConfig()),
+	} {
+		r := newTestRouter(l)
+		for i := 0; i < 5; i++ {
+			if w := get(r, "/user", "192.0.2.1", nil); w.Code != http.StatusOK {
+				t.Fatalf("%s: request %d: status %d", name, i+1, w.Code)
+			}
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), testConfig())
+	cfg := testConfig()
+	cfg.Groups = map[string]config.RateLimitRule{"user": {Rate: 0.001, Burst: 5}}
+	l.Update(cfg)
+	if limit, ok := l.limit("user"); !ok || limit.Burst != 5 {
+		t.Errorf("limit(user) = %+v, %v after Update", limit, ok)
+	}
+	if _, ok := l.limit("med"); ok {
+		t.Error("the removed default still applies")
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	cfg := testConfig()
+	cfg.Groups["grpc"] = config.RateLimitRule{Rate: 0.001, Burst: 1}
+	intercept := NewLimiter(NewMemoryStore(), cfg).UnaryServerInterceptor("grpc")
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/medically.UserService/GetUser"}
+
+	if _, err := intercept(context.Background(), nil, info, handler); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	_, err := intercept(context.Background(), nil, info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second call: %v, want ResourceExhausted", err)
+	}
+}
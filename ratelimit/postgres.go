@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// bucketRow is a token bucket in the "rate_limit_buckets" table.
+type bucketRow struct {
+	Key       string `gorm:"primaryKey"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+func (bucketRow) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// PostgresStore keeps buckets in Postgres so every replica enforces the
+// same limits. Each Take is a short transaction locking one row.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore creates a PostgresStore, creating its table if needed.
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&bucketRow{}); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// Take implements Store.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var res Result
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Create the bucket full if it is new; concurrent creators are
+		// serialised by the primary key.
+		row := bucketRow{Key: key, Tokens: float64(limit.Burst), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "key = ?", key).Error; err != nil {
+			return err
+		}
+		row.Tokens, res = take(row.Tokens, row.UpdatedAt, now, limit)
+		row.UpdatedAt = now
+		return tx.Save(&row).Error
+	})
+	return res, err
+}
+
+// Sweep deletes buckets untouched for longer than idle, every interval,
+// until ctx is done.
+func (s *PostgresStore) Sweep(ctx context.Context, idle, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.db.WithContext(ctx).Where("updated_at < ?", time.Now().Add(-idle)).Delete(&bucketRow{}).Error
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("ratelimit: sweeping buckets: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package ratelimit limits the request rate of each client with token
+// buckets.
+//
+// Buckets live in a Store: MemoryStore for a single instance, or
+// PostgresStore so that every replica shares the same buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second and holding
+// at most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until the next token is available. It is
+	// zero when tokens remain.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store holds token buckets.
+type Store interface {
+	// Take removes one token from the bucket named key, if one is left.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take refills a bucket holding tokens at last up to now and takes one
+// token from it if possible. It returns the new token count.
+func take(tokens float64, last, now time.Time, limit Limit) (float64, Result) {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+	}
+
+	var res Result
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((burst - tokens) / limit.Rate)
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
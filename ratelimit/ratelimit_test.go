@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tokens := float64(limit.Burst)
+	var res Result
+	for i := 2; i >= 0; i-- {
+		tokens, res = take(tokens, start, start, limit)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", 3-i, res, i)
+		}
+	}
+
+	tokens, res = take(tokens, start, start, limit)
+	if res.Allowed {
+		t.Fatal("took a token from an empty bucket")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", res.RetryAfter)
+	}
+	if res.Reset != 1500*time.Millisecond {
+		t.Errorf("Reset = %v, want 1.5s", res.Reset)
+	}
+
+	// Half a second later one token is back.
+	later := start.Add(500 * time.Millisecond)
+	tokens, res = take(tokens, start, later, limit)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refilling: got %+v, want allowed with 0 remaining", res)
+	}
+
+	// Refilling stops at the burst.
+	_, res = take(tokens, later, later.Add(time.Hour), limit)
+	if !res.Allowed || res.Remaining != 2 {
+		t.Errorf("after an hour: got %+v, want allowed with 2 remaining", res)
+	}
+}
+
+func TestTakeClockSkew(t *testing.T) {
+	// A last time after now, as between replicas with skewed clocks,
+	// adds no tokens.
+	now := time.Now()
+	tokens, res := take(0.5, now.Add(time.Second), now, Limit{Rate: 1, Burst: 1})
+	if res.Allowed || tokens != 0.5 {
+		t.Errorf("got %+v with %v tokens, want refused with 0.5", res, tokens)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Rate: 0.001, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if res, _ := s.Take(ctx, "a", limit); !res.Allowed {
+			t.Fatalf("take %d of a was refused", i+1)
+		}
+	}
+	if res, _ := s.Take(ctx, "a", limit); res.Allowed {
+		t.Error("a took more than its burst")
+	}
+	if res, _ := s.Take(ctx, "b", limit); !res.Allowed {
+		t.Error("b was limited by the bucket of a")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	s.Take(ctx, "full", Limit{Rate: 1000, Burst: 1})
+	s.Take(ctx, "empty", Limit{Rate: 0.001, Burst: 1})
+
+	s.mu.Lock()
+	s.sweep(time.Now().Add(time.Second))
+	_, full := s.buckets["full"]
+	_, empty := s.buckets["empty"]
+	s.mu.Unlock()
+	if full {
+		t.Error("a refilled bucket was kept")
+	}
+	if !empty {
+		t.Error("an empty bucket was dropped")
+	}
+}
@@ -0,0 +1,90 @@
+package scheduling
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is an entry of a calendar.
+type Event struct {
+	UID         string
+	Start, End  time.Time
+	Stamp       time.Time
+	Summary     string
+	Description string
+	Location    string
+	// Cancelled marks events that calendar clients should remove.
+	Cancelled bool
+	// Sequence is increased each time the event is changed, so calendar
+	// clients replace older copies of it.
+	Sequence int
+}
+
+// WriteICS writes events as an iCalendar (RFC 5545) calendar.
+func WriteICS(w io.Writer, name string, events []Event) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//medically//core//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeText(name))
+	for _, e := range events {
+		status := "CONFIRMED"
+		if e.Cancelled {
+			status = "CANCELLED"
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(e.UID))
+		line("DTSTAMP", formatTime(e.Stamp))
+		line("DTSTART", formatTime(e.Start))
+		line("DTEND", formatTime(e.End))
+		line("SEQUENCE", strconv.Itoa(e.Sequence))
+		line("STATUS", status)
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escapeText(e.Location))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// writeFolded writes a content line, folding it into lines of at most 75
+// octets without splitting UTF-8 sequences. Continuation lines begin with
+// a space, which counts towards their length.
+func writeFolded(b *bufio.Writer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
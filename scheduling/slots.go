@@ -0,0 +1,114 @@
+// Package scheduling computes bookable slots from weekly availability and
+// writes calendars in the iCalendar format.
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Window is a weekly period of availability divided into slots of equal
+// length. Start and End are times of day in Location.
+type Window struct {
+	// ID identifies the window to the caller, e.g. its schedule.
+	ID       int
+	Weekday  time.Weekday
+	Start    Clock
+	End      Clock
+	Slot     time.Duration
+	Location *time.Location
+}
+
+// Clock is a time of day.
+type Clock struct {
+	Hour, Minute int
+}
+
+// ParseClock parses a time of day written as "15:04".
+func ParseClock(s string) (Clock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return Clock{}, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return Clock{t.Hour(), t.Minute()}, nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+}
+
+// Before reports whether c is earlier in the day than d.
+func (c Clock) Before(d Clock) bool {
+	return c.Hour < d.Hour || c.Hour == d.Hour && c.Minute < d.Minute
+}
+
+// on returns the time c on the day of date, in loc.
+func (c Clock) on(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, c.Hour, c.Minute, 0, 0, loc)
+}
+
+// Interval is a period of time, from Start until End.
+type Interval struct {
+	Start, End time.Time
+}
+
+// Overlaps reports whether i and j share any instant.
+func (i Interval) Overlaps(j Interval) bool {
+	return i.Start.Before(j.End) && j.Start.Before(i.End)
+}
+
+// Slot is a bookable period of a window.
+type Slot struct {
+	WindowID int       `json:"-"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Slots returns the slots of windows that lie within [from, to) and do
+// not overlap busy, ordered by start.
+func Slots(windows []Window, from, to time.Time, busy []Interval) []Slot {
+	var slots []Slot
+	for _, w := range windows {
+		// Days are walked in the window's location so that slots keep
+		// their local time across daylight saving changes.
+		day := from.In(w.Location)
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, w.Location)
+		for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() != w.Weekday {
+				continue
+			}
+			y, m, d := day.Date()
+			end := w.End.on(y, m, d, w.Location)
+			for start := w.Start.on(y, m, d, w.Location); !start.Add(w.Slot).After(end); start = start.Add(w.Slot) {
+				s := Interval{start, start.Add(w.Slot)}
+				if s.Start.Before(from) || s.End.After(to) || overlapsAny(s, busy) {
+					continue
+				}
+				slots = append(slots, Slot{WindowID: w.ID, Start: s.Start, End: s.End})
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+// Match returns the slot of windows starting at start, if there is one.
+func Match(windows []Window, start time.Time) (Slot, bool) {
+	// A slot starting at start lies within the day around it.
+	for _, s := range Slots(windows, start, start.Add(24*time.Hour), nil) {
+		if s.Start.Equal(start) {
+			return s, true
+		}
+	}
+	return Slot{}, false
+}
+
+func overlapsAny(i Interval, busy []Interval) bool {
+	for _, b := range busy {
+		if i.Overlaps(b) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+
+	"medically-core/bulkexport"
+	"medically-core/config"
+	"medically-core/health"
+	"medically-core/hl7"
+	"medically-core/idempotency"
+	"medically-core/logging"
+	"medically-core/metrics"
+	"medically-core/notifications"
+	"medically-core/ratelimit"
+	"medically-core/tenant"
+	"medically-core/userexport"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -11,50 +25,183 @@ import (
 
 // Server is an http server that handles REST requests.
 type Server struct {
-	db *gorm.DB
+	db          *gorm.DB
+	probes      *health.Registry
+	limiter     *ratelimit.Limiter
+	idempotency *idempotency.Store
+	tenancy     *tenant.Resolver
+	exporter    *bulkexport.Exporter
+	hl7         *hl7.Server
+	scheduling  config.SchedulingConfig
+	notifier    *notifications.Notifier
+	changes     *changePublisher
+	graphQL     config.GraphQLConfig
+	userExports *userexport.Exporter
+	erasure     config.ErasureConfig
 }
 
 // NewServer creates a new instance of a Server.
-func NewServer(db *gorm.DB) *Server {
-	return &Server{db: db}
+func NewServer(db *gorm.DB, probes *health.Registry, limiter *ratelimit.Limiter, idem *idempotency.Store, tenancy *tenant.Resolver, exporter *bulkexport.Exporter, hl7Server *hl7.Server, scheduling config.SchedulingConfig, notifier *notifications.Notifier, changes *changePublisher, graphQL config.GraphQLConfig, userExports *userexport.Exporter, erasure config.ErasureConfig) *Server {
+	return &Server{db: db, probes: probes, limiter: limiter, idempotency: idem, tenancy: tenancy, exporter: exporter, hl7: hl7Server, scheduling: scheduling, notifier: notifier, changes: changes, graphQL: graphQL, userExports: userExports, erasure: erasure}
 }
 
 // RegisterRouter registers a router onto the Server.
 func (s *Server) RegisterRouter(router *gin.Engine) {
 	router.GET("/ping", s.ping)
-
-	router.GET("/user", s.getUsers)
-	router.POST("/user", s.createUser)
-	router.GET("/user/:userID", s.getUser)
-	router.PUT("/user/:userID", s.updateUser)
-	router.DELETE("/user/:userID", s.deleteUser)
-
-	router.GET("/med", s.getMeds)
-	router.POST("/med", s.createMed)
-	router.GET("/med/:medID", s.getMed)
-	router.PUT("/med/:medID", s.updateMed)
-	router.DELETE("/med/:medID", s.deleteMed)
-
-	router.GET("/disease", s.getDiseases)
-	router.POST("/disease", s.createDisease)
-	router.GET("/disease/:diseaseID", s.getDisease)
-	router.PUT("/disease/:diseaseID", s.updateDisease)
-	router.DELETE("/disease/:diseasesID", s.deleteDisease)
-
-	router.GET("/clinic", s.getClinics)
-	router.POST("/clinic", s.createClinic)
-	router.GET("/clinic/:clinicID", s.getClinic)
-	router.PUT("/clinic/:clinicID", s.updateClinic)
-	router.DELETE("/clinic/:clinicID", s.deleteClinic)
+	router.GET("/healthz", s.healthz)
+	router.GET("/readyz", s.readyz)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	user := router.Group("/user", s.limiter.Middleware("user"), s.tenancy.Middleware(), s.redirectMerged, s.auditAccess)
+	user.GET("", s.getUsers)
+	user.POST("", s.idempotency.Middleware(), s.createUser)
+	user.GET("/duplicates", s.getDuplicates)
+	user.POST("/duplicates/dismiss", s.dismissDuplicate)
+	user.GET("/:userID", s.getUser)
+	user.PUT("/:userID", s.updateUser)
+	user.DELETE("/:userID", s.requestErasure)
+	user.GET("/:userID/observations", s.getObservations)
+	user.GET("/:userID/appointments", s.getUserAppointments)
+	user.GET("/:userID/appointments.ics", s.getUserCalendar)
+	user.GET("/:userID/prescriptions", s.getPrescriptions)
+	user.POST("/:userID/prescriptions", s.idempotency.Middleware(), s.createPrescription)
+	user.POST("/:userID/prescriptions/:prescriptionID/stop", s.stopPrescription)
+	user.GET("/:userID/diagnoses", s.getDiagnoses)
+	user.POST("/:userID/diagnoses", s.idempotency.Middleware(), s.createDiagnosis)
+	user.GET("/:userID/doses", s.getDoses)
+	user.POST("/:userID/doses", s.idempotency.Middleware(), s.createDose)
+	user.GET("/:userID/reminders", s.getReminders)
+	user.GET("/:userID/adherence", s.getAdherence)
+	user.GET("/:userID/notifications", s.getNotifications)
+	user.GET("/:userID/notification-preferences", s.getNotificationPreferences)
+	user.PUT("/:userID/notification-preferences", s.putNotificationPreferences)
+	user.POST("/:userID/export", s.idempotency.Middleware(), s.requestUserExport)
+	user.GET("/:userID/export/:exportID", s.getUserExport)
+	user.GET("/:userID/erasure-requests", s.getErasureRequests)
+	user.POST("/:userID/erasure-requests", s.idempotency.Middleware(), s.requestErasure)
+	user.POST("/:userID/erasure-requests/:requestID/approve", s.approveErasure)
+	user.POST("/:userID/erasure-requests/:requestID/reject", s.rejectErasure)
+	user.GET("/:userID/legal-holds", s.getLegalHolds)
+	user.POST("/:userID/legal-holds", s.idempotency.Middleware(), s.createLegalHold)
+	user.POST("/:userID/legal-holds/:holdID/release", s.releaseLegalHold)
+	user.GET("/:userID/consents", s.getConsents)
+	user.POST("/:userID/consents", s.idempotency.Middleware(), s.createConsent)
+	user.GET("/:userID/consents/check", s.checkConsent)
+	user.POST("/:userID/consents/:consentID/revoke", s.revokeConsent)
+	user.POST("/:userID/merge", s.idempotency.Middleware(), s.mergeUser)
+
+	// Other clinics read the records of the patients who consent to
+	// sharing them.
+	shared := router.Group("/shared/:clinicID/user", s.limiter.Middleware("user"), s.tenancy.Middleware())
+	shared.GET("/:userID", s.getSharedUser)
+
+	// Export links are sent to patients, so they are served without a
+	// tenant to whoever holds one.
+	router.GET("/exports/:exportID", s.limiter.Middleware("exports"), s.userExports.Download)
+	// Certificates are checked by their holders, such as the erased user.
+	router.POST("/erasure-certificates/verify", s.limiter.Middleware("erasure"), s.verifyErasureCertificate)
+
+	med := router.Group("/med", s.limiter.Middleware("med"), s.redirectMergedEntry(medCatalog))
+	med.GET("", s.getMeds)
+	med.POST("", s.idempotency.Middleware(), s.createMed)
+	med.GET("/duplicates", s.getCatalogDuplicates(medCatalog))
+	med.POST("/duplicates/dismiss", s.dismissCatalogDuplicate(medCatalog))
+	med.GET("/:medID", s.getMed)
+	med.PUT("/:medID", s.updateMed)
+	med.DELETE("/:medID", s.deleteMed)
+	med.POST("/:medID/merge", s.idempotency.Middleware(), s.mergeCatalogEntry(medCatalog))
+
+	disease := router.Group("/disease", s.limiter.Middleware("disease"), s.redirectMergedEntry(diseaseCatalog))
+	disease.GET("", s.getDiseases)
+	disease.POST("", s.idempotency.Middleware(), s.createDisease)
+	disease.GET("/duplicates", s.getCatalogDuplicates(diseaseCatalog))
+	disease.POST("/duplicates/dismiss", s.dismissCatalogDuplicate(diseaseCatalog))
+	disease.GET("/:diseaseID", s.getDisease)
+	disease.PUT("/:diseaseID", s.updateDisease)
+	disease.DELETE("/:diseaseID", s.deleteDisease)
+	disease.POST("/:diseaseID/merge", s.idempotency.Middleware(), s.mergeCatalogEntry(diseaseCatalog))
+
+	clinic := router.Group("/clinic", s.limiter.Middleware("clinic"))
+	clinic.GET("", s.getClinics)
+	clinic.POST("", s.idempotency.Middleware(), s.createClinic)
+	clinic.GET("/nearby", s.getNearbyClinics)
+	clinic.GET("/:clinicID", s.getClinic)
+	clinic.GET("/:clinicID/opening-hours", s.getOpeningHours)
+	clinic.GET("/:clinicID/holidays", s.getHolidays)
+	clinic.GET("/:clinicID/services", s.getClinicServices)
+
+	// A clinic's staff and appointments are only served to the clinic
+	// itself, and only the clinic changes its hours and services.
+	own := clinic.Group("/:clinicID", s.tenancy.Middleware(), clinicTenant)
+	own.PUT("", s.updateClinic)
+	own.DELETE("", s.deleteClinic)
+	own.PUT("/opening-hours", s.putOpeningHours)
+	own.POST("/holidays", s.idempotency.Middleware(), s.createHoliday)
+	own.DELETE("/holidays/:holidayID", s.deleteHoliday)
+	own.POST("/services", s.idempotency.Middleware(), s.createClinicService)
+	own.DELETE("/services/:serviceID", s.deleteClinicService)
+	own.GET("/clinicians", s.getClinicians)
+	own.POST("/clinicians", s.idempotency.Middleware(), s.createClinician)
+	own.GET("/clinicians/:clinicianID/schedules", s.getSchedules)
+	own.POST("/clinicians/:clinicianID/schedules", s.idempotency.Middleware(), s.createSchedule)
+	own.DELETE("/clinicians/:clinicianID/schedules/:scheduleID", s.deleteSchedule)
+	own.GET("/slots", s.getSlots)
+	own.GET("/appointments", s.getAppointments)
+	own.POST("/appointments", s.idempotency.Middleware(), s.createAppointment)
+	own.GET("/appointments/:appointmentID", s.getAppointment)
+	own.POST("/appointments/:appointmentID/cancel", s.cancelAppointment)
+	own.POST("/appointments/:appointmentID/reschedule", s.rescheduleAppointment)
+
+	hooks := router.Group("/webhooks", s.limiter.Middleware("webhooks"), s.tenancy.Middleware())
+	hooks.GET("", s.getWebhooks)
+	hooks.POST("", s.idempotency.Middleware(), s.createWebhook)
+	hooks.GET("/:subscriptionID", s.getWebhook)
+	hooks.PUT("/:subscriptionID", s.updateWebhook)
+	hooks.DELETE("/:subscriptionID", s.deleteWebhook)
+	hooks.GET("/:subscriptionID/deliveries", s.getWebhookDeliveries)
+	hooks.POST("/:subscriptionID/deliveries/:deliveryID/redeliver", s.redeliverWebhook)
+
+	changes := router.Group("/changes", s.limiter.Middleware("changes"))
+	changes.GET("", s.tenancy.Middleware(), s.getChanges)
+	changes.GET("/stream", s.tenancy.StreamMiddleware(), s.streamChanges)
+
+	// Users are only served to requests with a tenant, while the shared
+	// catalogs are served to any.
+	graphQL := router.Group("/graphql", s.limiter.Middleware("graphql"), s.tenancy.OptionalMiddleware())
+	serveGraphQL := s.graphQLHandler()
+	graphQL.GET("", serveGraphQL)
+	graphQL.POST("", serveGraphQL)
+
+	s.registerFHIR(router)
+
+	// The HL7 routes only exist when the listener runs.
+	if s.hl7 != nil {
+		messages := router.Group("/hl7/messages", s.limiter.Middleware("hl7"), s.tenancy.Middleware())
+		messages.GET("", s.getHL7Messages)
+		messages.POST("/:messageID/replay", s.replayHL7Message)
+	}
 }
 
 // ------------------------------- User Server Methods ------------------------------------//
 func (s *Server) getUsers(c *gin.Context) {
+	db, err := usersWithEmail(s.dbFor(c), c.Query("email"))
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
 	var users []User
-	if err := s.db.Find(&users).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := db.Find(&users).Error; err != nil {
+		internalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, users)
+	// auditAccess only sees a single user's route.
+	ids := make([]int, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	recordAccess(s.dbFor(c), requestAccess(c, c.FullPath()), ids...)
 }
 
 func (s *Server) createUser(c *gin.Context) {
@@ -63,9 +210,15 @@ func (s *Server) createUser(c *gin.Context) {
 		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
 		return
 	}
+	if err := validateUser(&user); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
 
-	if err := s.db.Create(&user).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.createEntity(s.dbFor(c), "user", &user)
+	if err != nil {
+		internalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, user)
 
@@ -74,8 +227,8 @@ func (s *Server) createUser(c *gin.Context) {
 func (s *Server) getUser(c *gin.Context) {
 	id := c.Param("userID")
 	var user User
-	if err := s.db.Find(&user, id).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&user, id).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, user)
 	}
@@ -87,24 +240,39 @@ func (s *Server) updateUser(c *gin.Context) {
 		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
 		return
 	}
+	if err := validateUser(&user); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	// The route names the user, not the body, as redirectMerged and
+	// auditAccess went by the route.
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if user.ID != 0 && user.ID != userID {
+		c.String(http.StatusBadRequest, "error: id does not match the URL")
+		return
+	}
+	user.ID = userID
 
-	if err := s.db.Save(user).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err = s.saveEntity(s.dbFor(c), "user", &user)
+	if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, user)
 	}
 }
 
-func (s *Server) deleteUser(c *gin.Context) {
-	userID := c.Param("userID")
-	req := s.db.Delete(User{}, "ID = ?", userID)
-	if err := req.Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
-	} else if req.RowsAffected == 0 {
-		c.String(http.StatusNotFound, fmt.Sprintf("error: %s", err))
-	} else {
-		c.JSON(http.StatusOK, gin.H{"userId": userID})
+func (s *Server) getObservations(c *gin.Context) {
+	var observations []Observation
+	err := s.dbFor(c).Where("user_id = ?", c.Param("userID")).Order("effective_at DESC, id").Find(&observations).Error
+	if err != nil {
+		internalError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, observations)
 }
 
 // ------------------------------- ------------------- ------------------------------------//
@@ -112,8 +280,9 @@ func (s *Server) deleteUser(c *gin.Context) {
 // ----------------------------  Medication Server Methods ---------------------------------//
 func (s *Server) getMeds(c *gin.Context) {
 	var meds []Med
-	if err := s.db.Find(&meds).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&meds).Error; err != nil {
+		internalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, meds)
 }
@@ -125,16 +294,18 @@ func (s *Server) createMed(c *gin.Context) {
 		return
 	}
 
-	if err := s.db.Create(&med).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.createEntity(s.dbFor(c), "med", &med)
+	if err != nil {
+		internalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, med)
 }
 
 func (s *Server) getMed(c *gin.Context) {
 	var med Med
-	if err := s.db.Find(&med, c.Param("medID")).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&med, c.Param("medID")).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, med)
 	}
@@ -147,8 +318,9 @@ func (s *Server) updateMed(c *gin.Context) {
 		return
 	}
 
-	if err := s.db.Save(med).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.saveEntity(s.dbFor(c), "med", &med)
+	if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, med)
 	}
@@ -156,11 +328,12 @@ func (s *Server) updateMed(c *gin.Context) {
 
 func (s *Server) deleteMed(c *gin.Context) {
 	medID := c.Param("medID")
-	req := s.db.Delete(Med{}, "ID = ?", medID)
-	if err := req.Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
-	} else if req.RowsAffected == 0 {
-		c.String(http.StatusNotFound, fmt.Sprintf("error: %s", err))
+	var med Med
+	err := s.deleteEntity(s.dbFor(c), "med", &med, medID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, medID)
 	}
@@ -171,8 +344,8 @@ func (s *Server) deleteMed(c *gin.Context) {
 // ----------------------------  Disease Server Methods ---------------------------------//
 func (s *Server) getDiseases(c *gin.Context) {
 	var diseases []Disease
-	if err := s.db.Find(&diseases).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&diseases).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, diseases)
 	}
@@ -185,16 +358,18 @@ func (s *Server) createDisease(c *gin.Context) {
 		return
 	}
 
-	if err := s.db.Create(&disease).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.createEntity(s.dbFor(c), "disease", &disease)
+	if err != nil {
+		internalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, disease)
 }
 
 func (s *Server) getDisease(c *gin.Context) {
 	var disease Disease
-	if err := s.db.Find(&disease, c.Param("diseaseID")).Error; err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&disease, c.Param("diseaseID")).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, disease)
 	}
@@ -207,8 +382,9 @@ func (s *Server) updateDisease(c *gin.Context) {
 		return
 	}
 
-	if err := s.db.Save(disease).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.saveEntity(s.dbFor(c), "disease", &disease)
+	if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, disease)
 	}
@@ -216,11 +392,12 @@ func (s *Server) updateDisease(c *gin.Context) {
 
 func (s *Server) deleteDisease(c *gin.Context) {
 	diseaseID := c.Param("diseaseID")
-	req := s.db.Delete(Disease{}, "ID = ?", diseaseID)
-	if err := req.Error; err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
-	} else if req.RowsAffected == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	var disease Disease
+	err := s.deleteEntity(s.dbFor(c), "disease", &disease, diseaseID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, diseaseID)
 	}
@@ -230,8 +407,8 @@ func (s *Server) deleteDisease(c *gin.Context) {
 // ---------------------------- Clinic Server Methods ---------------------------------//
 func (s *Server) getClinics(c *gin.Context) {
 	var clinics []Clinic
-	if err := s.db.Find(&clinics).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&clinics).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, clinics)
 	}
@@ -243,9 +420,14 @@ func (s *Server) createClinic(c *gin.Context) {
 		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
 		return
 	}
+	if err := validateClinic(&clinic); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
 
-	if err := s.db.Create(&clinic).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.createEntity(s.dbFor(c), "clinic", &clinic)
+	if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, clinic)
 	}
@@ -253,8 +435,8 @@ func (s *Server) createClinic(c *gin.Context) {
 
 func (s *Server) getClinic(c *gin.Context) {
 	var clinic Clinic
-	if err := s.db.Find(&clinic, c.Param("clinicID")).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	if err := s.dbFor(c).Find(&clinic, c.Param("clinicID")).Error; err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, clinic)
 	}
@@ -266,9 +448,16 @@ func (s *Server) updateClinic(c *gin.Context) {
 		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
 		return
 	}
+	if err := validateClinic(&clinic); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	// clinicTenant checked the route's clinic, not the body's.
+	clinic.ID, _ = tenant.FromContext(c.Request.Context())
 
-	if err := s.db.Save(clinic).Error; err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	err := s.saveEntity(s.dbFor(c), "clinic", &clinic)
+	if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, clinic)
 	}
@@ -276,11 +465,12 @@ func (s *Server) updateClinic(c *gin.Context) {
 
 func (s *Server) deleteClinic(c *gin.Context) {
 	clinicId := c.Param("clinicID")
-	req := s.db.Delete(Clinic{}, "ID = ?", clinicId)
-	if err := req.Error; err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
-	} else if req.RowsAffected == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+	var clinic Clinic
+	err := s.deleteEntity(s.dbFor(c), "clinic", &clinic, clinicId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else if err != nil {
+		internalError(c, err)
 	} else {
 		c.JSON(http.StatusOK, clinicId)
 	}
@@ -288,10 +478,94 @@ func (s *Server) deleteClinic(c *gin.Context) {
 // ------------------------------- ------------------- ------------------------------------//
 
 
+// ----------------------------  HL7 Server Methods ---------------------------------//
+
+// getHL7Messages lists the latest received HL7 messages, optionally only
+// those with the given status, e.g. failed ones to replay.
+func (s *Server) getHL7Messages(c *gin.Context) {
+	db := s.dbFor(c).Order("id DESC").Limit(100)
+	if status, ok := c.GetQuery("status"); ok {
+		db = db.Where("status = ?", status)
+	}
+	var messages []hl7.StoredMessage
+	if err := db.Find(&messages).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// replayHL7Message processes a received message again.
+func (s *Server) replayHL7Message(c *gin.Context) {
+	var msg hl7.StoredMessage
+	err := s.dbFor(c).Take(&msg, "id = ?", c.Param("messageID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	status, err := s.hl7.Replay(c.Request.Context(), &msg)
+	if errors.Is(err, hl7.ErrErased) {
+		c.String(http.StatusGone, "error: message was erased")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": msg.ID, "status": status})
+}
+
+// ------------------------------- ------------------- ------------------------------------//
+
 func (s *Server) ping(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "service ready to go!"})
 }
 
+// healthz is the liveness probe: it only reports that the process serves
+// requests, so a failing dependency never gets the container restarted.
+func (s *Server) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// readyz is the readiness probe: it checks every dependency and reports
+// each result.
+func (s *Server) readyz(c *gin.Context) {
+	report := s.probes.Run(c.Request.Context())
+	if report.OK() {
+		c.JSON(http.StatusOK, report)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, report)
+	}
+}
+
+// dbFor returns the database handle for a request, scoped to its tenant on
+// tenant-owned routes.
+func (s *Server) dbFor(c *gin.Context) *gorm.DB {
+	return tenant.DB(c, s.db)
+}
+
+// clinicTenant rejects requests on a clinic, or its staff or appointments,
+// other than their tenant.
+func clinicTenant(c *gin.Context) {
+	id, _ := tenant.FromContext(c.Request.Context())
+	if c.Param("clinicID") != strconv.Itoa(id) {
+		c.String(http.StatusForbidden, "error: tenant does not match the clinic")
+		c.Abort()
+	}
+}
+
+// internalError logs err and answers 500 without echoing it, since
+// database errors can contain patient data.
+func internalError(c *gin.Context, err error) {
+	ctx := c.Request.Context()
+	logging.FromContext(ctx).Error("request failed", logging.Err(err))
+	c.String(http.StatusInternalServerError, fmt.Sprintf("error: internal error (request id %s)", logging.RequestIDFrom(ctx)))
+}
+
 func BindJSON(c *gin.Context, obj interface{}) (err error) {
 	if err = c.ShouldBindWith(obj, binding.JSON); err != nil {
 		return err
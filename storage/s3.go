@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"medically-core/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in an S3-compatible bucket.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 creates an S3 store for the bucket configured by cfg.
+func NewS3(cfg config.S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey.Value(), ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+// Put implements Store.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Open implements Store. Reads after a seek fetch only the remaining
+// range of the object.
+func (s *S3) Open(ctx context.Context, key string) (Object, Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Info{}, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Info{}, err
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, Info{}, ErrNotFound
+		}
+		return nil, Info{}, err
+	}
+	return obj, Info{Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+// DeleteDir implements Store.
+func (s *S3) DeleteDir(ctx context.Context, dir string) error {
+	if err := checkKey(dir); err != nil {
+		return err
+	}
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: dir + "/", Recursive: true})
+	var err error
+	for e := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = e.Err
+		}
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+// Package storage keeps generated files, such as bulk exports, in a local
+// directory or an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"medically-core/config"
+)
+
+// ErrNotFound is returned by Open when there is no object under the key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object is an open stored object. It supports seeking, so it can serve
+// range requests.
+type Object interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Info describes a stored object.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Store stores objects under slash-separated keys.
+type Store interface {
+	// Put stores the size bytes read from r under key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open opens the object under key.
+	Open(ctx context.Context, key string) (Object, Info, error)
+	// DeleteDir deletes every object whose key starts with dir + "/".
+	DeleteDir(ctx context.Context, dir string) error
+}
+
+// New creates the Store selected by cfg.
+func New(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.Dir)
+	case "s3":
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+}
+
+// checkKey rejects keys that could escape the store's root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}
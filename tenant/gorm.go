@@ -0,0 +1,134 @@
+package tenant
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// field is the field that makes a model tenant-owned, and column its
+// column.
+const (
+	field  = "TenantID"
+	column = "tenant_id"
+)
+
+// Register installs the callbacks that scope statements on tenant-owned
+// models to the tenant of their context.
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tenant:create", assign),
+		cb.Query().Before("gorm:query").Register("tenant:query", restrict),
+		cb.Update().Before("gorm:update").Register("tenant:update", func(db *gorm.DB) {
+			guardGlobal(db)
+			restrict(db)
+			assign(db)
+		}),
+		cb.Delete().Before("gorm:delete").Register("tenant:delete", func(db *gorm.DB) {
+			guardGlobal(db)
+			restrict(db)
+		}),
+		cb.Row().Before("gorm:row").Register("tenant:row", restrict),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scope restricts a query to the tenant of ctx. Register applies it to
+// every statement; it is exported for queries built on joins or
+// subqueries that the callbacks cannot see.
+func Scope(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		id, ok := FromContext(ctx)
+		if !ok {
+			db.AddError(ErrMissing)
+			return db
+		}
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: id})
+	}
+}
+
+// tenantOf returns the tenant a statement is scoped to. It reports false
+// when the statement is not on a tenant-owned model or runs as System,
+// and records ErrMissing when a tenant is needed but absent.
+func tenantOf(db *gorm.DB) (int, bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.LookUpField(field) == nil {
+		return 0, false
+	}
+	ctx := db.Statement.Context
+	id, ok := FromContext(ctx)
+	if ok {
+		return id, true
+	}
+	if !isSystem(ctx) {
+		db.AddError(ErrMissing)
+	}
+	return 0, false
+}
+
+// restrict adds "tenant_id = ?" to the statement.
+func restrict(db *gorm.DB) {
+	if id, ok := tenantOf(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: id},
+		}})
+	}
+}
+
+// assign sets TenantID on the rows written, overriding whatever the
+// client sent.
+func assign(db *gorm.DB) {
+	id, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	// Updates with a map may name the column either way; drop both so
+	// the client's value cannot sit next to ours.
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		delete(dest, field)
+		delete(dest, column)
+	case []map[string]interface{}:
+		for _, m := range dest {
+			delete(m, field)
+			delete(m, column)
+		}
+	}
+	db.Statement.SetColumn(field, id, true)
+}
+
+// guardGlobal keeps gorm's protection against updates and deletes without
+// conditions, which the tenant condition added by restrict would defeat.
+func guardGlobal(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.Schema.LookUpField(field) == nil || db.AllowGlobalUpdate {
+		return
+	}
+	if _, ok := stmt.Clauses["WHERE"]; ok {
+		return
+	}
+	if !hasPrimaryKey(stmt.Context, stmt.Schema, stmt.ReflectValue) {
+		db.AddError(gorm.ErrMissingWhereClause)
+	}
+}
+
+func hasPrimaryKey(ctx context.Context, s *schema.Schema, rv reflect.Value) bool {
+	if s.PrioritizedPrimaryField == nil {
+		return false
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		_, zero := s.PrioritizedPrimaryField.ValueOf(ctx, rv)
+		return !zero
+	case reflect.Slice, reflect.Array:
+		return rv.Len() > 0
+	}
+	return false
+}
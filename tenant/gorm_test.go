@@ -0,0 +1,143 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type owned struct {
+	ID       int
+	TenantID int
+	Name     string
+}
+
+type shared struct {
+	ID   int
+	Name string
+}
+
+// dryRunDB returns a database with the callbacks that builds statements
+// without running them.
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRestrict(t *testing.T) {
+	db := dryRunDB(t)
+	ctx := NewContext(context.Background(), 7)
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB) *gorm.DB
+	}{
+		{"find", func(db *gorm.DB) *gorm.DB { return db.Where("name = ?", "a").Find(&[]owned{}) }},
+		{"count", func(db *gorm.DB) *gorm.DB { var n int64; return db.Model(&owned{}).Count(&n) }},
+		{"update", func(db *gorm.DB) *gorm.DB { return db.Model(&owned{ID: 1}).Update("name", "b") }},
+		{"delete", func(db *gorm.DB) *gorm.DB { return db.Delete(&owned{ID: 1}) }},
+	}
+	for _, tt := range tests {
+		stmt := tt.run(db.WithContext(ctx)).Statement
+		if sql := stmt.SQL.String(); !strings.Contains(sql, `"owneds"."tenant_id" = $`) {
+			t.Errorf("%s: %s has no tenant condition", tt.name, sql)
+		}
+		if !containsVar(stmt.Vars, 7) {
+			t.Errorf("%s: vars %v do not hold the tenant", tt.name, stmt.Vars)
+		}
+	}
+
+	stmt := db.WithContext(ctx).Find(&[]shared{}).Statement
+	if sql := stmt.SQL.String(); strings.Contains(sql, "tenant_id") {
+		t.Errorf("a shared model was restricted: %s", sql)
+	}
+}
+
+func containsVar(vars []interface{}, v interface{}) bool {
+	for _, x := range vars {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMissingTenant(t *testing.T) {
+	db := dryRunDB(t)
+	if err := db.Find(&[]owned{}).Error; !errors.Is(err, ErrMissing) {
+		t.Errorf("query without a tenant: %v, want ErrMissing", err)
+	}
+	if err := db.Create(&owned{Name: "a"}).Error; !errors.Is(err, ErrMissing) {
+		t.Errorf("create without a tenant: %v, want ErrMissing", err)
+	}
+	if err := db.Find(&[]shared{}).Error; err != nil {
+		t.Errorf("query of a shared model: %v", err)
+	}
+
+	// System statements see every tenant, even from a tenant's context.
+	ctx := System(NewContext(context.Background(), 7))
+	if _, ok := FromContext(ctx); ok {
+		t.Error("System kept the tenant")
+	}
+	stmt := db.WithContext(ctx).Find(&[]owned{}).Statement
+	if stmt.Error != nil || strings.Contains(stmt.SQL.String(), "tenant_id") {
+		t.Errorf("system query: %s, %v", stmt.SQL.String(), stmt.Error)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	db := dryRunDB(t).WithContext(NewContext(context.Background(), 7))
+
+	row := owned{TenantID: 9, Name: "a"}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.TenantID != 7 {
+		t.Errorf("created with TenantID %d, want 7", row.TenantID)
+	}
+
+	for _, key := range []string{"TenantID", "tenant_id"} {
+		updates := map[string]interface{}{"name": "b", key: 9}
+		stmt := db.Model(&owned{ID: 1}).Updates(updates).Statement
+		if containsVar(stmt.Vars, 9) {
+			t.Errorf("an update naming %s moved the row: %s %v", key, stmt.SQL.String(), stmt.Vars)
+		}
+	}
+}
+
+func TestGuardGlobal(t *testing.T) {
+	db := dryRunDB(t).WithContext(NewContext(context.Background(), 7))
+	if err := db.Delete(&owned{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("delete without conditions: %v, want ErrMissingWhereClause", err)
+	}
+	if err := db.Model(&owned{}).Update("name", "b").Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("update without conditions: %v, want ErrMissingWhereClause", err)
+	}
+	if err := db.Where("name = ?", "a").Delete(&owned{}).Error; err != nil {
+		t.Errorf("delete with a condition: %v", err)
+	}
+	if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&owned{}).Error; err != nil {
+		t.Errorf("delete allowing global updates: %v", err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	db := dryRunDB(t)
+	ctx := NewContext(context.Background(), 7)
+	stmt := db.Session(&gorm.Session{}).Table("owneds").Scopes(Scope(ctx)).Find(&[]map[string]interface{}{}).Statement
+	if !strings.Contains(stmt.SQL.String(), "tenant_id") || !containsVar(stmt.Vars, 7) {
+		t.Errorf("Scope: %s %v", stmt.SQL.String(), stmt.Vars)
+	}
+	if err := db.Table("owneds").Scopes(Scope(context.Background())).Find(&[]map[string]interface{}{}).Error; !errors.Is(err, ErrMissing) {
+		t.Errorf("Scope without a tenant: %v, want ErrMissing", err)
+	}
+}
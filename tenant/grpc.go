@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"context"
+	"strconv"
+
+	"medically-core/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// MetadataKey names the tenant of a gRPC call, as Header does for HTTP
+// requests. It is likewise only trusted when tenancy.trust_header is set.
+const MetadataKey = "x-tenant-id"
+
+type dbContextKey struct{}
+
+// UnaryServerInterceptor is OptionalMiddleware for unary gRPC calls:
+// calls whose metadata names a tenant are scoped to it and, with
+// row-level security, get a connection restricted to it through
+// DBFromContext. Calls that name none pass without a tenant.
+func (r *Resolver) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := r.scopeCall(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+func (r *Resolver) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return r.scopeCall(ss.Context(), func(ctx context.Context) error {
+			return handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// scopeCall runs fn with the context of a call, scoped to its tenant if
+// it names one.
+func (r *Resolver) scopeCall(ctx context.Context, fn func(context.Context) error) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return fn(ctx)
+	}
+	if !r.cfg.TrustHeader {
+		return status.Error(codes.Unauthenticated, "tenant required")
+	}
+	id, err := strconv.Atoi(values[0])
+	if err != nil || id <= 0 {
+		return status.Error(codes.InvalidArgument, "invalid "+MetadataKey)
+	}
+
+	ctx = NewContext(ctx, id)
+	ctx = logging.NewContext(ctx, logging.FromContext(ctx).With(logging.Int("tenant_id", id)))
+	if !r.cfg.RowLevelSecurity {
+		return fn(ctx)
+	}
+	called := false
+	err = WithTenant(ctx, r.db, id, func(conn *gorm.DB) error {
+		called = true
+		return fn(context.WithValue(ctx, dbContextKey{}, conn))
+	})
+	if err != nil && !called {
+		logging.FromContext(ctx).Error("setting up tenant connection failed", logging.Err(err))
+		return status.Error(codes.Unavailable, "database unavailable")
+	}
+	return err
+}
+
+// DBFromContext is DB for gRPC calls: it returns the tenant connection
+// set up by the interceptors, or fallback, carrying ctx.
+func DBFromContext(ctx context.Context, fallback *gorm.DB) *gorm.DB {
+	db := fallback
+	if conn, ok := ctx.Value(dbContextKey{}).(*gorm.DB); ok {
+		db = conn
+	}
+	return db.WithContext(ctx)
+}
+
+// scopedStream is a server stream with the context of its tenant.
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
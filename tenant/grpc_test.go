@@ -0,0 +1,39 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"medically-core/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestScopeCall(t *testing.T) {
+	tests := []struct {
+		name  string
+		trust bool
+		md    metadata.MD
+		code  codes.Code
+		want  int
+	}{
+		{"no tenant", false, nil, codes.OK, 0},
+		{"untrusted", false, metadata.Pairs(MetadataKey, "7"), codes.Unauthenticated, 0},
+		{"trusted", true, metadata.Pairs(MetadataKey, "7"), codes.OK, 7},
+		{"invalid", true, metadata.Pairs(MetadataKey, "0"), codes.InvalidArgument, 0},
+	}
+	for _, tt := range tests {
+		r := NewResolver(nil, config.TenancyConfig{TrustHeader: tt.trust})
+		ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+		var got int
+		err := r.scopeCall(ctx, func(ctx context.Context) error {
+			got, _ = FromContext(ctx)
+			return nil
+		})
+		if status.Code(err) != tt.code || got != tt.want {
+			t.Errorf("%s: tenant %d, %v, want %d, %v", tt.name, got, err, tt.want, tt.code)
+		}
+	}
+}
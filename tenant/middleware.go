@@ -0,0 +1,151 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"medically-core/config"
+	"medically-core/logging"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Header names the tenant of a request when no authenticated principal
+// does. It is only trusted when tenancy.trust_header is set, i.e. behind a
+// gateway that authenticates clients and sets it.
+const Header = "X-Tenant-ID"
+
+// PrincipalTenantKey is the gin context key under which authentication
+// middleware stores the clinic ID of the authenticated principal.
+const PrincipalTenantKey = "principal_tenant"
+
+// dbKey is the gin context key of the tenant-scoped database handle.
+const dbKey = "tenant_db"
+
+// Resolver resolves the tenant of each request and sets up its database
+// access.
+type Resolver struct {
+	db  *gorm.DB
+	cfg config.TenancyConfig
+}
+
+// NewResolver creates a Resolver.
+func NewResolver(db *gorm.DB, cfg config.TenancyConfig) *Resolver {
+	return &Resolver{db: db, cfg: cfg}
+}
+
+// Middleware resolves the tenant from the authenticated principal or, if
+// trusted, the X-Tenant-ID header, and rejects requests without one. The
+// request context is scoped to the tenant and, with row-level security,
+// the handlers get a connection restricted to it through DB.
+func (r *Resolver) Middleware() gin.HandlerFunc {
+	return r.MiddlewareWith(func(c *gin.Context, status int, msg string) {
+		c.String(status, "error: "+msg)
+	})
+}
+
+// MiddlewareWith is Middleware answering rejected requests with fail, for
+// APIs with their own error format.
+func (r *Resolver) MiddlewareWith(fail func(c *gin.Context, status int, msg string)) gin.HandlerFunc {
+	return r.middleware(fail, r.cfg.RowLevelSecurity)
+}
+
+// StreamMiddleware is Middleware for long-lived requests, such as event
+// streams, that should not hold a database connection for as long as they
+// last. It only scopes the request context, so the handlers behind it
+// must not read tables under row-level security.
+func (r *Resolver) StreamMiddleware() gin.HandlerFunc {
+	return r.middleware(func(c *gin.Context, status int, msg string) {
+		c.String(status, "error: "+msg)
+	}, false)
+}
+
+// OptionalMiddleware is Middleware for routes that serve shared and
+// tenant-owned models alike: requests that name no tenant pass without
+// one, and statements on tenant-owned models then fail with ErrMissing.
+func (r *Resolver) OptionalMiddleware() gin.HandlerFunc {
+	scoped := r.Middleware()
+	return func(c *gin.Context) {
+		if _, ok := c.Get(PrincipalTenantKey); !ok && c.GetHeader(Header) == "" {
+			c.Next()
+			return
+		}
+		scoped(c)
+	}
+}
+
+func (r *Resolver) middleware(fail func(c *gin.Context, status int, msg string), rls bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, status, msg := r.resolve(c)
+		if status != 0 {
+			fail(c, status, msg)
+			c.Abort()
+			return
+		}
+
+		ctx := NewContext(c.Request.Context(), id)
+		ctx = logging.NewContext(ctx, logging.FromContext(ctx).With(logging.Int("tenant_id", id)))
+		c.Request = c.Request.WithContext(ctx)
+		if !rls {
+			c.Next()
+			return
+		}
+
+		err := WithTenant(ctx, r.db, id, func(conn *gorm.DB) error {
+			c.Set(dbKey, conn)
+			c.Next()
+			return nil
+		})
+		if err != nil && !c.Writer.Written() {
+			logging.FromContext(ctx).Error("setting up tenant connection failed", logging.Err(err))
+			fail(c, http.StatusServiceUnavailable, "database unavailable")
+			c.Abort()
+		}
+	}
+}
+
+func (r *Resolver) resolve(c *gin.Context) (int, int, string) {
+	header := c.GetHeader(Header)
+	if v, ok := c.Get(PrincipalTenantKey); ok {
+		id, _ := v.(int)
+		if header != "" && header != strconv.Itoa(id) {
+			return 0, http.StatusForbidden, "tenant does not match the authenticated principal"
+		}
+		return id, 0, ""
+	}
+	if header == "" || !r.cfg.TrustHeader {
+		return 0, http.StatusUnauthorized, "tenant required"
+	}
+	id, err := strconv.Atoi(header)
+	if err != nil || id <= 0 {
+		return 0, http.StatusBadRequest, "invalid " + Header
+	}
+	return id, 0, ""
+}
+
+// DB returns the database handle for the request: the tenant connection
+// set up by Middleware, or fallback. Either way it carries the request
+// context, which scopes GORM statements to the tenant.
+func DB(c *gin.Context, fallback *gorm.DB) *gorm.DB {
+	db := fallback
+	if v, ok := c.Get(dbKey); ok {
+		db = v.(*gorm.DB)
+	}
+	return db.WithContext(c.Request.Context())
+}
+
+// Run runs fn for tenant id outside of a request, such as in a background
+// job, with the same scoping Middleware gives requests: fn gets a handle
+// whose context is scoped to the tenant and, with row-level security, a
+// connection restricted to it.
+func (r *Resolver) Run(ctx context.Context, id int, fn func(*gorm.DB) error) error {
+	ctx = NewContext(ctx, id)
+	if !r.cfg.RowLevelSecurity {
+		return fn(r.db.WithContext(ctx))
+	}
+	return WithTenant(ctx, r.db, id, func(conn *gorm.DB) error {
+		return fn(conn.WithContext(ctx))
+	})
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"medically-core/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantRouter serves the tenant of each request at /, behind m, with
+// the principal's clinic set from the X-Principal test header.
+func tenantRouter(m func(*Resolver) gin.HandlerFunc, cfg config.TenancyConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if p := c.GetHeader("X-Principal"); p != "" {
+			id, _ := strconv.Atoi(p)
+			c.Set(PrincipalTenantKey, id)
+		}
+	})
+	r.GET("/", m(NewResolver(nil, cfg)), func(c *gin.Context) {
+		id, ok := FromContext(c.Request.Context())
+		if !ok {
+			c.String(http.StatusOK, "none")
+			return
+		}
+		c.String(http.StatusOK, strconv.Itoa(id))
+	})
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		header    string
+		principal string
+		status    int
+		body      string
+	}{
+		{"no tenant", true, "", "", http.StatusUnauthorized, ""},
+		{"untrusted header", false, "7", "", http.StatusUnauthorized, ""},
+		{"trusted header", true, "7", "", http.StatusOK, "7"},
+		{"invalid header", true, "seven", "", http.StatusBadRequest, ""},
+		{"negative header", true, "-7", "", http.StatusBadRequest, ""},
+		{"principal", false, "", "7", http.StatusOK, "7"},
+		{"principal with its own header", false, "7", "7", http.StatusOK, "7"},
+		{"principal with another header", true, "8", "7", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		r := tenantRouter((*Resolver).Middleware, config.TenancyConfig{TrustHeader: tt.trust})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set(Header, tt.header)
+		}
+		if tt.principal != "" {
+			req.Header.Set("X-Principal", tt.principal)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	r := tenantRouter((*Resolver).OptionalMiddleware, config.TenancyConfig{TrustHeader: true})
+	for header, want := range map[string]string{"": "none", "7": "7"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(Header, header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("header %q: %d %q, want %q", header, w.Code, w.Body.String(), want)
+		}
+	}
+}
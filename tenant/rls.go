@@ -0,0 +1,105 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session settings read by the row-level security policies.
+const (
+	settingTenant = "app.tenant_id"
+	settingBypass = "app.tenant_bypass"
+)
+
+// policy lets a session see and write the rows of the tenant in
+// app.tenant_id only, or every row when app.tenant_bypass is on. Rows of
+// a session without either setting are invisible.
+const policy = `current_setting('` + settingBypass + `', true) = 'on'
+	OR ` + column + ` = NULLIF(current_setting('` + settingTenant + `', true), '')::bigint`
+
+// InstallRLS enables and forces row-level security on the tables of the
+// given tenant-owned models. Forcing applies the policies to the table
+// owner too, which is the role the service migrates and connects with.
+// It is idempotent.
+func InstallRLS(db *gorm.DB, models ...interface{}) error {
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		if stmt.Schema.LookUpField(field) == nil {
+			return fmt.Errorf("%T has no %s field", m, field)
+		}
+		table := db.Statement.Quote(stmt.Schema.Table)
+		for _, sql := range []string{
+			"ALTER TABLE " + table + " ENABLE ROW LEVEL SECURITY",
+			"ALTER TABLE " + table + " FORCE ROW LEVEL SECURITY",
+			"DROP POLICY IF EXISTS tenant_isolation ON " + table,
+			"CREATE POLICY tenant_isolation ON " + table + " USING (" + policy + ") WITH CHECK (" + policy + ")",
+		} {
+			if err := db.Exec(sql).Error; err != nil {
+				return fmt.Errorf("installing row-level security on %s: %w", stmt.Schema.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// clearTimeout bounds clearing a session setting, which runs even after
+// the context of the statement is canceled.
+const clearTimeout = 5 * time.Second
+
+// withSetting runs fn on a single pooled connection on which the session
+// setting name is value, and clears the setting before the connection
+// returns to the pool.
+func withSetting(ctx context.Context, db *gorm.DB, name, value string, fn func(*gorm.DB) error) error {
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT set_config(?, ?, false)", name, value).Error; err != nil {
+			return err
+		}
+		defer func() {
+			// The setting is cleared on a context of its own, as a client
+			// that disconnects cancels ctx. A connection that cannot be
+			// cleared is closed rather than pooled, as it would lend the
+			// setting, possibly the bypass, to whoever uses it next.
+			clearCtx, cancel := context.WithTimeout(context.Background(), clearTimeout)
+			defer cancel()
+			if err := conn.WithContext(clearCtx).Exec("SELECT set_config(?, '', false)", name).Error; err != nil {
+				log.Printf("tenant: clearing %s, closing the connection: %v", name, err)
+				discard(conn)
+			}
+		}()
+		return fn(conn)
+	})
+}
+
+// discard closes the connection conn runs on instead of returning it to
+// the pool.
+func discard(conn *gorm.DB) {
+	if c, ok := conn.Statement.ConnPool.(*sql.Conn); ok {
+		c.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// WithTenant runs fn on a connection that row-level security restricts to
+// tenant id.
+func WithTenant(ctx context.Context, db *gorm.DB, id int, fn func(*gorm.DB) error) error {
+	return withSetting(ctx, db, settingTenant, strconv.Itoa(id), fn)
+}
+
+// AsSystem runs fn with access to every tenant, both through GORM and
+// row-level security. It is meant for migrations and background jobs that
+// act on behalf of no single clinic.
+func AsSystem(ctx context.Context, db *gorm.DB, fn func(*gorm.DB) error) error {
+	ctx = System(ctx)
+	return withSetting(ctx, db, settingBypass, "on", func(conn *gorm.DB) error {
+		return fn(conn.WithContext(ctx))
+	})
+}
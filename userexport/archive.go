@@ -0,0 +1,112 @@
+package userexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// writeSection writes records to zw as name.json, an array, and name.csv,
+// a row per record under a header of their JSON fields.
+func writeSection(zw *zip.Writer, name string, records interface{}, modified time.Time) error {
+	rv := reflect.Indirect(reflect.ValueOf(records))
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("records of %s are a %s, not a slice", name, rv.Kind())
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if rv.Len() == 0 {
+		// A nil slice would be written as null.
+		data = []byte("[]")
+	}
+	if err := writeFile(zw, name+".json", modified, data); err != nil {
+		return err
+	}
+
+	columns := jsonFields(rv.Type().Elem())
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		row, err := csvRow(rv.Index(i).Interface(), columns)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeFile(zw, name+".csv", modified, buf.Bytes())
+}
+
+func writeFile(zw *zip.Writer, name string, modified time.Time, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// jsonFields returns the names of the JSON fields of struct type t, in
+// order.
+func jsonFields(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// csvRow returns the values of the columns of record as encoded in JSON.
+// Strings are written as they are, missing and null values as empty
+// cells, and objects and arrays as JSON.
+func csvRow(record interface{}, columns []string) ([]string, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	row := make([]string, len(columns))
+	for i, name := range columns {
+		raw := fields[name]
+		var s string
+		switch {
+		case len(raw) == 0 || string(raw) == "null":
+		case json.Unmarshal(raw, &s) == nil:
+			row[i] = s
+		default:
+			row[i] = string(raw)
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,124 @@
+package userexport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"medically-core/logging"
+	"medically-core/storage"
+	"medically-core/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Request starts an export of the data of user userID, who the caller
+// checked belongs to the clinic of the request, and answers 202 with it.
+// While an export of the user is running, it is answered instead.
+func (e *Exporter) Request(c *gin.Context, db *gorm.DB, userID int) {
+	var x Export
+	err := db.Where("user_id = ? AND status IN ?", userID, []string{statusAccepted, statusInProgress}).
+		Order("created_at").Take(&x).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		x = Export{ID: randomID(), UserID: userID, Status: statusAccepted, BaseURL: e.baseURL}
+		if err := db.Create(&x).Error; err != nil {
+			internalError(c, err)
+			return
+		}
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	case err != nil:
+		internalError(c, err)
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/user/%d/export/%s", userID, x.ID))
+	c.JSON(http.StatusAccepted, &x)
+}
+
+// Status answers the export named by the exportID parameter of user
+// userID, with a fresh link if it can be downloaded.
+func (e *Exporter) Status(c *gin.Context, db *gorm.DB, userID int) {
+	var x Export
+	err := db.Take(&x, "id = ? AND user_id = ?", c.Param("exportID"), userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if x.Status == statusCompleted && x.ExpiresAt.After(time.Now()) {
+		x.URL = e.link(&x)
+	}
+	c.JSON(http.StatusOK, &x)
+}
+
+// Download serves the archive of an export to holders of its link,
+// without a tenant. It supports range requests, so interrupted downloads
+// can be resumed.
+func (e *Exporter) Download(c *gin.Context) {
+	id := c.Param("exportID")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || !e.keyring.Verify(linkPurpose, linkMessage(id, expires), c.Query("signature")) {
+		c.String(http.StatusForbidden, "error: invalid link")
+		return
+	}
+	if time.Now().Unix() >= expires {
+		c.String(http.StatusGone, "error: link expired")
+		return
+	}
+
+	ctx := tenant.System(c.Request.Context())
+	var x Export
+	err = e.db.WithContext(ctx).Take(&x, "id = ? AND status = ?", id, statusCompleted).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	obj, info, err := e.store.Open(ctx, x.key())
+	if errors.Is(err, storage.ErrNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	defer obj.Close()
+	c.Header("Content-Type", ZIPType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="medically-export-%s.zip"`, x.ID))
+	c.Header("Cache-Control", "private, no-store")
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, obj)
+}
+
+// link returns the signed download link of x, which expires with it.
+func (e *Exporter) link(x *Export) string {
+	expires := x.ExpiresAt.Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", e.keyring.Sign(linkPurpose, linkMessage(x.ID, expires)))
+	return e.baseURL + "/exports/" + x.ID + "?" + q.Encode()
+}
+
+func linkMessage(id string, expires int64) []byte {
+	return []byte(id + "\n" + strconv.FormatInt(expires, 10))
+}
+
+// internalError logs err and answers 500 without echoing it.
+func internalError(c *gin.Context, err error) {
+	ctx := c.Request.Context()
+	logging.FromContext(ctx).Error("request failed", logging.Err(err))
+	c.String(http.StatusInternalServerError, fmt.Sprintf("error: internal error (request id %s)", logging.RequestIDFrom(ctx)))
+}
@@ -0,0 +1,353 @@
+// Package userexport assembles the copy of their data a patient is
+// entitled to: a ZIP archive with a JSON and a CSV file for each section
+// of their record.
+//
+// A request records an export in the "user_exports" table. As with bulk
+// exports, every replica runs a worker that claims pending exports and
+// writes their archive to a storage.Store, so any replica can serve it.
+// Archives are downloaded through signed links that expire with them,
+// so the link can be sent to the patient.
+package userexport
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"medically-core/config"
+	"medically-core/encryption"
+	"medically-core/storage"
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+)
+
+// ZIPType is the media type of the archives.
+const ZIPType = "application/zip"
+
+// Export statuses. Expired exports are kept, without their archive, as a
+// record of what was handed out.
+const (
+	statusAccepted   = "accepted"
+	statusInProgress = "in-progress"
+	statusCompleted  = "completed"
+	statusFailed     = "failed"
+	statusExpired    = "expired"
+)
+
+const (
+	// pollInterval is how often workers look for pending exports.
+	pollInterval = 5 * time.Second
+	// staleAfter is how long after its last heartbeat another worker may
+	// take an export over.
+	staleAfter = 2 * time.Minute
+	// sweepInterval is how often expired archives are deleted.
+	sweepInterval = time.Hour
+	// linkPurpose is the purpose download links are signed for.
+	linkPurpose = "user-export"
+)
+
+// errLost is returned when a worker finds that another worker took its
+// export over.
+var errLost = errors.New("user export taken over")
+
+// Section exports one part of a user's record, such as their
+// prescriptions.
+type Section struct {
+	// Name names the files of the section, as Name.json and Name.csv.
+	Name string
+	// Export returns the records of the user, a slice of structs or a
+	// pointer to one, read through db.
+	Export func(db *gorm.DB, userID int) (interface{}, error)
+}
+
+// Export is an export of the data of a user, in the "user_exports"
+// table. It belongs to the clinic of the user.
+type Export struct {
+	ID       string `json:"id" gorm:"primaryKey"`
+	TenantID int    `json:"-" gorm:"index"`
+	UserID   int    `json:"userId" gorm:"not null;index"`
+	Status   string `json:"status" gorm:"not null;index"`
+	Error    string `json:"error,omitempty"`
+	// BaseURL is the public URL of the service when the export was asked
+	// for. Links are made with the configured URL.
+	BaseURL string `json:"-" gorm:"not null"`
+	Size    int64  `json:"size,omitempty"`
+	// Claim identifies the worker running the export.
+	Claim       string     `json:"-"`
+	HeartbeatAt time.Time  `json:"-"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	// URL is the signed download link of a completed export. It is made
+	// when the export is read, and not stored.
+	URL string `json:"url,omitempty" gorm:"-"`
+}
+
+// TableName implements gorm's tabler.
+func (Export) TableName() string {
+	return "user_exports"
+}
+
+func (x *Export) key() string {
+	return "user-exports/" + x.ID + "/export.zip"
+}
+
+// ReadyFunc is called in the transaction that completes an export, with
+// its link set, e.g. to notify the user.
+type ReadyFunc func(db *gorm.DB, x *Export) error
+
+// Exporter runs user exports and serves their archives.
+type Exporter struct {
+	db       *gorm.DB
+	store    storage.Store
+	tenancy  *tenant.Resolver
+	keyring  *encryption.Keyring
+	expiry   time.Duration
+	baseURL  string
+	sections []Section
+	ready    ReadyFunc
+	wake     chan struct{}
+}
+
+// New creates an Exporter of sections, creating the exports table if
+// needed. Download links are signed with keys of keyring.
+func New(db *gorm.DB, store storage.Store, tenancy *tenant.Resolver, keyring *encryption.Keyring, cfg config.UserExportConfig, ready ReadyFunc, sections ...Section) (*Exporter, error) {
+	if err := db.AutoMigrate(&Export{}); err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		db:       db,
+		store:    store,
+		tenancy:  tenancy,
+		keyring:  keyring,
+		expiry:   cfg.Expiry,
+		baseURL:  strings.TrimSuffix(cfg.PublicURL, "/"),
+		sections: sections,
+		ready:    ready,
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Run runs pending exports and expires old ones until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	ctx = tenant.System(ctx)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastSweep := time.Time{}
+	for {
+		for {
+			x, err := e.claim(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.Printf("userexport: claiming an export: %v", err)
+				}
+				break
+			}
+			if x == nil {
+				break
+			}
+			e.run(ctx, x)
+		}
+		if time.Since(lastSweep) > sweepInterval {
+			if err := e.sweep(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("userexport: expiring exports: %v", err)
+			}
+			lastSweep = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+// claim takes a pending export, or one whose worker stopped, for this
+// worker. It returns nil when there is none.
+func (e *Exporter) claim(ctx context.Context) (*Export, error) {
+	db := e.db.WithContext(ctx)
+	stale := time.Now().Add(-staleAfter)
+	var candidates []Export
+	err := db.Where("status = ? OR (status = ? AND heartbeat_at < ?)", statusAccepted, statusInProgress, stale).
+		Order("created_at").Limit(10).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range candidates {
+		claim := randomID()
+		now := time.Now()
+		// Only one worker can move the export from the state it was read
+		// in.
+		res := db.Model(&Export{}).
+			Where("id = ? AND status = ? AND heartbeat_at = ?", x.ID, x.Status, x.HeartbeatAt).
+			Updates(map[string]interface{}{"status": statusInProgress, "claim": claim, "heartbeat_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			x.Status, x.Claim, x.HeartbeatAt = statusInProgress, claim, now
+			return &x, nil
+		}
+	}
+	return nil, nil
+}
+
+// run writes the archive of x and records the outcome, calling the
+// ReadyFunc once it is complete.
+func (e *Exporter) run(ctx context.Context, x *Export) {
+	size, writeErr := e.write(ctx, x)
+	if errors.Is(writeErr, errLost) || errors.Is(writeErr, context.Canceled) {
+		return
+	}
+	err := e.tenancy.Run(ctx, x.TenantID, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			updates := map[string]interface{}{"completed_at": now}
+			if writeErr != nil {
+				log.Printf("userexport: export %s failed: %v", x.ID, writeErr)
+				updates["status"] = statusFailed
+				updates["error"] = "export failed"
+			} else {
+				x.Status, x.Size, x.CompletedAt = statusCompleted, size, &now
+				expires := now.Add(e.expiry)
+				x.ExpiresAt = &expires
+				updates["status"], updates["size"], updates["expires_at"] = statusCompleted, size, expires
+			}
+			res := tx.Model(&Export{}).Where("id = ? AND claim = ?", x.ID, x.Claim).Updates(updates)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 && writeErr == nil {
+				return e.orphaned(ctx, tx, x)
+			}
+			if res.RowsAffected == 0 || writeErr != nil {
+				return nil
+			}
+			x.URL = e.link(x)
+			return e.ready(tx, x)
+		})
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("userexport: recording export %s: %v", x.ID, err)
+	}
+}
+
+// write writes the archive of x to the store, returning its size.
+func (e *Exporter) write(ctx context.Context, x *Export) (int64, error) {
+	tmp, err := ioutil.TempFile("", "user-export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	err = e.tenancy.Run(ctx, x.TenantID, func(db *gorm.DB) error {
+		for _, s := range e.sections {
+			if err := e.heartbeat(ctx, x); err != nil {
+				return err
+			}
+			records, err := s.Export(db, x.UserID)
+			if err != nil {
+				return fmt.Errorf("exporting %s: %w", s.Name, err)
+			}
+			if err := writeSection(zw, s.Name, records, x.CreatedAt); err != nil {
+				return fmt.Errorf("writing %s: %w", s.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, e.store.Put(ctx, x.key(), tmp, size, ZIPType)
+}
+
+// heartbeat records that x is still running, returning errLost if
+// another worker took it over.
+func (e *Exporter) heartbeat(ctx context.Context, x *Export) error {
+	res := e.db.WithContext(ctx).Model(&Export{}).Where("id = ? AND claim = ?", x.ID, x.Claim).
+		Update("heartbeat_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errLost
+	}
+	return nil
+}
+
+// sweep deletes the archives of the exports that expired.
+func (e *Exporter) sweep(ctx context.Context) error {
+	db := e.db.WithContext(ctx)
+	var expired []Export
+	if err := db.Where("status = ? AND expires_at < ?", statusCompleted, time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, x := range expired {
+		if err := e.store.DeleteDir(ctx, "user-exports/"+x.ID); err != nil {
+			return err
+		}
+		if err := db.Model(&x).Update("status", statusExpired).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Erase deletes the exports of a user and their archives on db, when the
+// user is erased, and returns how many there were. Signed links to them
+// stop working.
+func (e *Exporter) Erase(db *gorm.DB, userID int) (int64, error) {
+	var exports []Export
+	if err := db.Where("user_id = ?", userID).Find(&exports).Error; err != nil {
+		return 0, err
+	}
+	for _, x := range exports {
+		if err := e.store.DeleteDir(db.Statement.Context, "user-exports/"+x.ID); err != nil {
+			return 0, err
+		}
+	}
+	res := db.Where("user_id = ?", userID).Delete(&Export{})
+	return res.RowsAffected, res.Error
+}
+
+// orphaned deletes the archive just written for x if x was deleted, by
+// Erase, while it ran.
+func (e *Exporter) orphaned(ctx context.Context, db *gorm.DB, x *Export) error {
+	var n int64
+	if err := db.Model(&Export{}).Where("id = ?", x.ID).Count(&n).Error; err != nil || n > 0 {
+		return err
+	}
+	return e.store.DeleteDir(ctx, "user-exports/"+x.ID)
+}
+
+func randomID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"medically-core/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webhookEvents are the event types partner systems can subscribe to: a
+// change to an entity is "<entity>.<created|updated|deleted>".
+var webhookEvents = func() []string {
+	var events []string
+	for _, entity := range []string{"user", "med", "disease", "clinic"} {
+		for _, change := range []string{"created", "updated", "deleted"} {
+			events = append(events, entity+"."+change)
+		}
+	}
+	return events
+}()
+
+// ----------------------------  Webhook Server Methods ---------------------------------//
+
+// getWebhooks lists the subscriptions of the clinic, without their
+// secrets.
+func (s *Server) getWebhooks(c *gin.Context) {
+	var subs []webhooks.Subscription
+	if err := s.dbFor(c).Order("id").Find(&subs).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// createWebhook subscribes an endpoint. The response holds the secret
+// deliveries are signed with; it is not shown again.
+func (s *Server) createWebhook(c *gin.Context) {
+	var sub webhooks.Subscription
+	if err := BindJSON(c, &sub); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	err := s.changes.hooks.Subscribe(s.dbFor(c), &sub)
+	if errors.Is(err, webhooks.ErrInvalidSubscription) {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+func (s *Server) getWebhook(c *gin.Context) {
+	sub, ok := s.findWebhook(c)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, sub)
+}
+
+// updateWebhook changes a subscription. Setting active re-enables a
+// subscription that was disabled after failing.
+func (s *Server) updateWebhook(c *gin.Context) {
+	var sub webhooks.Subscription
+	if err := BindJSON(c, &sub); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+		return
+	}
+	id, err := strconv.Atoi(c.Param("subscriptionID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	sub.ID = id
+	err = s.changes.hooks.Update(s.dbFor(c), &sub)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.String(http.StatusNotFound, "error: record not found")
+	case errors.Is(err, webhooks.ErrInvalidSubscription):
+		c.String(http.StatusBadRequest, fmt.Sprintf("error: %s", err))
+	case err != nil:
+		internalError(c, err)
+	default:
+		sub.Secret = ""
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+// deleteWebhook removes a subscription and its delivery log.
+func (s *Server) deleteWebhook(c *gin.Context) {
+	subID := c.Param("subscriptionID")
+	var deleted int64
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		req := tx.Delete(webhooks.Subscription{}, "id = ?", subID)
+		if deleted = req.RowsAffected; req.Error != nil || deleted == 0 {
+			return req.Error
+		}
+		return tx.Delete(webhooks.Delivery{}, "subscription_id = ?", subID).Error
+	})
+	if err != nil {
+		internalError(c, err)
+	} else if deleted == 0 {
+		c.String(http.StatusNotFound, "error: record not found")
+	} else {
+		c.JSON(http.StatusOK, subID)
+	}
+}
+
+// getWebhookDeliveries lists the latest deliveries of a subscription,
+// optionally only those with the given status.
+func (s *Server) getWebhookDeliveries(c *gin.Context) {
+	sub, ok := s.findWebhook(c)
+	if !ok {
+		return
+	}
+	db := s.dbFor(c).Where("subscription_id = ?", sub.ID).Order("id DESC").Limit(100)
+	if status, ok := c.GetQuery("status"); ok {
+		db = db.Where("status = ?", status)
+	}
+	var deliveries []webhooks.Delivery
+	if err := db.Find(&deliveries).Error; err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// redeliverWebhook sends the event of a delivery again.
+func (s *Server) redeliverWebhook(c *gin.Context) {
+	var delivery webhooks.Delivery
+	err := s.dbFor(c).Take(&delivery, "id = ? AND subscription_id = ?", c.Param("deliveryID"), c.Param("subscriptionID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	again, err := s.changes.hooks.Redeliver(s.dbFor(c), &delivery)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, again)
+}
+
+// findWebhook loads the subscription named by the subscriptionID
+// parameter, answering 404 if the clinic has none.
+func (s *Server) findWebhook(c *gin.Context) (*webhooks.Subscription, bool) {
+	var sub webhooks.Subscription
+	err := s.dbFor(c).Take(&sub, "id = ?", c.Param("subscriptionID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.String(http.StatusNotFound, "error: record not found")
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	return &sub, true
+}
+
+// ------------------------------- ------------------- ------------------------------------//
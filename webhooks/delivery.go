@@ -0,0 +1,236 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+)
+
+// Delivery statuses. A delivery is sending while a worker holds it; if
+// the worker stops, it is taken over once sendLease expires.
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	sendLease    = time.Minute
+	batchSize    = 50
+	// Retries back off exponentially from firstRetry up to maxRetry.
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+)
+
+// Headers of a delivery. The signature is the hex HMAC-SHA256, under the
+// subscription's secret, of the timestamp, a dot and the body; receivers
+// should reject old timestamps to stop replays.
+const (
+	HeaderEvent     = "X-Medically-Event"
+	HeaderDelivery  = "X-Medically-Delivery"
+	HeaderTimestamp = "X-Medically-Timestamp"
+	HeaderSignature = "X-Medically-Signature"
+)
+
+// Delivery is an event posted to one subscription, in the
+// "webhook_deliveries" table. Together they are the delivery log: each
+// records the outcome of its last attempt. Payloads may hold patient
+// data and are encrypted.
+type Delivery struct {
+	ID             int        `json:"id"`
+	TenantID       int        `json:"-" gorm:"index"`
+	UserID         int        `json:"-" gorm:"index"`
+	SubscriptionID int        `json:"subscriptionId" gorm:"not null;index"`
+	EventID        string     `json:"eventId" gorm:"not null"`
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        string     `json:"-" gorm:"not null;serializer:encrypted" phi:"true"`
+	Redelivery     bool       `json:"redelivery,omitempty"`
+	Status         string     `json:"status" gorm:"not null;index:idx_webhook_deliveries_due"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" gorm:"index:idx_webhook_deliveries_due"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"-"`
+}
+
+// TableName implements gorm's tabler.
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Run delivers due events until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ctx = tenant.System(ctx)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			sent, err := d.sendDue(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("webhooks: delivering: %v", err)
+			}
+			if err != nil || sent < batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// sendDue delivers a batch of due events and returns how many it
+// claimed.
+func (d *Dispatcher) sendDue(ctx context.Context) (int, error) {
+	db := d.db.WithContext(ctx)
+	now := time.Now()
+	var due []Delivery
+	err := db.Where("status IN ? AND next_attempt_at <= ?", []string{StatusPending, StatusSending}, now).
+		Order("next_attempt_at").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range due {
+		dl := &due[i]
+		// Only one worker can move the delivery from the state it was
+		// read in.
+		res := db.Model(&Delivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", dl.ID, dl.Status, dl.Attempts).
+			Updates(map[string]interface{}{"status": StatusSending, "attempts": dl.Attempts + 1, "next_attempt_at": now.Add(sendLease)})
+		if res.Error != nil {
+			return i, res.Error
+		}
+		if res.RowsAffected == 1 {
+			dl.Attempts++
+			d.send(ctx, dl)
+		}
+	}
+	return len(due), nil
+}
+
+// send posts dl to its subscription and records the outcome.
+func (d *Dispatcher) send(ctx context.Context, dl *Delivery) {
+	db := d.db.WithContext(ctx)
+	var sub Subscription
+	err := db.Take(&sub, "id = ?", dl.SubscriptionID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		d.record(ctx, dl, 0, errors.New("subscription was deleted"), true)
+		return
+	case err != nil:
+		d.record(ctx, dl, 0, err, false)
+		return
+	case !sub.Active:
+		d.record(ctx, dl, 0, errors.New("subscription is disabled"), true)
+		return
+	}
+
+	status, err := d.post(ctx, &sub, dl)
+	d.record(ctx, dl, status, err, false)
+
+	// Only failures of the endpoint count towards disabling it.
+	if err == nil {
+		if sub.Failures > 0 {
+			if err := db.Model(&sub).Update("failures", 0).Error; err != nil {
+				log.Printf("webhooks: resetting failures of subscription %d: %v", sub.ID, err)
+			}
+		}
+		return
+	}
+	res := db.Model(&Subscription{}).Where("id = ?", sub.ID).Update("failures", gorm.Expr("failures + 1"))
+	if res.Error == nil {
+		res = db.Model(&Subscription{}).
+			Where("id = ? AND active AND failures >= ?", sub.ID, d.cfg.DisableAfter).
+			Updates(map[string]interface{}{"active": false, "disabled_at": time.Now()})
+	}
+	if res.Error != nil {
+		log.Printf("webhooks: recording failures of subscription %d: %v", sub.ID, res.Error)
+	} else if res.RowsAffected == 1 {
+		log.Printf("webhooks: disabled subscription %d after %d consecutive failures", sub.ID, d.cfg.DisableAfter)
+	}
+}
+
+// post sends the signed payload of dl and returns the response status.
+// Any status but 2xx is a failure.
+func (d *Dispatcher) post(ctx context.Context, sub *Subscription, dl *Delivery) (int, error) {
+	body := []byte(dl.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "medically-webhooks")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, dl.EventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a delivery body sent at
+// timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record stores the outcome of an attempt at dl. Failed attempts are
+// retried unless final is set or the attempts are used up.
+func (d *Dispatcher) record(ctx context.Context, dl *Delivery, status int, err error, final bool) {
+	now := time.Now()
+	update := map[string]interface{}{"status": StatusSent, "response_status": status, "delivered_at": now, "last_error": ""}
+	if err != nil {
+		update = map[string]interface{}{"status": StatusPending, "response_status": status, "next_attempt_at": now.Add(backoff(dl.Attempts)), "last_error": err.Error()}
+		if final || dl.Attempts >= d.cfg.MaxAttempts {
+			update["status"] = StatusFailed
+		}
+	}
+	if err := d.db.WithContext(ctx).Model(&Delivery{}).Where("id = ?", dl.ID).Updates(update).Error; err != nil {
+		log.Printf("webhooks: recording delivery %d: %v", dl.ID, err)
+	}
+}
+
+// backoff returns how long to wait before the next of attempts.
+func backoff(attempts int) time.Duration {
+	d := firstRetry
+	for i := 1; i < attempts && d < maxRetry; i++ {
+		d *= 2
+	}
+	if d > maxRetry {
+		d = maxRetry
+	}
+	return d
+}
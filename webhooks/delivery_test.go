@@ -0,0 +1,70 @@
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"user.created"}`)
+	want := "be54c9b0b1bfcb889662e9b74778f194903a82691c8323f7bf085ca53892ee78"
+	if got := Sign("whsec_test", "1700000000", body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	for name, sig := range map[string]string{
+		"another secret":    Sign("whsec_other", "1700000000", body),
+		"another timestamp": Sign("whsec_test", "1700000001", body),
+		"another body":      Sign("whsec_test", "1700000000", []byte(`{"event":"user.deleted"}`)),
+	} {
+		if sig == want {
+			t.Errorf("%s gives the same signature", name)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	dl := &Delivery{EventID: "evt_1", Event: "user.created", Payload: `{"id":1}`}
+	sub := &Subscription{Secret: "whsec_test"}
+	var verified bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Receivers check the signature as documented.
+		body, _ := ioutil.ReadAll(r.Body)
+		sig := strings.TrimPrefix(r.Header.Get(HeaderSignature), "sha256=")
+		verified = sig == Sign(sub.Secret, r.Header.Get(HeaderTimestamp), body) &&
+			r.Header.Get(HeaderEvent) == dl.Event && r.Header.Get(HeaderDelivery) == dl.EventID
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	sub.URL = srv.URL
+
+	d := &Dispatcher{client: &http.Client{Transport: newTransport(true)}}
+	status, err := d.post(context.Background(), sub, dl)
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("post = %d, %v", status, err)
+	}
+	if !verified {
+		t.Error("the receiver could not verify the delivery")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, firstRetry},
+		{2, 2 * firstRetry},
+		{3, 4 * firstRetry},
+		{100, maxRetry},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// blockedNets are the ranges, besides loopback, private and link-local
+// addresses, that subscriptions must not reach: they belong to the
+// network the service runs in rather than to partner systems.
+var blockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved, and broadcast
+		"64:ff9b::/96",  // NAT64, which maps onto IPv4
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// blocked reports whether ip is an address webhooks are not posted to,
+// such as 127.0.0.1, 10.0.0.1 or the cloud metadata endpoint at
+// 169.254.169.254.
+func blocked(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// errBlocked is returned for connections to blocked addresses.
+type errBlocked struct{ addr string }
+
+func (e *errBlocked) Error() string {
+	return fmt.Sprintf("webhook endpoint %s is not a public address", e.addr)
+}
+
+// newTransport returns the transport webhooks are posted with. Unless
+// allowPrivate is set, it refuses to connect to blocked addresses. The
+// check runs on the address actually dialed, after name resolution, so a
+// name that resolves, or later rebinds, to an internal address is refused
+// too. Proxies from the environment are not used, as they would dial on
+// the service's behalf.
+func newTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blocked(ip) {
+				return &errBlocked{address}
+			}
+			return nil
+		}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
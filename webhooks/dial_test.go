@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlocked(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true}, // IPv4-mapped loopback
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"::ffff:192.168.1.1", true},
+		{"fd00::1", true},
+		{"169.254.169.254", true}, // cloud metadata
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"100.64.0.1", true},
+		{"192.0.0.8", true},
+		{"198.18.0.1", true},
+		{"255.255.255.255", true},
+		{"224.0.0.1", true},
+		{"ff02::1", true},
+		{"64:ff9b::7f00:1", true}, // NAT64 of 127.0.0.1
+		{"64:ff9b::a9fe:a9fe", true},
+		{"8.8.8.8", false},
+		{"::ffff:8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+		{"100.128.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := blocked(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blocked(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTransport(false)}
+	_, err := client.Get(srv.URL)
+	var refused *errBlocked
+	if !errors.As(err, &refused) {
+		t.Errorf("posting to %s: %v, want the address refused", srv.URL, err)
+	}
+
+	client = &http.Client{Transport: newTransport(true)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("posting to %s with private addresses allowed: %v", srv.URL, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,248 @@
+// Package webhooks tells partner systems about changes by posting events
+// to the URLs they subscribed. Events are queued in the transaction of
+// the change, signed with the subscription's secret and retried with
+// exponential backoff; subscriptions whose endpoint keeps failing are
+// disabled.
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"medically-core/config"
+	"medically-core/tenant"
+
+	"gorm.io/gorm"
+)
+
+// Subscription is an endpoint that receives the events it lists, in the
+// "webhook_subscriptions" table. An event type is matched exactly, by
+// "entity.*" or by "*". Failures counts the consecutive failed attempts;
+// the subscription is disabled when it reaches the configured limit.
+type Subscription struct {
+	ID          int        `json:"id"`
+	TenantID    int        `json:"-" gorm:"index"`
+	URL         string     `json:"url" gorm:"not null"`
+	Events      []string   `json:"events" gorm:"serializer:json"`
+	Description string     `json:"description,omitempty"`
+	Secret      string     `json:"secret,omitempty" gorm:"not null;serializer:encrypted"`
+	Active      bool       `json:"active"`
+	Failures    int        `json:"failures"`
+	DisabledAt  *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// TableName implements gorm's tabler.
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// matches reports whether the subscription receives events of type t.
+func (s *Subscription) matches(t string) bool {
+	for _, e := range s.Events {
+		if e == "*" || e == t || strings.HasSuffix(e, ".*") && strings.HasPrefix(t, e[:len(e)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change to an entity. Events on an entity owned by a clinic
+// (TenantID) only reach the clinic's subscriptions; events on shared
+// entities reach every subscription. UserID is the user an event is
+// about, if any, so its deliveries can be deleted with the user.
+type Event struct {
+	Type     string
+	TenantID int
+	UserID   int
+	Data     interface{}
+}
+
+// envelope is the body posted for an event. ID is the same for every
+// delivery of the event, so receivers can drop duplicates.
+type envelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher queues events and delivers them.
+type Dispatcher struct {
+	db     *gorm.DB
+	events map[string]bool
+	cfg    config.WebhooksConfig
+	client *http.Client
+	wake   chan struct{}
+}
+
+// New creates a Dispatcher for the given event types, creating its tables
+// if needed.
+func New(db *gorm.DB, cfg config.WebhooksConfig, events ...string) (*Dispatcher, error) {
+	if err := db.AutoMigrate(&Subscription{}, &Delivery{}); err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, e := range events {
+		known[e] = true
+		known[e[:strings.IndexByte(e, '.')+1]+"*"] = true
+	}
+	client := &http.Client{
+		Transport: newTransport(cfg.AllowPrivate),
+		Timeout:   cfg.Timeout,
+		// A redirected POST would turn into a GET; the subscription
+		// should name the final URL.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Dispatcher{db: db, events: known, cfg: cfg, client: client, wake: make(chan struct{}, 1)}, nil
+}
+
+// ErrInvalidSubscription is wrapped by the errors of Subscribe and Update
+// about the subscription itself.
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+// Subscribe validates and stores a new subscription. Unless one is
+// given, it generates the secret events are signed with.
+func (d *Dispatcher) Subscribe(db *gorm.DB, s *Subscription) error {
+	if s.Secret == "" {
+		var b [32]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		s.Secret = hex.EncodeToString(b[:])
+	}
+	s.ID, s.Active, s.Failures, s.DisabledAt = 0, true, 0, nil
+	if err := d.validate(s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	return db.Create(s).Error
+}
+
+// Update changes the URL, events, description and state of a stored
+// subscription. Activating a disabled subscription clears its failures;
+// its failed deliveries can then be redelivered. The secret is kept.
+func (d *Dispatcher) Update(db *gorm.DB, s *Subscription) error {
+	var stored Subscription
+	if err := db.Take(&stored, "id = ?", s.ID).Error; err != nil {
+		return err
+	}
+	s.Secret = stored.Secret
+	if err := d.validate(s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	s.Failures, s.DisabledAt = stored.Failures, stored.DisabledAt
+	if s.Active {
+		s.Failures, s.DisabledAt = 0, nil
+	} else if stored.Active {
+		now := time.Now()
+		s.DisabledAt = &now
+	}
+	s.CreatedAt = stored.CreatedAt
+	return db.Model(&stored).Select("url", "events", "description", "active", "failures", "disabled_at").Updates(s).Error
+}
+
+func (d *Dispatcher) validate(s *Subscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && d.cfg.AllowHTTP)) {
+		if d.cfg.AllowHTTP {
+			return errors.New("url must be an http or https URL")
+		}
+		return errors.New("url must be an https URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); !d.cfg.AllowPrivate && (u.Hostname() == "localhost" || ip != nil && blocked(ip)) {
+		return errors.New("url must name a public host")
+	}
+	if len(s.Events) == 0 {
+		return errors.New("events must name at least one event type")
+	}
+	for _, e := range s.Events {
+		if e != "*" && !d.events[e] {
+			return fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	return nil
+}
+
+// Publish queues e for every active subscription that receives it. Queued
+// in a transaction, it is only delivered if the transaction commits.
+func (d *Dispatcher) Publish(db *gorm.DB, e Event) error {
+	// Subscriptions of every clinic may receive events on shared
+	// entities.
+	db = db.WithContext(tenant.System(db.Statement.Context))
+	q := db.Select("id", "tenant_id", "events").Where("active")
+	if e.TenantID != 0 {
+		q = q.Where("tenant_id = ?", e.TenantID)
+	}
+	var subs []Subscription
+	if err := q.Find(&subs).Error; err != nil {
+		return err
+	}
+	var deliveries []Delivery
+	for i := range subs {
+		if subs[i].matches(e.Type) {
+			deliveries = append(deliveries, Delivery{TenantID: subs[i].TenantID, UserID: e.UserID, SubscriptionID: subs[i].ID})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	now := time.Now()
+	payload, err := json.Marshal(envelope{ID: hex.EncodeToString(id[:]), Type: e.Type, CreatedAt: now.UTC(), Data: e.Data})
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		dl := &deliveries[i]
+		dl.EventID, dl.Event, dl.Payload = hex.EncodeToString(id[:]), e.Type, string(payload)
+		dl.Status, dl.NextAttemptAt = StatusPending, now
+	}
+	if err := db.Create(&deliveries).Error; err != nil {
+		return err
+	}
+	d.notify()
+	return nil
+}
+
+// Redeliver queues the event of a delivery again, as a new delivery of
+// the same event to the same subscription.
+func (d *Dispatcher) Redeliver(db *gorm.DB, delivery *Delivery) (*Delivery, error) {
+	again := Delivery{
+		TenantID:       delivery.TenantID,
+		UserID:         delivery.UserID,
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		Event:          delivery.Event,
+		Payload:        delivery.Payload,
+		Redelivery:     true,
+		Status:         StatusPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := db.Create(&again).Error; err != nil {
+		return nil, err
+	}
+	d.notify()
+	return &again, nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}